@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -19,32 +22,81 @@ import (
 )
 
 type appConfig struct {
-	DBUri             string `yaml:"dbUri"`
-	ServingURI        string `yaml:"servingUri"`
-	PublicPemPath     string `yaml:"publicPemPath"`
-	SslCertfilePath   string `yaml:"sslCertfilePath"`
-	SslKeyfilePath    string `yaml:"sslKeyfilePath"`
-	PprofServingURI   string `yaml:"pprofServingUri"`
-	EnableTLSServing  bool   `yaml:"enableTlsServing"`
-	StoragePath       string `yaml:"storagePath"`
-	RateLimitRequests int    `yaml:"rateLimitRequests"`
-	RateLimitTTL      int64  `yaml:"rateLimitTtl"`
-	RateLimitCapacity int    `yaml:"rateLimitCapacity"`
+	DBUri                     string              `yaml:"dbUri"`
+	ServingURI                string              `yaml:"servingUri"`
+	S3ServingURI              string              `yaml:"s3ServingUri"`
+	PublicPemPath             string              `yaml:"publicPemPath"`
+	PresignSecret             string              `yaml:"presignSecret"`
+	SslCertfilePath           string              `yaml:"sslCertfilePath"`
+	SslKeyfilePath            string              `yaml:"sslKeyfilePath"`
+	PprofServingURI           string              `yaml:"pprofServingUri"`
+	EnableTLSServing          bool                `yaml:"enableTlsServing"`
+	StoragePath               string              `yaml:"storagePath"`
+	StorageBackend            files.BackendConfig `yaml:"storageBackend"`
+	DefaultBucketQuota        float64             `yaml:"defaultBucketQuota"`
+	UploadExpiryHours         int                 `yaml:"uploadExpiryHours"`
+	MultipartTTLHours         int                 `yaml:"multipartTtlHours"`
+	DefaultTrashRetentionDays int32               `yaml:"defaultTrashRetentionDays"`
+	ReconcilePeriodMinutes    int                 `yaml:"reconcilePeriodMinutes"`
+	ReconcileRepair           bool                `yaml:"reconcileRepair"`
+	ScrubPeriodHours          int                 `yaml:"scrubPeriodHours"`
+	ReplicaRepairPeriodHours  int                 `yaml:"replicaRepairPeriodHours"`
+	ScrubBytesPerSecond       int64               `yaml:"scrubBytesPerSecond"`
+	DedupBlobs                bool                `yaml:"dedupBlobs"`
+	RateLimitRequests         int                 `yaml:"rateLimitRequests"`
+	RateLimitTTL              int64               `yaml:"rateLimitTtl"`
+	RateLimitCapacity         int                 `yaml:"rateLimitCapacity"`
 }
 
 const (
-	CacheAutoEvictPeriodSeconds = 120
-	filesStorageDirMode         = 0700
-	filesStorageFileMode        = 0700
-	ConfigPath                  = "secret/config.yaml"
-	DBMigrationsPath            = "file://./sql"
+	CacheAutoEvictPeriodSeconds   = 120
+	BucketPurgerPeriodMinutes     = 10
+	UploadJanitorPeriodMinutes    = 10
+	MultipartJanitorPeriodMinutes = 30
+	TrashPurgerPeriodMinutes      = 60
+	DefaultScrubBytesPerSecond    = 8 << 20
+	DefaultDemoteAge              = 30 * 24 * time.Hour
+	filesStorageDirMode           = 0700
+	filesStorageFileMode          = 0700
+	ConfigPath                    = "secret/config.yaml"
+	DBMigrationsPath              = "file://./sql"
 )
 
 // set defaults.
 func newAppConfig() (conf appConfig) {
+	conf.StorageBackend.Type = files.BackendTypeLocal
+	conf.ScrubBytesPerSecond = DefaultScrubBytesPerSecond
+
 	return
 }
 
+// newFileStorage builds the configured storage backend, storagePath being the default location of the local one.
+func newFileStorage(conf *appConfig) (files.Backend, error) {
+	conf.StorageBackend.Inherit(files.BackendConfig{ //nolint:exhaustruct // only the leaf defaults.
+		Type:     files.BackendTypeLocal,
+		Path:     conf.StoragePath,
+		FileMode: filesStorageFileMode,
+		DirMode:  filesStorageDirMode,
+	})
+
+	fileStorage, err := files.NewBackend(conf.StorageBackend)
+	if err != nil {
+		return nil, fmt.Errorf("newFileStorage: %w", err)
+	}
+
+	return fileStorage, nil
+}
+
+func newBusinessConfig(conf *appConfig) business.Config {
+	return business.Config{
+		DefaultBucketQuota:        conf.DefaultBucketQuota,
+		UploadExpiry:              time.Duration(conf.UploadExpiryHours) * time.Hour,
+		MultipartUploadTTL:        time.Duration(conf.MultipartTTLHours) * time.Hour,
+		DefaultTrashRetentionDays: conf.DefaultTrashRetentionDays,
+		DedupBlobs:                conf.DedupBlobs,
+	}
+}
+
 func main() {
 	programContext, programContextStop := signal.NotifyContext(context.Background(), syscall.SIGINT)
 
@@ -59,6 +111,15 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 {
+		err = runSubcommand(programContext, conf, os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Println(err)
+		}
+
+		return
+	}
+
 	if conf.PprofServingURI != "" {
 		log.Println("Starting pprof http")
 
@@ -75,6 +136,17 @@ func main() {
 		return
 	}
 
+	if conf.PresignSecret == "" {
+		log.Println("presignSecret is not set, the presigned urls won't survive a restart")
+	}
+
+	urlSigner, err := auth.NewURLSigner([]byte(conf.PresignSecret))
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
 	dbInstance, err := database.Setup(programContext, conf.DBUri, DBMigrationsPath)
 	if err != nil {
 		log.Println(err)
@@ -88,13 +160,46 @@ func main() {
 
 	go cache.AutoEvict(CacheAutoEvictPeriodSeconds * time.Second)
 
-	var serv *http.Server
+	fileStorage, err := newFileStorage(&conf)
+	if err != nil {
+		log.Println(err)
+		dbInstance.ClosePool()
+
+		return
+	}
+
+	log.Printf("Storage backend %q setup ok\n", conf.StorageBackend.Type)
+
+	var serv, s3Serv *http.Server
 	{
-		fileStorage := files.NewContainer(conf.StoragePath, filesStorageFileMode, filesStorageDirMode)
-		business := business.NewBusinessModule(dbInstance, fileStorage)
-		apiHandler := handler.NewAPIHandler(business, jwtService, cache, conf.RateLimitRequests)
+		business := business.NewBusinessModule(dbInstance, fileStorage, newBusinessConfig(&conf))
+
+		go business.RunBucketPurger(programContext, BucketPurgerPeriodMinutes*time.Minute)
+		go business.RunUploadJanitor(programContext, UploadJanitorPeriodMinutes*time.Minute)
+		go business.RunMultipartJanitor(programContext, MultipartJanitorPeriodMinutes*time.Minute)
+		go business.RunTrashPurger(programContext, TrashPurgerPeriodMinutes*time.Minute)
+
+		if conf.ReconcilePeriodMinutes > 0 {
+			go business.RunReconciler(programContext, time.Duration(conf.ReconcilePeriodMinutes)*time.Minute,
+				conf.ReconcileRepair)
+		}
+
+		if conf.ScrubPeriodHours > 0 {
+			go business.RunScrubber(programContext, time.Duration(conf.ScrubPeriodHours)*time.Hour,
+				conf.ScrubBytesPerSecond)
+		}
+
+		if conf.ReplicaRepairPeriodHours > 0 {
+			go business.RunReplicaRepairer(programContext, time.Duration(conf.ReplicaRepairPeriodHours)*time.Hour)
+		}
+
+		apiHandler := handler.NewAPIHandler(business, jwtService, urlSigner, cache, conf.RateLimitRequests)
 		router := server.NewRouter(apiHandler)
 		serv = server.NewServer(conf.ServingURI, router)
+
+		if conf.S3ServingURI != "" {
+			s3Serv = server.NewServer(conf.S3ServingURI, server.NewS3Router(apiHandler))
+		}
 	}
 
 	if conf.EnableTLSServing {
@@ -107,6 +212,20 @@ func main() {
 		}()
 	}
 
+	var s3Err error
+
+	if s3Serv != nil {
+		log.Println("Starting the S3 API")
+
+		go func() {
+			if conf.EnableTLSServing {
+				s3Err = s3Serv.ListenAndServeTLS(conf.SslCertfilePath, conf.SslKeyfilePath)
+			} else {
+				s3Err = s3Serv.ListenAndServe()
+			}
+		}()
+	}
+
 	<-programContext.Done()
 
 	log.Println("shutting down")
@@ -117,6 +236,10 @@ func main() {
 
 		err = serv.Shutdown(shutdownContext)
 
+		if s3Serv != nil {
+			s3Err = errors.Join(s3Err, s3Serv.Shutdown(shutdownContext))
+		}
+
 		cache.StopAutoEvict()
 		dbInstance.ClosePool()
 	}
@@ -124,4 +247,8 @@ func main() {
 	if err != nil {
 		log.Println(err)
 	}
+
+	if s3Err != nil && !errors.Is(s3Err, http.ErrServerClosed) {
+		log.Println(s3Err)
+	}
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/business"
+)
+
+var errUnknownSubcommand = errors.New("unknown subcommand")
+
+// runSubcommand runs a maintenance task instead of the servers, e.g. `go-s3 reconcile -repair`.
+func runSubcommand(ctx context.Context, conf appConfig, name string, args []string) error {
+	switch name {
+	case "reconcile":
+		return runReconcile(ctx, conf, args)
+	case "rotate-keys":
+		return runRotateKeys(ctx, conf)
+	case "repair-replicas":
+		return runRepairReplicas(ctx, conf)
+	case "relayout":
+		return runRelayout(ctx, conf)
+	case "demote":
+		return runDemote(ctx, conf, args)
+	default:
+		return fmt.Errorf("%w %q, expected one of: reconcile, rotate-keys, repair-replicas, relayout, demote",
+			errUnknownSubcommand, name)
+	}
+}
+
+// runReconcile prints the reconciliation report of the file storage and the database as json.
+func runReconcile(ctx context.Context, conf appConfig, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "repair the issues found instead of only reporting them")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+
+	dbInstance, err := database.Setup(ctx, conf.DBUri, DBMigrationsPath)
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+
+	defer dbInstance.ClosePool()
+
+	fileStorage, err := newFileStorage(&conf)
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+
+	report, reconcileErr := business.NewBusinessModule(dbInstance, fileStorage, newBusinessConfig(&conf)).
+		Reconcile(ctx, *repair)
+
+	// a partial report is still worth printing.
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		err = encoder.Encode(report)
+		if err != nil {
+			return fmt.Errorf("reconcile: %w", err)
+		}
+	}
+
+	if reconcileErr != nil {
+		return fmt.Errorf("reconcile: %w", reconcileErr)
+	}
+
+	return nil
+}
+
+// runRotateKeys moves the stored files to the first of the configured master keys.
+func runRotateKeys(ctx context.Context, conf appConfig) error {
+	dbInstance, err := database.Setup(ctx, conf.DBUri, DBMigrationsPath)
+	if err != nil {
+		return fmt.Errorf("rotate-keys: %w", err)
+	}
+
+	defer dbInstance.ClosePool()
+
+	fileStorage, err := newFileStorage(&conf)
+	if err != nil {
+		return fmt.Errorf("rotate-keys: %w", err)
+	}
+
+	rewrapped, err := business.NewBusinessModule(dbInstance, fileStorage, newBusinessConfig(&conf)).RotateKeys(ctx)
+
+	fmt.Printf("rewrapped %d blobs\n", rewrapped) //nolint:forbidigo // the subcommand output.
+
+	if err != nil {
+		return fmt.Errorf("rotate-keys: %w", err)
+	}
+
+	return nil
+}
+
+func runRepairReplicas(ctx context.Context, conf appConfig) error {
+	dbInstance, err := database.Setup(ctx, conf.DBUri, DBMigrationsPath)
+	if err != nil {
+		return fmt.Errorf("repair-replicas: %w", err)
+	}
+
+	defer dbInstance.ClosePool()
+
+	fileStorage, err := newFileStorage(&conf)
+	if err != nil {
+		return fmt.Errorf("repair-replicas: %w", err)
+	}
+
+	copies, err := business.NewBusinessModule(dbInstance, fileStorage, newBusinessConfig(&conf)).RepairReplicas(ctx)
+
+	fmt.Printf("restored %d copies\n", copies) //nolint:forbidigo // the subcommand output.
+
+	if err != nil {
+		return fmt.Errorf("repair-replicas: %w", err)
+	}
+
+	return nil
+}
+
+// runRelayout moves the stored blobs to the configured directory layout while the servers keep running.
+func runRelayout(ctx context.Context, conf appConfig) error {
+	dbInstance, err := database.Setup(ctx, conf.DBUri, DBMigrationsPath)
+	if err != nil {
+		return fmt.Errorf("relayout: %w", err)
+	}
+
+	defer dbInstance.ClosePool()
+
+	fileStorage, err := newFileStorage(&conf)
+	if err != nil {
+		return fmt.Errorf("relayout: %w", err)
+	}
+
+	moved, err := business.NewBusinessModule(dbInstance, fileStorage, newBusinessConfig(&conf)).RelayoutFolders(ctx)
+
+	fmt.Printf("moved %d blobs\n", moved) //nolint:forbidigo // the subcommand output.
+
+	if err != nil {
+		return fmt.Errorf("relayout: %w", err)
+	}
+
+	return nil
+}
+
+// runDemote moves the blobs older than the given age to the cold tier, e.g. `go-s3 demote -older-than 720h`.
+func runDemote(ctx context.Context, conf appConfig, args []string) error {
+	flags := flag.NewFlagSet("demote", flag.ContinueOnError)
+	olderThan := flags.Duration("older-than", DefaultDemoteAge, "the age of the blobs to move to the cold tier")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return fmt.Errorf("demote: %w", err)
+	}
+
+	dbInstance, err := database.Setup(ctx, conf.DBUri, DBMigrationsPath)
+	if err != nil {
+		return fmt.Errorf("demote: %w", err)
+	}
+
+	defer dbInstance.ClosePool()
+
+	fileStorage, err := newFileStorage(&conf)
+	if err != nil {
+		return fmt.Errorf("demote: %w", err)
+	}
+
+	moved, err := business.NewBusinessModule(dbInstance, fileStorage, newBusinessConfig(&conf)).
+		DemoteFiles(ctx, time.Now().Add(-*olderThan))
+
+	fmt.Printf("demoted %d blobs\n", moved) //nolint:forbidigo // the subcommand output.
+
+	if err != nil {
+		return fmt.Errorf("demote: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/myerrors"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPresignMalformed = errors.New("malformed presigned url")
+	ErrPresignExpired   = errors.New("presigned url has expired")
+	ErrPresignMismatch  = errors.New("presigned url signature mismatch")
+)
+
+// the query parameters of the presigned urls, all of them but the signature are signed.
+const (
+	PresignParamSigner    = "X-Gos3-Signer"
+	PresignParamExpires   = "X-Gos3-Expires"
+	PresignParamMaxLength = "X-Gos3-Max-Length"
+	PresignParamNonce     = "X-Gos3-Nonce"
+	PresignParamFilename  = "X-Gos3-Filename"
+	PresignParamSignature = "X-Gos3-Signature"
+)
+
+const presignKeySize = 32
+
+// URLSigner mints and verifies the HMAC-SHA256 signed urls that act on behalf of the signer.
+// A url is bound to its method and path.
+type URLSigner struct {
+	key []byte
+}
+
+// PresignedURL is the scope of a presigned url.
+type PresignedURL struct {
+	ExpiresTS time.Time
+	Method    string
+	Path      string
+	// Filename is the name of the file to be uploaded.
+	Filename string
+	// MaxContentLength limits the uploaded content, 0 meaning no limit.
+	MaxContentLength int64
+	SignerID         uuid.UUID
+	// Nonce tells apart the upload urls, each one is meant to be used once.
+	Nonce uuid.UUID
+}
+
+// NewURLSigner makes a signer with the key, or with a random key if the key is empty.
+func NewURLSigner(key []byte) (*URLSigner, error) {
+	if len(key) == 0 {
+		key = make([]byte, presignKeySize)
+
+		_, err := rand.Read(key)
+		if err != nil {
+			return nil, fmt.Errorf("NewURLSigner rand.Read: %w", err)
+		}
+	}
+
+	return &URLSigner{
+		key: key,
+	}, nil
+}
+
+// IsPresigned tells if the query carries a presigned url signature.
+func IsPresigned(query url.Values) bool {
+	return query.Has(PresignParamSignature)
+}
+
+func (signer *URLSigner) signature(method, path string, query url.Values) string {
+	mac := hmac.New(sha256.New, signer.key)
+
+	// Encode sorts the keys.
+	mac.Write([]byte(method + "\n" + path + "\n" + query.Encode())) //nolint:errcheck // never fails.
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the path with the signed query.
+func (signer *URLSigner) Sign(scope PresignedURL) (string, error) {
+	if signer == nil {
+		return "", myerrors.ErrServiceNullPtr
+	}
+
+	query := url.Values{}
+	query.Set(PresignParamSigner, scope.SignerID.String())
+	query.Set(PresignParamExpires, strconv.FormatInt(scope.ExpiresTS.Unix(), 10))
+
+	if scope.MaxContentLength > 0 {
+		query.Set(PresignParamMaxLength, strconv.FormatInt(scope.MaxContentLength, 10))
+	}
+
+	if scope.Nonce != uuid.Nil {
+		query.Set(PresignParamNonce, scope.Nonce.String())
+	}
+
+	if scope.Filename != "" {
+		query.Set(PresignParamFilename, scope.Filename)
+	}
+
+	query.Set(PresignParamSignature, signer.signature(scope.Method, scope.Path, query))
+
+	return scope.Path + "?" + query.Encode(), nil
+}
+
+// Verify checks the signature of the request url and returns its scope.
+func (signer *URLSigner) Verify(method, path string, query url.Values, now time.Time) (*PresignedURL, error) {
+	if signer == nil {
+		return nil, myerrors.ErrServiceNullPtr
+	}
+
+	signedQuery := url.Values{}
+
+	for key, values := range query {
+		if key != PresignParamSignature {
+			signedQuery[key] = values
+		}
+	}
+
+	expected := signer.signature(method, path, signedQuery)
+	if !hmac.Equal([]byte(expected), []byte(query.Get(PresignParamSignature))) {
+		return nil, ErrPresignMismatch
+	}
+
+	scope := &PresignedURL{ //nolint:exhaustruct // the optional fields are parsed below.
+		Method:   method,
+		Path:     path,
+		Filename: query.Get(PresignParamFilename),
+	}
+
+	var err error
+
+	scope.SignerID, err = uuid.Parse(query.Get(PresignParamSigner))
+	if err != nil {
+		return nil, ErrPresignMalformed
+	}
+
+	expires, err := strconv.ParseInt(query.Get(PresignParamExpires), 10, 64)
+	if err != nil {
+		return nil, ErrPresignMalformed
+	}
+
+	scope.ExpiresTS = time.Unix(expires, 0)
+	if now.After(scope.ExpiresTS) {
+		return nil, ErrPresignExpired
+	}
+
+	if query.Has(PresignParamMaxLength) {
+		scope.MaxContentLength, err = strconv.ParseInt(query.Get(PresignParamMaxLength), 10, 64)
+		if err != nil || scope.MaxContentLength <= 0 {
+			return nil, ErrPresignMalformed
+		}
+	}
+
+	if query.Has(PresignParamNonce) {
+		scope.Nonce, err = uuid.Parse(query.Get(PresignParamNonce))
+		if err != nil {
+			return nil, ErrPresignMalformed
+		}
+	}
+
+	return scope, nil
+}
@@ -0,0 +1,69 @@
+package auth_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer, err := auth.NewURLSigner([]byte("secret"))
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	scope := auth.PresignedURL{
+		ExpiresTS:        now.Add(time.Minute),
+		Method:           "PUT",
+		Path:             "/buckets/my-bucket",
+		Filename:         "report q1.pdf",
+		MaxContentLength: 1024,
+		SignerID:         uuid.New(),
+		Nonce:            uuid.New(),
+	}
+
+	signed, err := signer.Sign(scope)
+	require.NoError(t, err)
+
+	path, rawQuery, found := strings.Cut(signed, "?")
+	require.True(t, found)
+	assert.Equal(t, scope.Path, path)
+
+	query, err := url.ParseQuery(rawQuery)
+	require.NoError(t, err)
+	assert.True(t, auth.IsPresigned(query))
+
+	verified, err := signer.Verify("PUT", path, query, now)
+	require.NoError(t, err)
+	assert.Equal(t, scope.SignerID, verified.SignerID)
+	assert.Equal(t, scope.Nonce, verified.Nonce)
+	assert.Equal(t, scope.Filename, verified.Filename)
+	assert.Equal(t, int64(1024), verified.MaxContentLength)
+
+	_, err = signer.Verify("PUT", path, query, now.Add(time.Hour))
+	require.ErrorIs(t, err, auth.ErrPresignExpired)
+
+	_, err = signer.Verify("GET", path, query, now)
+	require.ErrorIs(t, err, auth.ErrPresignMismatch)
+
+	_, err = signer.Verify("PUT", "/buckets/other-bucket", query, now)
+	require.ErrorIs(t, err, auth.ErrPresignMismatch)
+
+	query.Set(auth.PresignParamMaxLength, "999999")
+
+	_, err = signer.Verify("PUT", path, query, now)
+	require.ErrorIs(t, err, auth.ErrPresignMismatch)
+
+	otherSigner, err := auth.NewURLSigner(nil)
+	require.NoError(t, err)
+
+	query.Set(auth.PresignParamMaxLength, "1024")
+
+	_, err = otherSigner.Verify("PUT", path, query, now)
+	require.ErrorIs(t, err, auth.ErrPresignMismatch)
+}
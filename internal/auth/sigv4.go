@@ -0,0 +1,475 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSigV4Missing          = errors.New("the request is not signed")
+	ErrSigV4Malformed        = errors.New("malformed signature")
+	ErrSigV4Mismatch         = errors.New("signature does not match")
+	ErrSigV4Expired          = errors.New("the request signature is expired")
+	ErrSigV4PayloadMismatch  = errors.New("payload hash does not match")
+	ErrSigV4ChunkMalformed   = errors.New("malformed aws-chunked payload")
+	ErrSigV4ChunkSigMismatch = errors.New("chunk signature does not match")
+)
+
+const (
+	SigV4Algorithm    = "AWS4-HMAC-SHA256"
+	sigV4Terminator   = "aws4_request"
+	sigV4TimeFormat   = "20060102T150405Z"
+	sigV4DateFormat   = "20060102"
+	sigV4MaxSkew      = 15 * time.Minute
+	sigV4MaxExpires   = 7 * 24 * time.Hour
+	sigV4ChunkAlgo    = "AWS4-HMAC-SHA256-PAYLOAD"
+	sigV4MaxChunkSize = 16 << 20
+
+	PayloadUnsigned          = "UNSIGNED-PAYLOAD"
+	PayloadStreamingSigned   = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	PayloadStreamingUnsigned = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// SigV4Request holds the signature parameters of an AWS Signature V4 signed request,
+// taken either from the Authorization header or from the presigned query.
+type SigV4Request struct {
+	SignedAt      time.Time
+	AccessKeyID   string
+	Date          string
+	Region        string
+	Service       string
+	Signature     string
+	PayloadHash   string
+	SignedHeaders []string
+	Expires       time.Duration
+	Presigned     bool
+}
+
+// ParseSigV4 extracts the signature parameters from the request.
+func ParseSigV4(request *http.Request) (*SigV4Request, error) {
+	if request.URL.Query().Get("X-Amz-Algorithm") != "" {
+		return parseSigV4Query(request)
+	}
+
+	header := request.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrSigV4Missing
+	}
+
+	algorithm, rest, found := strings.Cut(header, " ")
+	if !found || algorithm != SigV4Algorithm {
+		return nil, ErrSigV4Malformed
+	}
+
+	var sig SigV4Request
+
+	for _, field := range strings.Split(rest, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return nil, ErrSigV4Malformed
+		}
+
+		switch name {
+		case "Credential":
+			if err := sig.parseCredential(value); err != nil {
+				return nil, err
+			}
+		case "SignedHeaders":
+			sig.SignedHeaders = strings.Split(value, ";")
+		case "Signature":
+			sig.Signature = value
+		}
+	}
+
+	signedAt, err := time.Parse(sigV4TimeFormat, request.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, ErrSigV4Malformed
+	}
+
+	sig.SignedAt = signedAt
+	sig.PayloadHash = request.Header.Get("X-Amz-Content-Sha256")
+
+	if sig.PayloadHash == "" {
+		sig.PayloadHash = emptySHA256
+	}
+
+	if sig.Signature == "" || len(sig.SignedHeaders) == 0 {
+		return nil, ErrSigV4Malformed
+	}
+
+	return &sig, nil
+}
+
+func parseSigV4Query(request *http.Request) (*SigV4Request, error) {
+	query := request.URL.Query()
+
+	if query.Get("X-Amz-Algorithm") != SigV4Algorithm {
+		return nil, ErrSigV4Malformed
+	}
+
+	sig := SigV4Request{ //nolint:exhaustruct // filled below.
+		Signature:     query.Get("X-Amz-Signature"),
+		SignedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		PayloadHash:   PayloadUnsigned,
+		Presigned:     true,
+	}
+
+	err := sig.parseCredential(query.Get("X-Amz-Credential"))
+	if err != nil {
+		return nil, err
+	}
+
+	sig.SignedAt, err = time.Parse(sigV4TimeFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, ErrSigV4Malformed
+	}
+
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || expires < 0 {
+		return nil, ErrSigV4Malformed
+	}
+
+	sig.Expires = time.Duration(expires) * time.Second
+	if sig.Expires > sigV4MaxExpires {
+		return nil, ErrSigV4Malformed
+	}
+
+	if sig.Signature == "" {
+		return nil, ErrSigV4Malformed
+	}
+
+	return &sig, nil
+}
+
+func (sig *SigV4Request) parseCredential(credential string) error {
+	parts := strings.Split(credential, "/")
+
+	const credentialParts = 5
+
+	if len(parts) != credentialParts || parts[4] != sigV4Terminator || parts[0] == "" {
+		return ErrSigV4Malformed
+	}
+
+	sig.AccessKeyID, sig.Date, sig.Region, sig.Service = parts[0], parts[1], parts[2], parts[3]
+
+	return nil
+}
+
+func (sig *SigV4Request) scope() string {
+	return strings.Join([]string{sig.Date, sig.Region, sig.Service, sigV4Terminator}, "/")
+}
+
+func (sig *SigV4Request) signingKey(secret string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), sig.Date)
+	key = hmacSHA256(key, sig.Region)
+	key = hmacSHA256(key, sig.Service)
+
+	return hmacSHA256(key, sigV4Terminator)
+}
+
+// Verify checks the signature against the secret key. On success it returns the
+// request body to be used in place of request.Body: the body is checked against the
+// signed payload hash while being read, and aws-chunked payloads are decoded.
+func (sig *SigV4Request) Verify(request *http.Request, secret string, now time.Time) (io.ReadCloser, error) {
+	if sig.SignedAt.Format(sigV4DateFormat) != sig.Date {
+		return nil, ErrSigV4Malformed
+	}
+
+	if sig.Presigned {
+		if now.Before(sig.SignedAt.Add(-sigV4MaxSkew)) || now.After(sig.SignedAt.Add(sig.Expires)) {
+			return nil, ErrSigV4Expired
+		}
+	} else if now.Sub(sig.SignedAt).Abs() > sigV4MaxSkew {
+		return nil, ErrSigV4Expired
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalURI(request.URL.Path),
+		canonicalQuery(request.URL.Query(), sig.Presigned),
+		canonicalHeaders(request, sig.SignedHeaders),
+		strings.Join(sig.SignedHeaders, ";"),
+		sig.PayloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		SigV4Algorithm,
+		sig.SignedAt.Format(sigV4TimeFormat),
+		sig.scope(),
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := sig.signingKey(secret)
+	expected := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(sig.Signature)) != 1 {
+		return nil, ErrSigV4Mismatch
+	}
+
+	switch sig.PayloadHash {
+	case PayloadUnsigned:
+		return request.Body, nil
+	case PayloadStreamingSigned:
+		return &chunkedReader{
+			src:        bufio.NewReader(request.Body),
+			closer:     request.Body,
+			sig:        sig,
+			signingKey: signingKey,
+			prevSig:    sig.Signature,
+			signed:     true,
+		}, nil
+	case PayloadStreamingUnsigned:
+		return &chunkedReader{ //nolint:exhaustruct // unsigned chunks.
+			src:    bufio.NewReader(request.Body),
+			closer: request.Body,
+		}, nil
+	}
+
+	expectedHash, err := hex.DecodeString(sig.PayloadHash)
+	if err != nil || len(expectedHash) != sha256.Size {
+		return nil, ErrSigV4Malformed
+	}
+
+	return &hashingReader{
+		src:      request.Body,
+		hash:     sha256.New(),
+		expected: expectedHash,
+	}, nil
+}
+
+// DecodedContentLength returns the payload length of aws-chunked requests, -1 if unknown.
+func DecodedContentLength(request *http.Request) int64 {
+	length, err := strconv.ParseInt(request.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return length
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// uriEncode implements the AWS flavour of RFC 3986 percent-encoding.
+func uriEncode(value string, encodeSlash bool) string {
+	var builder strings.Builder
+
+	for i := range len(value) {
+		char := value[i]
+
+		switch {
+		case (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9'),
+			char == '-', char == '_', char == '.', char == '~':
+			builder.WriteByte(char)
+		case char == '/' && !encodeSlash:
+			builder.WriteByte(char)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", char)
+		}
+	}
+
+	return builder.String()
+}
+
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return uriEncode(path, false)
+}
+
+func canonicalQuery(query url.Values, presigned bool) string {
+	pairs := make([]string, 0, len(query))
+
+	for key, values := range query {
+		if presigned && key == "X-Amz-Signature" {
+			continue
+		}
+
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+func canonicalHeaders(request *http.Request, signedHeaders []string) string {
+	var builder strings.Builder
+
+	for _, name := range signedHeaders {
+		var values []string
+
+		switch name {
+		case "host":
+			values = []string{request.Host}
+		case "content-length":
+			values = []string{strconv.FormatInt(request.ContentLength, 10)}
+		default:
+			values = request.Header.Values(name)
+		}
+
+		for i := range values {
+			values[i] = strings.Join(strings.Fields(values[i]), " ")
+		}
+
+		builder.WriteString(name)
+		builder.WriteByte(':')
+		builder.WriteString(strings.Join(values, ","))
+		builder.WriteByte('\n')
+	}
+
+	return builder.String()
+}
+
+// hashingReader fails the read of the last byte if the payload doesn't match the signed hash.
+type hashingReader struct {
+	src      io.ReadCloser
+	hash     hash.Hash
+	expected []byte
+}
+
+func (reader *hashingReader) Read(dst []byte) (int, error) {
+	read, err := reader.src.Read(dst)
+	reader.hash.Write(dst[:read])
+
+	if errors.Is(err, io.EOF) && !bytes.Equal(reader.hash.Sum(nil), reader.expected) {
+		return read, ErrSigV4PayloadMismatch
+	}
+
+	return read, err //nolint:wrapcheck // io.Reader contract.
+}
+
+func (reader *hashingReader) Close() error {
+	return reader.src.Close() //nolint:wrapcheck // io.Closer contract.
+}
+
+// chunkedReader decodes an aws-chunked body, verifying the chunk signatures if signed.
+type chunkedReader struct {
+	src        *bufio.Reader
+	closer     io.Closer
+	sig        *SigV4Request
+	signingKey []byte
+	prevSig    string
+	chunk      []byte
+	signed     bool
+	done       bool
+}
+
+func (reader *chunkedReader) Read(dst []byte) (int, error) {
+	for len(reader.chunk) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+
+		err := reader.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	read := copy(dst, reader.chunk)
+	reader.chunk = reader.chunk[read:]
+
+	return read, nil
+}
+
+func (reader *chunkedReader) nextChunk() error {
+	line, err := reader.src.ReadString('\n')
+	if err != nil {
+		return ErrSigV4ChunkMalformed
+	}
+
+	sizeHex, extension, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ";")
+
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > sigV4MaxChunkSize {
+		return ErrSigV4ChunkMalformed
+	}
+
+	chunk := make([]byte, size)
+
+	_, err = io.ReadFull(reader.src, chunk)
+	if err != nil {
+		return ErrSigV4ChunkMalformed
+	}
+
+	if reader.signed {
+		chunkSig, ok := strings.CutPrefix(extension, "chunk-signature=")
+		if !ok {
+			return ErrSigV4ChunkMalformed
+		}
+
+		stringToSign := strings.Join([]string{
+			sigV4ChunkAlgo,
+			reader.sig.SignedAt.Format(sigV4TimeFormat),
+			reader.sig.scope(),
+			reader.prevSig,
+			emptySHA256,
+			hexSHA256(chunk),
+		}, "\n")
+
+		expected := hex.EncodeToString(hmacSHA256(reader.signingKey, stringToSign))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(chunkSig)) != 1 {
+			return ErrSigV4ChunkSigMismatch
+		}
+
+		reader.prevSig = chunkSig
+	}
+
+	if size == 0 {
+		// the trailers (if any) are not verified, skip everything up to the end of the body.
+		reader.done = true
+
+		_, err = io.Copy(io.Discard, reader.src)
+		if err != nil {
+			return ErrSigV4ChunkMalformed
+		}
+
+		return nil
+	}
+
+	crlf := make([]byte, 2) //nolint:mnd // \r\n.
+
+	_, err = io.ReadFull(reader.src, crlf)
+	if err != nil || string(crlf) != "\r\n" {
+		return ErrSigV4ChunkMalformed
+	}
+
+	reader.chunk = chunk
+
+	return nil
+}
+
+func (reader *chunkedReader) Close() error {
+	return reader.closer.Close() //nolint:wrapcheck // io.Closer contract.
+}
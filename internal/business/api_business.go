@@ -2,15 +2,26 @@ package business
 
 import (
 	"context"
+	"crypto/md5" //nolint:gosec // the S3 clients expect MD5 ETags.
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eldarbr/go-auth/pkg/database"
 	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/myerrors"
+	"github.com/eldarbr/go-s3/internal/provider/files"
 	"github.com/eldarbr/go-s3/internal/provider/storage"
 	"github.com/google/uuid"
 )
@@ -18,29 +29,70 @@ import (
 type BusinessModule struct {
 	dbInstance  *database.Database
 	fileStorage FileStorage
+	conf        Config
+}
+
+type Config struct {
+	// DefaultBucketQuota is the size quota in bytes of the new buckets, 0 meaning no limit.
+	DefaultBucketQuota float64
+	// UploadExpiry is how long an unfinished resumable upload is kept after its last chunk.
+	UploadExpiry time.Duration
+	// MultipartUploadTTL is how long a multipart upload may stay incomplete before it's aborted.
+	MultipartUploadTTL time.Duration
+	// DefaultTrashRetentionDays is how long the deleted files of the new buckets stay restorable, 0 meaning no trash.
+	DefaultTrashRetentionDays int32
+	// DedupBlobs makes the new files share a single stored copy of the same content.
+	DedupBlobs bool
 }
 
 var (
-	ErrBadRequest   = errors.New("malformed request")
-	ErrNoPermission = errors.New("the user has no permissions")
-	ErrNoBucket     = errors.New("bucket not found")
+	ErrBadRequest     = myerrors.ErrBadRequest
+	ErrNoPermission   = myerrors.ErrNoPermission
+	ErrNoBucket       = myerrors.ErrNoBucket
+	ErrNoObject       = myerrors.ErrNoObject
+	ErrBucketExists   = myerrors.ErrBucketExists
+	ErrNoAccessKey    = myerrors.ErrNoAccessKey
+	ErrBucketNotEmpty = myerrors.ErrBucketNotEmpty
+	ErrQuotaExceeded  = myerrors.ErrQuotaExceeded
+	ErrUploadOffset   = myerrors.ErrUploadOffset
+	ErrUploadLocked   = myerrors.ErrUploadLocked
+	ErrUploadExpired  = myerrors.ErrUploadExpired
+	ErrNoUpload       = myerrors.ErrNoUpload
+	ErrInvalidPart    = myerrors.ErrInvalidPart
+	ErrPartTooSmall   = myerrors.ErrPartTooSmall
+	ErrBadDigest      = myerrors.ErrBadDigest
+	ErrPresignUsed    = myerrors.ErrPresignUsed
+	ErrKeyExists      = myerrors.ErrKeyExists
 )
 
 type FileStorage interface {
 	CreateFolder(bucketID string) error
 	OpenFile(bucketID, fileID string) (io.ReadSeekCloser, error)
 	WriteFile(bucketID, fileID string, src io.Reader) (int64, error)
+	AppendFile(bucketID, fileID string, offset int64, src io.Reader) (int64, error)
 	DeleteFile(bucketID, fileID string) error
+	DeleteFolder(bucketID string) error
+	ListFolder(bucketID string) ([]model.BlobInfo, error)
+	MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error
 }
 
-func NewBusinessModule(dbInstance *database.Database, fileStorage FileStorage) *BusinessModule {
+func NewBusinessModule(dbInstance *database.Database, fileStorage FileStorage, conf Config) *BusinessModule {
 	return &BusinessModule{
 		dbInstance:  dbInstance,
 		fileStorage: fileStorage,
+		conf:        conf,
 	}
 }
 
 func (business BusinessModule) CreateBucket(ctx context.Context, bucket *model.Bucket) error {
+	if bucket.SizeQuota == 0 {
+		bucket.SizeQuota = business.conf.DefaultBucketQuota
+	}
+
+	if bucket.TrashRetentionDays == 0 {
+		bucket.TrashRetentionDays = business.conf.DefaultTrashRetentionDays
+	}
+
 	transaction, err := business.dbInstance.GetPool().Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("business.CreateBucket begin transaction: %w", err)
@@ -49,6 +101,10 @@ func (business BusinessModule) CreateBucket(ctx context.Context, bucket *model.B
 	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
 
 	err = storage.TableBuckets.Add(ctx, transaction, bucket)
+	if errors.Is(err, database.ErrUniqueKeyViolation) {
+		return ErrBucketExists
+	}
+
 	if err != nil {
 		return fmt.Errorf("business.CreateBucket TableBuckets.Add: %w", err)
 	}
@@ -66,6 +122,86 @@ func (business BusinessModule) CreateBucket(ctx context.Context, bucket *model.B
 	return nil
 }
 
+func (business BusinessModule) ListBucketsUsage(ctx context.Context, requesterID uuid.UUID,
+) ([]model.BucketUsage, error) {
+	buckets, err := storage.TableBuckets.GetUsageByOwner(ctx, business.dbInstance.GetPool(), requesterID)
+	if err != nil {
+		return nil, fmt.Errorf("business.ListBucketsUsage TableBuckets.GetUsageByOwner: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// SetBucketQuota is meant for the root users, so the ownership is not checked.
+func (business BusinessModule) SetBucketQuota(ctx context.Context, bucketName string, sizeQuota float64) error {
+	if sizeQuota < 0 {
+		return ErrBadRequest
+	}
+
+	bucketInfo, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), bucketName)
+	if errors.Is(err, database.ErrNoRows) {
+		return ErrNoBucket
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.SetBucketQuota TableBuckets.GetByName: %w", err)
+	}
+
+	err = storage.TableBuckets.SetQuota(ctx, business.dbInstance.GetPool(), bucketInfo.ID, sizeQuota)
+	if err != nil {
+		return fmt.Errorf("business.SetBucketQuota TableBuckets.SetQuota: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteBucket hides the bucket and purges it. A non-empty bucket is only deleted when forced.
+// The purge is resumed by RunBucketPurger if it gets interrupted.
+func (business BusinessModule) DeleteBucket(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	force bool,
+) error {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return err
+	}
+
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("business.DeleteBucket begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	err = storage.TableBuckets.MarkDeleting(ctx, transaction, bucketInfo.ID)
+	if err != nil {
+		return fmt.Errorf("business.DeleteBucket TableBuckets.MarkDeleting: %w", err)
+	}
+
+	if !force {
+		filesCount, countErr := storage.TableFiles.CountFilesOfABucket(ctx, transaction, bucketInfo.ID)
+		if countErr != nil {
+			return fmt.Errorf("business.DeleteBucket TableFiles.CountFilesOfABucket: %w", countErr)
+		}
+
+		if filesCount != 0 {
+			return ErrBucketNotEmpty
+		}
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("business.DeleteBucket transaction.Commit: %w", err)
+	}
+
+	// the bucket is gone for the user already, a failed purge is retried in the background.
+	err = business.purgeBucket(context.WithoutCancel(ctx), bucketInfo.ID)
+	if err != nil {
+		log.Printf("business.DeleteBucket purge of the bucket %d postponed: %s\n", bucketInfo.ID, err.Error())
+	}
+
+	return nil
+}
+
 func (business BusinessModule) UploadFile(ctx context.Context, request model.UploadFileRequest) (*uuid.UUID, error) {
 	bucketInfo, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), request.BucketName)
 	if errors.Is(err, database.ErrNoRows) {
@@ -80,18 +216,96 @@ func (business BusinessModule) UploadFile(ctx context.Context, request model.Upl
 		return nil, ErrNoPermission
 	}
 
+	if !validKey(request.Filename) || !validAttributes(request.Metadata, request.Tags) {
+		return nil, ErrBadRequest
+	}
+
+	// the nonce is claimed along with the file entry, the check only saves the io.
+	if request.PresignNonce != uuid.Nil {
+		used, usedErr := storage.TablePresignNonces.Exists(ctx, business.dbInstance.GetPool(), request.PresignNonce)
+		if usedErr != nil {
+			return nil, fmt.Errorf("business.UploadFile TablePresignNonces.Exists: %w", usedErr)
+		}
+
+		if used {
+			return nil, ErrPresignUsed
+		}
+	}
+
+	file, err := business.uploadFile(ctx, bucketInfo, request)
+	if err != nil {
+		return nil, err
+	}
+
+	createdID := file.ID
+
+	return &createdID, nil
+}
+
+// uploadFile stores the content and creates the file entry. The permissions are checked by the caller.
+func (business BusinessModule) uploadFile(ctx context.Context, bucketInfo *model.Bucket,
+	request model.UploadFileRequest,
+) (*model.File, error) {
 	newFileUUID, uuidErr := uuid.NewRandom()
 	if uuidErr != nil {
 		return nil, fmt.Errorf("business.uuid.NewRandom: %w", uuidErr)
 	}
 
-	bytesWritten, err := business.fileStorage.WriteFile(strconv.FormatInt(bucketInfo.ID, 10),
-		newFileUUID.String(),
-		request.FileContent)
+	src := request.FileContent
+
+	// the quota is enforced by the transaction below, the early checks only save the io.
+	if bucketInfo.SizeQuota > 0 {
+		remaining := int64(bucketInfo.SizeQuota) - bucketInfo.BytesUsed
+		if request.ContentLength > remaining {
+			return nil, ErrQuotaExceeded
+		}
+
+		src = &quotaReader{src: src, left: remaining}
+	}
+
+	bucketIDStr := strconv.FormatInt(bucketInfo.ID, 10)
+	committed := false
+
+	// a deduplicated file leaves its staged content behind when the blob already exists.
+	defer func() {
+		if !committed || request.File.BlobSHA256 != "" {
+			business.discardFile(bucketIDStr, newFileUUID.String())
+		}
+	}()
+
+	md5Hash := md5.New() //nolint:gosec // the S3 clients expect MD5 ETags.
+	sha256Hash := sha256.New()
+
+	encoding := contentEncoding(bucketInfo, request.MIME)
+	content := io.TeeReader(src, io.MultiWriter(md5Hash, sha256Hash))
+
+	var framer *files.GzipFramer
+
+	if encoding == files.ContentEncodingGzip {
+		framer = files.NewGzipFramer(content)
+		content = framer
+	}
+
+	storedBytes, err := business.fileStorage.WriteFile(bucketIDStr, newFileUUID.String(), content)
 	if err != nil {
 		return nil, fmt.Errorf("business.UploadFile fileStorage.WriteFile: %w", err)
 	}
 
+	bytesWritten := storedBytes
+	if framer != nil {
+		bytesWritten = framer.Size
+	}
+
+	err = checkDigest(request.ContentMD5, md5Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkDigest(request.ChecksumSHA256, sha256Hash)
+	if err != nil {
+		return nil, err
+	}
+
 	transaction, err := business.dbInstance.GetPool().Begin(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("business.UploadFile begin transaction: %w", err)
@@ -99,7 +313,19 @@ func (business BusinessModule) UploadFile(ctx context.Context, request model.Upl
 
 	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
 
-	newSuffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, transaction, request.Filename)
+	if request.PresignNonce != uuid.Nil {
+		err = storage.TablePresignNonces.Add(ctx, transaction, request.PresignNonce, request.PresignExpiresTS)
+		if errors.Is(err, database.ErrUniqueKeyViolation) {
+			return nil, ErrPresignUsed
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("business.UploadFile TablePresignNonces.Add: %w", err)
+		}
+	}
+
+	newSuffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, transaction, bucketInfo.ID,
+		request.Filename)
 	if err != nil {
 		return nil, fmt.Errorf("business.UploadFile storage.TableFiles.PrepareNewFilenameSuffix: %w", err)
 	}
@@ -108,20 +334,63 @@ func (business BusinessModule) UploadFile(ctx context.Context, request model.Upl
 	request.File.BucketID = bucketInfo.ID
 	request.FilenameSuffix = newSuffix
 	request.File.SizeBytes = bytesWritten
+	request.File.StoredSizeBytes = storedBytes
+	request.File.ContentEncoding = encoding
+	request.File.MD5 = hex.EncodeToString(md5Hash.Sum(nil))
+	request.File.SHA256 = hex.EncodeToString(sha256Hash.Sum(nil))
+
+	err = business.dedupBlob(ctx, transaction, &request.File)
+	if err != nil {
+		return nil, fmt.Errorf("business.UploadFile: %w", err)
+	}
 
 	err = storage.TableFiles.InsertID(ctx, transaction, &request.File)
 	if err != nil {
 		return nil, fmt.Errorf("business.UploadFile TableFiles.Add: %w", err)
 	}
 
+	_, err = storage.TableBuckets.AddBytesUsed(ctx, transaction, bucketInfo.ID, bytesWritten)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrQuotaExceeded
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.UploadFile TableBuckets.AddBytesUsed: %w", err)
+	}
+
 	err = transaction.Commit(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("business.CreateBucket transaction.Commit: %w", err)
+		return nil, fmt.Errorf("business.UploadFile transaction.Commit: %w", err)
 	}
 
-	createdID := request.File.ID
+	committed = true
 
-	return &createdID, nil
+	return &request.File, nil
+}
+
+// discardFile removes the content of a file that didn't make it into the db.
+func (business BusinessModule) discardFile(bucketID, fileID string) {
+	err := business.fileStorage.DeleteFile(bucketID, fileID)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("business.discardFile %s/%s: %s\n", bucketID, fileID, err.Error())
+	}
+}
+
+// quotaReader fails the read once more than left bytes are read.
+type quotaReader struct {
+	src  io.Reader
+	left int64
+}
+
+func (reader *quotaReader) Read(dst []byte) (int, error) {
+	read, err := reader.src.Read(dst)
+
+	reader.left -= int64(read)
+	if reader.left < 0 {
+		return read, ErrQuotaExceeded
+	}
+
+	return read, err //nolint:wrapcheck // io.Reader contract.
 }
 
 func (business BusinessModule) FetchFile(ctx context.Context, request model.FetchFileRequest) error {
@@ -143,18 +412,42 @@ func (business BusinessModule) FetchFile(ctx context.Context, request model.Fetc
 		return fmt.Errorf("business.TableFiles.GetByID: %w", err)
 	}
 
-	mayServe := (fileInfo.BucketID == bucketInfo.ID) &&
-		((bucketInfo.Availability == model.BucketAvailabilityAccessible && fileInfo.Access == model.FileAccessPublic) ||
-			(request.RequestingUserID != nil && *request.RequestingUserID == bucketInfo.OwnerID))
+	// in a versioned bucket the id of any version stands for the object.
+	if fileInfo.BucketID == bucketInfo.ID && (bucketInfo.Versioning || request.VersionID != nil) {
+		fileInfo, err = business.resolveVersion(ctx, bucketInfo.ID, fileInfo.Filename, request.VersionID)
+		if err != nil {
+			return err
+		}
 
-	if !mayServe {
+		request.RespWriter.Header().Set("X-Version-Id", fileInfo.ID.String())
+	}
+
+	if !mayRead(bucketInfo, fileInfo, request.RequestingUserID) {
 		return ErrNoPermission
 	}
 
-	request.RespWriter.Header().Set("Content-Type", fileInfo.MIME)
-	request.RespWriter.Header().Set("Content-Disposition", "inline; filename="+fileInfo.Filename)
+	header := request.RespWriter.Header()
+	header.Set("Content-Type", fileInfo.MIME)
+	header.Set("Content-Disposition", "inline; filename="+path.Base(fileInfo.Filename))
+	setDigestHeaders(header, fileInfo)
+	setAttributeHeaders(header, fileInfo)
+
+	open := business.openFile
 
-	file, fileErr := business.fileStorage.OpenFile(strconv.FormatInt(bucketInfo.ID, 10), fileInfo.ID.String())
+	if fileInfo.ContentEncoding != "" {
+		header.Add("Vary", "Accept-Encoding")
+
+		// the stored form is served as is, the ranges and the validator then refer to the encoded content.
+		if acceptsEncoding(request.RawRequest, fileInfo.ContentEncoding) {
+			open = business.openStored
+
+			header.Set("Content-Encoding", fileInfo.ContentEncoding)
+			header.Set("ETag", strings.TrimSuffix(fileInfo.ETag(), `"`)+"-"+fileInfo.ContentEncoding+`"`)
+			header.Del("Content-MD5")
+		}
+	}
+
+	file, fileErr := open(fileInfo)
 	if fileErr != nil {
 		return fmt.Errorf("business.FetchFile fileStorage.OpenFile: %w", fileErr)
 	}
@@ -166,59 +459,243 @@ func (business BusinessModule) FetchFile(ctx context.Context, request model.Fetc
 	return nil
 }
 
-func (business BusinessModule) ListFiles(ctx context.Context, requesterUUID uuid.UUID, bucketName string,
-) ([]model.File, error) {
+// setDigestHeaders sets the validator and the content digests. The ETag makes http.ServeContent
+// honour the If-Match and If-None-Match preconditions.
+func setDigestHeaders(header http.Header, fileInfo *model.File) {
+	header.Set("ETag", fileInfo.ETag())
+
+	if contentMD5 := fileInfo.ContentMD5(); contentMD5 != "" {
+		header.Set("Content-MD5", contentMD5)
+	}
+
+	if checksum := fileInfo.ChecksumSHA256(); checksum != "" {
+		header.Set("X-Checksum-Sha256", checksum)
+	}
+}
+
+// mayRead tells if the file may be served to the user, nil user being anonymous.
+func mayRead(bucketInfo *model.Bucket, fileInfo *model.File, requesterID *uuid.UUID) bool {
+	return (fileInfo.BucketID == bucketInfo.ID) &&
+		((bucketInfo.Availability == model.BucketAvailabilityAccessible && fileInfo.Access == model.FileAccessPublic) ||
+			(requesterID != nil && *requesterID == bucketInfo.OwnerID))
+}
+
+// The sizes of the pages of the files listings.
+const (
+	defaultListFilesLimit = 1000
+	maxListFilesLimit     = 1000
+)
+
+// filesToken is the continuation token of a files listing, bound to its order.
+type filesToken struct {
+	Cursor     model.FilesCursor `json:"c"`
+	Sort       string            `json:"s"`
+	Descending bool              `json:"d,omitempty"`
+}
+
+func (token filesToken) encode() string {
+	encoded, _ := json.Marshal(token) //nolint:errchkjson // a plain struct.
+
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeFilesToken(encoded string) (*filesToken, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decodeFilesToken: %w", err)
+	}
+
+	var token filesToken
+
+	err = json.Unmarshal(decoded, &token)
+	if err != nil {
+		return nil, fmt.Errorf("decodeFilesToken: %w", err)
+	}
+
+	return &token, nil
+}
+
+// ListFiles lists a page of the files of the bucket under the prefix, rolling the deeper keys up into
+// the common prefixes if the delimiter is set. A versioned bucket lists the latest versions only.
+// The keys are ordered byte-wise, the ties of the other orders broken by the key.
+func (business BusinessModule) ListFiles(ctx context.Context, request model.ListFilesRequest,
+) (*model.ListFilesResponse, error) {
+	if request.Sort == "" {
+		request.Sort = model.FilesSortName
+	}
+
+	if request.Limit == 0 {
+		request.Limit = defaultListFilesLimit
+	}
+
+	switch request.Sort {
+	case model.FilesSortName, model.FilesSortSize, model.FilesSortCreated:
+	default:
+		return nil, ErrBadRequest
+	}
+
+	if request.Limit < 0 || request.Limit > maxListFilesLimit ||
+		(request.Delimiter != "" && request.Sort != model.FilesSortName) {
+		return nil, ErrBadRequest
+	}
+
+	bucketName := request.BucketName
+
 	bucketInfo, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), bucketName)
 	if err != nil {
 		return nil, fmt.Errorf("ListFiles couldn't get the bucket entry: %s, %w", bucketName, err)
 	}
 
-	if bucketInfo.OwnerID != requesterUUID {
+	if bucketInfo.OwnerID != request.RequesterUUID {
 		return nil, ErrNoPermission
 	}
 
-	files, err := storage.TableFiles.GetFilesOfABucket(ctx, business.dbInstance.GetPool(), bucketInfo.ID)
+	query := model.FilesQuery{
+		CreatedAfter:  request.CreatedAfter,
+		CreatedBefore: request.CreatedBefore,
+		MinSize:       request.MinSize,
+		MaxSize:       request.MaxSize,
+		After:         nil,
+		Prefix:        request.Prefix,
+		MIME:          request.MIME,
+		Access:        request.Access,
+		NameContains:  request.NameContains,
+		Sort:          request.Sort,
+		BucketID:      bucketInfo.ID,
+		Limit:         0,
+		Descending:    request.Descending,
+		LatestOnly:    bucketInfo.Versioning,
+	}
+
+	if request.Token != "" {
+		token, tokenErr := decodeFilesToken(request.Token)
+		if tokenErr != nil || token.Sort != request.Sort || token.Descending != request.Descending {
+			return nil, ErrBadRequest
+		}
+
+		query.After = &token.Cursor
+	}
+
+	response, err := business.listFilesPage(ctx, query, request.Delimiter, request.Limit)
 	if err != nil {
 		return nil, fmt.Errorf("ListFiles couldn't list files of the bucket: %s, %w", bucketName, err)
 	}
 
-	for fileIndex := range files {
-		if files[fileIndex].FilenameSuffix != 0 {
-			var builder strings.Builder
+	if bucketInfo.Versioning {
+		return response, nil
+	}
 
-			lastDotIdx := strings.LastIndex(files[fileIndex].Filename, ".")
+	for fileIndex := range response.Files {
+		response.Files[fileIndex].Filename = suffixedFilename(&response.Files[fileIndex])
+	}
 
-			if lastDotIdx != -1 {
-				builder.WriteString(files[fileIndex].Filename[0:lastDotIdx])
-			} else {
-				builder.WriteString(files[fileIndex].Filename)
+	return response, nil
+}
+
+// suffixedFilename returns the filename the file of a non-versioned bucket is shown under,
+// the filename suffix put before the extension.
+func suffixedFilename(file *model.File) string {
+	if file.FilenameSuffix == 0 {
+		return file.Filename
+	}
+
+	var builder strings.Builder
+
+	// the dot of the extension, not of a folder.
+	lastDotIdx := strings.LastIndex(file.Filename, ".")
+	if lastDotIdx < strings.LastIndex(file.Filename, "/") {
+		lastDotIdx = -1
+	}
+
+	if lastDotIdx != -1 {
+		builder.WriteString(file.Filename[0:lastDotIdx])
+	} else {
+		builder.WriteString(file.Filename)
+	}
+
+	builder.WriteString("_")
+	builder.WriteString(strconv.FormatInt(int64(file.FilenameSuffix), 10))
+
+	if lastDotIdx != -1 {
+		builder.WriteString(file.Filename[lastDotIdx:])
+	}
+
+	return builder.String()
+}
+
+// listFilesPage collects up to limit files and common prefixes past the cursor of the query, querying
+// one more row than needed to tell if the listing goes on. The rows under a common prefix already listed
+// are skipped, the query resuming past the prefix once a batch runs out.
+func (business BusinessModule) listFilesPage(ctx context.Context, query model.FilesQuery, delimiter string,
+	limit int,
+) (*model.ListFilesResponse, error) {
+	response := &model.ListFilesResponse{Files: []model.File{}} //nolint:exhaustruct // filled below.
+	cursor := query.After
+	count := 0
+
+	for {
+		query.After = cursor
+		query.Limit = limit - count + 1
+
+		batch, err := storage.TableFiles.GetPage(ctx, business.dbInstance.GetPool(), query)
+		if err != nil {
+			return nil, fmt.Errorf("business.listFilesPage TableFiles.GetPage: %w", err)
+		}
+
+		for _, file := range batch {
+			if cursor != nil && cursor.SkipPrefix != "" && strings.HasPrefix(file.Filename, cursor.SkipPrefix) {
+				continue
 			}
 
-			builder.WriteString("_")
-			builder.WriteString(strconv.FormatInt(int64(files[fileIndex].FilenameSuffix), 10))
+			if count == limit {
+				response.NextToken = filesToken{Cursor: *cursor, Sort: query.Sort, Descending: query.Descending}.encode()
+
+				return response, nil
+			}
 
-			if lastDotIdx != -1 {
-				builder.WriteString(files[fileIndex].Filename[lastDotIdx:])
+			if folder := commonPrefix(file.Filename, query.Prefix, delimiter); folder != "" {
+				response.CommonPrefixes = append(response.CommonPrefixes, folder)
+				cursor = &model.FilesCursor{SkipPrefix: folder} //nolint:exhaustruct // a position past the prefix.
+			} else {
+				response.Files = append(response.Files, file)
+				cursor = &model.FilesCursor{
+					CreatedTS:  file.CreatedTS,
+					Filename:   file.Filename,
+					SkipPrefix: "",
+					SizeBytes:  file.SizeBytes,
+					Suffix:     file.FilenameSuffix,
+				}
 			}
 
-			files[fileIndex].Filename = builder.String()
+			count++
 		}
-	}
 
-	return files, nil
+		if len(batch) < query.Limit {
+			return response, nil
+		}
+	}
 }
 
-func (business BusinessModule) EditFile(ctx context.Context, request model.File, bucketName string,
-	requesterID uuid.UUID,
+// EditFile renames the file, changes its access, and patches its metadata and tags.
+func (business BusinessModule) EditFile(ctx context.Context, fileID uuid.UUID, request model.EditFileRequest,
+	bucketName string, requesterID uuid.UUID,
 ) error {
-	dbFile, err := storage.TableFiles.GetByID(ctx, business.dbInstance.GetPool(), request.ID)
+	bucketInfo, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), bucketName)
 	if err != nil {
-		return fmt.Errorf("EditFile couldn't get the file entry: %s, %w", request.ID.String(), err)
+		return fmt.Errorf("EditFile couldn't get the bucket entry: %s, %w", bucketName, err)
 	}
 
-	bucketInfo, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), bucketName)
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("EditFile couldn't get the bucket entry: %s, %w", bucketName, err)
+		return fmt.Errorf("EditFile begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	// the row stays locked till the patched attributes are written, so that concurrent patches add up.
+	dbFile, err := storage.TableFiles.LockByID(ctx, transaction, fileID)
+	if err != nil {
+		return fmt.Errorf("EditFile couldn't get the file entry: %s, %w", fileID.String(), err)
 	}
 
 	// check if actually the file is in the bucket.
@@ -232,23 +709,45 @@ func (business BusinessModule) EditFile(ctx context.Context, request model.File,
 	}
 
 	if request.Filename != "" {
+		if !validKey(request.Filename) {
+			return ErrBadRequest
+		}
+
 		dbFile.Filename = request.Filename
 	}
 
-	if request.Access != "" {
-		dbFile.Access = request.Access
+	if request.Access != nil {
+		if *request.Access != model.FileAccessPrivate && *request.Access != model.FileAccessPublic {
+			return ErrBadRequest
+		}
+
+		dbFile.Access = *request.Access
 	}
 
-	err = storage.TableFiles.UpdateByID(ctx, business.dbInstance.GetPool(), dbFile)
+	dbFile.Metadata = patchAttributes(dbFile.Metadata, request.Metadata)
+	dbFile.Tags = patchAttributes(dbFile.Tags, request.Tags)
+
+	if !validAttributes(dbFile.Metadata, dbFile.Tags) {
+		return ErrBadRequest
+	}
+
+	err = storage.TableFiles.UpdateByID(ctx, transaction, dbFile)
 	if err != nil {
 		return fmt.Errorf("EditFile couldn't update the file entry: %w", err)
 	}
 
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("EditFile transaction.Commit: %w", err)
+	}
+
 	return nil
 }
 
-func (business BusinessModule) DeleteFile(ctx context.Context, fileID uuid.UUID, bucketName string,
-	requesterID uuid.UUID,
+// DeleteFile moves the file to the trash, or removes it if the bucket keeps no trash. In a versioned bucket
+// the object gets hidden behind a delete marker unless a version to remove for good is given.
+func (business BusinessModule) DeleteFile(ctx context.Context, fileID uuid.UUID, versionID *uuid.UUID,
+	bucketName string, requesterID uuid.UUID,
 ) error {
 	dbFile, err := storage.TableFiles.GetByID(ctx, business.dbInstance.GetPool(), fileID)
 	if err != nil {
@@ -270,19 +769,80 @@ func (business BusinessModule) DeleteFile(ctx context.Context, fileID uuid.UUID,
 		return ErrNoPermission
 	}
 
-	err = storage.TableFiles.MarkDeleted(ctx, business.dbInstance.GetPool(), fileID)
+	if versionID != nil {
+		version, versionErr := business.getObjectVersion(ctx, bucketInfo.ID, dbFile.Filename, *versionID)
+		if versionErr != nil {
+			return versionErr
+		}
+
+		return business.deleteFile(ctx, bucketInfo.ID, version.ID)
+	}
+
+	if bucketInfo.Versioning {
+		_, err = business.putDeleteMarker(ctx, bucketInfo.ID, dbFile.Filename)
+
+		return err
+	}
+
+	return business.removeFile(ctx, bucketInfo, fileID)
+}
+
+// deleteFile removes the file entry and its content. The permissions are checked by the caller.
+func (business BusinessModule) deleteFile(ctx context.Context, bucketID int64, fileID uuid.UUID) error {
+	err := storage.TableFiles.MarkDeleted(ctx, business.dbInstance.GetPool(), fileID)
 	if err != nil {
 		return fmt.Errorf("DeleteFile couldn't mark the db entry: %w", err)
 	}
 
-	err = business.fileStorage.DeleteFile(strconv.FormatInt(bucketInfo.ID, 10), fileID.String())
+	return business.deleteMarkedFile(ctx, bucketID, fileID)
+}
+
+// deleteMarkedFile removes the content and the entry of the file marked deleted.
+func (business BusinessModule) deleteMarkedFile(ctx context.Context, bucketID int64, fileID uuid.UUID) error {
+	// a delete marker has no content, an interrupted delete may have removed it already.
+	err := business.fileStorage.DeleteFile(strconv.FormatInt(bucketID, 10), fileID.String())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("DeleteFile couldn't delete the file: %w", err)
+	}
+
+	err = business.deleteFileEntry(ctx, bucketID, fileID)
 	if err != nil {
 		return fmt.Errorf("DeleteFile couldn't delete the db file entry: %w", err)
 	}
 
-	err = storage.TableFiles.DeleteByID(ctx, business.dbInstance.GetPool(), fileID)
+	return nil
+}
+
+// deleteFileEntry deletes the file row, releases its bytes from the bucket usage and its reference
+// to the deduplicated blob.
+func (business BusinessModule) deleteFileEntry(ctx context.Context, bucketID int64, fileID uuid.UUID) error {
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("business.deleteFileEntry begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	deleted, err := storage.TableFiles.DeleteByIDReturning(ctx, transaction, fileID)
 	if err != nil {
-		return fmt.Errorf("DeleteFile couldn't delete the db file entry: %w", err)
+		return fmt.Errorf("business.deleteFileEntry TableFiles.DeleteByIDReturning: %w", err)
+	}
+
+	_, err = storage.TableBuckets.AddBytesUsed(ctx, transaction, bucketID, -deleted.SizeBytes)
+	if err != nil && !errors.Is(err, database.ErrNoRows) {
+		return fmt.Errorf("business.deleteFileEntry TableBuckets.AddBytesUsed: %w", err)
+	}
+
+	if deleted.BlobSHA256 != "" {
+		err = business.releaseBlob(ctx, transaction, deleted.BlobSHA256)
+		if err != nil {
+			return fmt.Errorf("business.deleteFileEntry: %w", err)
+		}
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("business.deleteFileEntry transaction.Commit: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,90 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+const bucketPurgeBatchSize = 100
+
+// purgeBucket removes every file of a bucket marked as deleting, then its folder and its entry.
+// Every step is idempotent, so an interrupted purge is completed by simply running it again.
+func (business BusinessModule) purgeBucket(ctx context.Context, bucketID int64) error {
+	bucketIDStr := strconv.FormatInt(bucketID, 10)
+
+	for {
+		fileIDs, err := storage.TableFiles.GetIDsOfABucket(ctx, business.dbInstance.GetPool(), bucketID,
+			bucketPurgeBatchSize)
+		if err != nil {
+			return fmt.Errorf("business.purgeBucket TableFiles.GetIDsOfABucket: %w", err)
+		}
+
+		if len(fileIDs) == 0 {
+			break
+		}
+
+		for _, fileID := range fileIDs {
+			err = business.deleteFile(ctx, bucketID, fileID)
+			if err != nil && !errors.Is(err, database.ErrNoRows) {
+				return fmt.Errorf("business.purgeBucket: %w", err)
+			}
+		}
+	}
+
+	err := business.fileStorage.DeleteFolder(bucketIDStr)
+	if err != nil {
+		return fmt.Errorf("business.purgeBucket fileStorage.DeleteFolder: %w", err)
+	}
+
+	err = storage.TableBuckets.DeleteByID(ctx, business.dbInstance.GetPool(), bucketID)
+	if err != nil && !errors.Is(err, database.ErrNoRows) {
+		return fmt.Errorf("business.purgeBucket TableBuckets.DeleteByID: %w", err)
+	}
+
+	return nil
+}
+
+// ResumeBucketPurges completes the purges of the buckets marked as deleting.
+func (business BusinessModule) ResumeBucketPurges(ctx context.Context) error {
+	buckets, err := storage.TableBuckets.GetDeleting(ctx, business.dbInstance.GetPool())
+	if err != nil {
+		return fmt.Errorf("business.ResumeBucketPurges TableBuckets.GetDeleting: %w", err)
+	}
+
+	var errs []error
+
+	for _, bucket := range buckets {
+		err = business.purgeBucket(ctx, bucket.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bucket %d: %w", bucket.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RunBucketPurger resumes the interrupted purges on start and then every period until ctx is done.
+func (business BusinessModule) RunBucketPurger(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		err := business.ResumeBucketPurges(ctx)
+		if err != nil {
+			log.Println("bucket purger:", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package business_test
+
+import (
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/business"
+	"github.com/stretchr/testify/require"
+)
+
+var testDBUri = flag.String("t-db-uri", "", "perform sql tests on the `t-db-uri` database")
+
+var testDB *database.Database
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	if testDBUri != nil && *testDBUri != "" {
+		testDB, _ = database.Setup(context.Background(), *testDBUri, "file://../provider/storage/sql")
+
+		defer testDB.ClosePool()
+	}
+
+	m.Run()
+}
+
+// newTestBusiness returns the business module over the cleared test database, skipping the test without one.
+func newTestBusiness(t *testing.T, fileStorage business.FileStorage) *business.BusinessModule {
+	t.Helper()
+
+	if testDB.GetPool() == nil {
+		t.Skip("database was not initialized")
+	}
+
+	for _, table := range []string{"files", "buckets", "blobs"} {
+		_, err := testDB.GetPool().Exec(context.Background(), "TRUNCATE TABLE "+table+" RESTART IDENTITY CASCADE")
+		require.NoError(t, err)
+	}
+
+	return business.NewBusinessModule(testDB, fileStorage, business.Config{}) //nolint:exhaustruct // the defaults.
+}
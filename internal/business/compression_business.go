@@ -0,0 +1,117 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/files"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+)
+
+var errUnknownEncoding = errors.New("unknown content encoding")
+
+// SetBucketCompression sets the codec the compressible files uploaded to the bucket are stored with,
+// an empty one turning the compression off. The files already stored are kept as they are.
+func (business BusinessModule) SetBucketCompression(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	compression string,
+) error {
+	if compression != "" && compression != files.ContentEncodingGzip {
+		return ErrBadRequest
+	}
+
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return err
+	}
+
+	err = storage.TableBuckets.SetCompression(ctx, business.dbInstance.GetPool(), bucketInfo.ID, compression)
+	if err != nil {
+		return fmt.Errorf("business.SetBucketCompression TableBuckets.SetCompression: %w", err)
+	}
+
+	return nil
+}
+
+// compressedMIMEs are the compressible types outside of text/*.
+var compressedMIMEs = map[string]struct{}{ //nolint:gochecknoglobals // a lookup table.
+	"application/json":       {},
+	"application/x-ndjson":   {},
+	"application/xml":        {},
+	"application/javascript": {},
+	"application/x-yaml":     {},
+	"application/yaml":       {},
+	"application/csv":        {},
+	"application/sql":        {},
+	"image/svg+xml":          {},
+}
+
+// compressible tells the types worth compressing, the media and the archives being compressed already.
+func compressible(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+
+	if _, ok := compressedMIMEs[mediaType]; ok {
+		return true
+	}
+
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml")
+}
+
+// contentEncoding picks the codec for a file uploaded to the bucket.
+func contentEncoding(bucketInfo *model.Bucket, mimeType string) string {
+	if bucketInfo.Compression == "" || !compressible(mimeType) {
+		return ""
+	}
+
+	return bucketInfo.Compression
+}
+
+// acceptsEncoding tells whether the request accepts the content coding, ignoring the q-values but zero.
+func acceptsEncoding(request *http.Request, coding string) bool {
+	for _, header := range request.Header.Values("Accept-Encoding") {
+		for _, accepted := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+
+			if !strings.EqualFold(name, coding) && name != "*" {
+				continue
+			}
+
+			if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok && strings.Trim(q, "0.") == "" {
+				continue
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeStored wraps the stored content with the decoder of its codec.
+func decodeStored(stored io.ReadSeekCloser, encoding string) (io.ReadSeekCloser, error) {
+	switch encoding {
+	case "":
+		return stored, nil
+	case files.ContentEncodingGzip:
+		decoded, err := files.NewGzipFrameReader(stored)
+		if err != nil {
+			return nil, fmt.Errorf("business.decodeStored: %w", err)
+		}
+
+		return decoded, nil
+	default:
+		stored.Close()
+
+		return nil, fmt.Errorf("business.decodeStored %q: %w", encoding, errUnknownEncoding)
+	}
+}
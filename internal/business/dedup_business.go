@@ -0,0 +1,247 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"time"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+// dedupFolder keeps the deduplicated blobs named by the hex SHA-256 of the content, suffixed with the content
+// encoding if any. The bucket folders are named by the numeric bucket ids, so it can't clash with them.
+const dedupFolder = "dedup"
+
+// dedupBlob turns the content staged under the file id in the bucket folder into a reference to the
+// deduplicated blob with the same SHA-256, moving the content to the dedup folder if the blob is new.
+// Meant to run in the transaction creating the file entry, the blob row stays locked till its end.
+// The staged content, if still there, is the caller's to discard once the transaction is committed.
+func (business BusinessModule) dedupBlob(ctx context.Context, querier database.Querier, file *model.File) error {
+	if !business.conf.DedupBlobs {
+		return nil
+	}
+
+	// the content stored in different encodings makes different blobs.
+	key := file.SHA256
+	if file.ContentEncoding != "" {
+		key += "." + file.ContentEncoding
+	}
+
+	refCount, err := storage.TableBlobs.Acquire(ctx, querier, key, file.StoredSizeBytes)
+	if err != nil {
+		return fmt.Errorf("business.dedupBlob TableBlobs.Acquire: %w", err)
+	}
+
+	bring := refCount == 1
+
+	// a release that failed to commit may have removed the content of a live blob, the new copy restores it.
+	if !bring {
+		bring, err = business.blobMissing(dedupFolder, key)
+		if err != nil {
+			return fmt.Errorf("business.dedupBlob: %w", err)
+		}
+	}
+
+	if bring {
+		err = business.fileStorage.CreateFolder(dedupFolder)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("business.dedupBlob fileStorage.CreateFolder: %w", err)
+		}
+
+		err = business.fileStorage.MoveFile(strconv.FormatInt(file.BucketID, 10), file.ID.String(),
+			dedupFolder, key)
+		if err != nil {
+			return fmt.Errorf("business.dedupBlob fileStorage.MoveFile: %w", err)
+		}
+	}
+
+	file.BlobSHA256 = key
+
+	return nil
+}
+
+// releaseBlob drops a reference to the deduplicated blob, removing the content along with the last one.
+// Meant to run in the transaction deleting the file entry: the content is removed while the blob row
+// is locked, so a concurrent upload of the same content waits and brings it anew.
+func (business BusinessModule) releaseBlob(ctx context.Context, querier database.Querier, sha256 string) error {
+	refCount, err := storage.TableBlobs.Release(ctx, querier, sha256)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.releaseBlob TableBlobs.Release: %w", err)
+	}
+
+	if refCount > 0 {
+		return nil
+	}
+
+	err = business.fileStorage.DeleteFile(dedupFolder, sha256)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("business.releaseBlob fileStorage.DeleteFile: %w", err)
+	}
+
+	return nil
+}
+
+// openFile opens the content of the file entry, be it deduplicated or compressed.
+func (business BusinessModule) openFile(file *model.File) (io.ReadSeekCloser, error) {
+	stored, err := business.openStored(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeStored(stored, file.ContentEncoding)
+}
+
+// openStored opens the content of the file entry in its stored encoding.
+func (business BusinessModule) openStored(file *model.File) (io.ReadSeekCloser, error) {
+	if file.BlobSHA256 != "" {
+		return business.fileStorage.OpenFile(dedupFolder, file.BlobSHA256) //nolint:wrapcheck // a proxy.
+	}
+
+	return business.fileStorage.OpenFile(strconv.FormatInt(file.BucketID, 10), file.ID.String()) //nolint:wrapcheck,lll
+}
+
+// reconcileBlobs compares the dedup folder with the blobs table. The blobs without content can't be repaired,
+// they are only reported.
+//
+//nolint:funlen,cyclop // a single pass over the store reads better than split.
+func (business BusinessModule) reconcileBlobs(ctx context.Context, repair bool,
+	report *model.ReconcileReport,
+) error {
+	pool := business.dbInstance.GetPool()
+
+	stored, err := business.fileStorage.ListFolder(dedupFolder)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("business.reconcileBlobs fileStorage.ListFolder: %w", err)
+	}
+
+	blobs, err := storage.TableBlobs.GetAll(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("business.reconcileBlobs TableBlobs.GetAll: %w", err)
+	}
+
+	recorded := make(map[string]int64, len(blobs))
+	for _, blob := range blobs {
+		recorded[blob.SHA256] = blob.RefCount
+	}
+
+	var errs []error
+
+	present := make(map[string]struct{}, len(stored))
+	graceLimit := time.Now().Add(-reconcileGracePeriod)
+
+	for _, blob := range stored {
+		present[blob.ID] = struct{}{}
+
+		if _, ok := recorded[blob.ID]; ok || blob.ModTS.After(graceLimit) {
+			continue
+		}
+
+		issue := model.ReconcileIssue{ //nolint:exhaustruct // repaired below.
+			Kind:   model.ReconcileOrphanBlob,
+			ID:     blob.ID,
+			Detail: fmt.Sprintf("deduplicated, %d bytes", blob.Size),
+		}
+
+		if repair {
+			err = business.fileStorage.DeleteFile(dedupFolder, blob.ID)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("orphan blob %s: %w", blob.ID, err))
+			} else {
+				issue.Repaired = true
+			}
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	for _, blob := range blobs {
+		if _, ok := present[blob.SHA256]; ok {
+			continue
+		}
+
+		missing, confirmErr := business.blobMissing(dedupFolder, blob.SHA256)
+		if confirmErr != nil {
+			errs = append(errs, confirmErr)
+
+			continue
+		}
+
+		if missing {
+			report.Issues = append(report.Issues, model.ReconcileIssue{ //nolint:exhaustruct // not repairable.
+				Kind:   model.ReconcileMissingBlob,
+				ID:     blob.SHA256,
+				Detail: fmt.Sprintf("deduplicated, %d references", blob.RefCount),
+			})
+		}
+	}
+
+	miscounted, err := storage.TableBlobs.GetMiscounted(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("business.reconcileBlobs TableBlobs.GetMiscounted: %w", err)
+	}
+
+	for _, blob := range miscounted {
+		issue := model.ReconcileIssue{ //nolint:exhaustruct // repaired below.
+			Kind: model.ReconcileRefCountMismatch,
+			ID:   blob.SHA256,
+			Detail: fmt.Sprintf("recorded %d references, found %d", recorded[blob.SHA256],
+				blob.RefCount),
+		}
+
+		if repair {
+			err = business.recountBlob(ctx, blob.SHA256)
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				issue.Repaired = true
+			}
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return errors.Join(errs...)
+}
+
+// recountBlob fixes the reference count of the blob, removing it if nothing refers to it.
+func (business BusinessModule) recountBlob(ctx context.Context, sha256 string) error {
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("business.recountBlob begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	refCount, err := storage.TableBlobs.Recount(ctx, transaction, sha256)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.recountBlob TableBlobs.Recount: %w", err)
+	}
+
+	if refCount == 0 {
+		err = business.fileStorage.DeleteFile(dedupFolder, sha256)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("business.recountBlob fileStorage.DeleteFile: %w", err)
+		}
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("business.recountBlob transaction.Commit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+var ErrNotEncrypted = errors.New("the file storage doesn't encrypt the blobs")
+
+// KeyRotator is implemented by the file storages that encrypt the blobs with a master key.
+type KeyRotator interface {
+	// Rewrap moves the blob to the current master key and reports whether it was rewritten.
+	Rewrap(bucketID, fileID string) (bool, error)
+}
+
+// RotateKeys moves the content of every stored file to the current master key, so the previous master keys
+// can be dropped afterwards. The unfinished uploads are not rewrapped, the previous keys are still needed
+// to read them until they complete or expire. Returns the number of the blobs rewritten.
+func (business BusinessModule) RotateKeys(ctx context.Context) (int, error) {
+	rotator, ok := business.fileStorage.(KeyRotator)
+	if !ok {
+		return 0, ErrNotEncrypted
+	}
+
+	pool := business.dbInstance.GetPool()
+
+	buckets, err := storage.TableBuckets.GetActive(ctx, pool)
+	if err != nil {
+		return 0, fmt.Errorf("business.RotateKeys TableBuckets.GetActive: %w", err)
+	}
+
+	var (
+		errs      []error
+		rewrapped int
+	)
+
+	rewrap := func(folder, blobID string) {
+		done, err := rotator.Rewrap(folder, blobID)
+		if errors.Is(err, fs.ErrNotExist) { // deleted meanwhile.
+			return
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("blob %s/%s: %w", folder, blobID, err))
+		}
+
+		if done {
+			rewrapped++
+		}
+	}
+
+	for _, bucketInfo := range buckets {
+		if ctx.Err() != nil {
+			return rewrapped, errors.Join(append(errs, ctx.Err())...)
+		}
+
+		liveFiles, err := storage.TableFiles.GetFilesOfABucket(ctx, pool, bucketInfo.ID)
+		if err != nil {
+			return rewrapped, fmt.Errorf("business.RotateKeys TableFiles.GetFilesOfABucket: %w", err)
+		}
+
+		trashedFiles, err := storage.TableFiles.GetTrashOfABucket(ctx, pool, bucketInfo.ID)
+		if err != nil {
+			return rewrapped, fmt.Errorf("business.RotateKeys TableFiles.GetTrashOfABucket: %w", err)
+		}
+
+		bucketIDStr := strconv.FormatInt(bucketInfo.ID, 10)
+
+		for _, file := range slices.Concat(liveFiles, trashedFiles) {
+			if !file.DeleteMarker && file.BlobSHA256 == "" {
+				rewrap(bucketIDStr, file.ID.String())
+			}
+		}
+	}
+
+	blobs, err := storage.TableBlobs.GetAll(ctx, pool)
+	if err != nil {
+		return rewrapped, fmt.Errorf("business.RotateKeys TableBlobs.GetAll: %w", err)
+	}
+
+	for _, blob := range blobs {
+		rewrap(dedupFolder, blob.SHA256)
+	}
+
+	return rewrapped, errors.Join(errs...)
+}
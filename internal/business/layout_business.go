@@ -0,0 +1,65 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+var ErrNoLayout = errors.New("the file storage has no directory layout")
+
+// FolderRelayouter is implemented by the file storages keeping the blobs in a configurable directory layout.
+type FolderRelayouter interface {
+	// RelayoutFolder moves the blobs of the folder to the configured layout and returns the number of the blobs moved.
+	RelayoutFolder(bucketID string) (int, error)
+}
+
+// RelayoutFolders moves the blobs of the buckets that are not being deleted and the deduplicated blobs
+// to the configured directory layout, e.g. after the fan-out is changed. The blobs stay readable meanwhile.
+// Returns the number of the blobs moved.
+func (business BusinessModule) RelayoutFolders(ctx context.Context) (int, error) {
+	relayouter, ok := business.fileStorage.(FolderRelayouter)
+	if !ok {
+		return 0, ErrNoLayout
+	}
+
+	buckets, err := storage.TableBuckets.GetActive(ctx, business.dbInstance.GetPool())
+	if err != nil {
+		return 0, fmt.Errorf("business.RelayoutFolders TableBuckets.GetActive: %w", err)
+	}
+
+	folders := make([]string, 0, len(buckets)+1)
+	for _, bucketInfo := range buckets {
+		folders = append(folders, strconv.FormatInt(bucketInfo.ID, 10))
+	}
+
+	folders = append(folders, dedupFolder)
+
+	var (
+		errs  []error
+		moved int
+	)
+
+	for _, folder := range folders {
+		if ctx.Err() != nil {
+			return moved, errors.Join(append(errs, ctx.Err())...)
+		}
+
+		count, err := relayouter.RelayoutFolder(folder)
+		moved += count
+
+		if errors.Is(err, fs.ErrNotExist) { // nothing stored yet.
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("folder %s: %w", folder, err))
+		}
+	}
+
+	return moved, errors.Join(errs...)
+}
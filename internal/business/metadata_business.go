@@ -0,0 +1,111 @@
+package business
+
+import (
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eldarbr/go-s3/internal/model"
+)
+
+// The bounds of the user-defined metadata and tags of a file.
+const (
+	maxAttributeKeyLength  = 128
+	maxMetadataValueLength = 1024
+	maxMetadataSize        = 8 << 10
+	maxTagValueLength      = 256
+	maxTags                = 50
+)
+
+// validAttributeKey tells if the key may name a metadata entry or a tag: lowercase letters, digits,
+// hyphens and underscores, so that it makes a header name.
+func validAttributeKey(key string) bool {
+	if key == "" || len(key) > maxAttributeKeyLength {
+		return false
+	}
+
+	for _, char := range key {
+		if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '-' && char != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validAttributeValue tells if the value may be stored and sent in a header: UTF-8 without control characters.
+func validAttributeValue(value string, maxLength int) bool {
+	if len(value) > maxLength || !utf8.ValidString(value) {
+		return false
+	}
+
+	return !strings.ContainsFunc(value, func(char rune) bool {
+		return char < ' ' || char == 0x7f
+	})
+}
+
+// validAttributes tells if the metadata and the tags may be stored with a file.
+func validAttributes(metadata, tags map[string]string) bool {
+	if len(tags) > maxTags {
+		return false
+	}
+
+	size := 0
+
+	for key, value := range metadata {
+		size += len(key) + len(value)
+
+		if !validAttributeKey(key) || !validAttributeValue(value, maxMetadataValueLength) {
+			return false
+		}
+	}
+
+	for key, value := range tags {
+		if !validAttributeKey(key) || !validAttributeValue(value, maxTagValueLength) {
+			return false
+		}
+	}
+
+	return size <= maxMetadataSize
+}
+
+// patchAttributes returns the attributes with the patch merged in, a nil value removing the key.
+func patchAttributes(attributes map[string]string, patch map[string]*string) map[string]string {
+	patched := maps.Clone(attributes)
+	if patched == nil {
+		patched = make(map[string]string, len(patch))
+	}
+
+	for key, value := range patch {
+		if value == nil {
+			delete(patched, key)
+		} else {
+			patched[key] = *value
+		}
+	}
+
+	return patched
+}
+
+// encodeTags encodes the tags the way the model.TagsHeader carries them.
+func encodeTags(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+
+	return values.Encode()
+}
+
+// setAttributeHeaders sets the headers carrying the metadata and the tags of the file.
+func setAttributeHeaders(header http.Header, fileInfo *model.File) {
+	for key, value := range fileInfo.Metadata {
+		header.Set(model.MetadataHeaderPrefix+key, value)
+	}
+
+	if len(fileInfo.Tags) != 0 {
+		header.Set(model.TagsHeader, encodeTags(fileInfo.Tags))
+	}
+}
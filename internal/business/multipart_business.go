@@ -0,0 +1,562 @@
+package business
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // the S3 clients expect MD5 ETags.
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultMultipartUploadTTL = 7 * 24 * time.Hour
+	multipartMinPartSize      = 5 << 20
+	multipartMaxPartNumber    = 10000
+	multipartJanitorBatchSize = 100
+)
+
+func (business BusinessModule) multipartUploadTTL() time.Duration {
+	if business.conf.MultipartUploadTTL <= 0 {
+		return DefaultMultipartUploadTTL
+	}
+
+	return business.conf.MultipartUploadTTL
+}
+
+func (business BusinessModule) CreateMultipartUpload(ctx context.Context, request model.CreateMultipartUploadRequest,
+) (*model.MultipartUpload, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, request.BucketName, request.RequesterUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateMultipartUpload uuid.NewRandom: %w", err)
+	}
+
+	upload := &model.MultipartUpload{ //nolint:exhaustruct // created_ts is set by the db.
+		ID:       uploadID,
+		BucketID: bucketInfo.ID,
+		Key:      request.Filename,
+		MIME:     request.MIME,
+		Access:   request.Access,
+	}
+
+	err = storage.TableMultipartUploads.Add(ctx, business.dbInstance.GetPool(), upload)
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateMultipartUpload TableMultipartUploads.Add: %w", err)
+	}
+
+	return upload, nil
+}
+
+// getMultipartUpload returns the upload if it belongs to the key of the requester's bucket.
+func (business BusinessModule) getMultipartUpload(ctx context.Context, requesterID uuid.UUID, bucketName, key string,
+	uploadID uuid.UUID,
+) (*model.Bucket, *model.MultipartUpload, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upload, err := storage.TableMultipartUploads.GetByID(ctx, business.dbInstance.GetPool(), uploadID)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, nil, ErrNoUpload
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("business.getMultipartUpload TableMultipartUploads.GetByID: %w", err)
+	}
+
+	if upload.BucketID != bucketInfo.ID || upload.Key != key {
+		return nil, nil, ErrNoUpload
+	}
+
+	return bucketInfo, upload, nil
+}
+
+// lockMultipartUpload is getMultipartUpload locking the upload within the transaction.
+func (business BusinessModule) lockMultipartUpload(ctx context.Context, querier database.Querier,
+	requesterID uuid.UUID, bucketName, key string, uploadID uuid.UUID,
+) (*model.Bucket, *model.MultipartUpload, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upload, err := storage.TableMultipartUploads.LockByID(ctx, querier, uploadID)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, nil, ErrNoUpload
+	}
+
+	if errors.Is(err, storage.ErrRowLocked) {
+		return nil, nil, ErrUploadLocked
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("business.lockMultipartUpload TableMultipartUploads.LockByID: %w", err)
+	}
+
+	if upload.BucketID != bucketInfo.ID || upload.Key != key {
+		return nil, nil, ErrNoUpload
+	}
+
+	return bucketInfo, upload, nil
+}
+
+// UploadPart stores the part under a new blob, replacing the previous upload of the part number.
+// The announced digests are verified against the content.
+func (business BusinessModule) UploadPart(ctx context.Context, request model.UploadPartRequest,
+) (*model.MultipartPart, error) {
+	if request.PartNumber < 1 || request.PartNumber > multipartMaxPartNumber {
+		return nil, ErrBadRequest
+	}
+
+	bucketInfo, upload, err := business.getMultipartUpload(ctx, request.RequesterUUID, request.BucketName,
+		request.Key, request.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	src := request.Content
+
+	// the quota is enforced on completion, the check only saves the io.
+	if bucketInfo.SizeQuota > 0 {
+		remaining := int64(bucketInfo.SizeQuota) - bucketInfo.BytesUsed
+		if request.ContentLength > remaining {
+			return nil, ErrQuotaExceeded
+		}
+
+		src = &quotaReader{src: src, left: remaining}
+	}
+
+	blobID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("business.UploadPart uuid.NewRandom: %w", err)
+	}
+
+	bucketIDStr := strconv.FormatInt(bucketInfo.ID, 10)
+	committed := false
+
+	defer func() {
+		if !committed {
+			business.discardFile(bucketIDStr, blobID.String())
+		}
+	}()
+
+	md5Hash := md5.New() //nolint:gosec // the S3 clients expect MD5 ETags.
+	sha256Hash := sha256.New()
+
+	written, err := business.fileStorage.WriteFile(bucketIDStr, blobID.String(),
+		io.TeeReader(src, io.MultiWriter(md5Hash, sha256Hash)))
+	if err != nil {
+		return nil, fmt.Errorf("business.UploadPart fileStorage.WriteFile: %w", err)
+	}
+
+	err = checkDigest(request.ContentMD5, md5Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkDigest(request.ChecksumSHA256, sha256Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	part := &model.MultipartPart{ //nolint:exhaustruct // created_ts is set by the db.
+		UploadID:   upload.ID,
+		PartNumber: request.PartNumber,
+		BlobID:     blobID,
+		SizeBytes:  written,
+		MD5:        hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256:     hex.EncodeToString(sha256Hash.Sum(nil)),
+	}
+
+	replacedBlobID, err := business.replacePart(ctx, part)
+	if err != nil {
+		return nil, err
+	}
+
+	committed = true
+
+	if replacedBlobID != uuid.Nil {
+		business.discardFile(bucketIDStr, replacedBlobID.String())
+	}
+
+	return part, nil
+}
+
+// replacePart saves the part entry and returns the blob id of the part it replaced, if any.
+func (business BusinessModule) replacePart(ctx context.Context, part *model.MultipartPart) (uuid.UUID, error) {
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("business.replacePart begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	replacedBlobID, err := storage.TableMultipartParts.DeleteByNumber(ctx, transaction, part.UploadID,
+		part.PartNumber)
+	if err != nil && !errors.Is(err, database.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("business.replacePart TableMultipartParts.DeleteByNumber: %w", err)
+	}
+
+	err = storage.TableMultipartParts.Add(ctx, transaction, part)
+	if errors.Is(err, database.ErrNoRows) {
+		return uuid.Nil, ErrNoUpload
+	}
+
+	// the same part is being uploaded concurrently.
+	if errors.Is(err, database.ErrUniqueKeyViolation) {
+		return uuid.Nil, ErrUploadLocked
+	}
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("business.replacePart TableMultipartParts.Add: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("business.replacePart transaction.Commit: %w", err)
+	}
+
+	return replacedBlobID, nil
+}
+
+// checkDigest compares the base64 digest announced by the client, if any, with the computed one.
+func checkDigest(announced string, computed hash.Hash) error {
+	if announced == "" {
+		return nil
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(announced)
+	if err != nil {
+		return ErrBadRequest
+	}
+
+	if string(expected) != string(computed.Sum(nil)) {
+		return ErrBadDigest
+	}
+
+	return nil
+}
+
+func (business BusinessModule) ListParts(ctx context.Context, requesterID uuid.UUID, bucketName, key string,
+	uploadID uuid.UUID,
+) ([]model.MultipartPart, error) {
+	_, upload, err := business.getMultipartUpload(ctx, requesterID, bucketName, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := storage.TableMultipartParts.GetByUpload(ctx, business.dbInstance.GetPool(), upload.ID)
+	if err != nil {
+		return nil, fmt.Errorf("business.ListParts TableMultipartParts.GetByUpload: %w", err)
+	}
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload assembles the listed parts into the object, replacing the previous objects
+// with the same key. The parts are streamed from the storage one after another and verified on the way.
+func (business BusinessModule) CompleteMultipartUpload(ctx context.Context,
+	request model.CompleteMultipartUploadRequest,
+) (*model.File, error) {
+	// the lock keeps the new parts out till the upload is gone.
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.CompleteMultipartUpload begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	bucketInfo, upload, err := business.lockMultipartUpload(ctx, transaction, request.RequesterUUID,
+		request.BucketName, request.Key, request.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	storedParts, err := storage.TableMultipartParts.GetByUpload(ctx, transaction, upload.ID)
+	if err != nil {
+		return nil, fmt.Errorf("business.CompleteMultipartUpload TableMultipartParts.GetByUpload: %w", err)
+	}
+
+	parts, totalSize, err := pickCompletedParts(storedParts, request.Parts)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &partsReader{ //nolint:exhaustruct // the state of the reading.
+		fileStorage: business.fileStorage,
+		bucketID:    strconv.FormatInt(bucketInfo.ID, 10),
+		parts:       parts,
+	}
+
+	defer src.Close()
+
+	file, err := business.uploadFile(ctx, bucketInfo, model.UploadFileRequest{
+		FileContent:   src,
+		ContentLength: totalSize,
+		BucketName:    bucketInfo.Name,
+		RequesterUUID: request.RequesterUUID,
+		File: model.File{ //nolint:exhaustruct // the rest gets filled in the upload.
+			Filename: upload.Key,
+			MIME:     upload.MIME,
+			Access:   upload.Access,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = business.deleteOtherObjects(ctx, bucketInfo, file)
+	if err != nil {
+		return nil, err
+	}
+
+	// the object is there already, the leftovers are the janitor's job.
+	err = business.dropMultipartUpload(ctx, transaction, upload, storedParts)
+	if err == nil {
+		err = transaction.Commit(ctx)
+	}
+
+	if err != nil {
+		log.Printf("business.CompleteMultipartUpload cleanup of %s postponed: %s\n", upload.ID.String(), err.Error())
+	}
+
+	return file, nil
+}
+
+// pickCompletedParts checks the part list of the completion request against the stored parts.
+func pickCompletedParts(storedParts []model.MultipartPart, requested []model.S3CompletedPart,
+) ([]model.MultipartPart, int64, error) {
+	if len(requested) == 0 {
+		return nil, 0, ErrInvalidPart
+	}
+
+	byNumber := make(map[int]model.MultipartPart, len(storedParts))
+	for _, part := range storedParts {
+		byNumber[part.PartNumber] = part
+	}
+
+	parts := make([]model.MultipartPart, 0, len(requested))
+
+	var totalSize int64
+
+	for idx, requestedPart := range requested {
+		part, ok := byNumber[requestedPart.PartNumber]
+		if !ok || strings.Trim(requestedPart.ETag, "\"") != part.MD5 {
+			return nil, 0, ErrInvalidPart
+		}
+
+		if idx > 0 && requestedPart.PartNumber <= requested[idx-1].PartNumber {
+			return nil, 0, ErrInvalidPart
+		}
+
+		if idx != len(requested)-1 && part.SizeBytes < multipartMinPartSize {
+			return nil, 0, ErrPartTooSmall
+		}
+
+		parts = append(parts, part)
+		totalSize += part.SizeBytes
+	}
+
+	return parts, totalSize, nil
+}
+
+func (business BusinessModule) AbortMultipartUpload(ctx context.Context, requesterID uuid.UUID,
+	bucketName, key string, uploadID uuid.UUID,
+) error {
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("business.AbortMultipartUpload begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	_, upload, err := business.lockMultipartUpload(ctx, transaction, requesterID, bucketName, key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	parts, err := storage.TableMultipartParts.GetByUpload(ctx, transaction, upload.ID)
+	if err != nil {
+		return fmt.Errorf("business.AbortMultipartUpload TableMultipartParts.GetByUpload: %w", err)
+	}
+
+	err = business.dropMultipartUpload(ctx, transaction, upload, parts)
+	if err != nil {
+		return err
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("business.AbortMultipartUpload transaction.Commit: %w", err)
+	}
+
+	return nil
+}
+
+// dropMultipartUpload deletes the part blobs and the upload entries. The upload is expected to be locked.
+func (business BusinessModule) dropMultipartUpload(ctx context.Context, querier database.Querier,
+	upload *model.MultipartUpload, parts []model.MultipartPart,
+) error {
+	bucketIDStr := strconv.FormatInt(upload.BucketID, 10)
+
+	for _, part := range parts {
+		business.discardFile(bucketIDStr, part.BlobID.String())
+	}
+
+	err := storage.TableMultipartUploads.DeleteByID(ctx, querier, upload.ID)
+	if err != nil {
+		return fmt.Errorf("business.dropMultipartUpload TableMultipartUploads.DeleteByID: %w", err)
+	}
+
+	return nil
+}
+
+// abortStaleMultipartUpload drops the upload unless it's busy being completed.
+func (business BusinessModule) abortStaleMultipartUpload(ctx context.Context, uploadID uuid.UUID) error {
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("business.abortStaleMultipartUpload begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	upload, err := storage.TableMultipartUploads.LockByID(ctx, transaction, uploadID)
+	if errors.Is(err, storage.ErrRowLocked) || errors.Is(err, database.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.abortStaleMultipartUpload TableMultipartUploads.LockByID: %w", err)
+	}
+
+	parts, err := storage.TableMultipartParts.GetByUpload(ctx, transaction, upload.ID)
+	if err != nil {
+		return fmt.Errorf("business.abortStaleMultipartUpload TableMultipartParts.GetByUpload: %w", err)
+	}
+
+	err = business.dropMultipartUpload(ctx, transaction, upload, parts)
+	if err != nil {
+		return err
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("business.abortStaleMultipartUpload transaction.Commit: %w", err)
+	}
+
+	return nil
+}
+
+// AbortStaleMultipartUploads drops the multipart uploads started more than the TTL ago.
+func (business BusinessModule) AbortStaleMultipartUploads(ctx context.Context) error {
+	uploads, err := storage.TableMultipartUploads.GetStale(ctx, business.dbInstance.GetPool(),
+		time.Now().Add(-business.multipartUploadTTL()), multipartJanitorBatchSize)
+	if err != nil {
+		return fmt.Errorf("business.AbortStaleMultipartUploads TableMultipartUploads.GetStale: %w", err)
+	}
+
+	var errs []error
+
+	for _, upload := range uploads {
+		err = business.abortStaleMultipartUpload(ctx, upload.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("multipart upload %s: %w", upload.ID.String(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RunMultipartJanitor aborts the stale multipart uploads every period until ctx is done.
+func (business BusinessModule) RunMultipartJanitor(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		err := business.AbortStaleMultipartUploads(ctx)
+		if err != nil {
+			log.Println("multipart janitor:", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// partsReader reads the part blobs one after another, opening each only when it's reached.
+// The SHA-256 of every part is checked once the part is read to the end.
+type partsReader struct {
+	fileStorage FileStorage
+	current     io.ReadCloser
+	hash        hash.Hash
+	bucketID    string
+	parts       []model.MultipartPart
+}
+
+func (reader *partsReader) Read(dst []byte) (int, error) {
+	for len(reader.parts) > 0 {
+		if reader.current == nil {
+			file, err := reader.fileStorage.OpenFile(reader.bucketID, reader.parts[0].BlobID.String())
+			if err != nil {
+				return 0, fmt.Errorf("partsReader part %d: %w", reader.parts[0].PartNumber, err)
+			}
+
+			reader.current = file
+			reader.hash = sha256.New()
+		}
+
+		read, err := reader.current.Read(dst)
+		reader.hash.Write(dst[:read]) //nolint:errcheck // never fails.
+
+		if errors.Is(err, io.EOF) {
+			reader.current.Close() //nolint:errcheck // read-only.
+			reader.current = nil
+
+			if hex.EncodeToString(reader.hash.Sum(nil)) != reader.parts[0].SHA256 {
+				return read, fmt.Errorf("partsReader part %d: %w", reader.parts[0].PartNumber, ErrBadDigest)
+			}
+
+			reader.parts = reader.parts[1:]
+		} else if err != nil {
+			return read, fmt.Errorf("partsReader part %d: %w", reader.parts[0].PartNumber, err)
+		}
+
+		if read > 0 {
+			return read, nil
+		}
+	}
+
+	return 0, io.EOF
+}
+
+func (reader *partsReader) Close() error {
+	if reader.current == nil {
+		return nil
+	}
+
+	err := reader.current.Close()
+	reader.current = nil
+
+	return err //nolint:wrapcheck // io.Closer contract.
+}
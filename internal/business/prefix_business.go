@@ -0,0 +1,90 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+)
+
+// maxKeyLength bounds the keys of the files, as the S3 API does.
+const maxKeyLength = 1024
+
+// validKey tells if the key may name a file: slash-separated non-empty segments, none of them "." or "..".
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength || strings.ContainsRune(key, 0) {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validFolder tells if the prefix names a virtual folder: a valid key followed by a slash, or empty for the root.
+func validFolder(prefix string) bool {
+	return prefix == "" || (strings.HasSuffix(prefix, "/") && validKey(strings.TrimSuffix(prefix, "/")))
+}
+
+// commonPrefix returns the key up to the first delimiter after the prefix, the delimiter included,
+// or empty if the key doesn't contain the delimiter there.
+func commonPrefix(key, prefix, delimiter string) string {
+	if delimiter == "" {
+		return ""
+	}
+
+	delimIdx := strings.Index(key[len(prefix):], delimiter)
+	if delimIdx == -1 {
+		return ""
+	}
+
+	return key[:len(prefix)+delimIdx+len(delimiter)]
+}
+
+// MovePrefix moves the files of the bucket from one virtual folder to another at once, e.g. "docs/2024/" to
+// "archive/2024/", or renames a folder. The versions and the delete markers move along, the trash stays in place.
+// Fails with ErrKeyExists if a moved file would take the key of a file left in place.
+// Returns the number of the file entries moved.
+func (business BusinessModule) MovePrefix(ctx context.Context, requesterID uuid.UUID, bucketName, from, to string,
+) (int64, error) {
+	// a folder can't be moved into itself.
+	if from == "" || !validFolder(from) || !validFolder(to) || strings.HasPrefix(to, from) {
+		return 0, ErrBadRequest
+	}
+
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return 0, err
+	}
+
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("business.MovePrefix begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	moved, err := storage.TableFiles.MovePrefix(ctx, transaction, bucketInfo.ID, from, to)
+	if errors.Is(err, database.ErrUniqueKeyViolation) {
+		return 0, ErrKeyExists
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("business.MovePrefix TableFiles.MovePrefix: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("business.MovePrefix transaction.Commit: %w", err)
+	}
+
+	return moved, nil
+}
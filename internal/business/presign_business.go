@@ -0,0 +1,43 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+// AuthorizePresign checks the requester may hand the operation over to a presigned url:
+// a download of a file of the requester's bucket or an upload to the requester's bucket.
+func (business BusinessModule) AuthorizePresign(ctx context.Context, scope model.PresignScope) error {
+	bucketInfo, err := business.getOwnedBucket(ctx, scope.BucketName, scope.RequesterUUID)
+	if err != nil {
+		return err
+	}
+
+	switch scope.Method {
+	case http.MethodPut:
+		return nil
+	case http.MethodGet:
+		fileInfo, err := storage.TableFiles.GetByID(ctx, business.dbInstance.GetPool(), scope.FileID)
+		if errors.Is(err, database.ErrNoRows) {
+			return ErrNoObject
+		}
+
+		if err != nil {
+			return fmt.Errorf("business.AuthorizePresign TableFiles.GetByID: %w", err)
+		}
+
+		if fileInfo.BucketID != bucketInfo.ID {
+			return ErrNoObject
+		}
+
+		return nil
+	default:
+		return ErrBadRequest
+	}
+}
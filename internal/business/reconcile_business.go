@@ -0,0 +1,312 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+// reconcileGracePeriod is how old an unreferenced blob must be to be an orphan.
+// The uploads write the blob before they create its entry, so a fresh blob is likely an upload in progress.
+const reconcileGracePeriod = time.Hour
+
+// Reconcile compares the file storage with the files table of every bucket that is not being deleted.
+// With repair set, the orphan blobs are removed, the interrupted deletions are completed, the entries without
+// content are dropped and the recorded sizes are fixed. The deduplicated blobs are checked against their reference
+// counts afterwards. The report is a snapshot, the concurrent uploads and deletions may show up in it, the repairs
+// are safe against them though.
+func (business BusinessModule) Reconcile(ctx context.Context, repair bool) (*model.ReconcileReport, error) {
+	buckets, err := storage.TableBuckets.GetActive(ctx, business.dbInstance.GetPool())
+	if err != nil {
+		return nil, fmt.Errorf("business.Reconcile TableBuckets.GetActive: %w", err)
+	}
+
+	report := &model.ReconcileReport{Issues: []model.ReconcileIssue{}, Repair: repair} //nolint:exhaustruct // counted.
+
+	var errs []error
+
+	for i := range buckets {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+
+			break
+		}
+
+		err = business.reconcileBucket(ctx, &buckets[i], repair, report)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bucket %d: %w", buckets[i].ID, err))
+		}
+
+		report.BucketsChecked++
+	}
+
+	if ctx.Err() == nil {
+		err = business.reconcileBlobs(ctx, repair, report)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deduplicated blobs: %w", err))
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+//nolint:funlen,gocognit,cyclop // a single pass over the bucket reads better than split.
+func (business BusinessModule) reconcileBucket(ctx context.Context, bucketInfo *model.Bucket, repair bool,
+	report *model.ReconcileReport,
+) error {
+	bucketIDStr := strconv.FormatInt(bucketInfo.ID, 10)
+	pool := business.dbInstance.GetPool()
+
+	// the blobs are listed before the entries are read, as a blob is always written before its entry.
+	blobs, err := business.fileStorage.ListFolder(bucketIDStr)
+	if errors.Is(err, fs.ErrNotExist) {
+		report.Issues = append(report.Issues, model.ReconcileIssue{ //nolint:exhaustruct // bucket wide.
+			Kind:     model.ReconcileMissingFolder,
+			BucketID: bucketInfo.ID,
+		})
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.reconcileBucket fileStorage.ListFolder: %w", err)
+	}
+
+	liveFiles, err := storage.TableFiles.GetFilesOfABucket(ctx, pool, bucketInfo.ID)
+	if err != nil {
+		return fmt.Errorf("business.reconcileBucket TableFiles.GetFilesOfABucket: %w", err)
+	}
+
+	trashedFiles, err := storage.TableFiles.GetTrashOfABucket(ctx, pool, bucketInfo.ID)
+	if err != nil {
+		return fmt.Errorf("business.reconcileBucket TableFiles.GetTrashOfABucket: %w", err)
+	}
+
+	deletedFiles, err := storage.TableFiles.GetDeletedOfABucket(ctx, pool, bucketInfo.ID)
+	if err != nil {
+		return fmt.Errorf("business.reconcileBucket TableFiles.GetDeletedOfABucket: %w", err)
+	}
+
+	uploadIDs, err := storage.TableUploads.GetIDsOfABucket(ctx, pool, bucketInfo.ID)
+	if err != nil {
+		return fmt.Errorf("business.reconcileBucket TableUploads.GetIDsOfABucket: %w", err)
+	}
+
+	partBlobIDs, err := storage.TableMultipartParts.GetBlobIDsOfABucket(ctx, pool, bucketInfo.ID)
+	if err != nil {
+		return fmt.Errorf("business.reconcileBucket TableMultipartParts.GetBlobIDsOfABucket: %w", err)
+	}
+
+	storedFiles := slices.Concat(liveFiles, trashedFiles)
+	referenced := make(map[string]struct{}, len(storedFiles)+len(deletedFiles)+len(uploadIDs)+len(partBlobIDs))
+
+	for _, blobID := range slices.Concat(uploadIDs, partBlobIDs) {
+		referenced[blobID.String()] = struct{}{}
+	}
+
+	// the content of a deduplicated file is in the dedup folder, what's left under its id is a leftover.
+	for _, file := range slices.Concat(storedFiles, deletedFiles) {
+		if file.BlobSHA256 == "" {
+			referenced[file.ID.String()] = struct{}{}
+		}
+	}
+
+	var errs []error
+
+	blobSizes := make(map[string]int64, len(blobs))
+	graceLimit := time.Now().Add(-reconcileGracePeriod)
+
+	for _, blob := range blobs {
+		blobSizes[blob.ID] = blob.Size
+
+		if _, ok := referenced[blob.ID]; ok || blob.ModTS.After(graceLimit) {
+			continue
+		}
+
+		issue := model.ReconcileIssue{ //nolint:exhaustruct // repaired below.
+			Kind:     model.ReconcileOrphanBlob,
+			ID:       blob.ID,
+			Detail:   fmt.Sprintf("%d bytes, modified %s", blob.Size, blob.ModTS.Format(time.RFC3339)),
+			BucketID: bucketInfo.ID,
+		}
+
+		if repair {
+			err = business.fileStorage.DeleteFile(bucketIDStr, blob.ID)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("orphan blob %s: %w", blob.ID, err))
+			} else {
+				issue.Repaired = true
+			}
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	var totalSize int64
+
+	for _, file := range deletedFiles {
+		totalSize += file.SizeBytes
+
+		issue := model.ReconcileIssue{ //nolint:exhaustruct // repaired below.
+			Kind:     model.ReconcileDanglingRow,
+			ID:       file.ID.String(),
+			Detail:   "deletion not completed",
+			BucketID: bucketInfo.ID,
+		}
+
+		// deleteFile is idempotent, a deletion completed meanwhile is fine.
+		if repair {
+			err = business.deleteFile(ctx, bucketInfo.ID, file.ID)
+			if err != nil && !errors.Is(err, database.ErrNoRows) {
+				errs = append(errs, fmt.Errorf("dangling row %s: %w", file.ID, err))
+			} else {
+				issue.Repaired = true
+			}
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	sizeFixed := false
+
+	for _, file := range storedFiles {
+		totalSize += file.SizeBytes
+
+		// a delete marker has no content, the deduplicated blobs are checked by reconcileBlobs.
+		if file.DeleteMarker || file.BlobSHA256 != "" {
+			continue
+		}
+
+		blobSize, ok := blobSizes[file.ID.String()]
+		if !ok {
+			missing, confirmErr := business.blobMissing(bucketIDStr, file.ID.String())
+			if confirmErr != nil {
+				errs = append(errs, confirmErr)
+
+				continue
+			}
+
+			if !missing { // written after the listing.
+				continue
+			}
+
+			issue := model.ReconcileIssue{ //nolint:exhaustruct // repaired below.
+				Kind:     model.ReconcileMissingBlob,
+				ID:       file.ID.String(),
+				Detail:   fmt.Sprintf("%s (%d)", file.Filename, file.FilenameSuffix),
+				BucketID: bucketInfo.ID,
+			}
+
+			if repair {
+				err = business.deleteFileEntry(ctx, bucketInfo.ID, file.ID)
+				if err != nil && !errors.Is(err, database.ErrNoRows) {
+					errs = append(errs, fmt.Errorf("missing blob %s: %w", file.ID, err))
+				} else {
+					issue.Repaired = true
+				}
+			}
+
+			report.Issues = append(report.Issues, issue)
+
+			continue
+		}
+
+		if blobSize == file.StoredSizeBytes {
+			continue
+		}
+
+		issue := model.ReconcileIssue{ //nolint:exhaustruct // repaired below.
+			Kind:     model.ReconcileSizeMismatch,
+			ID:       file.ID.String(),
+			Detail:   fmt.Sprintf("recorded %d bytes, stored %d bytes", file.StoredSizeBytes, blobSize),
+			BucketID: bucketInfo.ID,
+		}
+
+		// the size of a compressed content isn't known without decompressing it in full.
+		if repair && file.ContentEncoding == "" {
+			err = storage.TableFiles.SetSize(ctx, pool, file.ID, blobSize)
+			if err != nil && !errors.Is(err, database.ErrNoRows) {
+				errs = append(errs, fmt.Errorf("size mismatch %s: %w", file.ID, err))
+			} else {
+				issue.Repaired = true
+				sizeFixed = true
+			}
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	usageMismatch := totalSize != bucketInfo.BytesUsed
+	usageRecounted := false
+
+	if repair && (usageMismatch || sizeFixed) {
+		_, err = storage.TableBuckets.RecountBytesUsed(ctx, pool, bucketInfo.ID)
+		if err != nil && !errors.Is(err, database.ErrNoRows) {
+			errs = append(errs, fmt.Errorf("business.reconcileBucket TableBuckets.RecountBytesUsed: %w", err))
+		} else {
+			usageRecounted = true
+		}
+	}
+
+	if usageMismatch {
+		report.Issues = append(report.Issues, model.ReconcileIssue{ //nolint:exhaustruct // bucket wide.
+			Kind:     model.ReconcileUsageMismatch,
+			Detail:   fmt.Sprintf("recorded %d bytes, files total %d bytes", bucketInfo.BytesUsed, totalSize),
+			BucketID: bucketInfo.ID,
+			Repaired: usageRecounted,
+		})
+	}
+
+	return errors.Join(errs...)
+}
+
+// blobMissing confirms the blob is absent from the file storage.
+func (business BusinessModule) blobMissing(folder, blobID string) (bool, error) {
+	file, err := business.fileStorage.OpenFile(folder, blobID)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("business.blobMissing fileStorage.OpenFile: %w", err)
+	}
+
+	file.Close()
+
+	return false, nil
+}
+
+// RunReconciler reconciles the file storage with the database on start and then every period until ctx is done.
+func (business BusinessModule) RunReconciler(ctx context.Context, period time.Duration, repair bool) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		report, err := business.Reconcile(ctx, repair)
+		if err != nil {
+			log.Println("reconciler:", err.Error())
+		}
+
+		if report != nil {
+			for _, issue := range report.Issues {
+				log.Printf("reconciler: bucket %d %s %s %s, repaired: %t\n", issue.BucketID, issue.Kind, issue.ID,
+					issue.Detail, issue.Repaired)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+var ErrNotReplicated = errors.New("the file storage doesn't replicate the blobs")
+
+// ReplicaRepairer is implemented by the file storages that keep several copies of the blobs.
+type ReplicaRepairer interface {
+	// RepairFolder restores the missing copies of the blobs of the folder and returns the number of the copies made.
+	RepairFolder(bucketID string) (int, error)
+}
+
+// RepairReplicas restores the missing copies of the blobs in the folders of the buckets that are not being deleted
+// and in the folder of the deduplicated blobs, e.g. after a disk is replaced. Returns the number of the copies made.
+func (business BusinessModule) RepairReplicas(ctx context.Context) (int, error) {
+	repairer, ok := business.fileStorage.(ReplicaRepairer)
+	if !ok {
+		return 0, ErrNotReplicated
+	}
+
+	buckets, err := storage.TableBuckets.GetActive(ctx, business.dbInstance.GetPool())
+	if err != nil {
+		return 0, fmt.Errorf("business.RepairReplicas TableBuckets.GetActive: %w", err)
+	}
+
+	folders := make([]string, 0, len(buckets)+1)
+	for _, bucketInfo := range buckets {
+		folders = append(folders, strconv.FormatInt(bucketInfo.ID, 10))
+	}
+
+	folders = append(folders, dedupFolder)
+
+	var (
+		errs   []error
+		copies int
+	)
+
+	for _, folder := range folders {
+		if ctx.Err() != nil {
+			return copies, errors.Join(append(errs, ctx.Err())...)
+		}
+
+		copied, err := repairer.RepairFolder(folder)
+		copies += copied
+
+		if errors.Is(err, fs.ErrNotExist) { // no replica has it, the reconciler reports it.
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("folder %s: %w", folder, err))
+		}
+	}
+
+	return copies, errors.Join(errs...)
+}
+
+// RunReplicaRepairer restores the missing copies of the blobs every period until the context is done.
+func (business BusinessModule) RunReplicaRepairer(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		copies, err := business.RepairReplicas(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Println("replica repairer:", err.Error())
+		}
+
+		if copies > 0 {
+			log.Printf("replica repairer: restored %d copies\n", copies)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package business
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	accessKeyIDPrefix     = "GS3"
+	accessKeyIDRandBytes  = 10
+	accessKeySecretBytes  = 30
+	defaultListObjectsMax = 1000
+)
+
+func (business BusinessModule) CreateAccessKey(ctx context.Context, ownerID uuid.UUID) (*model.AccessKey, error) {
+	idBytes := make([]byte, accessKeyIDRandBytes)
+	secretBytes := make([]byte, accessKeySecretBytes)
+
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateAccessKey rand.Read: %w", err)
+	}
+
+	_, err = rand.Read(secretBytes)
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateAccessKey rand.Read: %w", err)
+	}
+
+	key := &model.AccessKey{ //nolint:exhaustruct // the rest gets filled by the storage.
+		ID:      accessKeyIDPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(idBytes),
+		Secret:  base64.StdEncoding.EncodeToString(secretBytes),
+		OwnerID: ownerID,
+	}
+
+	err = storage.TableAccessKeys.Add(ctx, business.dbInstance.GetPool(), key)
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateAccessKey TableAccessKeys.Add: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetAccessKey returns the key including its secret, it is meant for the signature verification only.
+func (business BusinessModule) GetAccessKey(ctx context.Context, keyID string) (*model.AccessKey, error) {
+	key, err := storage.TableAccessKeys.GetByID(ctx, business.dbInstance.GetPool(), keyID)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrNoAccessKey
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.GetAccessKey TableAccessKeys.GetByID: %w", err)
+	}
+
+	return key, nil
+}
+
+func (business BusinessModule) ListAccessKeys(ctx context.Context, ownerID uuid.UUID) ([]model.AccessKey, error) {
+	keys, err := storage.TableAccessKeys.GetByOwner(ctx, business.dbInstance.GetPool(), ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("business.ListAccessKeys TableAccessKeys.GetByOwner: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (business BusinessModule) DeleteAccessKey(ctx context.Context, ownerID uuid.UUID, keyID string) error {
+	key, err := business.GetAccessKey(ctx, keyID)
+	if err != nil {
+		return err
+	}
+
+	if key.OwnerID != ownerID {
+		return ErrNoPermission
+	}
+
+	err = storage.TableAccessKeys.DeleteByID(ctx, business.dbInstance.GetPool(), keyID)
+	if err != nil {
+		return fmt.Errorf("business.DeleteAccessKey TableAccessKeys.DeleteByID: %w", err)
+	}
+
+	return nil
+}
+
+func (business BusinessModule) ListBuckets(ctx context.Context, ownerID uuid.UUID) ([]model.Bucket, error) {
+	buckets, err := storage.TableBuckets.GetByOwner(ctx, business.dbInstance.GetPool(), ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("business.ListBuckets TableBuckets.GetByOwner: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// getOwnedBucket fetches the bucket and checks that the requester owns it.
+func (business BusinessModule) getOwnedBucket(ctx context.Context, bucketName string, requesterID uuid.UUID,
+) (*model.Bucket, error) {
+	bucketInfo, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), bucketName)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrNoBucket
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.TableBuckets.GetByName: %w", err)
+	}
+
+	if bucketInfo.OwnerID != requesterID {
+		return nil, ErrNoPermission
+	}
+
+	return bucketInfo, nil
+}
+
+func (business BusinessModule) HeadBucket(ctx context.Context, requesterID uuid.UUID, bucketName string) error {
+	_, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+
+	return err
+}
+
+// getObject returns the latest file stored under the key.
+func (business BusinessModule) getObject(ctx context.Context, bucketID int64, key string) (*model.File, error) {
+	files, err := storage.TableFiles.GetByFilename(ctx, business.dbInstance.GetPool(), bucketID, key)
+	if err != nil {
+		return nil, fmt.Errorf("business.TableFiles.GetByFilename: %w", err)
+	}
+
+	if len(files) == 0 || files[0].DeleteMarker {
+		return nil, ErrNoObject
+	}
+
+	return &files[0], nil
+}
+
+// PutObject stores the object under the key, replacing the previous objects with the same key.
+func (business BusinessModule) PutObject(ctx context.Context, request model.UploadFileRequest) (*model.File, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, request.BucketName, request.RequesterUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := business.uploadFile(ctx, bucketInfo, request)
+	if err != nil {
+		return nil, err
+	}
+
+	err = business.deleteOtherObjects(ctx, bucketInfo, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// deleteOtherObjects removes the files with the same key but the kept one.
+// A versioned bucket keeps them as the previous versions.
+func (business BusinessModule) deleteOtherObjects(ctx context.Context, bucketInfo *model.Bucket, kept *model.File,
+) error {
+	if bucketInfo.Versioning {
+		return nil
+	}
+
+	bucketID := bucketInfo.ID
+
+	files, err := storage.TableFiles.GetByFilename(ctx, business.dbInstance.GetPool(), bucketID, kept.Filename)
+	if err != nil {
+		return fmt.Errorf("business.TableFiles.GetByFilename: %w", err)
+	}
+
+	for _, file := range files {
+		if file.ID == kept.ID {
+			continue
+		}
+
+		err = business.deleteFile(ctx, bucketID, file.ID)
+		if err != nil && !errors.Is(err, database.ErrNoRows) {
+			return fmt.Errorf("business.deleteOtherObjects: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (business BusinessModule) FetchObject(ctx context.Context, request model.FetchObjectRequest) error {
+	bucketInfo, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), request.BucketName)
+	if errors.Is(err, database.ErrNoRows) {
+		return ErrNoBucket
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.TableBuckets.GetByName: %w", err)
+	}
+
+	fileInfo, err := business.resolveVersion(ctx, bucketInfo.ID, request.Key, request.VersionID)
+	if err != nil {
+		return err
+	}
+
+	if !mayRead(bucketInfo, fileInfo, request.RequestingUserID) {
+		return ErrNoPermission
+	}
+
+	file, err := business.openFile(fileInfo)
+	if err != nil {
+		return fmt.Errorf("business.FetchObject fileStorage.OpenFile: %w", err)
+	}
+
+	defer file.Close()
+
+	request.RespWriter.Header().Set("Content-Type", fileInfo.MIME)
+	request.RespWriter.Header().Set("ETag", fileInfo.ETag())
+
+	if bucketInfo.Versioning {
+		request.RespWriter.Header().Set("X-Amz-Version-Id", fileInfo.ID.String())
+	}
+
+	http.ServeContent(request.RespWriter, request.RawRequest, "", fileInfo.CreatedTS, file)
+
+	return nil
+}
+
+// DeleteObject removes every file stored under the key, to the trash if the bucket keeps one.
+// Missing keys are not an error.
+// A versioned bucket gets a delete marker instead, unless a version to remove for good is given.
+// The returned version is the marker or the removed version, nil for an unversioned delete.
+func (business BusinessModule) DeleteObject(ctx context.Context, requesterID uuid.UUID, bucketName, key string,
+	versionID *uuid.UUID,
+) (*model.File, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if versionID != nil {
+		version, versionErr := business.getObjectVersion(ctx, bucketInfo.ID, key, *versionID)
+		if errors.Is(versionErr, ErrNoObject) {
+			return nil, nil //nolint:nilnil // a missing version is not an error.
+		}
+
+		if versionErr != nil {
+			return nil, versionErr
+		}
+
+		err = business.deleteFile(ctx, bucketInfo.ID, version.ID)
+		if err != nil && !errors.Is(err, database.ErrNoRows) {
+			return nil, fmt.Errorf("business.DeleteObject: %w", err)
+		}
+
+		return version, nil
+	}
+
+	if bucketInfo.Versioning {
+		return business.putDeleteMarker(ctx, bucketInfo.ID, key)
+	}
+
+	files, err := storage.TableFiles.GetByFilename(ctx, business.dbInstance.GetPool(), bucketInfo.ID, key)
+	if err != nil {
+		return nil, fmt.Errorf("business.DeleteObject TableFiles.GetByFilename: %w", err)
+	}
+
+	for _, file := range files {
+		err = business.removeFile(ctx, bucketInfo, file.ID)
+		if err != nil && !errors.Is(err, database.ErrNoRows) {
+			return nil, fmt.Errorf("business.DeleteObject: %w", err)
+		}
+	}
+
+	return nil, nil //nolint:nilnil // no version is left behind.
+}
+
+// ListObjects lists the keys of the bucket in the S3 manner: in byte order, after StartAfter or from
+// the continuation token, with the keys containing the delimiter after the prefix rolled up into
+// the common prefixes. A StartAfter being a common prefix under the prefix skips the keys it rolls up.
+// The page is read by the keyset listing of the files, the latest file of a key standing for it
+// and the keys with a delete marker on top being hidden.
+func (business BusinessModule) ListObjects(ctx context.Context, request model.ListObjectsRequest,
+) (*model.ListObjectsResult, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, request.BucketName, request.RequesterUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.MaxKeys <= 0 || request.MaxKeys > defaultListObjectsMax {
+		request.MaxKeys = defaultListObjectsMax
+	}
+
+	query := model.FilesQuery{ //nolint:exhaustruct // no filters.
+		Prefix:     request.Prefix,
+		Sort:       model.FilesSortName,
+		BucketID:   bucketInfo.ID,
+		LatestOnly: true,
+	}
+
+	switch {
+	case request.ContinuationToken != "":
+		token, tokenErr := decodeFilesToken(request.ContinuationToken)
+		if tokenErr != nil || token.Sort != model.FilesSortName || token.Descending {
+			return nil, ErrBadRequest
+		}
+
+		query.After = &token.Cursor
+	case len(request.StartAfter) > len(request.Prefix) && strings.HasPrefix(request.StartAfter, request.Prefix) &&
+		commonPrefix(request.StartAfter, request.Prefix, request.Delimiter) == request.StartAfter:
+		// a common prefix returned before, as the marker of the v1 listing.
+		query.After = &model.FilesCursor{SkipPrefix: request.StartAfter} //nolint:exhaustruct // past the prefix.
+	case request.StartAfter != "":
+		query.After = &model.FilesCursor{ //nolint:exhaustruct // past every file of the key.
+			Filename: request.StartAfter,
+			Suffix:   math.MaxInt32,
+		}
+	}
+
+	page, err := business.listFilesPage(ctx, query, request.Delimiter, request.MaxKeys)
+	if err != nil {
+		return nil, fmt.Errorf("business.ListObjects: %w", err)
+	}
+
+	result := &model.ListObjectsResult{ //nolint:exhaustruct // filled below.
+		Objects:               page.Files,
+		CommonPrefixes:        page.CommonPrefixes,
+		NextContinuationToken: page.NextToken,
+		IsTruncated:           page.NextToken != "",
+	}
+
+	// the keys and the prefixes come in the byte order, the greater of the last ones being the last returned.
+	if result.IsTruncated {
+		if len(page.Files) > 0 {
+			result.NextStartAfter = page.Files[len(page.Files)-1].Filename
+		}
+
+		if len(page.CommonPrefixes) > 0 {
+			result.NextStartAfter = max(result.NextStartAfter, page.CommonPrefixes[len(page.CommonPrefixes)-1])
+		}
+	}
+
+	return result, nil
+}
+
+// CopyObject streams the source object into the destination key. The source has to be readable
+// by the requester, the destination bucket has to be owned by the requester.
+func (business BusinessModule) CopyObject(ctx context.Context, request model.CopyObjectRequest,
+) (*model.File, error) {
+	srcBucket, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), request.SrcBucketName)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrNoBucket
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.CopyObject TableBuckets.GetByName: %w", err)
+	}
+
+	srcFile, err := business.getObject(ctx, srcBucket.ID, request.SrcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if !mayRead(srcBucket, srcFile, &request.RequesterUUID) {
+		return nil, ErrNoPermission
+	}
+
+	dstBucket, err := business.getOwnedBucket(ctx, request.DstBucketName, request.RequesterUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := business.copyFile(ctx, srcFile, dstBucket, model.File{ //nolint:exhaustruct // filled by copyFile.
+		Filename: request.DstKey,
+		MIME:     srcFile.MIME,
+		Access:   model.FileAccessPrivate,
+		Metadata: srcFile.Metadata,
+		Tags:     srcFile.Tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = business.deleteOtherObjects(ctx, dstBucket, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
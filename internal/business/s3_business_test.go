@@ -0,0 +1,98 @@
+package business_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eldarbr/go-s3/internal/business"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/files"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListObjectsIntegration(t *testing.T) {
+	businessModule := newTestBusiness(t, files.NewMemoryContainer())
+	ctx := context.Background()
+	ownerID := uuid.New()
+
+	bucket := &model.Bucket{
+		Name:         "test-list-objects",
+		Availability: model.BucketAvailabilityAccessible,
+		OwnerID:      ownerID,
+	}
+	require.NoError(t, storage.TableBuckets.Add(ctx, testDB.GetPool(), bucket))
+
+	for _, key := range []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", "a/f/g.txt", "a/h.txt", "b.txt"} {
+		require.NoError(t, storage.TableFiles.InsertID(ctx, testDB.GetPool(), &model.File{
+			ID:       uuid.New(),
+			Filename: key,
+			BucketID: bucket.ID,
+			Access:   model.FileAccessPrivate,
+		}))
+	}
+
+	list := func(request model.ListObjectsRequest) ([]string, *model.ListObjectsResult) {
+		request.BucketName = bucket.Name
+		request.RequesterUUID = ownerID
+
+		result, err := businessModule.ListObjects(ctx, request)
+		require.NoError(t, err)
+
+		listed := result.CommonPrefixes
+		for _, file := range result.Objects {
+			listed = append(listed, file.Filename)
+		}
+
+		return listed, result
+	}
+
+	// the start after a key before the prefix, or equal to it, lists it all.
+	listed, _ := list(model.ListObjectsRequest{Prefix: "a/b/", Delimiter: "/", StartAfter: "a/"})
+	assert.Equal(t, []string{"a/b/c.txt", "a/b/d.txt"}, listed)
+
+	listed, _ = list(model.ListObjectsRequest{Prefix: "a/", Delimiter: "/", StartAfter: "a/"})
+	assert.ElementsMatch(t, []string{"a/b/", "a/f/", "a/e.txt", "a/h.txt"}, listed)
+
+	// the start after a common prefix skips its keys.
+	listed, _ = list(model.ListObjectsRequest{Prefix: "a/", Delimiter: "/", StartAfter: "a/b/"})
+	assert.ElementsMatch(t, []string{"a/f/", "a/e.txt", "a/h.txt"}, listed)
+
+	listed, _ = list(model.ListObjectsRequest{Prefix: "a/", StartAfter: "a/b/"})
+	assert.Equal(t, []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", "a/f/g.txt", "a/h.txt"}, listed)
+
+	// the pages by the continuation token and by the marker.
+	for _, byToken := range []bool{true, false} {
+		request := model.ListObjectsRequest{Prefix: "a/", Delimiter: "/", MaxKeys: 1} //nolint:exhaustruct // no start.
+
+		var pages []string
+
+		for {
+			listed, result := list(request)
+			require.Len(t, listed, 1)
+
+			pages = append(pages, listed[0])
+
+			if !result.IsTruncated {
+				break
+			}
+
+			request.StartAfter = result.NextStartAfter
+			if byToken {
+				request.StartAfter = "z"
+				request.ContinuationToken = result.NextContinuationToken
+			}
+		}
+
+		assert.Equal(t, []string{"a/b/", "a/e.txt", "a/f/", "a/h.txt"}, pages)
+	}
+
+	_, err := businessModule.ListObjects(ctx, model.ListObjectsRequest{ //nolint:exhaustruct // a bad token.
+		BucketName:        bucket.Name,
+		ContinuationToken: "not a token",
+		RequesterUUID:     ownerID,
+	})
+	require.ErrorIs(t, err, business.ErrBadRequest)
+}
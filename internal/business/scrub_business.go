@@ -0,0 +1,373 @@
+package business
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/files"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+// The scrubber metrics, published as the "scrubber" expvar map: the blobs and the bytes checked
+// since the start, and the corrupt blobs known after the last pass.
+//
+//nolint:gochecknoglobals // expvar is global.
+var (
+	scrubBlobsChecked = new(expvar.Int)
+	scrubBytesRead    = new(expvar.Int)
+	scrubCorruptBlobs = new(expvar.Int)
+	scrubLastPass     = new(expvar.String)
+)
+
+//nolint:gochecknoinits // the metrics are registered once.
+func init() {
+	metrics := expvar.NewMap("scrubber")
+	metrics.Set("blobsChecked", scrubBlobsChecked)
+	metrics.Set("bytesRead", scrubBytesRead)
+	metrics.Set("corruptBlobs", scrubCorruptBlobs)
+	metrics.Set("lastPassTs", scrubLastPass)
+}
+
+// scrubThrottle paces the reads of a pass to the rate in bytes per second, 0 meaning no limit.
+type scrubThrottle struct {
+	start time.Time
+	rate  int64
+	read  int64
+}
+
+func (throttle *scrubThrottle) wait(ctx context.Context, read int) error {
+	throttle.read += int64(read)
+
+	if throttle.rate <= 0 {
+		return nil
+	}
+
+	due := throttle.start.Add(time.Duration(float64(throttle.read) / float64(throttle.rate) * float64(time.Second)))
+
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck // the context error as is.
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledReader reads through the throttle.
+type throttledReader struct {
+	ctx      context.Context //nolint:containedctx // scoped to a single read of a blob.
+	src      io.Reader
+	throttle *scrubThrottle
+}
+
+func (reader throttledReader) Read(dst []byte) (int, error) {
+	read, err := reader.src.Read(dst)
+	scrubBytesRead.Add(int64(read))
+
+	waitErr := reader.throttle.wait(reader.ctx, read)
+	if err == nil {
+		err = waitErr
+	}
+
+	return read, err //nolint:wrapcheck // a proxy.
+}
+
+// scrubPass is the state of a single pass over the stored blobs.
+type scrubPass struct {
+	throttle *scrubThrottle
+	// known are the corruptions recorded before the pass, to be cleared if found intact.
+	known map[string]struct{}
+	found []model.BlobCorruption
+}
+
+// Scrub reads every stored file and deduplicated blob whose digest is known at most at bytesPerSecond,
+// 0 meaning no limit, and compares the content with the digest. The mismatching blobs, and the ones failing
+// to decode or decrypt, are recorded as corrupt, while the recorded ones found intact are cleared. After a complete
+// pass the corruptions of the blobs gone meanwhile are dropped. The missing blobs are left to the reconciler.
+// Returns the corruptions found by the pass.
+func (business BusinessModule) Scrub(ctx context.Context, bytesPerSecond int64) ([]model.BlobCorruption, error) {
+	pool := business.dbInstance.GetPool()
+	passStart := time.Now()
+
+	knownCorruptions, err := storage.TableBlobCorruptions.GetAll(ctx, pool)
+	if err != nil {
+		return nil, fmt.Errorf("business.Scrub TableBlobCorruptions.GetAll: %w", err)
+	}
+
+	pass := &scrubPass{
+		throttle: &scrubThrottle{start: passStart, rate: bytesPerSecond, read: 0},
+		known:    make(map[string]struct{}, len(knownCorruptions)),
+		found:    []model.BlobCorruption{},
+	}
+
+	for _, corruption := range knownCorruptions {
+		pass.known[corruptionKey(corruption.Folder, corruption.BlobID)] = struct{}{}
+	}
+
+	buckets, err := storage.TableBuckets.GetActive(ctx, pool)
+	if err != nil {
+		return nil, fmt.Errorf("business.Scrub TableBuckets.GetActive: %w", err)
+	}
+
+	var errs []error
+
+	for i := range buckets {
+		if ctx.Err() != nil {
+			break
+		}
+
+		err = business.scrubBucket(ctx, pass, buckets[i].ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bucket %d: %w", buckets[i].ID, err))
+		}
+	}
+
+	if ctx.Err() == nil {
+		err = business.scrubBlobs(ctx, pass)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deduplicated blobs: %w", err))
+		}
+	}
+
+	if ctx.Err() != nil {
+		return pass.found, errors.Join(append(errs, ctx.Err())...)
+	}
+
+	if len(errs) == 0 {
+		_, err = storage.TableBlobCorruptions.DeleteCheckedBefore(ctx, pool, passStart)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("business.Scrub TableBlobCorruptions.DeleteCheckedBefore: %w", err))
+		}
+	}
+
+	corruptions, err := storage.TableBlobCorruptions.GetAll(ctx, pool)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("business.Scrub TableBlobCorruptions.GetAll: %w", err))
+	} else {
+		scrubCorruptBlobs.Set(int64(len(corruptions)))
+	}
+
+	scrubLastPass.Set(time.Now().UTC().Format(time.RFC3339))
+
+	return pass.found, errors.Join(errs...)
+}
+
+// corruptionKey identifies the blob among the known corruptions.
+func corruptionKey(folder, blobID string) string {
+	return folder + "/" + blobID
+}
+
+// scrubBucket checks the blobs of the bucket folder that belong to the live and the trashed files.
+func (business BusinessModule) scrubBucket(ctx context.Context, pass *scrubPass, bucketID int64) error {
+	pool := business.dbInstance.GetPool()
+	bucketIDStr := strconv.FormatInt(bucketID, 10)
+
+	blobs, err := business.fileStorage.ListFolder(bucketIDStr)
+	if errors.Is(err, fs.ErrNotExist) { // the reconciler reports it.
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.scrubBucket fileStorage.ListFolder: %w", err)
+	}
+
+	liveFiles, err := storage.TableFiles.GetFilesOfABucket(ctx, pool, bucketID)
+	if err != nil {
+		return fmt.Errorf("business.scrubBucket TableFiles.GetFilesOfABucket: %w", err)
+	}
+
+	trashedFiles, err := storage.TableFiles.GetTrashOfABucket(ctx, pool, bucketID)
+	if err != nil {
+		return fmt.Errorf("business.scrubBucket TableFiles.GetTrashOfABucket: %w", err)
+	}
+
+	// the blobs without a file entry or a digest are the uploads and the parts, or the legacy files.
+	checked := make(map[string]*model.File, len(liveFiles)+len(trashedFiles))
+
+	storedFiles := slices.Concat(liveFiles, trashedFiles)
+	for i := range storedFiles {
+		if storedFiles[i].BlobSHA256 == "" && !storedFiles[i].DeleteMarker && storedFiles[i].SHA256 != "" {
+			checked[storedFiles[i].ID.String()] = &storedFiles[i]
+		}
+	}
+
+	var errs []error
+
+	for _, blob := range blobs {
+		if ctx.Err() != nil {
+			return ctx.Err() //nolint:wrapcheck // the context error as is.
+		}
+
+		file, ok := checked[blob.ID]
+		if !ok {
+			continue
+		}
+
+		err = business.scrubBlob(ctx, pass, &model.BlobCorruption{ //nolint:exhaustruct // set once recorded.
+			BucketID:       &bucketID,
+			Folder:         bucketIDStr,
+			BlobID:         blob.ID,
+			ExpectedSHA256: file.SHA256,
+		}, file.ContentEncoding)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("blob %s: %w", blob.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// scrubBlobs checks the deduplicated blobs against the digests they are named by.
+func (business BusinessModule) scrubBlobs(ctx context.Context, pass *scrubPass) error {
+	blobs, err := business.fileStorage.ListFolder(dedupFolder)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.scrubBlobs fileStorage.ListFolder: %w", err)
+	}
+
+	var errs []error
+
+	for _, blob := range blobs {
+		if ctx.Err() != nil {
+			return ctx.Err() //nolint:wrapcheck // the context error as is.
+		}
+
+		digest, encoding, _ := strings.Cut(blob.ID, ".")
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != 2*sha256.Size {
+			continue // not a blob, the reconciler reports it.
+		}
+
+		err = business.scrubBlob(ctx, pass, &model.BlobCorruption{ //nolint:exhaustruct // set once recorded.
+			Folder:         dedupFolder,
+			BlobID:         blob.ID,
+			ExpectedSHA256: digest,
+		}, encoding)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("blob %s: %w", blob.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// scrubBlob hashes the decoded content of the blob, recording the corruption if it doesn't match.
+func (business BusinessModule) scrubBlob(ctx context.Context, pass *scrubPass, corruption *model.BlobCorruption,
+	encoding string,
+) error {
+	pool := business.dbInstance.GetPool()
+
+	actual, err := business.hashBlob(ctx, pass.throttle, corruption.Folder, corruption.BlobID, encoding)
+	if errors.Is(err, fs.ErrNotExist) { // deleted meanwhile, or the reconciler reports it.
+		return nil
+	}
+
+	if errors.Is(err, files.ErrCorruptFrames) || errors.Is(err, files.ErrCorruptBlob) ||
+		errors.Is(err, files.ErrTooFewShards) || errors.Is(err, errUnknownEncoding) {
+		corruption.Detail = err.Error()
+	} else if err != nil {
+		return err
+	}
+
+	scrubBlobsChecked.Add(1)
+
+	if corruption.Detail == "" && actual == corruption.ExpectedSHA256 {
+		if _, ok := pass.known[corruptionKey(corruption.Folder, corruption.BlobID)]; !ok {
+			return nil
+		}
+
+		err = storage.TableBlobCorruptions.Clear(ctx, pool, corruption.Folder, corruption.BlobID)
+		if err != nil {
+			return fmt.Errorf("business.scrubBlob TableBlobCorruptions.Clear: %w", err)
+		}
+
+		return nil
+	}
+
+	corruption.ActualSHA256 = actual
+
+	err = storage.TableBlobCorruptions.Record(ctx, pool, corruption)
+	if err != nil {
+		return fmt.Errorf("business.scrubBlob TableBlobCorruptions.Record: %w", err)
+	}
+
+	pass.found = append(pass.found, *corruption)
+
+	return nil
+}
+
+// hashBlob returns the hex SHA-256 of the decoded content of the blob, reading it through the throttle.
+func (business BusinessModule) hashBlob(ctx context.Context, throttle *scrubThrottle, folder, blobID,
+	encoding string,
+) (string, error) {
+	stored, err := business.fileStorage.OpenFile(folder, blobID)
+	if err != nil {
+		return "", fmt.Errorf("business.hashBlob fileStorage.OpenFile: %w", err)
+	}
+
+	decoded, err := decodeStored(stored, encoding)
+	if err != nil {
+		return "", fmt.Errorf("business.hashBlob: %w", err)
+	}
+
+	defer decoded.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, throttledReader{ctx: ctx, src: decoded, throttle: throttle})
+	if err != nil {
+		return "", fmt.Errorf("business.hashBlob io.Copy: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// GetBlobCorruptions returns the corrupt blobs found by the scrubber and not cleared since.
+func (business BusinessModule) GetBlobCorruptions(ctx context.Context) ([]model.BlobCorruption, error) {
+	corruptions, err := storage.TableBlobCorruptions.GetAll(ctx, business.dbInstance.GetPool())
+	if err != nil {
+		return nil, fmt.Errorf("business.GetBlobCorruptions TableBlobCorruptions.GetAll: %w", err)
+	}
+
+	return corruptions, nil
+}
+
+// RunScrubber scrubs the stored blobs every period until the context is done, logging the corruptions found.
+func (business BusinessModule) RunScrubber(ctx context.Context, period time.Duration, bytesPerSecond int64) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		found, err := business.Scrub(ctx, bytesPerSecond)
+		if err != nil && ctx.Err() == nil {
+			log.Println("scrubber:", err.Error())
+		}
+
+		for _, corruption := range found {
+			log.Printf("scrubber: corrupt blob %s/%s, expected sha256 %s, got %q %s\n", corruption.Folder,
+				corruption.BlobID, corruption.ExpectedSHA256, corruption.ActualSHA256, corruption.Detail)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+// The numbers of the matches a search returns.
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// SearchFiles searches the files of all the buckets of the requester by the words of their filenames
+// and metadata values, the best matches first. The files must have the requested tags.
+// Without the words, the files having the tags are listed, the newest first.
+// A versioned bucket is searched in its latest versions only.
+func (business BusinessModule) SearchFiles(ctx context.Context, request model.SearchFilesRequest,
+) ([]model.FoundFile, error) {
+	if request.Limit == 0 {
+		request.Limit = defaultSearchLimit
+	}
+
+	if (strings.TrimSpace(request.Query) == "" && len(request.Tags) == 0) ||
+		request.Limit < 0 || request.Limit > maxSearchLimit {
+		return nil, ErrBadRequest
+	}
+
+	found, err := storage.TableFiles.Search(ctx, business.dbInstance.GetPool(), model.FilesSearch{
+		Query:   request.Query,
+		Tags:    request.Tags,
+		Limit:   request.Limit,
+		OwnerID: request.RequesterUUID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("business.SearchFiles storage.TableFiles.Search: %w", err)
+	}
+
+	for i := range found {
+		if !found[i].BucketVersioning {
+			found[i].Filename = suffixedFilename(&found[i].File)
+		}
+	}
+
+	return found, nil
+}
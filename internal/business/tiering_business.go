@@ -0,0 +1,121 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+)
+
+var ErrNotTiered = errors.New("the file storage has no cold tier")
+
+// demotePageSize is the number of the file entries or the blobs read at once by DemoteFiles.
+const demotePageSize = 1000
+
+// BlobDemoter is implemented by the file storages keeping the blobs in a hot and a cold tier.
+type BlobDemoter interface {
+	// Demote moves the blob from the hot tier to the cold one.
+	Demote(bucketID, fileID string) error
+}
+
+// DemoteFiles moves the content of the files and of the deduplicated blobs created before the time
+// to the cold tier. The blobs already there are skipped. The trash and the unfinished uploads stay
+// in the hot tier, until purged or restored and until completed. Returns the number of the blobs moved.
+func (business BusinessModule) DemoteFiles(ctx context.Context, createdBefore time.Time) (int, error) {
+	demoter, ok := business.fileStorage.(BlobDemoter)
+	if !ok {
+		return 0, ErrNotTiered
+	}
+
+	pool := business.dbInstance.GetPool()
+
+	buckets, err := storage.TableBuckets.GetActive(ctx, pool)
+	if err != nil {
+		return 0, fmt.Errorf("business.DemoteFiles TableBuckets.GetActive: %w", err)
+	}
+
+	var (
+		errs  []error
+		moved int
+	)
+
+	demote := func(folder, blobID string) {
+		err := demoter.Demote(folder, blobID)
+		if errors.Is(err, fs.ErrNotExist) { // already cold, or deleted meanwhile.
+			return
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("blob %s/%s: %w", folder, blobID, err))
+
+			return
+		}
+
+		moved++
+	}
+
+	for _, bucketInfo := range buckets {
+		bucketIDStr := strconv.FormatInt(bucketInfo.ID, 10)
+		query := model.FilesQuery{ //nolint:exhaustruct // no filters.
+			CreatedBefore: &createdBefore,
+			Sort:          model.FilesSortName,
+			BucketID:      bucketInfo.ID,
+			Limit:         demotePageSize,
+		}
+
+		for {
+			if ctx.Err() != nil {
+				return moved, errors.Join(append(errs, ctx.Err())...)
+			}
+
+			page, err := storage.TableFiles.GetPage(ctx, pool, query)
+			if err != nil {
+				return moved, fmt.Errorf("business.DemoteFiles TableFiles.GetPage: %w", err)
+			}
+
+			for _, file := range page {
+				if file.BlobSHA256 == "" {
+					demote(bucketIDStr, file.ID.String())
+				}
+			}
+
+			if len(page) < query.Limit {
+				break
+			}
+
+			last := page[len(page)-1]
+			query.After = &model.FilesCursor{ //nolint:exhaustruct // the name order.
+				Filename: last.Filename,
+				Suffix:   last.FilenameSuffix,
+			}
+		}
+	}
+
+	afterSHA256 := ""
+
+	for {
+		if ctx.Err() != nil {
+			return moved, errors.Join(append(errs, ctx.Err())...)
+		}
+
+		blobs, err := storage.TableBlobs.GetCreatedBefore(ctx, pool, createdBefore, afterSHA256, demotePageSize)
+		if err != nil {
+			return moved, fmt.Errorf("business.DemoteFiles TableBlobs.GetCreatedBefore: %w", err)
+		}
+
+		for _, blob := range blobs {
+			demote(dedupFolder, blob.SHA256)
+		}
+
+		if len(blobs) < demotePageSize {
+			return moved, errors.Join(errs...)
+		}
+
+		afterSHA256 = blobs[len(blobs)-1].SHA256
+	}
+}
@@ -0,0 +1,101 @@
+package business_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/business"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/files"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemoteFilesIntegration(t *testing.T) {
+	hot, cold := files.NewMemoryContainer(), files.NewMemoryContainer()
+	tiered := files.NewTieredContainer(hot, cold)
+	businessModule := newTestBusiness(t, tiered)
+	ctx := context.Background()
+
+	bucket := &model.Bucket{Name: "test-demote", Availability: model.BucketAvailabilityAccessible, OwnerID: uuid.New()}
+	require.NoError(t, storage.TableBuckets.Add(ctx, testDB.GetPool(), bucket))
+
+	folder := strconv.FormatInt(bucket.ID, 10)
+	require.NoError(t, tiered.CreateFolder(folder))
+	require.NoError(t, tiered.CreateFolder("dedup"))
+
+	const sha = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	_, err := storage.TableBlobs.Acquire(ctx, testDB.GetPool(), sha, 4)
+	require.NoError(t, err)
+
+	_, err = tiered.WriteFile("dedup", sha, strings.NewReader("data"))
+	require.NoError(t, err)
+
+	fileIDs := []string{}
+
+	for _, file := range []model.File{
+		{ID: uuid.New(), Filename: "a.txt"},
+		{ID: uuid.New(), Filename: "a.txt", FilenameSuffix: 1},
+		{ID: uuid.New(), Filename: "b.txt", BlobSHA256: sha},
+	} {
+		file.BucketID = bucket.ID
+		file.Access = model.FileAccessPrivate
+		require.NoError(t, storage.TableFiles.InsertID(ctx, testDB.GetPool(), &file))
+
+		if file.BlobSHA256 == "" {
+			_, err = tiered.WriteFile(folder, file.ID.String(), strings.NewReader("data"))
+			require.NoError(t, err)
+
+			fileIDs = append(fileIDs, file.ID.String())
+		}
+	}
+
+	// the blobs created after the time stay hot.
+	moved, err := businessModule.DemoteFiles(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+
+	moved, err = businessModule.DemoteFiles(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 3, moved)
+
+	for _, fileID := range fileIDs {
+		_, err = hot.OpenFile(folder, fileID)
+		require.ErrorIs(t, err, fs.ErrNotExist)
+		assert.Equal(t, "data", readBlob(t, cold, folder, fileID))
+	}
+
+	assert.Equal(t, "data", readBlob(t, cold, "dedup", sha))
+
+	// the cold blobs are skipped.
+	moved, err = businessModule.DemoteFiles(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+
+	hotOnly := business.NewBusinessModule(testDB, hot, business.Config{}) //nolint:exhaustruct // the defaults.
+
+	_, err = hotOnly.DemoteFiles(ctx, time.Now())
+	require.ErrorIs(t, err, business.ErrNotTiered)
+}
+
+func readBlob(t *testing.T, backend files.Backend, folder, blobID string) string {
+	t.Helper()
+
+	file, err := backend.OpenFile(folder, blobID)
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+
+	return string(content)
+}
@@ -0,0 +1,294 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+)
+
+// FileLinker is implemented by the file storages able to copy a blob without copying its content.
+// LinkFile fails with errors.ErrUnsupported if it can't link the blobs given, e.g. kept on different devices.
+type FileLinker interface {
+	LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error
+}
+
+// CopyFile copies the file to a bucket of the requester, the file being readable by the requester. The id of any
+// version of a versioned object stands for its latest version. The copy keeps the content, the access,
+// the metadata and the tags, and is added to the bucket the way an upload is.
+func (business BusinessModule) CopyFile(ctx context.Context, transfer model.FileTransfer) (*model.File, error) {
+	srcBucket, srcFile, err := business.getTransferSource(ctx, transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	if !mayRead(srcBucket, srcFile, &transfer.RequesterUUID) {
+		return nil, ErrNoPermission
+	}
+
+	dstBucket, err := business.getOwnedBucket(ctx, transfer.DstBucketName, transfer.RequesterUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := business.copyFile(ctx, srcFile, dstBucket, transferredFile(srcFile, transfer.DstKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if !dstBucket.Versioning {
+		file.Filename = suffixedFilename(file)
+	}
+
+	return file, nil
+}
+
+// MoveFile moves the file of a bucket of the requester to a bucket of the requester, or under another key.
+// The file is copied first and then deleted: hidden behind a delete marker in a versioned bucket, removed
+// for good otherwise, the trash being skipped as the content lives on in the copy. A move failing to delete
+// the file leaves both.
+func (business BusinessModule) MoveFile(ctx context.Context, transfer model.FileTransfer) (*model.File, error) {
+	srcBucket, srcFile, err := business.getTransferSource(ctx, transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	if srcBucket.OwnerID != transfer.RequesterUUID {
+		return nil, ErrNoPermission
+	}
+
+	dstBucket, err := business.getOwnedBucket(ctx, transfer.DstBucketName, transfer.RequesterUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	dstFile := transferredFile(srcFile, transfer.DstKey)
+
+	// the delete marker would hide the copy itself.
+	if dstBucket.ID == srcBucket.ID && dstFile.Filename == srcFile.Filename {
+		return nil, ErrBadRequest
+	}
+
+	file, err := business.copyFile(ctx, srcFile, dstBucket, dstFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if srcBucket.Versioning {
+		_, err = business.putDeleteMarker(ctx, srcBucket.ID, srcFile.Filename)
+	} else {
+		err = business.deleteFile(ctx, srcBucket.ID, srcFile.ID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.MoveFile couldn't delete the moved file %s: %w", srcFile.ID.String(), err)
+	}
+
+	if !dstBucket.Versioning {
+		file.Filename = suffixedFilename(file)
+	}
+
+	return file, nil
+}
+
+// getTransferSource returns the source bucket and the file to be copied, the latest version of a versioned object.
+func (business BusinessModule) getTransferSource(ctx context.Context, transfer model.FileTransfer,
+) (*model.Bucket, *model.File, error) {
+	bucketInfo, err := storage.TableBuckets.GetByName(ctx, business.dbInstance.GetPool(), transfer.SrcBucketName)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, nil, ErrNoBucket
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("business.getTransferSource TableBuckets.GetByName: %w", err)
+	}
+
+	fileInfo, err := storage.TableFiles.GetByID(ctx, business.dbInstance.GetPool(), transfer.FileID)
+	if errors.Is(err, database.ErrNoRows) || (err == nil && fileInfo.BucketID != bucketInfo.ID) {
+		return nil, nil, ErrNoObject
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("business.getTransferSource TableFiles.GetByID: %w", err)
+	}
+
+	if bucketInfo.Versioning {
+		fileInfo, err = business.getObject(ctx, bucketInfo.ID, fileInfo.Filename)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if fileInfo.DeleteMarker {
+		return nil, nil, ErrNoObject
+	}
+
+	return bucketInfo, fileInfo, nil
+}
+
+// transferredFile returns the entry of the copy of the file under the key, the key of the file if empty.
+func transferredFile(srcFile *model.File, key string) model.File {
+	if key == "" {
+		key = srcFile.Filename
+	}
+
+	return model.File{ //nolint:exhaustruct // the rest gets filled by copyFile.
+		Filename: key,
+		MIME:     srcFile.MIME,
+		Access:   srcFile.Access,
+		Metadata: srcFile.Metadata,
+		Tags:     srcFile.Tags,
+	}
+}
+
+// copyFile adds the copy of the content of the source file to the bucket, the entry taking the filename, the MIME,
+// the access and the attributes of dstFile. The content is copied as stored: a deduplicated one gets one more
+// reference, the one in the bucket folder gets linked by the file storage if it can, and streamed otherwise.
+// The permissions are checked by the caller.
+//
+//nolint:funlen,cyclop // the copy is staged, recorded and accounted in a single pass, as an upload is.
+func (business BusinessModule) copyFile(ctx context.Context, srcFile *model.File, dstBucket *model.Bucket,
+	dstFile model.File,
+) (*model.File, error) {
+	if !validKey(dstFile.Filename) {
+		return nil, ErrBadRequest
+	}
+
+	// the quota is enforced by the transaction below, the early check only saves the io.
+	if dstBucket.SizeQuota > 0 && dstBucket.BytesUsed+srcFile.SizeBytes > int64(dstBucket.SizeQuota) {
+		return nil, ErrQuotaExceeded
+	}
+
+	newFileUUID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("business.copyFile uuid.NewRandom: %w", err)
+	}
+
+	dstFile.ID = newFileUUID
+	dstFile.BucketID = dstBucket.ID
+	dstFile.SizeBytes = srcFile.SizeBytes
+	dstFile.StoredSizeBytes = srcFile.StoredSizeBytes
+	dstFile.ContentEncoding = srcFile.ContentEncoding
+	dstFile.MD5 = srcFile.MD5
+	dstFile.SHA256 = srcFile.SHA256
+	dstFile.BlobSHA256 = srcFile.BlobSHA256
+
+	dstFolder := strconv.FormatInt(dstBucket.ID, 10)
+	committed := false
+
+	if srcFile.BlobSHA256 == "" {
+		// a deduplicated copy leaves its staged content behind when the blob already exists.
+		defer func() {
+			if !committed || dstFile.BlobSHA256 != "" {
+				business.discardFile(dstFolder, dstFile.ID.String())
+			}
+		}()
+
+		err = business.copyContent(srcFile, dstFolder, dstFile.ID.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.copyFile begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	dstFile.FilenameSuffix, err = storage.TableFiles.PrepareNewFilenameSuffix(ctx, transaction, dstBucket.ID,
+		dstFile.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("business.copyFile TableFiles.PrepareNewFilenameSuffix: %w", err)
+	}
+
+	switch {
+	case srcFile.BlobSHA256 != "":
+		err = business.acquireBlob(ctx, transaction, srcFile.BlobSHA256, srcFile.StoredSizeBytes)
+	case srcFile.SHA256 != "":
+		err = business.dedupBlob(ctx, transaction, &dstFile)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.copyFile: %w", err)
+	}
+
+	err = storage.TableFiles.InsertID(ctx, transaction, &dstFile)
+	if err != nil {
+		return nil, fmt.Errorf("business.copyFile TableFiles.InsertID: %w", err)
+	}
+
+	_, err = storage.TableBuckets.AddBytesUsed(ctx, transaction, dstBucket.ID, dstFile.SizeBytes)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrQuotaExceeded
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.copyFile TableBuckets.AddBytesUsed: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.copyFile transaction.Commit: %w", err)
+	}
+
+	committed = true
+
+	return &dstFile, nil
+}
+
+// copyContent copies the content of the file from its bucket folder as stored, linking the blob if the file
+// storage can and streaming it otherwise.
+func (business BusinessModule) copyContent(srcFile *model.File, dstFolder, dstFileID string) error {
+	if linker, ok := business.fileStorage.(FileLinker); ok {
+		err := linker.LinkFile(strconv.FormatInt(srcFile.BucketID, 10), srcFile.ID.String(), dstFolder, dstFileID)
+		if err == nil {
+			return nil
+		}
+
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return fmt.Errorf("business.copyContent fileStorage.LinkFile: %w", err)
+		}
+	}
+
+	src, err := business.openStored(srcFile)
+	if err != nil {
+		return fmt.Errorf("business.copyContent fileStorage.OpenFile: %w", err)
+	}
+
+	defer src.Close()
+
+	_, err = business.fileStorage.WriteFile(dstFolder, dstFileID, src)
+	if err != nil {
+		return fmt.Errorf("business.copyContent fileStorage.WriteFile: %w", err)
+	}
+
+	return nil
+}
+
+// acquireBlob adds a reference to the deduplicated blob of a file being copied. Meant to run in the transaction
+// creating the copy, the blob row stays locked till its end.
+func (business BusinessModule) acquireBlob(ctx context.Context, querier database.Querier, sha256 string,
+	storedSizeBytes int64,
+) error {
+	_, err := storage.TableBlobs.Acquire(ctx, querier, sha256, storedSizeBytes)
+	if err != nil {
+		return fmt.Errorf("business.acquireBlob TableBlobs.Acquire: %w", err)
+	}
+
+	// the file copied may have been deleted meanwhile, its blob along with it.
+	missing, err := business.blobMissing(dedupFolder, sha256)
+	if err != nil {
+		return fmt.Errorf("business.acquireBlob: %w", err)
+	}
+
+	if missing {
+		return ErrNoObject
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+)
+
+const trashPurgeBatchSize = 100
+
+// SetTrashRetention sets how many days the deleted files of the bucket stay restorable, 0 turning the trash off.
+// The files already in the trash follow the new retention.
+func (business BusinessModule) SetTrashRetention(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	days int32,
+) error {
+	if days < 0 {
+		return ErrBadRequest
+	}
+
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return err
+	}
+
+	err = storage.TableBuckets.SetTrashRetention(ctx, business.dbInstance.GetPool(), bucketInfo.ID, days)
+	if err != nil {
+		return fmt.Errorf("business.SetTrashRetention TableBuckets.SetTrashRetention: %w", err)
+	}
+
+	return nil
+}
+
+func (business BusinessModule) ListTrash(ctx context.Context, requesterID uuid.UUID, bucketName string,
+) ([]model.File, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := storage.TableFiles.GetTrashOfABucket(ctx, business.dbInstance.GetPool(), bucketInfo.ID)
+	if err != nil {
+		return nil, fmt.Errorf("business.ListTrash TableFiles.GetTrashOfABucket: %w", err)
+	}
+
+	return files, nil
+}
+
+// getTrashedFile returns the file in the trash of the requester's bucket.
+func (business BusinessModule) getTrashedFile(ctx context.Context, querier database.Querier,
+	bucketInfo *model.Bucket, fileID uuid.UUID,
+) (*model.File, error) {
+	file, err := storage.TableFiles.GetTrashedByID(ctx, querier, fileID)
+	if errors.Is(err, database.ErrNoRows) || (err == nil && file.BucketID != bucketInfo.ID) {
+		return nil, ErrNoObject
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.TableFiles.GetTrashedByID: %w", err)
+	}
+
+	return file, nil
+}
+
+// RestoreFile takes the file out of the trash as the latest file under its name.
+func (business BusinessModule) RestoreFile(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	fileID uuid.UUID,
+) (*model.File, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreFile begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	file, err := business.getTrashedFile(ctx, transaction, bucketInfo, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	newSuffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, transaction, bucketInfo.ID,
+		file.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreFile TableFiles.PrepareNewFilenameSuffix: %w", err)
+	}
+
+	// a concurrent purge may have taken it.
+	err = storage.TableFiles.RestoreFromTrash(ctx, transaction, fileID, newSuffix)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrNoObject
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreFile TableFiles.RestoreFromTrash: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreFile transaction.Commit: %w", err)
+	}
+
+	file.FilenameSuffix = newSuffix
+	file.DeletedTS = nil
+
+	return file, nil
+}
+
+// PurgeFile removes the file from the trash for good.
+func (business BusinessModule) PurgeFile(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	fileID uuid.UUID,
+) error {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return err
+	}
+
+	return business.purgeFile(ctx, fileID, func(file *model.File) bool {
+		return file.BucketID != bucketInfo.ID
+	})
+}
+
+// purgeFile removes the trashed file for good, failing with ErrNoObject if the file isn't in the trash or
+// is to be kept there, as told by keep on the locked row. The file is taken out of the trash before its content
+// is removed, so a concurrent restore either comes first and the purge finds no file, or finds no file itself.
+func (business BusinessModule) purgeFile(ctx context.Context, fileID uuid.UUID,
+	keep func(file *model.File) bool,
+) error {
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("business.purgeFile begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	file, err := storage.TableFiles.LockTrashedByID(ctx, transaction, fileID)
+	if errors.Is(err, database.ErrNoRows) || (err == nil && keep(file)) {
+		return ErrNoObject
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.purgeFile TableFiles.LockTrashedByID: %w", err)
+	}
+
+	err = storage.TableFiles.MarkDeleted(ctx, transaction, fileID)
+	if err != nil {
+		return fmt.Errorf("business.purgeFile TableFiles.MarkDeleted: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("business.purgeFile transaction.Commit: %w", err)
+	}
+
+	return business.deleteMarkedFile(ctx, file.BucketID, fileID)
+}
+
+// removeFile deletes the file, moving it to the trash if the bucket keeps one.
+func (business BusinessModule) removeFile(ctx context.Context, bucketInfo *model.Bucket, fileID uuid.UUID) error {
+	if bucketInfo.TrashRetentionDays <= 0 {
+		return business.deleteFile(ctx, bucketInfo.ID, fileID)
+	}
+
+	err := storage.TableFiles.MoveToTrash(ctx, business.dbInstance.GetPool(), fileID)
+	if err != nil {
+		return fmt.Errorf("business.removeFile TableFiles.MoveToTrash: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeExpiredTrash removes the files kept in the trash beyond the retention of their bucket.
+func (business BusinessModule) PurgeExpiredTrash(ctx context.Context) error {
+	for {
+		files, err := storage.TableFiles.GetExpiredTrash(ctx, business.dbInstance.GetPool(), time.Now(),
+			trashPurgeBatchSize)
+		if err != nil {
+			return fmt.Errorf("business.PurgeExpiredTrash TableFiles.GetExpiredTrash: %w", err)
+		}
+
+		for _, file := range files {
+			// a file restored and deleted again since is kept.
+			err = business.purgeFile(ctx, file.ID, func(locked *model.File) bool {
+				return !locked.DeletedTS.Equal(*file.DeletedTS)
+			})
+			if err != nil && !errors.Is(err, ErrNoObject) {
+				return fmt.Errorf("business.PurgeExpiredTrash: %w", err)
+			}
+		}
+
+		if len(files) < trashPurgeBatchSize {
+			return nil
+		}
+	}
+}
+
+// RunTrashPurger purges the expired trash on start and then every period until ctx is done.
+func (business BusinessModule) RunTrashPurger(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		err := business.PurgeExpiredTrash(ctx)
+		if err != nil {
+			log.Println("trash purger:", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // the S3 clients expect MD5 ETags.
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultUploadExpiry    = 24 * time.Hour
+	uploadJanitorBatchSize = 100
+)
+
+func (business BusinessModule) uploadExpiry() time.Duration {
+	if business.conf.UploadExpiry <= 0 {
+		return DefaultUploadExpiry
+	}
+
+	return business.conf.UploadExpiry
+}
+
+// CreateUpload registers a resumable upload and creates its empty blob.
+// An empty upload is complete right away.
+func (business BusinessModule) CreateUpload(ctx context.Context, request model.CreateUploadRequest,
+) (*model.Upload, error) {
+	if request.Length < 0 || !validKey(request.Filename) {
+		return nil, ErrBadRequest
+	}
+
+	bucketInfo, err := business.getOwnedBucket(ctx, request.BucketName, request.RequesterUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucketInfo.SizeQuota > 0 && request.Length > int64(bucketInfo.SizeQuota)-bucketInfo.BytesUsed {
+		return nil, ErrQuotaExceeded
+	}
+
+	uploadID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateUpload uuid.NewRandom: %w", err)
+	}
+
+	upload := &model.Upload{ //nolint:exhaustruct // the timestamps are set below.
+		ID:        uploadID,
+		BucketID:  bucketInfo.ID,
+		Filename:  request.Filename,
+		MIME:      request.MIME,
+		Access:    request.Access,
+		Metadata:  request.Metadata,
+		Length:    request.Length,
+		ExpiresTS: time.Now().Add(business.uploadExpiry()),
+	}
+
+	if upload.Access == "" {
+		upload.Access = model.FileAccessPrivate
+	}
+
+	bucketIDStr := strconv.FormatInt(bucketInfo.ID, 10)
+	committed := false
+
+	_, err = business.fileStorage.WriteFile(bucketIDStr, uploadID.String(), bytes.NewReader(nil))
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateUpload fileStorage.WriteFile: %w", err)
+	}
+
+	defer func() {
+		if !committed {
+			business.discardFile(bucketIDStr, uploadID.String())
+		}
+	}()
+
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateUpload begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	err = storage.TableUploads.Add(ctx, transaction, upload)
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateUpload TableUploads.Add: %w", err)
+	}
+
+	var file *model.File
+
+	if upload.Length == 0 {
+		file, err = business.completeUpload(ctx, transaction, upload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.CreateUpload transaction.Commit: %w", err)
+	}
+
+	committed = true
+
+	business.discardDeduplicated(file)
+
+	return upload, nil
+}
+
+// GetUpload returns the upload if the requester owns its bucket.
+func (business BusinessModule) GetUpload(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	uploadID uuid.UUID,
+) (*model.Upload, error) {
+	upload, err := storage.TableUploads.GetByID(ctx, business.dbInstance.GetPool(), uploadID)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrNoObject
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.GetUpload TableUploads.GetByID: %w", err)
+	}
+
+	err = business.checkUploadOwner(ctx, upload, bucketName, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Offset < upload.Length && time.Now().After(upload.ExpiresTS) {
+		return nil, ErrUploadExpired
+	}
+
+	return upload, nil
+}
+
+// PatchUpload appends the content to the upload at the offset. The bytes that made it to the storage
+// are kept even if the content couldn't be read in full, so the client can resume from there.
+// The file entry is created along with the last chunk.
+func (business BusinessModule) PatchUpload(ctx context.Context, request model.PatchUploadRequest,
+) (*model.Upload, error) {
+	// the bytes received before the client went away are still to be recorded.
+	ctx = context.WithoutCancel(ctx)
+
+	// the row lock is held for the whole write, so the chunks of an upload can't interleave.
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.PatchUpload begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	upload, err := business.lockUpload(ctx, transaction, request.RequesterUUID, request.BucketName, request.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Offset != request.Offset {
+		return nil, ErrUploadOffset
+	}
+
+	if upload.Offset == upload.Length {
+		return upload, nil
+	}
+
+	if time.Now().After(upload.ExpiresTS) {
+		return nil, ErrUploadExpired
+	}
+
+	remaining := upload.Length - upload.Offset
+	if request.ContentLength > remaining {
+		return nil, ErrBadRequest
+	}
+
+	written, writeErr := business.fileStorage.AppendFile(strconv.FormatInt(upload.BucketID, 10), upload.ID.String(),
+		upload.Offset, io.LimitReader(request.Content, remaining))
+	if writeErr == nil && written == remaining {
+		var extra [1]byte
+
+		// the content doesn't fit the announced length.
+		if n, _ := request.Content.Read(extra[:]); n != 0 {
+			return nil, ErrBadRequest
+		}
+	}
+
+	upload.Offset += written
+	upload.ExpiresTS = time.Now().Add(business.uploadExpiry())
+
+	var file *model.File
+
+	if writeErr == nil && upload.Offset == upload.Length {
+		file, err = business.completeUpload(ctx, transaction, upload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = storage.TableUploads.UpdateOffset(ctx, transaction, upload.ID, upload.Offset, upload.ExpiresTS)
+	if err != nil {
+		return nil, fmt.Errorf("business.PatchUpload TableUploads.UpdateOffset: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.PatchUpload transaction.Commit: %w", err)
+	}
+
+	business.discardDeduplicated(file)
+
+	if writeErr != nil {
+		return upload, fmt.Errorf("business.PatchUpload fileStorage.AppendFile: %w", writeErr)
+	}
+
+	return upload, nil
+}
+
+// TerminateUpload drops an unfinished upload along with its content.
+func (business BusinessModule) TerminateUpload(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	uploadID uuid.UUID,
+) error {
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("business.TerminateUpload begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	upload, err := business.lockUpload(ctx, transaction, requesterID, bucketName, uploadID)
+	if err != nil {
+		return err
+	}
+
+	// the content belongs to the file now.
+	if upload.Offset == upload.Length {
+		return ErrBadRequest
+	}
+
+	err = business.dropUpload(ctx, transaction, upload)
+	if err != nil {
+		return err
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("business.TerminateUpload transaction.Commit: %w", err)
+	}
+
+	return nil
+}
+
+func (business BusinessModule) lockUpload(ctx context.Context, querier database.Querier, requesterID uuid.UUID,
+	bucketName string, uploadID uuid.UUID,
+) (*model.Upload, error) {
+	upload, err := storage.TableUploads.LockByID(ctx, querier, uploadID)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrNoObject
+	}
+
+	if errors.Is(err, storage.ErrRowLocked) {
+		return nil, ErrUploadLocked
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.lockUpload TableUploads.LockByID: %w", err)
+	}
+
+	err = business.checkUploadOwner(ctx, upload, bucketName, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func (business BusinessModule) checkUploadOwner(ctx context.Context, upload *model.Upload, bucketName string,
+	requesterID uuid.UUID,
+) error {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return err
+	}
+
+	if bucketInfo.ID != upload.BucketID {
+		return ErrNoObject
+	}
+
+	return nil
+}
+
+// completeUpload creates the file entry of a complete upload within the transaction.
+// The content is left uncompressed, as it's only complete with the last chunk.
+func (business BusinessModule) completeUpload(ctx context.Context, querier database.Querier,
+	upload *model.Upload,
+) (*model.File, error) {
+	newSuffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, querier, upload.BucketID,
+		upload.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("business.completeUpload TableFiles.PrepareNewFilenameSuffix: %w", err)
+	}
+
+	// the chunks may come from different requests, so the content is digested once it's complete.
+	md5Digest, sha256Digest, err := business.digestBlob(strconv.FormatInt(upload.BucketID, 10), upload.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	file := model.File{ //nolint:exhaustruct // created_ts is set by the db.
+		ID:              upload.ID,
+		BucketID:        upload.BucketID,
+		Filename:        upload.Filename,
+		MIME:            upload.MIME,
+		Access:          upload.Access,
+		SizeBytes:       upload.Length,
+		StoredSizeBytes: upload.Length,
+		FilenameSuffix:  newSuffix,
+		MD5:             md5Digest,
+		SHA256:          sha256Digest,
+	}
+
+	err = business.dedupBlob(ctx, querier, &file)
+	if err != nil {
+		return nil, fmt.Errorf("business.completeUpload: %w", err)
+	}
+
+	err = storage.TableFiles.InsertID(ctx, querier, &file)
+	if err != nil {
+		return nil, fmt.Errorf("business.completeUpload TableFiles.InsertID: %w", err)
+	}
+
+	_, err = storage.TableBuckets.AddBytesUsed(ctx, querier, upload.BucketID, upload.Length)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrQuotaExceeded
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.completeUpload TableBuckets.AddBytesUsed: %w", err)
+	}
+
+	return &file, nil
+}
+
+// discardDeduplicated removes what's left of the uploaded content once the file refers to a deduplicated blob.
+func (business BusinessModule) discardDeduplicated(file *model.File) {
+	if file != nil && file.BlobSHA256 != "" {
+		business.discardFile(strconv.FormatInt(file.BucketID, 10), file.ID.String())
+	}
+}
+
+// digestBlob returns the hex MD5 and SHA-256 of the stored content.
+func (business BusinessModule) digestBlob(bucketID, fileID string) (string, string, error) {
+	file, err := business.fileStorage.OpenFile(bucketID, fileID)
+	if err != nil {
+		return "", "", fmt.Errorf("business.digestBlob fileStorage.OpenFile: %w", err)
+	}
+
+	defer file.Close()
+
+	md5Hash := md5.New() //nolint:gosec // the S3 clients expect MD5 ETags.
+	sha256Hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), file)
+	if err != nil {
+		return "", "", fmt.Errorf("business.digestBlob io.Copy: %w", err)
+	}
+
+	return hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}
+
+// dropUpload deletes the partial content and the upload entry. The row is expected to be locked.
+func (business BusinessModule) dropUpload(ctx context.Context, querier database.Querier,
+	upload *model.Upload,
+) error {
+	err := business.fileStorage.DeleteFile(strconv.FormatInt(upload.BucketID, 10), upload.ID.String())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("business.dropUpload fileStorage.DeleteFile: %w", err)
+	}
+
+	err = storage.TableUploads.DeleteByID(ctx, querier, upload.ID)
+	if err != nil {
+		return fmt.Errorf("business.dropUpload TableUploads.DeleteByID: %w", err)
+	}
+
+	return nil
+}
+
+// expireUpload removes an expired upload entry, and its content unless the upload is complete.
+// An upload busy with a chunk is left for the next run.
+func (business BusinessModule) expireUpload(ctx context.Context, uploadID uuid.UUID, now time.Time) error {
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("business.expireUpload begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	upload, err := storage.TableUploads.LockByID(ctx, transaction, uploadID)
+	if errors.Is(err, storage.ErrRowLocked) || errors.Is(err, database.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.expireUpload TableUploads.LockByID: %w", err)
+	}
+
+	// refreshed by a chunk meanwhile.
+	if !upload.ExpiresTS.Before(now) {
+		return nil
+	}
+
+	if upload.Offset < upload.Length {
+		err = business.dropUpload(ctx, transaction, upload)
+	} else {
+		err = storage.TableUploads.DeleteByID(ctx, transaction, upload.ID)
+	}
+
+	if err != nil {
+		return fmt.Errorf("business.expireUpload: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("business.expireUpload transaction.Commit: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireUploads removes the expired uploads, along with the nonces of the expired presigned upload urls.
+func (business BusinessModule) ExpireUploads(ctx context.Context) error {
+	now := time.Now()
+
+	err := storage.TablePresignNonces.DeleteExpired(ctx, business.dbInstance.GetPool(), now)
+	if err != nil {
+		return fmt.Errorf("business.ExpireUploads TablePresignNonces.DeleteExpired: %w", err)
+	}
+
+	uploads, err := storage.TableUploads.GetExpired(ctx, business.dbInstance.GetPool(), now, uploadJanitorBatchSize)
+	if err != nil {
+		return fmt.Errorf("business.ExpireUploads TableUploads.GetExpired: %w", err)
+	}
+
+	var errs []error
+
+	for _, upload := range uploads {
+		err = business.expireUpload(ctx, upload.ID, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("upload %s: %w", upload.ID.String(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RunUploadJanitor removes the expired uploads every period until ctx is done.
+func (business BusinessModule) RunUploadJanitor(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		err := business.ExpireUploads(ctx)
+		if err != nil {
+			log.Println("upload janitor:", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
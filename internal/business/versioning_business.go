@@ -0,0 +1,240 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eldarbr/go-auth/pkg/database"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/provider/storage"
+	"github.com/google/uuid"
+)
+
+// SetBucketVersioning switches the versioning of the bucket. The versions kept while it was on stay
+// after it's switched off, but the next S3 overwrite of a key replaces all of them.
+func (business BusinessModule) SetBucketVersioning(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	enabled bool,
+) error {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return err
+	}
+
+	err = storage.TableBuckets.SetVersioning(ctx, business.dbInstance.GetPool(), bucketInfo.ID, enabled)
+	if err != nil {
+		return fmt.Errorf("business.SetBucketVersioning TableBuckets.SetVersioning: %w", err)
+	}
+
+	return nil
+}
+
+// versionsTokenSort binds the continuation tokens to the versions listing.
+const versionsTokenSort = "versions"
+
+// ListVersions lists a page of the versions of the objects of the bucket, by filename and the latest first.
+// An empty filename lists the versions of every object.
+func (business BusinessModule) ListVersions(ctx context.Context, request model.ListVersionsRequest,
+) (*model.ListVersionsResponse, error) {
+	if request.Limit == 0 {
+		request.Limit = defaultListFilesLimit
+	}
+
+	if request.Limit < 0 || request.Limit > maxListFilesLimit {
+		return nil, ErrBadRequest
+	}
+
+	bucketInfo, err := business.getOwnedBucket(ctx, request.BucketName, request.RequesterUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := model.VersionsQuery{
+		After:    nil,
+		Filename: request.Filename,
+		BucketID: bucketInfo.ID,
+		Limit:    request.Limit + 1,
+	}
+
+	if request.Token != "" {
+		token, tokenErr := decodeFilesToken(request.Token)
+		if tokenErr != nil || token.Sort != versionsTokenSort {
+			return nil, ErrBadRequest
+		}
+
+		query.After = &token.Cursor
+	}
+
+	versions, err := storage.TableFiles.GetVersionsPage(ctx, business.dbInstance.GetPool(), query)
+	if err != nil {
+		return nil, fmt.Errorf("business.ListVersions TableFiles.GetVersionsPage: %w", err)
+	}
+
+	response := &model.ListVersionsResponse{Versions: versions, NextToken: ""}
+
+	if len(versions) > request.Limit {
+		last := versions[request.Limit-1]
+		response.Versions = versions[:request.Limit]
+		response.NextToken = filesToken{
+			Cursor: model.FilesCursor{ //nolint:exhaustruct // the position by the filename and suffix.
+				Filename: last.Filename,
+				Suffix:   last.FilenameSuffix,
+			},
+			Sort:       versionsTokenSort,
+			Descending: false,
+		}.encode()
+	}
+
+	return response, nil
+}
+
+// RestoreVersion makes the version the latest one of its object, hiding the versions and the delete
+// markers put after it.
+func (business BusinessModule) RestoreVersion(ctx context.Context, requesterID uuid.UUID, bucketName string,
+	versionID uuid.UUID,
+) (*model.File, error) {
+	bucketInfo, err := business.getOwnedBucket(ctx, bucketName, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreVersion begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	version, err := storage.TableFiles.GetByID(ctx, transaction, versionID)
+	if errors.Is(err, database.ErrNoRows) || (err == nil && version.BucketID != bucketInfo.ID) {
+		return nil, ErrNoObject
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreVersion TableFiles.GetByID: %w", err)
+	}
+
+	if version.DeleteMarker {
+		return nil, ErrBadRequest
+	}
+
+	newSuffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, transaction, bucketInfo.ID,
+		version.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreVersion TableFiles.PrepareNewFilenameSuffix: %w", err)
+	}
+
+	version.FilenameSuffix = newSuffix
+
+	err = storage.TableFiles.UpdateByID(ctx, transaction, version)
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreVersion TableFiles.UpdateByID: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.RestoreVersion transaction.Commit: %w", err)
+	}
+
+	return version, nil
+}
+
+// getObjectVersion returns the version of the object stored under the key.
+func (business BusinessModule) getObjectVersion(ctx context.Context, bucketID int64, key string,
+	versionID uuid.UUID,
+) (*model.File, error) {
+	version, err := storage.TableFiles.GetByID(ctx, business.dbInstance.GetPool(), versionID)
+	if errors.Is(err, database.ErrNoRows) {
+		return nil, ErrNoObject
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("business.TableFiles.GetByID: %w", err)
+	}
+
+	if version.BucketID != bucketID || version.Filename != key {
+		return nil, ErrNoObject
+	}
+
+	return version, nil
+}
+
+// putDeleteMarker hides the object stored under the key behind a new version without content.
+func (business BusinessModule) putDeleteMarker(ctx context.Context, bucketID int64, key string,
+) (*model.File, error) {
+	markerID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("business.putDeleteMarker uuid.NewRandom: %w", err)
+	}
+
+	transaction, err := business.dbInstance.GetPool().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.putDeleteMarker begin transaction: %w", err)
+	}
+
+	defer transaction.Rollback(ctx) //nolint:errcheck // won't check
+
+	newSuffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, transaction, bucketID, key)
+	if err != nil {
+		return nil, fmt.Errorf("business.putDeleteMarker TableFiles.PrepareNewFilenameSuffix: %w", err)
+	}
+
+	marker := &model.File{ //nolint:exhaustruct // the rest gets filled by the storage.
+		ID:             markerID,
+		Filename:       key,
+		Access:         model.FileAccessPrivate,
+		BucketID:       bucketID,
+		FilenameSuffix: newSuffix,
+		DeleteMarker:   true,
+	}
+
+	err = storage.TableFiles.InsertID(ctx, transaction, marker)
+	if err != nil {
+		return nil, fmt.Errorf("business.putDeleteMarker TableFiles.InsertID: %w", err)
+	}
+
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("business.putDeleteMarker transaction.Commit: %w", err)
+	}
+
+	return marker, nil
+}
+
+// latestVersions keeps the latest version of every object of the files ordered by filename and suffix,
+// the objects hidden by a delete marker are left out.
+func latestVersions(files []model.File) []model.File {
+	latest := files[:0]
+
+	for fileIdx, file := range files {
+		if fileIdx+1 < len(files) && files[fileIdx+1].Filename == file.Filename {
+			continue
+		}
+
+		if !file.DeleteMarker {
+			latest = append(latest, file)
+		}
+	}
+
+	return latest
+}
+
+// resolveVersion returns the requested version of the object, the latest one by default.
+func (business BusinessModule) resolveVersion(ctx context.Context, bucketID int64, key string,
+	versionID *uuid.UUID,
+) (*model.File, error) {
+	if versionID == nil {
+		return business.getObject(ctx, bucketID, key)
+	}
+
+	version, err := business.getObjectVersion(ctx, bucketID, key, *versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if version.DeleteMarker {
+		return nil, ErrNoObject
+	}
+
+	return version, nil
+}
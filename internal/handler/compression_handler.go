@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (apiHandler APIHandler) SetBucketCompression(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request SetBucketCompression received")
+
+	var compressionRequest model.SetBucketCompressionRequest
+
+	err := json.NewDecoder(request.Body).Decode(&compressionRequest)
+	if err != nil || compressionRequest.Compression == nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	err = apiHandler.business.SetBucketCompression(request.Context(), currentUser.UserID, params.ByName("bucketName"),
+		*compressionRequest.Compression)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
@@ -6,10 +6,19 @@ import (
 	"errors"
 	"io"
 	"log"
+	"maps"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/eldarbr/go-s3/internal/auth"
 	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/myerrors"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 )
@@ -20,15 +29,68 @@ type CacheImpl interface {
 
 type BusinessModule interface {
 	CreateBucket(ctx context.Context, bucket *model.Bucket) error
-	ListFiles(ctx context.Context, requesterUUID uuid.UUID, bucketName string) ([]model.File, error)
+	DeleteBucket(ctx context.Context, requesterID uuid.UUID, bucketName string, force bool) error
+	ListBucketsUsage(ctx context.Context, requesterID uuid.UUID) ([]model.BucketUsage, error)
+	SetBucketQuota(ctx context.Context, bucketName string, sizeQuota float64) error
+	ListFiles(ctx context.Context, request model.ListFilesRequest) (*model.ListFilesResponse, error)
+	MovePrefix(ctx context.Context, requesterID uuid.UUID, bucketName, from, to string) (int64, error)
+	SearchFiles(ctx context.Context, request model.SearchFilesRequest) ([]model.FoundFile, error)
+	CopyFile(ctx context.Context, transfer model.FileTransfer) (*model.File, error)
+	MoveFile(ctx context.Context, transfer model.FileTransfer) (*model.File, error)
 	UploadFile(ctx context.Context, request model.UploadFileRequest) (*uuid.UUID, error)
 	FetchFile(ctx context.Context, request model.FetchFileRequest) error
-	EditFile(ctx context.Context, request model.File, bucketName string, requesterID uuid.UUID) error
-	DeleteFile(ctx context.Context, fileID uuid.UUID, bucketName string, requesterID uuid.UUID) error
+	EditFile(ctx context.Context, fileID uuid.UUID, request model.EditFileRequest, bucketName string,
+		requesterID uuid.UUID) error
+	DeleteFile(ctx context.Context, fileID uuid.UUID, versionID *uuid.UUID, bucketName string,
+		requesterID uuid.UUID) error
+
+	SetBucketVersioning(ctx context.Context, requesterID uuid.UUID, bucketName string, enabled bool) error
+	ListVersions(ctx context.Context, request model.ListVersionsRequest) (*model.ListVersionsResponse, error)
+	RestoreVersion(ctx context.Context, requesterID uuid.UUID, bucketName string, versionID uuid.UUID,
+	) (*model.File, error)
+
+	SetBucketCompression(ctx context.Context, requesterID uuid.UUID, bucketName string, compression string) error
+
+	SetTrashRetention(ctx context.Context, requesterID uuid.UUID, bucketName string, days int32) error
+
+	GetBlobCorruptions(ctx context.Context) ([]model.BlobCorruption, error)
+	ListTrash(ctx context.Context, requesterID uuid.UUID, bucketName string) ([]model.File, error)
+	RestoreFile(ctx context.Context, requesterID uuid.UUID, bucketName string, fileID uuid.UUID) (*model.File, error)
+	PurgeFile(ctx context.Context, requesterID uuid.UUID, bucketName string, fileID uuid.UUID) error
+
+	CreateUpload(ctx context.Context, request model.CreateUploadRequest) (*model.Upload, error)
+	GetUpload(ctx context.Context, requesterID uuid.UUID, bucketName string, uploadID uuid.UUID) (*model.Upload, error)
+	PatchUpload(ctx context.Context, request model.PatchUploadRequest) (*model.Upload, error)
+	TerminateUpload(ctx context.Context, requesterID uuid.UUID, bucketName string, uploadID uuid.UUID) error
+
+	CreateAccessKey(ctx context.Context, ownerID uuid.UUID) (*model.AccessKey, error)
+	GetAccessKey(ctx context.Context, keyID string) (*model.AccessKey, error)
+	ListAccessKeys(ctx context.Context, ownerID uuid.UUID) ([]model.AccessKey, error)
+	DeleteAccessKey(ctx context.Context, ownerID uuid.UUID, keyID string) error
+
+	ListBuckets(ctx context.Context, ownerID uuid.UUID) ([]model.Bucket, error)
+	HeadBucket(ctx context.Context, requesterID uuid.UUID, bucketName string) error
+	ListObjects(ctx context.Context, request model.ListObjectsRequest) (*model.ListObjectsResult, error)
+	PutObject(ctx context.Context, request model.UploadFileRequest) (*model.File, error)
+	FetchObject(ctx context.Context, request model.FetchObjectRequest) error
+	DeleteObject(ctx context.Context, requesterID uuid.UUID, bucketName, key string, versionID *uuid.UUID,
+	) (*model.File, error)
+	CopyObject(ctx context.Context, request model.CopyObjectRequest) (*model.File, error)
+
+	CreateMultipartUpload(ctx context.Context, request model.CreateMultipartUploadRequest,
+	) (*model.MultipartUpload, error)
+	UploadPart(ctx context.Context, request model.UploadPartRequest) (*model.MultipartPart, error)
+	ListParts(ctx context.Context, requesterID uuid.UUID, bucketName, key string, uploadID uuid.UUID,
+	) ([]model.MultipartPart, error)
+	CompleteMultipartUpload(ctx context.Context, request model.CompleteMultipartUploadRequest) (*model.File, error)
+	AbortMultipartUpload(ctx context.Context, requesterID uuid.UUID, bucketName, key string, uploadID uuid.UUID) error
+
+	AuthorizePresign(ctx context.Context, scope model.PresignScope) error
 }
 
 type APIHandler struct {
 	jwtService *auth.JWTService
+	urlSigner  *auth.URLSigner
 	cache      CacheImpl
 	business   BusinessModule
 	reqLimit   int
@@ -59,9 +121,12 @@ func writeJSONResponse(responseWriter http.ResponseWriter, response any, code in
 	responseWriter.Write(resp) //nolint:errcheck // won't check.
 }
 
-func NewAPIHandler(business BusinessModule, jwtService *auth.JWTService, cache CacheImpl, limit int) APIHandler {
+func NewAPIHandler(business BusinessModule, jwtService *auth.JWTService, urlSigner *auth.URLSigner, cache CacheImpl,
+	limit int,
+) APIHandler {
 	srv := APIHandler{
 		jwtService: jwtService,
+		urlSigner:  urlSigner,
 		cache:      cache,
 		reqLimit:   limit,
 		business:   business,
@@ -226,6 +291,96 @@ func (apiHandler APIHandler) CreateBucket(respWriter http.ResponseWriter, rawReq
 	}, http.StatusOK)
 }
 
+func (apiHandler APIHandler) ListBuckets(respWriter http.ResponseWriter, request *http.Request, _ httprouter.Params,
+) {
+	log.Printf("request ListBuckets received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	buckets, err := apiHandler.business.ListBucketsUsage(request.Context(), currentUser.UserID)
+	if err != nil {
+		log.Println("Couldn't list the buckets", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	if buckets == nil {
+		buckets = []model.BucketUsage{}
+	}
+
+	writeJSONResponse(respWriter, model.ListBucketsResponse{Buckets: buckets}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) SetBucketQuota(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request SetBucketQuota received")
+
+	var quotaRequest model.SetBucketQuotaRequest
+
+	err := json.NewDecoder(request.Body).Decode(&quotaRequest)
+	if err != nil || quotaRequest.SizeQuota == nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	err = apiHandler.business.SetBucketQuota(request.Context(), params.ByName("bucketName"), *quotaRequest.SizeQuota)
+	if errors.Is(err, myerrors.ErrNoBucket) {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "not found"}, http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		log.Println("Couldn't set the bucket quota: ", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) DeleteBucket(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request DeleteBucket received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	force := request.URL.Query().Get("force") == "true"
+
+	err := apiHandler.business.DeleteBucket(request.Context(), currentUser.UserID, params.ByName("bucketName"), force)
+	if errors.Is(err, myerrors.ErrBucketNotEmpty) {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bucket is not empty"}, http.StatusConflict)
+
+		return
+	}
+
+	if err != nil {
+		log.Println("Couldn't delete the bucket: ", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
+
 func (apiHandler APIHandler) UploadFile(respWriter http.ResponseWriter, rawRequest *http.Request,
 	params httprouter.Params,
 ) {
@@ -247,8 +402,12 @@ func (apiHandler APIHandler) UploadFile(respWriter http.ResponseWriter, rawReque
 
 	bucketName := params.ByName("bucketName")
 	response := model.UploadFileResponse{Results: nil}
+	responseCode := http.StatusOK
+
+	// the metadata and the tags form fields apply to the files following them.
+	var formMetadata, formTags map[string]string
 
-	for {
+	for responseCode == http.StatusOK {
 		part, partErr := mpReader.NextPart()
 		if errors.Is(partErr, io.EOF) {
 			break
@@ -261,19 +420,53 @@ func (apiHandler APIHandler) UploadFile(respWriter http.ResponseWriter, rawReque
 			return
 		}
 
+		if field := part.FormName(); partFilename(part) == "" && (field == "metadata" || field == "tags") {
+			var attributes map[string]string
+
+			err = json.NewDecoder(part).Decode(&attributes)
+			if err != nil {
+				writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad " + field}, http.StatusBadRequest)
+
+				return
+			}
+
+			if field == "metadata" {
+				formMetadata = attributes
+			} else {
+				formTags = attributes
+			}
+
+			continue
+		}
+
+		metadata, tags, attributesOk := partAttributes(part.Header, formMetadata, formTags)
+		if !attributesOk {
+			writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad tags"}, http.StatusBadRequest)
+
+			return
+		}
+
 		newFileUUID, saveErr := apiHandler.business.UploadFile(rawRequest.Context(), model.UploadFileRequest{
 			FileContent:   part,
+			ContentMD5:    part.Header.Get("Content-MD5"),
 			RequesterUUID: currentUser.UserID,
 			BucketName:    bucketName,
 			File: model.File{
-				Filename: part.FileName(),
+				Filename: partFilename(part),
 				Access:   model.FileAccessPrivate,
 				MIME:     part.Header.Get("Content-Type"),
+				Metadata: metadata,
+				Tags:     tags,
 			},
 		})
 
 		newResult := model.UploadedFileInfo{
-			FileName: part.FileName(),
+			FileName: partFilename(part),
+		}
+
+		if errors.Is(saveErr, myerrors.ErrQuotaExceeded) {
+			// the rest of the parts wouldn't fit either.
+			responseCode = http.StatusInsufficientStorage
 		}
 
 		if saveErr != nil {
@@ -287,7 +480,52 @@ func (apiHandler APIHandler) UploadFile(respWriter http.ResponseWriter, rawReque
 		response.Results = append(response.Results, newResult)
 	}
 
-	writeJSONResponse(respWriter, response, http.StatusOK)
+	writeJSONResponse(respWriter, response, responseCode)
+}
+
+// partFilename returns the filename of the part as sent, the folders of the key kept, unlike part.FileName.
+func partFilename(part *multipart.Part) string {
+	_, dispositionParams, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+
+	return dispositionParams["filename"]
+}
+
+// partAttributes returns the metadata and the tags of a file part: the ones of the form fields, overridden by
+// the X-Meta-* headers and the X-Tags header of the part. The metadata keys are lowercased.
+func partAttributes(header textproto.MIMEHeader, formMetadata, formTags map[string]string,
+) (map[string]string, map[string]string, bool) {
+	metadata := maps.Clone(formMetadata)
+	tags := maps.Clone(formTags)
+
+	for name, values := range header {
+		if key, ok := strings.CutPrefix(name, model.MetadataHeaderPrefix); ok && len(values) != 0 {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+
+			metadata[strings.ToLower(key)] = values[0]
+		}
+	}
+
+	if rawTags := header.Get(model.TagsHeader); rawTags != "" {
+		headerTags, err := url.ParseQuery(rawTags)
+		if err != nil {
+			return nil, nil, false
+		}
+
+		if tags == nil {
+			tags = make(map[string]string, len(headerTags))
+		}
+
+		for key := range headerTags {
+			tags[key] = headerTags.Get(key)
+		}
+	}
+
+	return metadata, tags, true
 }
 
 func (apiHandler APIHandler) GetFile(respWriter http.ResponseWriter, rawRequest *http.Request,
@@ -307,7 +545,17 @@ func (apiHandler APIHandler) GetFile(respWriter http.ResponseWriter, rawRequest
 		}
 	}
 
-	if userToken != "" {
+	// a presigned url acts on behalf of its signer, for this very file only.
+	if auth.IsPresigned(rawRequest.URL.Query()) {
+		scope, err := apiHandler.urlSigner.Verify(http.MethodGet, rawRequest.URL.Path, rawRequest.URL.Query(), time.Now())
+		if err != nil {
+			writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusForbidden)
+
+			return
+		}
+
+		currentUserUUID = &scope.SignerID
+	} else if userToken != "" {
 		claims, err := apiHandler.jwtService.ValidateToken(userToken)
 		if err == nil {
 			uuid := claims.UserID
@@ -318,7 +566,9 @@ func (apiHandler APIHandler) GetFile(respWriter http.ResponseWriter, rawRequest
 	bucketName := params.ByName("bucketName")
 
 	fileID, idParseErr := uuid.Parse(params.ByName("fileID"))
-	if idParseErr != nil {
+	versionID, versionOk := parseVersionID(rawRequest.URL.Query())
+
+	if idParseErr != nil || !versionOk {
 		log.Println("bad uuid")
 		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
 
@@ -328,6 +578,7 @@ func (apiHandler APIHandler) GetFile(respWriter http.ResponseWriter, rawRequest
 	fetchReq := model.FetchFileRequest{
 		BucketName:       bucketName,
 		FileID:           fileID,
+		VersionID:        versionID,
 		RespWriter:       respWriter,
 		RequestingUserID: currentUserUUID,
 		RawRequest:       rawRequest,
@@ -355,7 +606,17 @@ func (apiHandler APIHandler) ListFiles(respWriter http.ResponseWriter, rawReques
 		return
 	}
 
-	files, err := apiHandler.business.ListFiles(rawRequest.Context(), currentUser.UserID, params.ByName("bucketName"))
+	listRequest, queryOk := parseListFilesQuery(rawRequest.URL.Query())
+	if !queryOk {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	listRequest.BucketName = params.ByName("bucketName")
+	listRequest.RequesterUUID = currentUser.UserID
+
+	response, err := apiHandler.business.ListFiles(rawRequest.Context(), listRequest)
 	if err != nil {
 		log.Println("Couldn't list files in the bucket", params.ByName("bucketName"), err.Error())
 		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
@@ -363,9 +624,73 @@ func (apiHandler APIHandler) ListFiles(respWriter http.ResponseWriter, rawReques
 		return
 	}
 
-	writeJSONResponse(respWriter, model.ListFilesResponse{
-		Files: files,
-	}, http.StatusOK)
+	writeJSONResponse(respWriter, response, http.StatusOK)
+}
+
+// parseListFilesQuery reads the page, the order and the filters of a files listing, the sizes being integers
+// and the timestamps RFC 3339 ones.
+func parseListFilesQuery(query url.Values) (model.ListFilesRequest, bool) {
+	request := model.ListFilesRequest{ //nolint:exhaustruct // the rest is parsed below.
+		Prefix:       query.Get("prefix"),
+		Delimiter:    query.Get("delimiter"),
+		Token:        query.Get("token"),
+		Sort:         query.Get("sort"),
+		MIME:         query.Get("mime"),
+		Access:       model.FileAccess(query.Get("access")),
+		NameContains: query.Get("contains"),
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		request.Descending = true
+	default:
+		return request, false
+	}
+
+	if query.Has("limit") {
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			return request, false
+		}
+
+		request.Limit = limit
+	}
+
+	var minOk, maxOk, afterOk, beforeOk bool
+
+	request.MinSize, minOk = parseSizeParam(query, "minSize")
+	request.MaxSize, maxOk = parseSizeParam(query, "maxSize")
+	request.CreatedAfter, afterOk = parseTimeParam(query, "createdAfter")
+	request.CreatedBefore, beforeOk = parseTimeParam(query, "createdBefore")
+
+	return request, minOk && maxOk && afterOk && beforeOk
+}
+
+func parseSizeParam(query url.Values, name string) (*int64, bool) {
+	if !query.Has(name) {
+		return nil, true
+	}
+
+	size, err := strconv.ParseInt(query.Get(name), 10, 64)
+	if err != nil || size < 0 {
+		return nil, false
+	}
+
+	return &size, true
+}
+
+func parseTimeParam(query url.Values, name string) (*time.Time, bool) {
+	if !query.Has(name) {
+		return nil, true
+	}
+
+	moment, err := time.Parse(time.RFC3339, query.Get(name))
+	if err != nil {
+		return nil, false
+	}
+
+	return &moment, true
 }
 
 func (apiHandler APIHandler) EditFile(respWriter http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -396,16 +721,8 @@ func (apiHandler APIHandler) EditFile(respWriter http.ResponseWriter, request *h
 		return
 	}
 
-	file := model.File{
-		ID:       fileID,
-		Filename: fileRequest.Filename,
-	}
-
-	if fileRequest.Access != nil {
-		file.Access = *fileRequest.Access
-	}
-
-	err = apiHandler.business.EditFile(request.Context(), file, params.ByName("bucketName"), currentUser.UserID)
+	err = apiHandler.business.EditFile(request.Context(), fileID, fileRequest, params.ByName("bucketName"),
+		currentUser.UserID)
 	if err != nil {
 		log.Println("Couldn't edit the file: ", err.Error())
 		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
@@ -429,13 +746,16 @@ func (apiHandler APIHandler) DeleteFile(respWriter http.ResponseWriter, request
 	}
 
 	fileID, idParseErr := uuid.Parse(params.ByName("fileID"))
-	if idParseErr != nil {
+	versionID, versionOk := parseVersionID(request.URL.Query())
+
+	if idParseErr != nil || !versionOk {
 		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
 
 		return
 	}
 
-	err := apiHandler.business.DeleteFile(request.Context(), fileID, params.ByName("bucketName"), currentUser.UserID)
+	err := apiHandler.business.DeleteFile(request.Context(), fileID, versionID, params.ByName("bucketName"),
+		currentUser.UserID)
 	if err != nil {
 		log.Println("Couldn't delete the file: ", err.Error())
 		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (apiHandler APIHandler) MovePrefix(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request MovePrefix received")
+
+	var moveRequest model.MovePrefixRequest
+
+	err := json.NewDecoder(request.Body).Decode(&moveRequest)
+	if err != nil || moveRequest.From == nil || moveRequest.To == nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	moved, err := apiHandler.business.MovePrefix(request.Context(), currentUser.UserID, params.ByName("bucketName"),
+		*moveRequest.From, *moveRequest.To)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.MovePrefixResponse{Moved: moved}, http.StatusOK)
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/myerrors"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	presignDefaultExpiresIn = 15 * time.Minute
+	presignMaxExpiresIn     = 7 * 24 * time.Hour
+)
+
+// PresignURL mints a url to download a file of the bucket or to upload a file to the bucket
+// without the token of the user.
+func (apiHandler APIHandler) PresignURL(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request PresignURL received")
+
+	var presignRequest model.PresignURLRequest
+
+	err := json.NewDecoder(request.Body).Decode(&presignRequest)
+	if err != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	expiresIn := time.Duration(presignRequest.ExpiresIn) * time.Second
+	if presignRequest.ExpiresIn == 0 {
+		expiresIn = presignDefaultExpiresIn
+	}
+
+	bucketName := params.ByName("bucketName")
+	scope := auth.PresignedURL{ //nolint:exhaustruct // the rest depends on the method.
+		ExpiresTS: time.Now().Add(expiresIn).Truncate(time.Second),
+		Method:    presignRequest.Method,
+		SignerID:  currentUser.UserID,
+	}
+
+	switch {
+	case expiresIn < 0 || expiresIn > presignMaxExpiresIn || presignRequest.MaxContentLength < 0:
+		scope.Method = ""
+	case presignRequest.Method == http.MethodGet && presignRequest.FileID != nil:
+		scope.Path = "/buckets/" + bucketName + "/" + presignRequest.FileID.String()
+	case presignRequest.Method == http.MethodPut && presignRequest.Filename != "":
+		scope.Path = "/buckets/" + bucketName
+		scope.Filename = presignRequest.Filename
+		scope.MaxContentLength = presignRequest.MaxContentLength
+		scope.Nonce, err = uuid.NewRandom()
+	default:
+		scope.Method = ""
+	}
+
+	if err != nil || scope.Method == "" {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	presignScope := model.PresignScope{
+		BucketName:    bucketName,
+		Method:        scope.Method,
+		RequesterUUID: currentUser.UserID,
+	}
+
+	if presignRequest.FileID != nil {
+		presignScope.FileID = *presignRequest.FileID
+	}
+
+	err = apiHandler.business.AuthorizePresign(request.Context(), presignScope)
+	if errors.Is(err, myerrors.ErrNoBucket) || errors.Is(err, myerrors.ErrNoObject) {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "not found"}, http.StatusNotFound)
+
+		return
+	}
+
+	if errors.Is(err, myerrors.ErrNoPermission) {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "forbidden"}, http.StatusForbidden)
+
+		return
+	}
+
+	if err != nil {
+		log.Println("Couldn't authorize the presigned url: ", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	signedURL, err := apiHandler.urlSigner.Sign(scope)
+	if err != nil {
+		log.Println("Couldn't sign the url: ", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.PresignURLResponse{
+		ExpiresTS: scope.ExpiresTS,
+		URL:       signedURL,
+	}, http.StatusOK)
+}
+
+// PresignedUploadFile stores the request body as a file, authorized by a presigned url.
+func (apiHandler APIHandler) PresignedUploadFile(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request PresignedUploadFile received")
+
+	scope, err := apiHandler.urlSigner.Verify(http.MethodPut, request.URL.Path, request.URL.Query(), time.Now())
+	if err != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusForbidden)
+
+		return
+	}
+
+	content := request.Body
+
+	if scope.MaxContentLength > 0 {
+		if request.ContentLength > scope.MaxContentLength {
+			writeJSONResponse(respWriter, model.ErrorResponse{Error: "content is too large"},
+				http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		content = http.MaxBytesReader(respWriter, request.Body, scope.MaxContentLength)
+	}
+
+	newFileUUID, err := apiHandler.business.UploadFile(request.Context(), model.UploadFileRequest{
+		FileContent:      content,
+		ContentMD5:       request.Header.Get("Content-MD5"),
+		ContentLength:    request.ContentLength,
+		RequesterUUID:    scope.SignerID,
+		BucketName:       params.ByName("bucketName"),
+		PresignNonce:     scope.Nonce,
+		PresignExpiresTS: scope.ExpiresTS,
+		File: model.File{ //nolint:exhaustruct // the rest gets filled in the business.
+			Filename: scope.Filename,
+			Access:   model.FileAccessPrivate,
+			MIME:     request.Header.Get("Content-Type"),
+		},
+	})
+
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case err == nil:
+	case errors.As(err, &maxBytesErr):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "content is too large"},
+			http.StatusRequestEntityTooLarge)
+
+		return
+	case errors.Is(err, myerrors.ErrBadDigest), errors.Is(err, myerrors.ErrBadRequest):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+
+		return
+	case errors.Is(err, myerrors.ErrPresignUsed):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusConflict)
+
+		return
+	case errors.Is(err, myerrors.ErrQuotaExceeded):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusInsufficientStorage)
+
+		return
+	case errors.Is(err, myerrors.ErrNoBucket), errors.Is(err, myerrors.ErrNoPermission):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "forbidden"}, http.StatusForbidden)
+
+		return
+	default:
+		log.Println("Couldn't upload the file: ", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.UploadFileResponse{
+		Results: []model.UploadedFileInfo{{
+			IDstr:    newFileUUID.String(),
+			FileName: scope.Filename,
+			Result:   model.UploadResultOk,
+		}},
+	}, http.StatusOK)
+}
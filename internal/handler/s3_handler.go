@@ -0,0 +1,717 @@
+package handler
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/myerrors"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	ctxKeyS3User ctxKey = "s3UserID"
+)
+
+const (
+	s3ACLPublicRead         = "public-read"
+	s3DefaultContentType    = "binary/octet-stream"
+	s3StorageClassStandard  = "STANDARD"
+	s3EncodingTypeURL       = "url"
+	s3ListTypeV2            = "2"
+	s3ErrAccessDenied       = "AccessDenied"
+	s3ErrInternal           = "InternalError"
+	s3ErrInvalidArgument    = "InvalidArgument"
+	s3ErrInvalidBucketName  = "InvalidBucketName"
+	s3ErrNoSuchBucket       = "NoSuchBucket"
+	s3ErrNoSuchKey          = "NoSuchKey"
+	s3ErrBucketExists       = "BucketAlreadyExists"
+	s3ErrBucketNotEmpty     = "BucketNotEmpty"
+	s3ErrQuotaExceeded      = "QuotaExceeded"
+	s3ErrInvalidAccessKeyID = "InvalidAccessKeyId"
+	s3ErrSignatureMismatch  = "SignatureDoesNotMatch"
+	s3ErrRequestExpired     = "RequestTimeTooSkewed"
+	s3ErrMethodNotAllowed   = "MethodNotAllowed"
+	s3ErrNotImplemented     = "NotImplemented"
+	s3ErrSlowDown           = "SlowDown"
+	s3ErrBadDigest          = "XAmzContentSHA256Mismatch"
+	s3ErrBadContentDigest   = "BadDigest"
+	s3ErrNoSuchUpload       = "NoSuchUpload"
+	s3ErrInvalidPart        = "InvalidPart"
+	s3ErrEntityTooSmall     = "EntityTooSmall"
+	s3ErrOperationAborted   = "OperationAborted"
+)
+
+func writeXMLResponse(respWriter http.ResponseWriter, response any, code int) {
+	resp, marshalErr := xml.Marshal(response)
+	if marshalErr != nil {
+		writeS3Error(respWriter, nil, s3ErrInternal, "response marshal error", http.StatusInternalServerError)
+
+		return
+	}
+
+	respWriter.Header().Set("Content-Type", "application/xml")
+	respWriter.WriteHeader(code)
+	respWriter.Write([]byte(xml.Header)) //nolint:errcheck // won't check.
+	respWriter.Write(resp)               //nolint:errcheck // won't check.
+}
+
+func writeS3Error(respWriter http.ResponseWriter, request *http.Request, code, message string, status int) {
+	s3Err := model.S3ErrorResponse{ //nolint:exhaustruct // the name is set by the tag.
+		Code:      code,
+		Message:   message,
+		RequestID: uuid.NewString(),
+	}
+
+	if request != nil {
+		s3Err.Resource = request.URL.Path
+	}
+
+	resp, _ := xml.Marshal(s3Err)
+
+	respWriter.Header().Set("Content-Type", "application/xml")
+	respWriter.WriteHeader(status)
+
+	// HEAD responses carry no body.
+	if request != nil && request.Method == http.MethodHead {
+		return
+	}
+
+	respWriter.Write([]byte(xml.Header)) //nolint:errcheck // won't check.
+	respWriter.Write(resp)               //nolint:errcheck // won't check.
+}
+
+// writeS3BusinessError maps the business errors to the S3 error codes.
+func writeS3BusinessError(respWriter http.ResponseWriter, request *http.Request, err error) {
+	switch {
+	case errors.Is(err, myerrors.ErrNoBucket):
+		writeS3Error(respWriter, request, s3ErrNoSuchBucket, err.Error(), http.StatusNotFound)
+	case errors.Is(err, myerrors.ErrNoObject):
+		writeS3Error(respWriter, request, s3ErrNoSuchKey, err.Error(), http.StatusNotFound)
+	case errors.Is(err, myerrors.ErrNoPermission):
+		writeS3Error(respWriter, request, s3ErrAccessDenied, err.Error(), http.StatusForbidden)
+	case errors.Is(err, myerrors.ErrBucketExists):
+		writeS3Error(respWriter, request, s3ErrBucketExists, err.Error(), http.StatusConflict)
+	case errors.Is(err, myerrors.ErrBucketNotEmpty):
+		writeS3Error(respWriter, request, s3ErrBucketNotEmpty, err.Error(), http.StatusConflict)
+	case errors.Is(err, myerrors.ErrQuotaExceeded):
+		// not a 5xx, the clients would retry.
+		writeS3Error(respWriter, request, s3ErrQuotaExceeded, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, myerrors.ErrNoUpload):
+		writeS3Error(respWriter, request, s3ErrNoSuchUpload, err.Error(), http.StatusNotFound)
+	case errors.Is(err, myerrors.ErrInvalidPart):
+		writeS3Error(respWriter, request, s3ErrInvalidPart, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, myerrors.ErrPartTooSmall):
+		writeS3Error(respWriter, request, s3ErrEntityTooSmall, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, myerrors.ErrBadDigest):
+		writeS3Error(respWriter, request, s3ErrBadContentDigest, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, myerrors.ErrUploadLocked):
+		writeS3Error(respWriter, request, s3ErrOperationAborted, err.Error(), http.StatusConflict)
+	case errors.Is(err, myerrors.ErrBadRequest):
+		writeS3Error(respWriter, request, s3ErrInvalidArgument, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, auth.ErrSigV4PayloadMismatch), errors.Is(err, auth.ErrSigV4ChunkSigMismatch),
+		errors.Is(err, auth.ErrSigV4ChunkMalformed):
+		writeS3Error(respWriter, request, s3ErrBadDigest, err.Error(), http.StatusBadRequest)
+	default:
+		log.Println("s3 request failed:", err.Error())
+		writeS3Error(respWriter, request, s3ErrInternal, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func (APIHandler) S3NotFound(w http.ResponseWriter, r *http.Request) {
+	writeS3Error(w, r, s3ErrNotImplemented, "not implemented", http.StatusNotImplemented)
+}
+
+func (APIHandler) S3MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeS3Error(w, r, s3ErrMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+// MiddlewareS3Authenticate verifies the SigV4 signature of the request and puts the key owner into
+// the context. Unsigned requests pass as anonymous.
+func (apiHandler APIHandler) MiddlewareS3Authenticate(next httprouter.Handle) httprouter.Handle {
+	return func(respWriter http.ResponseWriter, request *http.Request, routerParams httprouter.Params) {
+		if apiHandler.cache == nil {
+			log.Println("MiddlewareS3Authenticate uninitialized cache")
+			writeS3Error(respWriter, request, s3ErrInternal, "internal error", http.StatusInternalServerError)
+
+			return
+		}
+
+		if ip := request.Header.Get(defaultRateLimiterIPSourceHeader); ip != "" {
+			if apiHandler.cache.GetAndIncrease("ip:"+ip) > apiHandler.reqLimit {
+				writeS3Error(respWriter, request, s3ErrSlowDown, "rate limited", http.StatusServiceUnavailable)
+
+				return
+			}
+		}
+
+		sig, err := auth.ParseSigV4(request)
+		if errors.Is(err, auth.ErrSigV4Missing) {
+			next(respWriter, request.WithContext(context.WithValue(request.Context(), ctxKeyS3User, (*uuid.UUID)(nil))),
+				routerParams)
+
+			return
+		}
+
+		if err != nil {
+			writeS3Error(respWriter, request, s3ErrAccessDenied, err.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		key, err := apiHandler.business.GetAccessKey(request.Context(), sig.AccessKeyID)
+		if errors.Is(err, myerrors.ErrNoAccessKey) {
+			writeS3Error(respWriter, request, s3ErrInvalidAccessKeyID, err.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		if err != nil {
+			writeS3BusinessError(respWriter, request, err)
+
+			return
+		}
+
+		body, err := sig.Verify(request, key.Secret, time.Now())
+		if errors.Is(err, auth.ErrSigV4Expired) {
+			writeS3Error(respWriter, request, s3ErrRequestExpired, err.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		if err != nil {
+			writeS3Error(respWriter, request, s3ErrSignatureMismatch, err.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		if apiHandler.cache.GetAndIncrease("usr:"+key.OwnerID.String()) > apiHandler.reqLimit {
+			writeS3Error(respWriter, request, s3ErrSlowDown, "rate limited", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		request.Body = body
+		if length := auth.DecodedContentLength(request); length >= 0 {
+			request.ContentLength = length
+		}
+
+		ownerID := key.OwnerID
+
+		next(respWriter, request.WithContext(context.WithValue(request.Context(), ctxKeyS3User, &ownerID)),
+			routerParams)
+	}
+}
+
+// s3User returns the authenticated user, writing the error response if there's none.
+func s3User(respWriter http.ResponseWriter, request *http.Request) (uuid.UUID, bool) {
+	userID, _ := request.Context().Value(ctxKeyS3User).(*uuid.UUID)
+	if userID == nil {
+		writeS3Error(respWriter, request, s3ErrAccessDenied, "anonymous access is forbidden", http.StatusForbidden)
+
+		return uuid.Nil, false
+	}
+
+	return *userID, true
+}
+
+func s3ObjectKey(params httprouter.Params) string {
+	return strings.TrimPrefix(params.ByName("key"), "/")
+}
+
+func s3URLEncode(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "%2F", "/")
+}
+
+func (apiHandler APIHandler) S3ListBuckets(respWriter http.ResponseWriter, request *http.Request,
+	_ httprouter.Params,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	buckets, err := apiHandler.business.ListBuckets(request.Context(), userID)
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	response := model.S3ListAllMyBucketsResult{ //nolint:exhaustruct // the name is set by the tag.
+		Xmlns:   model.S3XMLNamespace,
+		Owner:   model.S3Owner{ID: userID.String(), DisplayName: userID.String()},
+		Buckets: make([]model.S3Bucket, 0, len(buckets)),
+	}
+
+	for _, bucket := range buckets {
+		response.Buckets = append(response.Buckets, model.S3Bucket{
+			Name:         bucket.Name,
+			CreationDate: bucket.CreatedTS.UTC(),
+		})
+	}
+
+	writeXMLResponse(respWriter, response, http.StatusOK)
+}
+
+func (apiHandler APIHandler) S3CreateBucket(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	bucketRequest := model.CreateBucketRequest{
+		Name:         params.ByName("bucket"),
+		Availability: model.BucketAvailabilityClosed,
+	}
+
+	if request.Header.Get("X-Amz-Acl") == s3ACLPublicRead {
+		bucketRequest.Availability = model.BucketAvailabilityAccessible
+	}
+
+	if !bucketRequest.Valid() {
+		writeS3Error(respWriter, request, s3ErrInvalidBucketName, "invalid bucket name", http.StatusBadRequest)
+
+		return
+	}
+
+	bucket := &model.Bucket{ //nolint:exhaustruct // the rest gets filled in the business.
+		Name:         bucketRequest.Name,
+		Availability: bucketRequest.Availability,
+		OwnerID:      userID,
+	}
+
+	err := apiHandler.business.CreateBucket(request.Context(), bucket)
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	respWriter.Header().Set("Location", "/"+bucket.Name)
+	respWriter.WriteHeader(http.StatusOK)
+}
+
+func (apiHandler APIHandler) S3HeadBucket(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	err := apiHandler.business.HeadBucket(request.Context(), userID, params.ByName("bucket"))
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusOK)
+}
+
+func (apiHandler APIHandler) S3DeleteBucket(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	err := apiHandler.business.DeleteBucket(request.Context(), userID, params.ByName("bucket"), false)
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+// S3ListObjects serves ListObjectsV2, ListObjects (v1) and GetBucketLocation.
+func (apiHandler APIHandler) S3ListObjects(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	query := request.URL.Query()
+	bucketName := params.ByName("bucket")
+
+	if query.Has("location") {
+		err := apiHandler.business.HeadBucket(request.Context(), userID, bucketName)
+		if err != nil {
+			writeS3BusinessError(respWriter, request, err)
+
+			return
+		}
+
+		writeXMLResponse(respWriter, model.S3LocationConstraint{ //nolint:exhaustruct // default region.
+			Xmlns: model.S3XMLNamespace,
+		}, http.StatusOK)
+
+		return
+	}
+
+	listV2 := query.Get("list-type") == s3ListTypeV2
+
+	listRequest := model.ListObjectsRequest{
+		BucketName:    bucketName,
+		Prefix:        query.Get("prefix"),
+		Delimiter:     query.Get("delimiter"),
+		RequesterUUID: userID,
+	}
+
+	if maxKeys := query.Get("max-keys"); maxKeys != "" {
+		parsed, err := strconv.Atoi(maxKeys)
+		if err != nil || parsed < 0 {
+			writeS3Error(respWriter, request, s3ErrInvalidArgument, "bad max-keys", http.StatusBadRequest)
+
+			return
+		}
+
+		listRequest.MaxKeys = parsed
+	}
+
+	if listV2 {
+		listRequest.StartAfter = query.Get("start-after")
+		listRequest.ContinuationToken = query.Get("continuation-token")
+	} else {
+		listRequest.StartAfter = query.Get("marker")
+	}
+
+	result, err := apiHandler.business.ListObjects(request.Context(), listRequest)
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	encode := func(value string) string { return value }
+	if query.Get("encoding-type") == s3EncodingTypeURL {
+		encode = s3URLEncode
+	}
+
+	response := model.S3ListBucketResult{ //nolint:exhaustruct // filled below.
+		Xmlns:        model.S3XMLNamespace,
+		Name:         bucketName,
+		Prefix:       encode(listRequest.Prefix),
+		Delimiter:    encode(listRequest.Delimiter),
+		EncodingType: query.Get("encoding-type"),
+		MaxKeys:      listRequest.MaxKeys,
+		IsTruncated:  result.IsTruncated,
+	}
+
+	if response.MaxKeys == 0 {
+		response.MaxKeys = len(result.Objects) + len(result.CommonPrefixes)
+	}
+
+	for _, file := range result.Objects {
+		response.Contents = append(response.Contents, model.S3Object{
+			Key:          encode(file.Filename),
+			LastModified: file.CreatedTS.UTC(),
+			ETag:         file.ETag(),
+			Size:         file.SizeBytes,
+			StorageClass: s3StorageClassStandard,
+		})
+	}
+
+	for _, prefix := range result.CommonPrefixes {
+		response.CommonPrefixes = append(response.CommonPrefixes, model.S3CommonPrefix{Prefix: encode(prefix)})
+	}
+
+	if listV2 {
+		keyCount := len(result.Objects) + len(result.CommonPrefixes)
+		response.KeyCount = &keyCount
+		response.StartAfter = encode(query.Get("start-after"))
+		response.ContinuationToken = query.Get("continuation-token")
+
+		response.NextContinuationToken = result.NextContinuationToken
+	} else {
+		marker := encode(listRequest.StartAfter)
+		response.Marker = &marker
+
+		if result.IsTruncated {
+			response.NextMarker = encode(result.NextStartAfter)
+		}
+	}
+
+	writeXMLResponse(respWriter, response, http.StatusOK)
+}
+
+// S3PutObject serves PutObject, CopyObject and UploadPart. The bucket requests with a trailing slash land here too.
+func (apiHandler APIHandler) S3PutObject(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	key := s3ObjectKey(params)
+	if key == "" {
+		apiHandler.S3CreateBucket(respWriter, request, params)
+
+		return
+	}
+
+	if request.URL.Query().Has("uploadId") {
+		apiHandler.s3UploadPart(respWriter, request, userID, params.ByName("bucket"), key)
+
+		return
+	}
+
+	if copySource := request.Header.Get("X-Amz-Copy-Source"); copySource != "" {
+		apiHandler.s3CopyObject(respWriter, request, userID, copySource, params.ByName("bucket"), key)
+
+		return
+	}
+
+	access := model.FileAccessPrivate
+	if request.Header.Get("X-Amz-Acl") == s3ACLPublicRead {
+		access = model.FileAccessPublic
+	}
+
+	mime := request.Header.Get("Content-Type")
+	if mime == "" {
+		mime = s3DefaultContentType
+	}
+
+	file, err := apiHandler.business.PutObject(request.Context(), model.UploadFileRequest{
+		FileContent:    request.Body,
+		ContentMD5:     request.Header.Get("Content-MD5"),
+		ChecksumSHA256: request.Header.Get("X-Amz-Checksum-Sha256"),
+		ContentLength:  request.ContentLength,
+		BucketName:     params.ByName("bucket"),
+		RequesterUUID:  userID,
+		File: model.File{ //nolint:exhaustruct // the rest gets filled in the business.
+			Filename: key,
+			MIME:     mime,
+			Access:   access,
+		},
+	})
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	respWriter.Header().Set("ETag", file.ETag())
+	respWriter.Header().Set("X-Amz-Checksum-Sha256", file.ChecksumSHA256())
+	respWriter.WriteHeader(http.StatusOK)
+}
+
+func (apiHandler APIHandler) s3CopyObject(respWriter http.ResponseWriter, request *http.Request, userID uuid.UUID,
+	copySource, dstBucket, dstKey string,
+) {
+	copySource, _, _ = strings.Cut(copySource, "?")
+
+	source, err := url.PathUnescape(copySource)
+	if err != nil {
+		writeS3Error(respWriter, request, s3ErrInvalidArgument, "bad copy source", http.StatusBadRequest)
+
+		return
+	}
+
+	srcBucket, srcKey, found := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if !found || srcBucket == "" || srcKey == "" {
+		writeS3Error(respWriter, request, s3ErrInvalidArgument, "bad copy source", http.StatusBadRequest)
+
+		return
+	}
+
+	file, err := apiHandler.business.CopyObject(request.Context(), model.CopyObjectRequest{
+		SrcBucketName: srcBucket,
+		SrcKey:        srcKey,
+		DstBucketName: dstBucket,
+		DstKey:        dstKey,
+		RequesterUUID: userID,
+	})
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	writeXMLResponse(respWriter, model.S3CopyObjectResult{ //nolint:exhaustruct // the name is set by the tag.
+		Xmlns:        model.S3XMLNamespace,
+		LastModified: file.CreatedTS.UTC(),
+		ETag:         file.ETag(),
+	}, http.StatusOK)
+}
+
+// S3GetObject serves GetObject, HeadObject and ListParts. The bucket requests with a trailing slash land here too.
+func (apiHandler APIHandler) S3GetObject(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	if s3ObjectKey(params) == "" {
+		if request.Method == http.MethodHead {
+			apiHandler.S3HeadBucket(respWriter, request, params)
+		} else {
+			apiHandler.S3ListObjects(respWriter, request, params)
+		}
+
+		return
+	}
+
+	if request.Method == http.MethodGet && request.URL.Query().Has("uploadId") {
+		apiHandler.s3ListParts(respWriter, request, params.ByName("bucket"), s3ObjectKey(params))
+
+		return
+	}
+
+	userID, _ := request.Context().Value(ctxKeyS3User).(*uuid.UUID)
+
+	versionID, versionOk := parseVersionID(request.URL.Query())
+	if !versionOk {
+		writeS3Error(respWriter, request, s3ErrInvalidArgument, "bad version id", http.StatusBadRequest)
+
+		return
+	}
+
+	err := apiHandler.business.FetchObject(request.Context(), model.FetchObjectRequest{
+		RequestingUserID: userID,
+		RespWriter:       respWriter,
+		RawRequest:       request,
+		BucketName:       params.ByName("bucket"),
+		Key:              s3ObjectKey(params),
+		VersionID:        versionID,
+	})
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+}
+
+// S3DeleteObject serves DeleteObject and AbortMultipartUpload.
+func (apiHandler APIHandler) S3DeleteObject(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	if s3ObjectKey(params) == "" {
+		apiHandler.S3DeleteBucket(respWriter, request, params)
+
+		return
+	}
+
+	if request.URL.Query().Has("uploadId") {
+		apiHandler.s3AbortMultipartUpload(respWriter, request, userID, params.ByName("bucket"), s3ObjectKey(params))
+
+		return
+	}
+
+	versionID, versionOk := parseVersionID(request.URL.Query())
+	if !versionOk {
+		writeS3Error(respWriter, request, s3ErrInvalidArgument, "bad version id", http.StatusBadRequest)
+
+		return
+	}
+
+	version, err := apiHandler.business.DeleteObject(request.Context(), userID, params.ByName("bucket"),
+		s3ObjectKey(params), versionID)
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	if version != nil {
+		respWriter.Header().Set("X-Amz-Version-Id", version.ID.String())
+
+		if version.DeleteMarker {
+			respWriter.Header().Set("X-Amz-Delete-Marker", "true")
+		}
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (apiHandler APIHandler) CreateAccessKey(respWriter http.ResponseWriter, request *http.Request,
+	_ httprouter.Params,
+) {
+	log.Printf("request CreateAccessKey received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	key, err := apiHandler.business.CreateAccessKey(request.Context(), currentUser.UserID)
+	if err != nil {
+		log.Println("Couldn't create an access key", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, key, http.StatusOK)
+}
+
+func (apiHandler APIHandler) ListAccessKeys(respWriter http.ResponseWriter, request *http.Request,
+	_ httprouter.Params,
+) {
+	log.Printf("request ListAccessKeys received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	keys, err := apiHandler.business.ListAccessKeys(request.Context(), currentUser.UserID)
+	if err != nil {
+		log.Println("Couldn't list the access keys", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ListAccessKeysResponse{AccessKeys: keys}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) DeleteAccessKey(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request DeleteAccessKey received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	err := apiHandler.business.DeleteAccessKey(request.Context(), currentUser.UserID, params.ByName("accessKeyID"))
+	if err != nil {
+		log.Println("Couldn't delete the access key: ", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	s3ErrMalformedXML = "MalformedXML"
+	// the completion request lists up to 10000 parts.
+	s3MaxCompleteBodySize = 4 << 20
+)
+
+// S3PostObject serves CreateMultipartUpload and CompleteMultipartUpload.
+func (apiHandler APIHandler) S3PostObject(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	key := s3ObjectKey(params)
+	query := request.URL.Query()
+
+	switch {
+	case key == "":
+		apiHandler.S3NotFound(respWriter, request)
+	case query.Has("uploads"):
+		apiHandler.s3CreateMultipartUpload(respWriter, request, userID, params.ByName("bucket"), key)
+	case query.Has("uploadId"):
+		apiHandler.s3CompleteMultipartUpload(respWriter, request, userID, params.ByName("bucket"), key)
+	default:
+		apiHandler.S3NotFound(respWriter, request)
+	}
+}
+
+// s3UploadID parses the uploadId query parameter, writing the error response if it's malformed.
+func s3UploadID(respWriter http.ResponseWriter, request *http.Request) (uuid.UUID, bool) {
+	uploadID, err := uuid.Parse(request.URL.Query().Get("uploadId"))
+	if err != nil {
+		writeS3Error(respWriter, request, s3ErrNoSuchUpload, "multipart upload not found", http.StatusNotFound)
+
+		return uuid.Nil, false
+	}
+
+	return uploadID, true
+}
+
+func (apiHandler APIHandler) s3CreateMultipartUpload(respWriter http.ResponseWriter, request *http.Request,
+	userID uuid.UUID, bucketName, key string,
+) {
+	access := model.FileAccessPrivate
+	if request.Header.Get("X-Amz-Acl") == s3ACLPublicRead {
+		access = model.FileAccessPublic
+	}
+
+	mime := request.Header.Get("Content-Type")
+	if mime == "" {
+		mime = s3DefaultContentType
+	}
+
+	upload, err := apiHandler.business.CreateMultipartUpload(request.Context(), model.CreateMultipartUploadRequest{
+		BucketName:    bucketName,
+		RequesterUUID: userID,
+		File: model.File{ //nolint:exhaustruct // the rest gets filled on completion.
+			Filename: key,
+			MIME:     mime,
+			Access:   access,
+		},
+	})
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	writeXMLResponse(respWriter, model.S3InitiateMultipartUploadResult{ //nolint:exhaustruct // the name is set by the tag.
+		Xmlns:    model.S3XMLNamespace,
+		Bucket:   bucketName,
+		Key:      key,
+		UploadID: upload.ID.String(),
+	}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) s3UploadPart(respWriter http.ResponseWriter, request *http.Request, userID uuid.UUID,
+	bucketName, key string,
+) {
+	uploadID, ok := s3UploadID(respWriter, request)
+	if !ok {
+		return
+	}
+
+	if request.Header.Get("X-Amz-Copy-Source") != "" {
+		writeS3Error(respWriter, request, s3ErrNotImplemented, "UploadPartCopy is not supported",
+			http.StatusNotImplemented)
+
+		return
+	}
+
+	partNumber, err := strconv.Atoi(request.URL.Query().Get("partNumber"))
+	if err != nil {
+		writeS3Error(respWriter, request, s3ErrInvalidArgument, "bad part number", http.StatusBadRequest)
+
+		return
+	}
+
+	part, err := apiHandler.business.UploadPart(request.Context(), model.UploadPartRequest{
+		Content:        request.Body,
+		BucketName:     bucketName,
+		Key:            key,
+		ContentMD5:     request.Header.Get("Content-MD5"),
+		ChecksumSHA256: request.Header.Get("X-Amz-Checksum-Sha256"),
+		ContentLength:  request.ContentLength,
+		PartNumber:     partNumber,
+		UploadID:       uploadID,
+		RequesterUUID:  userID,
+	})
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	respWriter.Header().Set("ETag", part.ETag())
+	respWriter.Header().Set("X-Amz-Checksum-Sha256", hexToBase64(part.SHA256))
+	respWriter.WriteHeader(http.StatusOK)
+}
+
+func (apiHandler APIHandler) s3ListParts(respWriter http.ResponseWriter, request *http.Request,
+	bucketName, key string,
+) {
+	userID, ok := s3User(respWriter, request)
+	if !ok {
+		return
+	}
+
+	uploadID, ok := s3UploadID(respWriter, request)
+	if !ok {
+		return
+	}
+
+	parts, err := apiHandler.business.ListParts(request.Context(), userID, bucketName, key, uploadID)
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	response := model.S3ListPartsResult{ //nolint:exhaustruct // the name is set by the tag.
+		Xmlns:    model.S3XMLNamespace,
+		Bucket:   bucketName,
+		Key:      key,
+		UploadID: uploadID.String(),
+		Parts:    make([]model.S3Part, 0, len(parts)),
+	}
+
+	for _, part := range parts {
+		response.Parts = append(response.Parts, model.S3Part{
+			LastModified:   part.CreatedTS.UTC(),
+			ETag:           part.ETag(),
+			ChecksumSHA256: hexToBase64(part.SHA256),
+			PartNumber:     part.PartNumber,
+			Size:           part.SizeBytes,
+		})
+	}
+
+	writeXMLResponse(respWriter, response, http.StatusOK)
+}
+
+func (apiHandler APIHandler) s3CompleteMultipartUpload(respWriter http.ResponseWriter, request *http.Request,
+	userID uuid.UUID, bucketName, key string,
+) {
+	uploadID, ok := s3UploadID(respWriter, request)
+	if !ok {
+		return
+	}
+
+	var completeRequest model.S3CompleteMultipartUpload
+
+	err := xml.NewDecoder(io.LimitReader(request.Body, s3MaxCompleteBodySize)).Decode(&completeRequest)
+	if err != nil {
+		writeS3Error(respWriter, request, s3ErrMalformedXML, "bad completion request", http.StatusBadRequest)
+
+		return
+	}
+
+	file, err := apiHandler.business.CompleteMultipartUpload(request.Context(), model.CompleteMultipartUploadRequest{
+		BucketName:    bucketName,
+		Key:           key,
+		Parts:         completeRequest.Parts,
+		UploadID:      uploadID,
+		RequesterUUID: userID,
+	})
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	writeXMLResponse(respWriter, model.S3CompleteMultipartUploadResult{ //nolint:exhaustruct // the name is set by the tag.
+		Xmlns:  model.S3XMLNamespace,
+		Bucket: bucketName,
+		Key:    key,
+		ETag:   file.ETag(),
+	}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) s3AbortMultipartUpload(respWriter http.ResponseWriter, request *http.Request,
+	userID uuid.UUID, bucketName, key string,
+) {
+	uploadID, ok := s3UploadID(respWriter, request)
+	if !ok {
+		return
+	}
+
+	err := apiHandler.business.AbortMultipartUpload(request.Context(), userID, bucketName, key, uploadID)
+	if err != nil {
+		writeS3BusinessError(respWriter, request, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func hexToBase64(hexDigest string) string {
+	digest, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(digest)
+}
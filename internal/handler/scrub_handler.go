@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (apiHandler APIHandler) ListBlobCorruptions(respWriter http.ResponseWriter, request *http.Request,
+	_ httprouter.Params,
+) {
+	log.Printf("request ListBlobCorruptions received")
+
+	corruptions, err := apiHandler.business.GetBlobCorruptions(request.Context())
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	if corruptions == nil {
+		corruptions = []model.BlobCorruption{}
+	}
+
+	writeJSONResponse(respWriter, model.ListBlobCorruptionsResponse{Corruptions: corruptions}, http.StatusOK)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (apiHandler APIHandler) SearchFiles(respWriter http.ResponseWriter, request *http.Request,
+	_ httprouter.Params,
+) {
+	log.Printf("request SearchFiles received")
+
+	query := request.URL.Query()
+	searchRequest := model.SearchFilesRequest{ //nolint:exhaustruct // the requester is set below.
+		Query: query.Get("q"),
+	}
+
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit <= 0 {
+			writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+			return
+		}
+
+		searchRequest.Limit = limit
+	}
+
+	// the tags as the key:value pairs.
+	for _, tag := range query["tag"] {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+			return
+		}
+
+		if searchRequest.Tags == nil {
+			searchRequest.Tags = map[string]string{}
+		}
+
+		searchRequest.Tags[key] = value
+	}
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	searchRequest.RequesterUUID = currentUser.UserID
+
+	found, err := apiHandler.business.SearchFiles(request.Context(), searchRequest)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	if found == nil {
+		found = []model.FoundFile{}
+	}
+
+	writeJSONResponse(respWriter, model.SearchFilesResponse{Files: found}, http.StatusOK)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (apiHandler APIHandler) CopyFile(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request CopyFile received")
+
+	apiHandler.transferFile(respWriter, request, params, apiHandler.business.CopyFile)
+}
+
+func (apiHandler APIHandler) MoveFile(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request MoveFile received")
+
+	apiHandler.transferFile(respWriter, request, params, apiHandler.business.MoveFile)
+}
+
+// transferFile serves the copy and the move of a file, which only differ in the business call.
+func (apiHandler APIHandler) transferFile(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params, transfer func(context.Context, model.FileTransfer) (*model.File, error),
+) {
+	var copyRequest model.CopyFileRequest
+
+	err := json.NewDecoder(request.Body).Decode(&copyRequest)
+	if err != nil || copyRequest.Bucket == nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	fileID, idParseErr := uuid.Parse(params.ByName("fileID"))
+	if idParseErr != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	file, err := transfer(request.Context(), model.FileTransfer{
+		SrcBucketName: params.ByName("bucketName"),
+		DstBucketName: *copyRequest.Bucket,
+		DstKey:        copyRequest.Key,
+		FileID:        fileID,
+		RequesterUUID: currentUser.UserID,
+	})
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.CopyFileResponse{File: *file}, http.StatusOK)
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (apiHandler APIHandler) SetTrashRetention(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request SetTrashRetention received")
+
+	var retentionRequest model.SetTrashRetentionRequest
+
+	err := json.NewDecoder(request.Body).Decode(&retentionRequest)
+	if err != nil || retentionRequest.RetentionDays == nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	err = apiHandler.business.SetTrashRetention(request.Context(), currentUser.UserID, params.ByName("bucketName"),
+		*retentionRequest.RetentionDays)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) ListTrash(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request ListTrash received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	files, err := apiHandler.business.ListTrash(request.Context(), currentUser.UserID, params.ByName("bucketName"))
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	if files == nil {
+		files = []model.File{}
+	}
+
+	writeJSONResponse(respWriter, model.ListFilesResponse{Files: files}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) RestoreFile(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request RestoreFile received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	fileID, idParseErr := uuid.Parse(params.ByName("fileID"))
+	if idParseErr != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	_, err := apiHandler.business.RestoreFile(request.Context(), currentUser.UserID, params.ByName("bucketName"),
+		fileID)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) PurgeFile(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request PurgeFile received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	fileID, idParseErr := uuid.Parse(params.ByName("fileID"))
+	if idParseErr != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	err := apiHandler.business.PurgeFile(request.Context(), currentUser.UserID, params.ByName("bucketName"), fileID)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/myerrors"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// tus 1.0 resumable uploads, https://tus.io/protocols/resumable-upload.
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination,expiration"
+	tusContentType = "application/offset+octet-stream"
+
+	tusHeaderResumable = "Tus-Resumable"
+	tusHeaderVersion   = "Tus-Version"
+	tusHeaderExtension = "Tus-Extension"
+	tusHeaderLength    = "Upload-Length"
+	tusHeaderDefer     = "Upload-Defer-Length"
+	tusHeaderOffset    = "Upload-Offset"
+	tusHeaderMetadata  = "Upload-Metadata"
+	tusHeaderExpires   = "Upload-Expires"
+
+	tusMetaFilename = "filename"
+	tusMetaFiletype = "filetype"
+	tusMetaAccess   = "access"
+)
+
+// writeTusBusinessError maps the business errors to the status codes the tus clients act upon.
+func writeTusBusinessError(respWriter http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, myerrors.ErrNoBucket), errors.Is(err, myerrors.ErrNoObject):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "not found"}, http.StatusNotFound)
+	case errors.Is(err, myerrors.ErrNoPermission):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "forbidden"}, http.StatusForbidden)
+	case errors.Is(err, myerrors.ErrUploadExpired):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusGone)
+	case errors.Is(err, myerrors.ErrUploadOffset):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusConflict)
+	case errors.Is(err, myerrors.ErrUploadLocked):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusLocked)
+	case errors.Is(err, myerrors.ErrQuotaExceeded):
+		// not a 5xx, the clients would retry.
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusRequestEntityTooLarge)
+	case errors.Is(err, myerrors.ErrBadRequest):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+	default:
+		log.Println("tus request failed:", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+	}
+}
+
+// parseTusMetadata decodes the Upload-Metadata header: comma separated keys with optional base64 values.
+func parseTusMetadata(header string) (map[string]string, bool) {
+	metadata := map[string]string{}
+
+	if strings.TrimSpace(header) == "" {
+		return metadata, true
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encodedValue, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, false
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encodedValue)
+		if err != nil {
+			return nil, false
+		}
+
+		metadata[key] = string(value)
+	}
+
+	return metadata, true
+}
+
+func setTusUploadHeaders(respWriter http.ResponseWriter, upload *model.Upload) {
+	respWriter.Header().Set(tusHeaderOffset, strconv.FormatInt(upload.Offset, 10))
+
+	if upload.Offset < upload.Length {
+		respWriter.Header().Set(tusHeaderExpires, upload.ExpiresTS.UTC().Format(http.TimeFormat))
+	}
+}
+
+// MiddlewareTusResumable sets the protocol version on the responses and rejects the unsupported versions.
+func (APIHandler) MiddlewareTusResumable(next httprouter.Handle) httprouter.Handle {
+	return func(respWriter http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		respWriter.Header().Set(tusHeaderResumable, tusVersion)
+
+		if request.Method != http.MethodOptions && request.Header.Get(tusHeaderResumable) != tusVersion {
+			respWriter.Header().Set(tusHeaderVersion, tusVersion)
+			writeJSONResponse(respWriter, model.ErrorResponse{Error: "unsupported tus version"},
+				http.StatusPreconditionFailed)
+
+			return
+		}
+
+		next(respWriter, request, params)
+	}
+}
+
+func (APIHandler) TusOptions(respWriter http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	respWriter.Header().Set(tusHeaderVersion, tusVersion)
+	respWriter.Header().Set(tusHeaderExtension, tusExtensions)
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (apiHandler APIHandler) TusCreateUpload(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request TusCreateUpload received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	// creation-defer-length is not supported.
+	length, err := strconv.ParseInt(request.Header.Get(tusHeaderLength), 10, 64)
+	if err != nil || length < 0 || request.Header.Get(tusHeaderDefer) != "" {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	metadata, metadataOk := parseTusMetadata(request.Header.Get(tusHeaderMetadata))
+	access := model.FileAccess(metadata[tusMetaAccess])
+
+	if !metadataOk || (access != "" && access != model.FileAccessPrivate && access != model.FileAccessPublic) {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	upload, err := apiHandler.business.CreateUpload(request.Context(), model.CreateUploadRequest{
+		BucketName: params.ByName("bucketName"),
+		File: model.File{ //nolint:exhaustruct // the rest is set once the upload is complete.
+			Filename: metadata[tusMetaFilename],
+			MIME:     metadata[tusMetaFiletype],
+			Access:   access,
+		},
+		Metadata:      request.Header.Get(tusHeaderMetadata),
+		Length:        length,
+		RequesterUUID: currentUser.UserID,
+	})
+	if err != nil {
+		writeTusBusinessError(respWriter, err)
+
+		return
+	}
+
+	setTusUploadHeaders(respWriter, upload)
+	respWriter.Header().Set("Location", path.Join(request.URL.Path, upload.ID.String()))
+	respWriter.WriteHeader(http.StatusCreated)
+}
+
+func (apiHandler APIHandler) TusHeadUpload(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	uploadID, idParseErr := uuid.Parse(params.ByName("uploadID"))
+	if idParseErr != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "not found"}, http.StatusNotFound)
+
+		return
+	}
+
+	upload, err := apiHandler.business.GetUpload(request.Context(), currentUser.UserID, params.ByName("bucketName"),
+		uploadID)
+	if err != nil {
+		writeTusBusinessError(respWriter, err)
+
+		return
+	}
+
+	setTusUploadHeaders(respWriter, upload)
+	respWriter.Header().Set(tusHeaderLength, strconv.FormatInt(upload.Length, 10))
+	respWriter.Header().Set("Cache-Control", "no-store")
+
+	if upload.Metadata != "" {
+		respWriter.Header().Set(tusHeaderMetadata, upload.Metadata)
+	}
+
+	respWriter.WriteHeader(http.StatusOK)
+}
+
+func (apiHandler APIHandler) TusPatchUpload(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	if request.Header.Get("Content-Type") != tusContentType {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "unsupported media type"},
+			http.StatusUnsupportedMediaType)
+
+		return
+	}
+
+	uploadID, idParseErr := uuid.Parse(params.ByName("uploadID"))
+	if idParseErr != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "not found"}, http.StatusNotFound)
+
+		return
+	}
+
+	offset, err := strconv.ParseInt(request.Header.Get(tusHeaderOffset), 10, 64)
+	if err != nil || offset < 0 {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	upload, err := apiHandler.business.PatchUpload(request.Context(), model.PatchUploadRequest{
+		Content:       request.Body,
+		BucketName:    params.ByName("bucketName"),
+		Offset:        offset,
+		ContentLength: request.ContentLength,
+		UploadID:      uploadID,
+		RequesterUUID: currentUser.UserID,
+	})
+	if err != nil {
+		writeTusBusinessError(respWriter, err)
+
+		return
+	}
+
+	setTusUploadHeaders(respWriter, upload)
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (apiHandler APIHandler) TusTerminateUpload(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request TusTerminateUpload received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	uploadID, idParseErr := uuid.Parse(params.ByName("uploadID"))
+	if idParseErr != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "not found"}, http.StatusNotFound)
+
+		return
+	}
+
+	err := apiHandler.business.TerminateUpload(request.Context(), currentUser.UserID, params.ByName("bucketName"),
+		uploadID)
+	if err != nil {
+		writeTusBusinessError(respWriter, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
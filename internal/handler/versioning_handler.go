@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/eldarbr/go-s3/internal/auth"
+	"github.com/eldarbr/go-s3/internal/model"
+	"github.com/eldarbr/go-s3/internal/myerrors"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// parseVersionID parses the optional versionId query parameter.
+func parseVersionID(query url.Values) (*uuid.UUID, bool) {
+	if !query.Has("versionId") {
+		return nil, true
+	}
+
+	versionID, err := uuid.Parse(query.Get("versionId"))
+	if err != nil {
+		return nil, false
+	}
+
+	return &versionID, true
+}
+
+// writeBusinessError maps the common business errors of the manage API to the responses.
+func writeBusinessError(respWriter http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, myerrors.ErrNoBucket), errors.Is(err, myerrors.ErrNoObject):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "not found"}, http.StatusNotFound)
+	case errors.Is(err, myerrors.ErrNoPermission):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "forbidden"}, http.StatusForbidden)
+	case errors.Is(err, myerrors.ErrBadRequest):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+	case errors.Is(err, myerrors.ErrKeyExists):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "conflict"}, http.StatusConflict)
+	case errors.Is(err, myerrors.ErrQuotaExceeded):
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: err.Error()}, http.StatusInsufficientStorage)
+	default:
+		log.Println("request failed:", err.Error())
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+	}
+}
+
+func (apiHandler APIHandler) SetBucketVersioning(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request SetBucketVersioning received")
+
+	var versioningRequest model.SetBucketVersioningRequest
+
+	err := json.NewDecoder(request.Body).Decode(&versioningRequest)
+	if err != nil || versioningRequest.Enabled == nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	err = apiHandler.business.SetBucketVersioning(request.Context(), currentUser.UserID, params.ByName("bucketName"),
+		*versioningRequest.Enabled)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
+
+func (apiHandler APIHandler) ListVersions(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request ListVersions received")
+
+	query := request.URL.Query()
+	listRequest := model.ListVersionsRequest{ //nolint:exhaustruct // the requester is set below.
+		BucketName: params.ByName("bucketName"),
+		Filename:   query.Get("filename"),
+		Token:      query.Get("token"),
+	}
+
+	if query.Has("limit") {
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+			return
+		}
+
+		listRequest.Limit = limit
+	}
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	listRequest.RequesterUUID = currentUser.UserID
+
+	response, err := apiHandler.business.ListVersions(request.Context(), listRequest)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, response, http.StatusOK)
+}
+
+func (apiHandler APIHandler) RestoreVersion(respWriter http.ResponseWriter, request *http.Request,
+	params httprouter.Params,
+) {
+	log.Printf("request RestoreVersion received")
+
+	currentUser, ctxFetchOk := request.Context().Value(ctxKeyThisServiceUser).(*auth.ThisServiceUser)
+	if !ctxFetchOk {
+		log.Println("bad ctx")
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "internal error"}, http.StatusInternalServerError)
+
+		return
+	}
+
+	versionID, idParseErr := uuid.Parse(params.ByName("versionID"))
+	if idParseErr != nil {
+		writeJSONResponse(respWriter, model.ErrorResponse{Error: "bad request"}, http.StatusBadRequest)
+
+		return
+	}
+
+	_, err := apiHandler.business.RestoreVersion(request.Context(), currentUser.UserID, params.ByName("bucketName"),
+		versionID)
+	if err != nil {
+		writeBusinessError(respWriter, err)
+
+		return
+	}
+
+	writeJSONResponse(respWriter, model.ErrorResponse{Error: ""}, http.StatusOK)
+}
@@ -3,10 +3,17 @@ package model
 import (
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// The headers carrying the user-defined metadata and the tags of a file, the tags URL-encoded as a query string.
+const (
+	MetadataHeaderPrefix = "X-Meta-"
+	TagsHeader           = "X-Tags"
+)
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -25,6 +32,34 @@ type UploadFileRequest struct {
 	FileContent io.Reader
 	BucketName  string
 	File
+	// ContentMD5 and ChecksumSHA256 are the base64 digests announced by the client, if any.
+	ContentMD5     string
+	ChecksumSHA256 string
+	// ContentLength is the announced size of the content if known, used for the early quota check.
+	ContentLength int64
+	RequesterUUID uuid.UUID
+	// PresignNonce is set for the uploads by a presigned url, a nonce is accepted once
+	// and remembered till PresignExpiresTS.
+	PresignNonce     uuid.UUID
+	PresignExpiresTS time.Time
+}
+
+type CreateUploadRequest struct {
+	BucketName string
+	File
+	// Metadata is the raw Upload-Metadata header, returned as is on the upload lookups.
+	Metadata      string
+	Length        int64
+	RequesterUUID uuid.UUID
+}
+
+type PatchUploadRequest struct {
+	Content    io.Reader
+	BucketName string
+	Offset     int64
+	// ContentLength is the size of the chunk if known, -1 otherwise.
+	ContentLength int64
+	UploadID      uuid.UUID
 	RequesterUUID uuid.UUID
 }
 
@@ -52,13 +87,153 @@ type FetchFileRequest struct {
 	RawRequest       *http.Request
 	BucketName       string
 	FileID           uuid.UUID
+	// VersionID picks a version of a versioned file, the latest one is served by default.
+	VersionID *uuid.UUID
+}
+
+// ListFilesRequest lists a page of the files of the bucket whose keys start with the prefix and that match
+// the filters. With the delimiter set, the keys containing it after the prefix are rolled up into the common
+// prefixes, the virtual folders, each one taking a single place on the page.
+type ListFilesRequest struct {
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinSize       *int64
+	MaxSize       *int64
+	BucketName    string
+	Prefix        string
+	Delimiter     string
+	// Token is the NextToken of the previous page, empty for the first page.
+	Token string
+	// Sort is one of the FilesSort orders, by name if empty. The delimiter requires the name order.
+	Sort         string
+	MIME         string
+	Access       FileAccess
+	NameContains string
+	// Limit is the size of the page, the default one if 0.
+	Limit         int
+	Descending    bool
+	RequesterUUID uuid.UUID
 }
 
 type ListFilesResponse struct {
-	Files []File `json:"files"`
+	Files          []File   `json:"files"`
+	CommonPrefixes []string `json:"commonPrefixes,omitempty"`
+	// NextToken continues the listing, set if there is more to list.
+	NextToken string `json:"nextToken,omitempty"`
+}
+
+// SearchFilesRequest searches the files of all the buckets of the requester, the best matches first.
+type SearchFilesRequest struct {
+	// Query may be empty if the tags are given, the newest files coming first.
+	Query string
+	// Tags are the tags the files must have, with the same values.
+	Tags map[string]string
+	// Limit is the number of the matches returned, the default one if 0.
+	Limit         int
+	RequesterUUID uuid.UUID
+}
+
+type SearchFilesResponse struct {
+	Files []FoundFile `json:"files"`
+}
+
+// CopyFileRequest names the bucket a file is copied or moved to, and the key of the copy if not the same.
+type CopyFileRequest struct {
+	Bucket *string `json:"bucket"`
+	Key    string  `json:"key"`
+}
+
+type CopyFileResponse struct {
+	File File `json:"file"`
+}
+
+// FileTransfer copies or moves the file of the source bucket to a bucket of the requester.
+type FileTransfer struct {
+	SrcBucketName string
+	DstBucketName string
+	// DstKey is the key of the copy, the key of the file if empty.
+	DstKey        string
+	FileID        uuid.UUID
+	RequesterUUID uuid.UUID
+}
+
+type MovePrefixRequest struct {
+	From *string `json:"from"`
+	To   *string `json:"to"`
+}
+
+type MovePrefixResponse struct {
+	Moved int64 `json:"moved"`
+}
+
+type ListBucketsResponse struct {
+	Buckets []BucketUsage `json:"buckets"`
+}
+
+type SetBucketVersioningRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type SetBucketCompressionRequest struct {
+	Compression *string `json:"compression"`
+}
+
+type SetTrashRetentionRequest struct {
+	RetentionDays *int32 `json:"retentionDays"`
+}
+
+type ListBlobCorruptionsResponse struct {
+	Corruptions []BlobCorruption `json:"corruptions"`
+}
+
+type ListVersionsRequest struct {
+	BucketName string
+	// Filename lists the versions of the single object if set.
+	Filename string
+	// Token is the NextToken of the previous page, empty for the first page.
+	Token string
+	// Limit is the size of the page, the default one if 0.
+	Limit         int
+	RequesterUUID uuid.UUID
+}
+
+type ListVersionsResponse struct {
+	Versions []FileVersion `json:"versions"`
+	// NextToken continues the listing, set if there is more to list.
+	NextToken string `json:"nextToken,omitempty"`
+}
+
+type SetBucketQuotaRequest struct {
+	SizeQuota *float64 `json:"sizeQuota"`
+}
+
+type PresignURLRequest struct {
+	FileID   *uuid.UUID `json:"fileId"`
+	Method   string     `json:"method"`
+	Filename string     `json:"filename"`
+	// ExpiresIn is in seconds.
+	ExpiresIn        int64 `json:"expiresIn"`
+	MaxContentLength int64 `json:"maxContentLength"`
+}
+
+type PresignURLResponse struct {
+	ExpiresTS time.Time `json:"expiresTs"`
+	URL       string    `json:"url"`
+}
+
+// PresignScope is the operation a presigned url is about to be minted for.
+type PresignScope struct {
+	BucketName    string
+	Method        string
+	FileID        uuid.UUID
+	RequesterUUID uuid.UUID
 }
 
+// EditFileRequest changes the set fields of a file. The metadata and the tags are merged into the ones
+// of the file, a null value removing the key.
 type EditFileRequest struct {
-	Access   *FileAccess `json:"access"`
-	Filename string      `json:"filename"`
+	Access   *FileAccess        `json:"access"`
+	Metadata map[string]*string `json:"metadata"`
+	Tags     map[string]*string `json:"tags"`
+	Filename string             `json:"filename"`
 }
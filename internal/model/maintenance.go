@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+)
+
+// BlobInfo describes a blob found in a folder of the file storage.
+type BlobInfo struct {
+	ModTS time.Time
+	ID    string
+	Size  int64
+}
+
+type ReconcileIssueKind string
+
+const (
+	// ReconcileOrphanBlob is a blob no file, upload or part refers to.
+	ReconcileOrphanBlob ReconcileIssueKind = "orphan_blob"
+	// ReconcileDanglingRow is a file entry marked deleted by a deletion that didn't complete.
+	ReconcileDanglingRow ReconcileIssueKind = "dangling_row"
+	// ReconcileMissingBlob is a file entry whose content is gone.
+	ReconcileMissingBlob ReconcileIssueKind = "missing_blob"
+	// ReconcileSizeMismatch is a file entry whose size differs from the size of its blob.
+	ReconcileSizeMismatch ReconcileIssueKind = "size_mismatch"
+	// ReconcileUsageMismatch is a bucket whose bytes used differ from the total size of its files.
+	ReconcileUsageMismatch ReconcileIssueKind = "usage_mismatch"
+	// ReconcileRefCountMismatch is a deduplicated blob whose reference count differs from the files referring to it.
+	ReconcileRefCountMismatch ReconcileIssueKind = "ref_count_mismatch"
+	// ReconcileMissingFolder is a bucket without a folder, it is reported and never repaired.
+	ReconcileMissingFolder ReconcileIssueKind = "missing_folder"
+)
+
+type ReconcileIssue struct {
+	Kind ReconcileIssueKind `json:"kind"`
+	// ID is the id of the blob or of the file entry, empty for the bucket wide issues.
+	ID       string `json:"id,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	BucketID int64  `json:"bucketId"`
+	Repaired bool   `json:"repaired"`
+}
+
+type ReconcileReport struct {
+	Issues         []ReconcileIssue `json:"issues"`
+	BucketsChecked int              `json:"bucketsChecked"`
+	Repair         bool             `json:"repair"`
+}
@@ -0,0 +1,231 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const S3XMLNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+type S3ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type S3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type S3Bucket struct {
+	CreationDate time.Time `xml:"CreationDate"`
+	Name         string    `xml:"Name"`
+}
+
+type S3ListAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   S3Owner    `xml:"Owner"`
+	Buckets []S3Bucket `xml:"Buckets>Bucket"`
+}
+
+type S3Object struct {
+	LastModified time.Time `xml:"LastModified"`
+	Key          string    `xml:"Key"`
+	ETag         string    `xml:"ETag"`
+	StorageClass string    `xml:"StorageClass"`
+	Size         int64     `xml:"Size"`
+}
+
+type S3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type S3ListBucketResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	Xmlns                 string           `xml:"xmlns,attr"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	Marker                *string          `xml:"Marker,omitempty"`
+	NextMarker            string           `xml:"NextMarker,omitempty"`
+	StartAfter            string           `xml:"StartAfter,omitempty"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	EncodingType          string           `xml:"EncodingType,omitempty"`
+	KeyCount              *int             `xml:"KeyCount,omitempty"`
+	Contents              []S3Object       `xml:"Contents"`
+	CommonPrefixes        []S3CommonPrefix `xml:"CommonPrefixes"`
+	MaxKeys               int              `xml:"MaxKeys"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+}
+
+type S3CopyObjectResult struct {
+	XMLName      xml.Name  `xml:"CopyObjectResult"`
+	Xmlns        string    `xml:"xmlns,attr"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+type S3LocationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Region  string   `xml:",chardata"`
+}
+
+type S3InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type S3CompletedPart struct {
+	ETag       string `xml:"ETag"`
+	PartNumber int    `xml:"PartNumber"`
+}
+
+type S3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []S3CompletedPart `xml:"Part"`
+}
+
+type S3CompleteMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+type S3Part struct {
+	LastModified   time.Time `xml:"LastModified"`
+	ETag           string    `xml:"ETag"`
+	ChecksumSHA256 string    `xml:"ChecksumSHA256"`
+	PartNumber     int       `xml:"PartNumber"`
+	Size           int64     `xml:"Size"`
+}
+
+type S3ListPartsResult struct {
+	XMLName     xml.Name `xml:"ListPartsResult"`
+	Xmlns       string   `xml:"xmlns,attr"`
+	Bucket      string   `xml:"Bucket"`
+	Key         string   `xml:"Key"`
+	UploadID    string   `xml:"UploadId"`
+	Parts       []S3Part `xml:"Part"`
+	IsTruncated bool     `xml:"IsTruncated"`
+}
+
+type FetchObjectRequest struct {
+	RequestingUserID *uuid.UUID
+	RespWriter       http.ResponseWriter
+	RawRequest       *http.Request
+	BucketName       string
+	Key              string
+	VersionID        *uuid.UUID
+}
+
+type ListObjectsRequest struct {
+	BucketName string
+	Prefix     string
+	Delimiter  string
+	StartAfter string
+	// ContinuationToken continues the listing as returned with the previous page, StartAfter being ignored then.
+	ContinuationToken string
+	MaxKeys           int
+	RequesterUUID     uuid.UUID
+}
+
+type ListObjectsResult struct {
+	Objects        []File
+	CommonPrefixes []string
+	// NextStartAfter is the last key or common prefix returned when the result is truncated.
+	NextStartAfter string
+	// NextContinuationToken continues the listing when the result is truncated.
+	NextContinuationToken string
+	IsTruncated           bool
+}
+
+type CopyObjectRequest struct {
+	SrcBucketName string
+	SrcKey        string
+	DstBucketName string
+	DstKey        string
+	RequesterUUID uuid.UUID
+}
+
+type CreateMultipartUploadRequest struct {
+	BucketName string
+	File
+	RequesterUUID uuid.UUID
+}
+
+type UploadPartRequest struct {
+	Content    io.Reader
+	BucketName string
+	Key        string
+	// ContentMD5 and ChecksumSHA256 are the base64 digests announced by the client, if any.
+	ContentMD5     string
+	ChecksumSHA256 string
+	ContentLength  int64
+	PartNumber     int
+	UploadID       uuid.UUID
+	RequesterUUID  uuid.UUID
+}
+
+type CompleteMultipartUploadRequest struct {
+	BucketName    string
+	Key           string
+	Parts         []S3CompletedPart
+	UploadID      uuid.UUID
+	RequesterUUID uuid.UUID
+}
+
+type ListAccessKeysResponse struct {
+	AccessKeys []AccessKey `json:"accessKeys"`
+}
+
+// ETag is the quoted hex MD5 of the file content. The files stored before the digests
+// were computed fall back to their id, which is as strong a validator, as the content never changes.
+func (file File) ETag() string {
+	if file.MD5 == "" {
+		return "\"" + strings.ReplaceAll(file.ID.String(), "-", "") + "\""
+	}
+
+	return "\"" + file.MD5 + "\""
+}
+
+// ContentMD5 is the base64 MD5 of the file content, as in the Content-MD5 header. Empty if unknown.
+func (file File) ContentMD5() string {
+	return hexToBase64(file.MD5)
+}
+
+// ChecksumSHA256 is the base64 SHA-256 of the file content. Empty if unknown.
+func (file File) ChecksumSHA256() string {
+	return hexToBase64(file.SHA256)
+}
+
+func hexToBase64(digest string) string {
+	raw, err := hex.DecodeString(digest)
+	if err != nil || len(raw) == 0 {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// ETag of a part is the quoted hex MD5 of its content, as the S3 clients expect.
+func (part MultipartPart) ETag() string {
+	return "\"" + part.MD5 + "\""
+}
@@ -11,22 +11,126 @@ type BucketAvailability string
 type FileAccess string
 
 type Bucket struct {
+	CreatedTS    time.Time
 	Name         string
 	Availability BucketAvailability
 	ID           int64
 	OwnerID      uuid.UUID
 	SizeQuota    float64
+	BytesUsed    int64
+	// TrashRetentionDays is how long the deleted files stay restorable, 0 meaning no trash.
+	TrashRetentionDays int32
+	Versioning         bool
+	// Compression is the codec the compressible files are stored with, empty meaning none.
+	Compression string
 }
 
 type File struct {
-	CreatedTS      time.Time  `json:"createdTs"`
-	Filename       string     `json:"filename"`
-	MIME           string     `json:"mime"`
-	Access         FileAccess `json:"access"`
-	BucketID       int64      `json:"-"`
-	SizeBytes      int64      `json:"sizeBytes"`
-	FilenameSuffix int32      `json:"-"`
-	ID             uuid.UUID  `json:"id"`
+	CreatedTS  time.Time  `json:"createdTs"`
+	DeletedTS  *time.Time `json:"deletedTs,omitempty"`
+	Filename   string     `json:"filename"`
+	MIME       string     `json:"mime"`
+	Access     FileAccess `json:"access"`
+	MD5        string     `json:"md5,omitempty"`
+	SHA256     string     `json:"sha256,omitempty"`
+	BlobSHA256 string     `json:"-"`
+	// ContentEncoding is the codec the content is stored with, empty if stored as is.
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	BucketID        int64  `json:"-"`
+	SizeBytes       int64  `json:"sizeBytes"`
+	// StoredSizeBytes is the size of the content in the file storage.
+	StoredSizeBytes int64 `json:"storedSizeBytes"`
+	FilenameSuffix  int32 `json:"-"`
+	// DeleteMarker is set on the versions without content that hide a versioned object.
+	DeleteMarker bool `json:"deleteMarker,omitempty"`
+	// Metadata is the user-defined metadata, served as the X-Meta-* headers.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Tags label the file, the search filtering by them.
+	Tags map[string]string `json:"tags,omitempty"`
+	ID   uuid.UUID         `json:"id"`
+}
+
+// Blob is a deduplicated content, stored once for every file entry referring to it by BlobSHA256.
+type Blob struct {
+	CreatedTS time.Time
+	SHA256    string
+	SizeBytes int64
+	RefCount  int64
+}
+
+// BlobCorruption is a stored blob whose content doesn't match its digest, as found by the scrubber.
+type BlobCorruption struct {
+	DetectedTS time.Time `json:"detectedTs"`
+	CheckedTS  time.Time `json:"checkedTs"`
+	// BucketID is nil for the deduplicated blobs.
+	BucketID       *int64 `json:"bucketId,omitempty"`
+	Folder         string `json:"folder"`
+	BlobID         string `json:"blobId"`
+	ExpectedSHA256 string `json:"expectedSha256"`
+	// ActualSHA256 is empty when the content couldn't be read to the end.
+	ActualSHA256 string `json:"actualSha256"`
+	Detail       string `json:"detail,omitempty"`
+}
+
+// FileVersion is a version of a versioned object, the latest one being its current state.
+type FileVersion struct {
+	File
+	IsLatest bool `json:"isLatest"`
+}
+
+// Upload is a resumable upload, its ID becomes the ID of the file once Offset reaches Length.
+type Upload struct {
+	CreatedTS time.Time
+	ExpiresTS time.Time
+	Filename  string
+	MIME      string
+	Access    FileAccess
+	// Metadata is the raw Upload-Metadata header of the creation request.
+	Metadata string
+	BucketID int64
+	Length   int64
+	Offset   int64
+	ID       uuid.UUID
+}
+
+// MultipartUpload is an S3 multipart upload in progress, the object is created on completion.
+type MultipartUpload struct {
+	CreatedTS time.Time
+	Key       string
+	MIME      string
+	Access    FileAccess
+	BucketID  int64
+	ID        uuid.UUID
+}
+
+// MultipartPart is an uploaded part, its content is stored under BlobID in the bucket folder.
+type MultipartPart struct {
+	CreatedTS  time.Time
+	MD5        string
+	SHA256     string
+	SizeBytes  int64
+	PartNumber int
+	UploadID   uuid.UUID
+	BlobID     uuid.UUID
+}
+
+type BucketUsage struct {
+	CreatedTS          time.Time          `json:"createdTs"`
+	Name               string             `json:"name"`
+	Availability       BucketAvailability `json:"availability"`
+	SizeQuota          float64            `json:"sizeQuota"`
+	FilesCount         int64              `json:"filesCount"`
+	BytesUsed          int64              `json:"bytesUsed"`
+	Versioning         bool               `json:"versioning"`
+	TrashRetentionDays int32              `json:"trashRetentionDays"`
+	Compression        string             `json:"compression"`
+}
+
+type AccessKey struct {
+	CreatedTS time.Time `json:"createdTs"`
+	ID        string    `json:"accessKeyId"`
+	Secret    string    `json:"secretAccessKey,omitempty"`
+	OwnerID   uuid.UUID `json:"-"`
 }
 
 const (
@@ -38,3 +142,72 @@ const (
 	FileAccessPrivate FileAccess = "private"
 	FileAccessPublic  FileAccess = "public"
 )
+
+// The orders the files of a bucket may be listed in, the ties broken by the filename.
+const (
+	FilesSortName    = "name"
+	FilesSortSize    = "size"
+	FilesSortCreated = "created"
+)
+
+// FilesQuery selects a page of the files of a bucket, the delete markers excluded.
+// The keys are compared in the byte order.
+type FilesQuery struct {
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinSize       *int64
+	MaxSize       *int64
+	// After is the position the page starts past, nil for the first page.
+	After  *FilesCursor
+	Prefix string
+	// MIME matches the media type, or the types of the family if it ends with "/*", e.g. "image/*".
+	MIME         string
+	Access       FileAccess
+	NameContains string
+	Sort         string
+	BucketID     int64
+	Limit        int
+	Descending   bool
+	// LatestOnly leaves the latest versions of the objects of a versioned bucket only.
+	LatestOnly bool
+}
+
+// FilesCursor is the position of a file in the listing order, or past a whole prefix if SkipPrefix is set.
+type FilesCursor struct {
+	CreatedTS  time.Time `json:"c"`
+	Filename   string    `json:"f,omitempty"`
+	SkipPrefix string    `json:"p,omitempty"`
+	SizeBytes  int64     `json:"s,omitempty"`
+	Suffix     int32     `json:"x,omitempty"`
+}
+
+// VersionsQuery is a page of the versions of the objects of a bucket, by filename and the latest first.
+type VersionsQuery struct {
+	// After is the position the page starts past, by its filename and suffix, nil for the first page.
+	After *FilesCursor
+	// Filename lists the versions of the single object if set.
+	Filename string
+	BucketID int64
+	Limit    int
+}
+
+// FilesSearch is a full-text search of the latest files of the buckets of an owner by their filenames
+// and metadata, the delete markers excluded.
+type FilesSearch struct {
+	// Query is a web search style query, the quoted phrases and the "-" and "or" operators supported.
+	// An empty query matches all the files, the newest first.
+	Query string
+	// Tags are the tags the files must have, with the same values.
+	Tags    map[string]string
+	Limit   int
+	OwnerID uuid.UUID
+}
+
+// FoundFile is a file matched by a search, along with its bucket and its relevance.
+type FoundFile struct {
+	File
+	BucketName string  `json:"bucketName"`
+	Rank       float32 `json:"rank"`
+	// BucketVersioning tells the versioned buckets, their files being shown without the suffixes.
+	BucketVersioning bool `json:"-"`
+}
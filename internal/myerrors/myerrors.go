@@ -5,3 +5,24 @@ import "errors"
 var (
 	ErrServiceNullPtr = errors.New("nullptr exception")
 )
+
+// business errors, shared with the handlers to pick the response codes.
+var (
+	ErrBadRequest     = errors.New("malformed request")
+	ErrNoPermission   = errors.New("the user has no permissions")
+	ErrNoBucket       = errors.New("bucket not found")
+	ErrNoObject       = errors.New("object not found")
+	ErrBucketExists   = errors.New("bucket already exists")
+	ErrNoAccessKey    = errors.New("access key not found")
+	ErrBucketNotEmpty = errors.New("bucket is not empty")
+	ErrQuotaExceeded  = errors.New("bucket size quota exceeded")
+	ErrUploadOffset   = errors.New("upload offset mismatch")
+	ErrUploadLocked   = errors.New("upload is in use by another request")
+	ErrUploadExpired  = errors.New("upload has expired")
+	ErrNoUpload       = errors.New("multipart upload not found")
+	ErrInvalidPart    = errors.New("invalid multipart part list")
+	ErrPartTooSmall   = errors.New("multipart part is too small")
+	ErrBadDigest      = errors.New("content checksum mismatch")
+	ErrPresignUsed    = errors.New("presigned url has been used already")
+	ErrKeyExists      = errors.New("a file with the key already exists")
+)
@@ -0,0 +1,788 @@
+package files_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/eldarbr/go-s3/internal/provider/files"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, backend files.Backend, bucketID, fileID string) string {
+	t.Helper()
+
+	file, err := backend.OpenFile(bucketID, fileID)
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+
+	return string(content)
+}
+
+type nopCloserReader struct {
+	*bytes.Reader
+}
+
+func (nopCloserReader) Close() error {
+	return nil
+}
+
+func nopCloser(content []byte) io.ReadSeekCloser {
+	return nopCloserReader{bytes.NewReader(content)}
+}
+
+func newEncrypted(t *testing.T, inner files.Backend, keys ...files.MasterKey) *files.EncryptedContainer {
+	t.Helper()
+
+	if len(keys) == 0 {
+		keys = []files.MasterKey{{ID: 1, Key: bytes.Repeat([]byte{1}, 32)}}
+	}
+
+	ring, err := files.NewKeyRing(keys...)
+	require.NoError(t, err)
+
+	return files.NewEncryptedContainer(inner, ring)
+}
+
+// newErasure codes the blobs over 3 data and 2 parity memory shards, or over the shards given.
+func newErasure(t *testing.T, shards []files.Backend) *files.ErasureContainer {
+	t.Helper()
+
+	if shards == nil {
+		for range 5 {
+			shards = append(shards, files.NewMemoryContainer())
+		}
+	}
+
+	container, err := files.NewErasureContainer(3, 4, shards...)
+	require.NoError(t, err)
+
+	return container
+}
+
+func TestMemoryContainer(t *testing.T) {
+	container := files.NewMemoryContainer()
+
+	_, err := container.WriteFile("1", "a", strings.NewReader("data"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, container.CreateFolder("1"))
+	require.ErrorIs(t, container.CreateFolder("1"), fs.ErrExist)
+
+	written, err := container.WriteFile("1", "a", strings.NewReader("data"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), written)
+	assert.Equal(t, "data", readAll(t, container, "1", "a"))
+
+	require.NoError(t, container.DeleteFile("1", "a"))
+	require.ErrorIs(t, container.DeleteFile("1", "a"), fs.ErrNotExist)
+
+	_, err = container.OpenFile("1", "a")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestTieredContainer(t *testing.T) {
+	hot := files.NewMemoryContainer()
+	cold := files.NewMemoryContainer()
+	tiered := files.NewTieredContainer(hot, cold)
+
+	require.NoError(t, tiered.CreateFolder("1"))
+
+	_, err := tiered.WriteFile("1", "a", strings.NewReader("data"))
+	require.NoError(t, err)
+
+	require.NoError(t, tiered.Demote("1", "a"))
+
+	_, err = hot.OpenFile("1", "a")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, "data", readAll(t, tiered, "1", "a"))
+
+	require.NoError(t, tiered.DeleteFile("1", "a"))
+	require.ErrorIs(t, tiered.DeleteFile("1", "a"), fs.ErrNotExist)
+
+	// a blob deleted during the demotion isn't left in the cold tier.
+	_, err = tiered.WriteFile("1", "b", strings.NewReader("data"))
+	require.NoError(t, err)
+
+	racing := files.NewTieredContainer(hot, writeHook{Backend: cold, before: func() {
+		require.NoError(t, tiered.DeleteFile("1", "b"))
+	}})
+	require.ErrorIs(t, racing.Demote("1", "b"), fs.ErrNotExist)
+
+	_, err = cold.OpenFile("1", "b")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// writeHook runs a function before every write to the backend.
+type writeHook struct {
+	files.Backend
+	before func()
+}
+
+func (hook writeHook) WriteFile(bucketID, fileID string, src io.Reader) (int64, error) {
+	hook.before()
+
+	return hook.Backend.WriteFile(bucketID, fileID, src) //nolint:wrapcheck // a proxy.
+}
+
+func TestNewBackend(t *testing.T) {
+	backend, err := files.NewBackend(files.BackendConfig{
+		Type: files.BackendTypeTiered,
+		Hot:  &files.BackendConfig{Type: files.BackendTypeMemory},
+		Cold: &files.BackendConfig{Type: files.BackendTypeLocal, Path: t.TempDir()},
+	})
+	require.NoError(t, err)
+	require.NoError(t, backend.CreateFolder("1"))
+
+	_, err = files.NewBackend(files.BackendConfig{Type: "nope"})
+	require.ErrorIs(t, err, files.ErrUnknownBackend)
+
+	_, err = files.NewBackend(files.BackendConfig{Type: files.BackendTypeTiered})
+	require.ErrorIs(t, err, files.ErrBadBackendConfig)
+
+	_, err = files.NewBackend(files.BackendConfig{
+		Type:        files.BackendTypeReplicated,
+		Replicas:    []files.BackendConfig{{Type: files.BackendTypeMemory}},
+		WriteQuorum: 2,
+	})
+	require.ErrorIs(t, err, files.ErrBadBackendConfig)
+
+	require.ErrorIs(t, files.Register(files.BackendTypeLocal, nil), files.ErrBadBackendConfig)
+	assert.Contains(t, files.RegisteredBackends(), files.BackendTypeMemory)
+}
+
+func TestAppendFile(t *testing.T) {
+	backends := map[string]files.Backend{
+		"memory":    files.NewMemoryContainer(),
+		"local":     files.NewContainer(t.TempDir(), 0o600, 0o700),
+		"fanned":    files.NewFanOutContainer(t.TempDir(), 1, 0o600, 0o700),
+		"encrypted": newEncrypted(t, files.NewMemoryContainer()),
+		"replicated": files.NewReplicatedContainer(2, files.NewMemoryContainer(), files.NewMemoryContainer(),
+			files.NewMemoryContainer()),
+		"erasure": newErasure(t, nil),
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, backend.CreateFolder("1"))
+
+			_, err := backend.AppendFile("1", "a", 0, strings.NewReader("data"))
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			_, err = backend.WriteFile("1", "a", strings.NewReader("da"))
+			require.NoError(t, err)
+
+			written, err := backend.AppendFile("1", "a", 2, strings.NewReader("ta"))
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), written)
+			assert.Equal(t, "data", readAll(t, backend, "1", "a"))
+
+			// the tail past the offset is overwritten.
+			_, err = backend.AppendFile("1", "a", 3, strings.NewReader("e"))
+			require.NoError(t, err)
+			assert.Equal(t, "date", readAll(t, backend, "1", "a"))
+
+			_, err = backend.AppendFile("1", "a", 5, strings.NewReader("x"))
+			require.ErrorIs(t, err, files.ErrOffsetBeyondEnd)
+
+			// a source failing midway reports the bytes stored, which the next append resumes from.
+			written, err = backend.AppendFile("1", "a", 4,
+				io.MultiReader(strings.NewReader("xy"), iotest.ErrReader(errInjected)))
+			require.ErrorIs(t, err, errInjected)
+			assert.Equal(t, "datexy"[:4+written], readAll(t, backend, "1", "a"))
+
+			_, err = backend.AppendFile("1", "a", 4+written, strings.NewReader("xyz"[written:]))
+			require.NoError(t, err)
+			assert.Equal(t, "datexyz", readAll(t, backend, "1", "a"))
+		})
+	}
+}
+
+func TestListFolder(t *testing.T) {
+	backends := map[string]files.Backend{
+		"memory":    files.NewMemoryContainer(),
+		"local":     files.NewContainer(t.TempDir(), 0o600, 0o700),
+		"fanned":    files.NewFanOutContainer(t.TempDir(), 1, 0o600, 0o700),
+		"tiered":    files.NewTieredContainer(files.NewMemoryContainer(), files.NewMemoryContainer()),
+		"encrypted": newEncrypted(t, files.NewMemoryContainer()),
+		"replicated": files.NewReplicatedContainer(2, files.NewMemoryContainer(), files.NewMemoryContainer(),
+			files.NewMemoryContainer()),
+		"erasure": newErasure(t, nil),
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			_, err := backend.ListFolder("1")
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			require.NoError(t, backend.CreateFolder("1"))
+
+			_, err = backend.WriteFile("1", "a", strings.NewReader("data"))
+			require.NoError(t, err)
+
+			blobs, err := backend.ListFolder("1")
+			require.NoError(t, err)
+			require.Len(t, blobs, 1)
+			assert.Equal(t, "a", blobs[0].ID)
+			assert.Equal(t, int64(4), blobs[0].Size)
+			assert.False(t, blobs[0].ModTS.IsZero())
+		})
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	backends := map[string]files.Backend{
+		"memory":    files.NewMemoryContainer(),
+		"local":     files.NewContainer(t.TempDir(), 0o600, 0o700),
+		"fanned":    files.NewFanOutContainer(t.TempDir(), 1, 0o600, 0o700),
+		"encrypted": newEncrypted(t, files.NewMemoryContainer()),
+		"replicated": files.NewReplicatedContainer(2, files.NewMemoryContainer(), files.NewMemoryContainer(),
+			files.NewMemoryContainer()),
+		"erasure": newErasure(t, nil),
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, backend.CreateFolder("1"))
+			require.NoError(t, backend.CreateFolder("2"))
+
+			_, err := backend.WriteFile("1", "a", strings.NewReader("data"))
+			require.NoError(t, err)
+
+			require.NoError(t, backend.MoveFile("1", "a", "2", "b"))
+			assert.Equal(t, "data", readAll(t, backend, "2", "b"))
+
+			_, err = backend.OpenFile("1", "a")
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			require.ErrorIs(t, backend.MoveFile("1", "a", "2", "b"), fs.ErrNotExist)
+		})
+	}
+}
+
+// linker is the interface of the backends able to link a blob, as the business module sees it.
+type linker interface {
+	LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error
+}
+
+func TestLinkFile(t *testing.T) {
+	backends := map[string]files.Backend{
+		"memory":    files.NewMemoryContainer(),
+		"local":     files.NewContainer(t.TempDir(), 0o600, 0o700),
+		"fanned":    files.NewFanOutContainer(t.TempDir(), 1, 0o600, 0o700),
+		"tiered":    files.NewTieredContainer(files.NewMemoryContainer(), files.NewMemoryContainer()),
+		"encrypted": newEncrypted(t, files.NewMemoryContainer()),
+		"replicated": files.NewReplicatedContainer(2, files.NewMemoryContainer(), files.NewMemoryContainer(),
+			files.NewMemoryContainer()),
+		"erasure": newErasure(t, nil),
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, backend.CreateFolder("1"))
+			require.NoError(t, backend.CreateFolder("2"))
+
+			_, err := backend.WriteFile("1", "a", strings.NewReader("data"))
+			require.NoError(t, err)
+
+			require.Implements(t, (*linker)(nil), backend)
+			require.NoError(t, backend.(linker).LinkFile("1", "a", "2", "b"))
+			assert.Equal(t, "data", readAll(t, backend, "2", "b"))
+
+			// the copies are independent.
+			_, err = backend.WriteFile("1", "a", strings.NewReader("new data"))
+			require.NoError(t, err)
+			assert.Equal(t, "data", readAll(t, backend, "2", "b"))
+
+			require.NoError(t, backend.DeleteFile("2", "b"))
+			assert.Equal(t, "new data", readAll(t, backend, "1", "a"))
+
+			require.ErrorIs(t, backend.(linker).LinkFile("1", "x", "2", "y"), fs.ErrNotExist)
+		})
+	}
+
+	// a wrapped backend that can't link.
+	encrypted := newEncrypted(t, struct{ files.Backend }{files.NewMemoryContainer()})
+	require.NoError(t, encrypted.CreateFolder("1"))
+
+	_, err := encrypted.WriteFile("1", "a", strings.NewReader("data"))
+	require.NoError(t, err)
+	require.ErrorIs(t, encrypted.LinkFile("1", "a", "1", "b"), errors.ErrUnsupported)
+}
+
+func TestEncryptedContainer(t *testing.T) {
+	inner := files.NewMemoryContainer()
+	oldKey := files.MasterKey{ID: 1, Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := files.MasterKey{ID: 2, Key: bytes.Repeat([]byte{2}, 32)}
+	encrypted := newEncrypted(t, inner, oldKey)
+
+	require.NoError(t, encrypted.CreateFolder("1"))
+
+	// a few chunks with a short tail.
+	content := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+
+	written, err := encrypted.WriteFile("1", "a", bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), written)
+	assert.NotContains(t, readAll(t, inner, "1", "a.gs3e"), "0123456789abcdef")
+
+	file, err := encrypted.OpenFile("1", "a")
+	require.NoError(t, err)
+
+	size, err := file.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	// a range across the chunk boundary.
+	_, err = file.Seek(65530, io.SeekStart)
+	require.NoError(t, err)
+
+	part := make([]byte, 20)
+	_, err = io.ReadFull(file, part)
+	require.NoError(t, err)
+	assert.Equal(t, content[65530:65550], part)
+	require.NoError(t, file.Close())
+
+	// an append within a chunk reseals it.
+	written, err = encrypted.AppendFile("1", "a", 70000, strings.NewReader("tail"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), written)
+
+	content = append(content[:70000], "tail"...)
+	assert.Equal(t, string(content), readAll(t, encrypted, "1", "a"))
+
+	// the blobs stored before the encryption are served as they are.
+	_, err = inner.WriteFile("1", "plain", strings.NewReader("data"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", readAll(t, encrypted, "1", "plain"))
+
+	// so are the ones starting with the magic, whatever the key id.
+	lookalike := "GS3E\x01\x00\x00\x00\x07" + strings.Repeat("not a data key, ", 5)
+
+	_, err = inner.WriteFile("1", "lookalike", strings.NewReader(lookalike))
+	require.NoError(t, err)
+	assert.Equal(t, lookalike, readAll(t, encrypted, "1", "lookalike"))
+
+	blobs, err := encrypted.ListFolder("1")
+	require.NoError(t, err)
+
+	for _, blob := range blobs {
+		if blob.ID == "lookalike" {
+			assert.Equal(t, int64(len(lookalike)), blob.Size)
+		}
+	}
+
+	written, err = encrypted.AppendFile("1", "lookalike", int64(len(lookalike)), strings.NewReader("tail"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), written)
+
+	lookalike += "tail"
+	assert.Equal(t, lookalike, readAll(t, encrypted, "1", "lookalike"))
+
+	// an encrypted blob whose header doesn't authenticate is never served as it is.
+	_, err = encrypted.WriteFile("1", "damaged", strings.NewReader("data"))
+	require.NoError(t, err)
+
+	damaged := []byte(readAll(t, inner, "1", "damaged.gs3e"))
+	damaged[20] ^= 1
+
+	_, err = inner.WriteFile("1", "damaged.gs3e", bytes.NewReader(damaged))
+	require.NoError(t, err)
+
+	_, err = encrypted.OpenFile("1", "damaged")
+	require.ErrorIs(t, err, files.ErrCorruptBlob)
+
+	_, err = encrypted.AppendFile("1", "damaged", 4, strings.NewReader("tail"))
+	require.ErrorIs(t, err, files.ErrCorruptBlob)
+
+	_, err = encrypted.Rewrap("1", "damaged")
+	require.ErrorIs(t, err, files.ErrCorruptBlob)
+	require.NoError(t, encrypted.DeleteFile("1", "damaged"))
+
+	// rotation: the old key is kept to read until the blobs are rewrapped.
+	rotated := newEncrypted(t, inner, newKey, oldKey)
+
+	for _, fileID := range []string{"a", "plain", "lookalike"} {
+		rewrapped, err := rotated.Rewrap("1", fileID)
+		require.NoError(t, err)
+		assert.True(t, rewrapped)
+	}
+
+	rewrapped, err := rotated.Rewrap("1", "a")
+	require.NoError(t, err)
+	assert.False(t, rewrapped)
+
+	newOnly := newEncrypted(t, inner, newKey)
+	assert.Equal(t, string(content), readAll(t, newOnly, "1", "a"))
+	assert.Equal(t, "data", readAll(t, newOnly, "1", "plain"))
+	assert.NotContains(t, readAll(t, inner, "1", "plain.gs3e"), "data")
+
+	_, err = inner.OpenFile("1", "plain")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, lookalike, readAll(t, newOnly, "1", "lookalike"))
+
+	_, err = encrypted.OpenFile("1", "a")
+	require.ErrorIs(t, err, files.ErrUnknownMasterKey)
+
+	blobs, err = newOnly.ListFolder("1")
+	require.NoError(t, err)
+	require.Len(t, blobs, 3)
+
+	for _, blob := range blobs {
+		if blob.ID == "lookalike" {
+			assert.Equal(t, int64(len(lookalike)), blob.Size)
+		}
+	}
+}
+
+func TestGzipFrames(t *testing.T) {
+	content := bytes.Repeat([]byte(`{"level":"info","msg":"compressible"}`+"\n"), 20000)
+
+	for _, size := range []int{0, 10, len(content)} {
+		framer := files.NewGzipFramer(bytes.NewReader(content[:size]))
+
+		stored, err := io.ReadAll(framer)
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), framer.Size)
+		assert.Equal(t, int64(len(stored)), framer.Stored)
+
+		// the stored form is a plain gzip stream.
+		gzipReader, err := gzip.NewReader(bytes.NewReader(stored))
+		require.NoError(t, err)
+
+		decoded, err := io.ReadAll(gzipReader)
+		require.NoError(t, err)
+		assert.Equal(t, content[:size], decoded)
+
+		reader, err := files.NewGzipFrameReader(nopCloser(stored))
+		require.NoError(t, err)
+
+		end, err := reader.Seek(0, io.SeekEnd)
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), end)
+
+		if size == len(content) {
+			assert.Less(t, len(stored), size/10)
+
+			// a range across the frame boundary.
+			_, err = reader.Seek(files.GzipFrameSize-5, io.SeekStart)
+			require.NoError(t, err)
+
+			part := make([]byte, 10)
+			_, err = io.ReadFull(reader, part)
+			require.NoError(t, err)
+			assert.Equal(t, content[files.GzipFrameSize-5:files.GzipFrameSize+5], part)
+		}
+
+		require.NoError(t, reader.Close())
+	}
+
+	_, err := files.NewGzipFrameReader(nopCloser([]byte("not framed")))
+	require.ErrorIs(t, err, files.ErrCorruptFrames)
+}
+
+// failingBackend fails the writes, keeping the blobs it has.
+type failingBackend struct {
+	files.Backend
+}
+
+func (failingBackend) WriteFile(string, string, io.Reader) (int64, error) {
+	return 0, errInjected
+}
+
+func TestReplicatedContainer(t *testing.T) {
+	healthy := []files.Backend{
+		files.NewContainer(t.TempDir(), 0o600, 0o700),
+		files.NewContainer(t.TempDir(), 0o600, 0o700),
+	}
+	broken := files.NewMemoryContainer()
+	container := files.NewReplicatedContainer(2, healthy[0], healthy[1], failingBackend{broken})
+
+	require.NoError(t, container.CreateFolder("1"))
+	require.ErrorIs(t, container.CreateFolder("1"), fs.ErrExist)
+
+	// the stale blob of the failing replica is removed once the quorum is made.
+	_, err := broken.WriteFile("1", "a", strings.NewReader("stale"))
+	require.NoError(t, err)
+
+	written, err := container.WriteFile("1", "a", strings.NewReader("data"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), written)
+
+	_, err = broken.OpenFile("1", "a")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	for _, replica := range healthy {
+		assert.Equal(t, "data", readAll(t, replica, "1", "a"))
+	}
+
+	// the reads fall back to a replica having the blob, the repair restores the copies.
+	require.NoError(t, healthy[0].DeleteFile("1", "a"))
+	assert.Equal(t, "data", readAll(t, container, "1", "a"))
+
+	// the failed replica is back.
+	repaired := files.NewReplicatedContainer(2, healthy[0], healthy[1], broken)
+
+	copies, err := repaired.RepairFolder("1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, copies)
+	assert.Equal(t, "data", readAll(t, healthy[0], "1", "a"))
+	assert.Equal(t, "data", readAll(t, broken, "1", "a"))
+
+	// no quorum without the failing replica.
+	strict := files.NewReplicatedContainer(3, healthy[0], healthy[1], failingBackend{broken})
+
+	_, err = strict.WriteFile("1", "b", bytes.NewReader(bytes.Repeat([]byte("x"), 100<<10)))
+	require.ErrorIs(t, err, files.ErrNoQuorum)
+
+	// the reader errors abort the write on every replica.
+	_, err = container.WriteFile("1", "c", &crashingReader{
+		src: strings.NewReader("data"), left: 2, crash: func() {},
+	})
+	require.ErrorIs(t, err, errInjected)
+
+	_, err = container.OpenFile("1", "c")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, container.DeleteFile("1", "a"))
+	require.ErrorIs(t, container.DeleteFile("1", "a"), fs.ErrNotExist)
+}
+
+func TestErasureContainer(t *testing.T) {
+	shards := make([]files.Backend, 5)
+	for i := range shards {
+		shards[i] = files.NewContainer(t.TempDir(), 0o600, 0o700)
+	}
+
+	container := newErasure(t, shards)
+
+	require.NoError(t, container.CreateFolder("1"))
+
+	// a few stripes, the last one short.
+	content := make([]byte, 3*3*files.ErasureChunkSize+1000)
+	for i := range content {
+		content[i] = byte(i * 7 % 251)
+	}
+
+	for _, size := range []int{0, 1, 5, len(content)} {
+		written, err := container.WriteFile("1", "a", bytes.NewReader(content[:size]))
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), written)
+		assert.Equal(t, string(content[:size]), readAll(t, container, "1", "a"))
+	}
+
+	// any two shards may be lost.
+	for _, pair := range [][2]int{{0, 1}, {1, 4}, {3, 4}, {0, 3}} {
+		degraded := make([]files.Backend, len(shards))
+		copy(degraded, shards)
+
+		for _, i := range pair {
+			degraded[i] = files.NewMemoryContainer()
+		}
+
+		assert.Equal(t, string(content), readAll(t, newErasure(t, degraded), "1", "a"), pair)
+	}
+
+	// a damaged chunk is restored from the other shards, the reads seek.
+	shardPath := t.TempDir()
+	damaged := files.NewContainer(shardPath, 0o600, 0o700)
+	require.NoError(t, damaged.CreateFolder("1"))
+
+	shard, err := shards[1].OpenFile("1", "a")
+	require.NoError(t, err)
+
+	shardContent, err := io.ReadAll(shard)
+	require.NoError(t, err)
+	require.NoError(t, shard.Close())
+
+	shardContent[files.ErasureChunkSize+10] ^= 0xff
+
+	_, err = damaged.WriteFile("1", "a", bytes.NewReader(shardContent))
+	require.NoError(t, err)
+
+	file, err := newErasure(t, []files.Backend{shards[0], damaged, shards[2], shards[3], files.NewMemoryContainer()}).
+		OpenFile("1", "a")
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	offset := int64(4*files.ErasureChunkSize - 100)
+
+	_, err = file.Seek(offset, io.SeekStart)
+	require.NoError(t, err)
+
+	part := make([]byte, 300)
+
+	_, err = io.ReadFull(file, part)
+	require.NoError(t, err)
+	assert.Equal(t, content[offset:offset+300], part)
+
+	// three lost shards are too many.
+	_, err = newErasure(t, []files.Backend{shards[0], files.NewMemoryContainer(), shards[2], files.NewMemoryContainer(),
+		files.NewMemoryContainer()}).OpenFile("1", "a")
+	require.ErrorIs(t, err, files.ErrTooFewShards)
+
+	// the shards of a previous write are not mixed in.
+	stale, err := shards[4].OpenFile("1", "a")
+	require.NoError(t, err)
+
+	staleContent, err := io.ReadAll(stale)
+	require.NoError(t, err)
+	require.NoError(t, stale.Close())
+
+	_, err = container.WriteFile("1", "a", strings.NewReader("fresh"))
+	require.NoError(t, err)
+
+	_, err = shards[4].WriteFile("1", "a", bytes.NewReader(staleContent))
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", readAll(t, container, "1", "a"))
+
+	// the listing reports the size of the content.
+	blobs, err := container.ListFolder("1")
+	require.NoError(t, err)
+	require.Len(t, blobs, 1)
+	assert.Equal(t, int64(5), blobs[0].Size)
+}
+
+func TestErasureAppendFile(t *testing.T) {
+	shards := make([]files.Backend, 5)
+	for i := range shards {
+		shards[i] = files.NewMemoryContainer()
+	}
+
+	container := newErasure(t, shards)
+
+	require.NoError(t, container.CreateFolder("1"))
+
+	content := make([]byte, 5*3*files.ErasureChunkSize+1000)
+	for i := range content {
+		content[i] = byte(i * 7 % 251)
+	}
+
+	_, err := container.WriteFile("1", "a", bytes.NewReader(nil))
+	require.NoError(t, err)
+
+	// the chunks across the stripe boundaries, one of them ending at a boundary.
+	var offset int64
+
+	for _, size := range []int64{1000, 3*files.ErasureChunkSize - 1000, 7, 4 * files.ErasureChunkSize, 1} {
+		written, err := container.AppendFile("1", "a", offset, bytes.NewReader(content[offset:offset+size]))
+		require.NoError(t, err)
+		assert.Equal(t, size, written)
+
+		offset += size
+		assert.Equal(t, string(content[:offset]), readAll(t, container, "1", "a"))
+	}
+
+	// a source failing past a few stripes keeps them.
+	written, err := container.AppendFile("1", "a", offset, io.MultiReader(
+		bytes.NewReader(content[offset:offset+4*files.ErasureChunkSize]), iotest.ErrReader(errInjected)))
+	require.ErrorIs(t, err, errInjected)
+	assert.Equal(t, int64(4*files.ErasureChunkSize), written)
+
+	offset += written
+	assert.Equal(t, string(content[:offset]), readAll(t, container, "1", "a"))
+
+	// any two shards may still be lost.
+	degraded := []files.Backend{files.NewMemoryContainer(), shards[1], shards[2], shards[3], files.NewMemoryContainer()}
+	assert.Equal(t, string(content[:offset]), readAll(t, newErasure(t, degraded), "1", "a"))
+
+	// the tail past the offset is dropped.
+	offset -= 3 * files.ErasureChunkSize
+
+	_, err = container.AppendFile("1", "a", offset, bytes.NewReader(content[offset:offset+10]))
+	require.NoError(t, err)
+	assert.Equal(t, string(content[:offset+10]), readAll(t, container, "1", "a"))
+
+	// a blob missing a shard is rewritten, which restores the shard.
+	require.NoError(t, shards[0].DeleteFile("1", "a"))
+
+	_, err = container.AppendFile("1", "a", offset+10, bytes.NewReader(content[offset+10:]))
+	require.NoError(t, err)
+	assert.Equal(t, string(content), readAll(t, container, "1", "a"))
+
+	degraded = []files.Backend{shards[0], files.NewMemoryContainer(), shards[2], files.NewMemoryContainer(), shards[4]}
+	assert.Equal(t, string(content), readAll(t, newErasure(t, degraded), "1", "a"))
+}
+
+// appendFaults counts the next appends to fail midway, and the ones to fail once all of src is stored.
+type appendFaults struct {
+	midway, atEnd int
+}
+
+// faultyAppends cuts the blob at the offset and fails the appends as told by the faults.
+type faultyAppends struct {
+	files.Backend
+	faults *appendFaults
+}
+
+func (backend faultyAppends) AppendFile(bucketID, fileID string, offset int64, src io.Reader) (int64, error) {
+	if backend.faults.midway > 0 {
+		backend.faults.midway--
+		src = io.MultiReader(io.LimitReader(src, 100), iotest.ErrReader(errInjected))
+	}
+
+	written, err := backend.Backend.AppendFile(bucketID, fileID, offset, src)
+	if err == nil && backend.faults.atEnd > 0 {
+		backend.faults.atEnd--
+		err = errInjected
+	}
+
+	return written, err //nolint:wrapcheck // a proxy.
+}
+
+func TestErasureAppendFileNoQuorum(t *testing.T) {
+	faults := make([]appendFaults, 5)
+	shards := make([]files.Backend, len(faults))
+
+	for i := range shards {
+		shards[i] = faultyAppends{Backend: files.NewMemoryContainer(), faults: &faults[i]}
+	}
+
+	container := newErasure(t, shards)
+
+	require.NoError(t, container.CreateFolder("1"))
+
+	content := make([]byte, 3*3*files.ErasureChunkSize)
+	for i := range content {
+		content[i] = byte(i * 7 % 251)
+	}
+
+	offset := int64(3*files.ErasureChunkSize + 1000)
+
+	_, err := container.WriteFile("1", "a", bytes.NewReader(content[:offset]))
+	require.NoError(t, err)
+
+	// the data shards count of the shards got the append, which reads back.
+	faults[0].atEnd, faults[4].atEnd = 1, 1
+
+	written, err := container.AppendFile("1", "a", offset, bytes.NewReader(content[offset:offset+5000]))
+	require.ErrorIs(t, err, files.ErrNoQuorum)
+	assert.Equal(t, int64(5000), written)
+
+	offset += written
+	assert.Equal(t, string(content[:offset]), readAll(t, container, "1", "a"))
+
+	// too few shards got the append, the content before it is written back.
+	faults[0].midway, faults[1].midway, faults[2].midway = 1, 1, 1
+
+	written, err = container.AppendFile("1", "a", offset, bytes.NewReader(content[offset:]))
+	require.ErrorIs(t, err, files.ErrNoQuorum)
+	assert.Equal(t, int64(0), written)
+	assert.Equal(t, string(content[:offset]), readAll(t, container, "1", "a"))
+
+	written, err = container.AppendFile("1", "a", offset, bytes.NewReader(content[offset:]))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content))-offset, written)
+	assert.Equal(t, string(content), readAll(t, container, "1", "a"))
+}
@@ -0,0 +1,360 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// The gzip framed blob layout, every part being a gzip member:
+//
+//	frames: the content compressed in frames of GzipFrameSize bytes
+//	index:  empty members carrying the offsets of the frames in their extra field
+//	footer: an empty member of gzipFooterSize bytes carrying the offset of the index, the frames count and the size
+//
+// A concatenation of gzip members is a gzip stream itself, so the blob can be served as is with
+// the gzip content encoding, while the index allows decompressing any range without the preceding frames.
+const (
+	ContentEncodingGzip = "gzip"
+	GzipFrameSize       = 256 << 10
+
+	gzipIndexPerMember = 8000
+	gzipFooterDataSize = 3 * 8
+	// a member: header with the extra field, an empty deflate block, CRC-32 and size.
+	gzipMemberOverhead = 10 + 2 + 4 + 2 + 8
+	gzipFooterSize     = gzipMemberOverhead + gzipFooterDataSize
+)
+
+var (
+	gzipIndexID  = [2]byte{'G', 'I'}
+	gzipFooterID = [2]byte{'G', 'F'}
+
+	ErrCorruptFrames = errors.New("gzip framed blob is corrupt")
+)
+
+// emptyGzipMember returns a gzip member without content whose extra field holds the data under the subfield id.
+func emptyGzipMember(subfieldID [2]byte, data []byte) []byte {
+	member := make([]byte, 0, gzipMemberOverhead+len(data))
+	// magic, deflate, FEXTRA, no mtime, no extra flags, unknown OS.
+	member = append(member, 0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff)
+	member = binary.LittleEndian.AppendUint16(member, uint16(4+len(data))) //nolint:gosec // bounded by the callers.
+	member = append(member, subfieldID[:]...)
+	member = binary.LittleEndian.AppendUint16(member, uint16(len(data))) //nolint:gosec // bounded by the callers.
+	member = append(member, data...)
+	// the final fixed Huffman block with no symbols, the CRC-32 and the size of nothing.
+	member = append(member, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	return member
+}
+
+// parseEmptyGzipMember returns the data of a member built by emptyGzipMember along with the member size.
+func parseEmptyGzipMember(src []byte, subfieldID [2]byte) ([]byte, int, error) {
+	if len(src) < gzipMemberOverhead || src[0] != 0x1f || src[1] != 0x8b || src[3] != 4 {
+		return nil, 0, ErrCorruptFrames
+	}
+
+	dataLen := int(binary.LittleEndian.Uint16(src[14:16]))
+	size := gzipMemberOverhead + dataLen
+
+	if len(src) < size || src[12] != subfieldID[0] || src[13] != subfieldID[1] ||
+		int(binary.LittleEndian.Uint16(src[10:12])) != 4+dataLen {
+		return nil, 0, ErrCorruptFrames
+	}
+
+	return src[16 : 16+dataLen], size, nil
+}
+
+// GzipFramer compresses src into the framed layout as it's read.
+type GzipFramer struct {
+	src     io.Reader
+	err     error
+	plain   []byte
+	pending bytes.Buffer
+	offsets []uint64
+	// Size is the number of bytes read from src, Stored is the number of the compressed bytes produced.
+	Size   int64
+	Stored int64
+	done   bool
+}
+
+func NewGzipFramer(src io.Reader) *GzipFramer {
+	return &GzipFramer{ //nolint:exhaustruct // the rest is the state.
+		src:   src,
+		plain: make([]byte, GzipFrameSize),
+	}
+}
+
+func (framer *GzipFramer) Read(dst []byte) (int, error) {
+	for framer.pending.Len() == 0 {
+		if framer.err != nil {
+			return 0, framer.err
+		}
+
+		framer.fill()
+	}
+
+	read, _ := framer.pending.Read(dst)
+	framer.Stored += int64(read)
+
+	return read, nil
+}
+
+// fill compresses the next frame, or writes the index and the footer once src is over.
+func (framer *GzipFramer) fill() {
+	if framer.done {
+		framer.err = io.EOF
+
+		return
+	}
+
+	read, err := io.ReadFull(framer.src, framer.plain)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+		framer.done = true
+	}
+
+	if err != nil {
+		framer.err = err
+
+		return
+	}
+
+	if read > 0 {
+		frameOffset := framer.Stored + int64(framer.pending.Len())
+		framer.offsets = append(framer.offsets, uint64(frameOffset)) //nolint:gosec // never negative.
+		framer.Size += int64(read)
+
+		writer := gzip.NewWriter(&framer.pending)
+
+		_, err = writer.Write(framer.plain[:read])
+		if err == nil {
+			err = writer.Close()
+		}
+
+		if err != nil {
+			framer.err = fmt.Errorf("GzipFramer gzip: %w", err)
+		}
+	}
+
+	if framer.done {
+		framer.writeIndex()
+	}
+}
+
+func (framer *GzipFramer) writeIndex() {
+	indexOffset := framer.Stored + int64(framer.pending.Len())
+
+	for start := 0; start < len(framer.offsets); start += gzipIndexPerMember {
+		data := make([]byte, 0, 8*gzipIndexPerMember)
+
+		for _, offset := range framer.offsets[start:min(start+gzipIndexPerMember, len(framer.offsets))] {
+			data = binary.BigEndian.AppendUint64(data, offset)
+		}
+
+		framer.pending.Write(emptyGzipMember(gzipIndexID, data))
+	}
+
+	footer := make([]byte, 0, gzipFooterDataSize)
+	footer = binary.BigEndian.AppendUint64(footer, uint64(indexOffset))         //nolint:gosec // never negative.
+	footer = binary.BigEndian.AppendUint64(footer, uint64(len(framer.offsets))) //nolint:gosec // never negative.
+	footer = binary.BigEndian.AppendUint64(footer, uint64(framer.Size))         //nolint:gosec // never negative.
+
+	framer.pending.Write(emptyGzipMember(gzipFooterID, footer))
+}
+
+// gzipFrameReader decompresses the framed blob frame by frame, keeping the last decompressed frame.
+type gzipFrameReader struct {
+	src     io.ReadSeekCloser
+	offsets []int64
+	plain   []byte
+	size    int64
+	pos     int64
+	frame   int
+}
+
+// NewGzipFrameReader returns the seekable decompressed view of the framed blob, taking over src.
+func NewGzipFrameReader(src io.ReadSeekCloser) (io.ReadSeekCloser, error) {
+	reader, err := newGzipFrameReader(src)
+	if err != nil {
+		src.Close()
+
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func newGzipFrameReader(src io.ReadSeekCloser) (*gzipFrameReader, error) {
+	storedSize, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("NewGzipFrameReader Seek: %w", err)
+	}
+
+	if storedSize < gzipFooterSize {
+		return nil, ErrCorruptFrames
+	}
+
+	footerOffset := storedSize - gzipFooterSize
+
+	footer, err := readAt(src, footerOffset, gzipFooterSize)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := parseEmptyGzipMember(footer, gzipFooterID)
+	if err != nil || len(data) != gzipFooterDataSize {
+		return nil, ErrCorruptFrames
+	}
+
+	indexOffset := int64(binary.BigEndian.Uint64(data[0:8]))  //nolint:gosec // checked below.
+	framesCount := int64(binary.BigEndian.Uint64(data[8:16])) //nolint:gosec // checked below.
+	size := int64(binary.BigEndian.Uint64(data[16:24]))       //nolint:gosec // checked below.
+
+	if indexOffset < 0 || indexOffset > footerOffset || framesCount < 0 || size < 0 ||
+		framesCount != (size+GzipFrameSize-1)/GzipFrameSize || framesCount > (footerOffset-indexOffset)/8 {
+		return nil, ErrCorruptFrames
+	}
+
+	index, err := readAt(src, indexOffset, footerOffset-indexOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int64, 0, framesCount+1)
+
+	for len(index) > 0 {
+		data, memberSize, err := parseEmptyGzipMember(index, gzipIndexID)
+		if err != nil || len(data)%8 != 0 {
+			return nil, ErrCorruptFrames
+		}
+
+		for i := 0; i < len(data); i += 8 {
+			offsets = append(offsets, int64(binary.BigEndian.Uint64(data[i:i+8]))) //nolint:gosec // checked below.
+		}
+
+		index = index[memberSize:]
+	}
+
+	if int64(len(offsets)) != framesCount {
+		return nil, ErrCorruptFrames
+	}
+
+	// the end of the last frame.
+	offsets = append(offsets, indexOffset)
+
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] <= offsets[i-1] {
+			return nil, ErrCorruptFrames
+		}
+	}
+
+	return &gzipFrameReader{
+		src:     src,
+		offsets: offsets,
+		plain:   make([]byte, 0, GzipFrameSize),
+		size:    size,
+		pos:     0,
+		frame:   -1,
+	}, nil
+}
+
+func readAt(src io.ReadSeeker, offset, length int64) ([]byte, error) {
+	_, err := src.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("readAt Seek: %w", err)
+	}
+
+	buf := make([]byte, length)
+
+	_, err = io.ReadFull(src, buf)
+	if err != nil {
+		return nil, fmt.Errorf("readAt io.ReadFull: %w", err)
+	}
+
+	return buf, nil
+}
+
+func (reader *gzipFrameReader) loadFrame(frame int) error {
+	if frame == reader.frame {
+		return nil
+	}
+
+	_, err := reader.src.Seek(reader.offsets[frame], io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("gzipFrameReader.loadFrame Seek: %w", err)
+	}
+
+	reader.frame = -1
+
+	gzipReader, err := gzip.NewReader(io.LimitReader(reader.src, reader.offsets[frame+1]-reader.offsets[frame]))
+	if err != nil {
+		return fmt.Errorf("gzipFrameReader.loadFrame frame %d: %w", frame, ErrCorruptFrames)
+	}
+
+	buf := bytes.NewBuffer(reader.plain[:0])
+
+	_, err = io.Copy(buf, io.LimitReader(gzipReader, GzipFrameSize+1))
+	if err != nil {
+		return fmt.Errorf("gzipFrameReader.loadFrame frame %d: %w", frame, errors.Join(ErrCorruptFrames, err))
+	}
+
+	reader.plain = buf.Bytes()
+
+	expected := min(reader.size-int64(frame)*GzipFrameSize, GzipFrameSize)
+	if int64(len(reader.plain)) != expected {
+		return fmt.Errorf("gzipFrameReader.loadFrame frame %d: %w", frame, ErrCorruptFrames)
+	}
+
+	reader.frame = frame
+
+	return nil
+}
+
+func (reader *gzipFrameReader) Read(dst []byte) (int, error) {
+	if reader.pos >= reader.size {
+		return 0, io.EOF
+	}
+
+	frame := int(reader.pos / GzipFrameSize)
+
+	err := reader.loadFrame(frame)
+	if err != nil {
+		return 0, err
+	}
+
+	copied := copy(dst, reader.plain[reader.pos-int64(frame)*GzipFrameSize:])
+	reader.pos += int64(copied)
+
+	return copied, nil
+}
+
+func (reader *gzipFrameReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = reader.pos + offset
+	case io.SeekEnd:
+		pos = reader.size + offset
+	default:
+		return 0, fmt.Errorf("gzipFrameReader.Seek whence %d: %w", whence, fs.ErrInvalid)
+	}
+
+	if pos < 0 {
+		return 0, fmt.Errorf("gzipFrameReader.Seek to %d: %w", pos, fs.ErrInvalid)
+	}
+
+	reader.pos = pos
+
+	return pos, nil
+}
+
+func (reader *gzipFrameReader) Close() error {
+	return reader.src.Close() //nolint:wrapcheck // a proxy.
+}
@@ -0,0 +1,756 @@
+package files
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/eldarbr/go-s3/internal/model"
+)
+
+// The encrypted blob layout:
+//
+//	header: "GS3E" | version | master key id, uint32 | nonce | data key sealed by the master key
+//	chunks: nonce | plaintext chunk of encChunkSize bytes sealed by the data key, the last one may be shorter
+//
+// Every chunk has a random nonce and its index as the additional data, so the chunks can't be reordered
+// and the tail chunk rewritten by an append never reuses a nonce. The fixed chunk size maps any plaintext
+// offset to its chunk, which keeps the blobs seekable.
+const (
+	encMagic           = "GS3E"
+	encVersion         = 1
+	encChunkSize       = 64 << 10
+	encKeySize         = 32
+	encNonceSize       = 12
+	encTagSize         = 16
+	encPrefixSize      = 4 + 1 + 4 // magic, version, key id.
+	encHeaderSize      = encPrefixSize + encNonceSize + encKeySize + encTagSize
+	encChunkOverhead   = encNonceSize + encTagSize
+	encSealedChunkSize = encChunkSize + encChunkOverhead
+	rewrapSuffix       = ".rewrap"
+	encBlobSuffix      = ".gs3e"
+)
+
+var (
+	ErrBadMasterKey     = errors.New("bad master key")
+	ErrUnknownMasterKey = errors.New("blob is encrypted with an unknown master key")
+	ErrCorruptBlob      = errors.New("encrypted blob is corrupt")
+)
+
+type MasterKey struct {
+	Key []byte
+	ID  uint32
+}
+
+// KeyRing holds the master keys wrapping the data keys. The first key wraps the new data keys,
+// the others are only kept to unwrap the data keys wrapped before a rotation.
+type KeyRing struct {
+	aeads   map[uint32]cipher.AEAD
+	current uint32
+}
+
+func NewKeyRing(keys ...MasterKey) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("NewKeyRing no keys: %w", ErrBadMasterKey)
+	}
+
+	ring := &KeyRing{
+		aeads:   make(map[uint32]cipher.AEAD, len(keys)),
+		current: keys[0].ID,
+	}
+
+	for _, key := range keys {
+		if len(key.Key) != encKeySize {
+			return nil, fmt.Errorf("NewKeyRing key %d is not %d bytes long: %w", key.ID, encKeySize, ErrBadMasterKey)
+		}
+
+		if _, exists := ring.aeads[key.ID]; exists {
+			return nil, fmt.Errorf("NewKeyRing duplicate key %d: %w", key.ID, ErrBadMasterKey)
+		}
+
+		aead, err := newGCM(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("NewKeyRing key %d: %w", key.ID, err)
+		}
+
+		ring.aeads[key.ID] = aead
+	}
+
+	return ring, nil
+}
+
+// wrap returns the blob header carrying the data key sealed by the current master key.
+func (ring *KeyRing) wrap(dataKey []byte) ([]byte, error) {
+	header := make([]byte, 0, encHeaderSize)
+	header = append(header, encMagic...)
+	header = append(header, encVersion)
+	header = binary.BigEndian.AppendUint32(header, ring.current)
+
+	var nonce [encNonceSize]byte
+
+	_, err := rand.Read(nonce[:])
+	if err != nil {
+		return nil, fmt.Errorf("KeyRing.wrap rand.Read: %w", err)
+	}
+
+	prefix := bytes.Clone(header)
+	header = append(header, nonce[:]...)
+
+	return ring.aeads[ring.current].Seal(header, nonce[:], dataKey, prefix), nil
+}
+
+// unwrap returns the data key of the blob header.
+func (ring *KeyRing) unwrap(header []byte) ([]byte, error) {
+	if len(header) != encHeaderSize || header[len(encMagic)] != encVersion {
+		return nil, ErrCorruptBlob
+	}
+
+	keyID := binary.BigEndian.Uint32(header[len(encMagic)+1 : encPrefixSize])
+
+	aead, ok := ring.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("KeyRing.unwrap key %d: %w", keyID, ErrUnknownMasterKey)
+	}
+
+	dataKey, err := aead.Open(nil, header[encPrefixSize:encPrefixSize+encNonceSize],
+		header[encPrefixSize+encNonceSize:], header[:encPrefixSize])
+	if err != nil {
+		return nil, fmt.Errorf("KeyRing.unwrap key %d: %w", keyID, ErrCorruptBlob)
+	}
+
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("newGCM aes.NewCipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("newGCM cipher.NewGCM: %w", err)
+	}
+
+	return aead, nil
+}
+
+// EncryptedContainer encrypts the blobs of the wrapped backend with a random data key per blob,
+// the data key being stored in the blob header wrapped by a master key.
+// The encrypted blobs are kept under their ids with encBlobSuffix, so the blobs stored before the encryption
+// was enabled, kept under the ids as they are, are told from them by the name and served as they are
+// until rewrapped.
+type EncryptedContainer struct {
+	inner Backend
+	keys  *KeyRing
+}
+
+func NewEncryptedContainer(inner Backend, keys *KeyRing) *EncryptedContainer {
+	return &EncryptedContainer{
+		inner: inner,
+		keys:  keys,
+	}
+}
+
+// encryptedID is the id the inner backend keeps the encrypted blob under.
+func encryptedID(fileID string) string {
+	return fileID + encBlobSuffix
+}
+
+// openBlob opens the encrypted blob, or the plaintext one if there is no encrypted blob,
+// and reports whether the blob opened is encrypted.
+func (container EncryptedContainer) openBlob(bucketID, fileID string) (io.ReadSeekCloser, bool, error) {
+	file, err := container.inner.OpenFile(bucketID, encryptedID(fileID))
+	if err == nil {
+		return file, true, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, fmt.Errorf("EncryptedContainer.openBlob: %w", err)
+	}
+
+	file, err = container.inner.OpenFile(bucketID, fileID)
+	if err != nil {
+		return nil, false, fmt.Errorf("EncryptedContainer.openBlob: %w", err)
+	}
+
+	return file, false, nil
+}
+
+// dropPlaintext removes the plaintext blob shadowed by the encrypted one. A blob left behind
+// is never served while the encrypted one is there, so the removal is only best effort.
+func (container EncryptedContainer) dropPlaintext(bucketID, fileID string) {
+	_ = container.inner.DeleteFile(bucketID, fileID)
+}
+
+func (container EncryptedContainer) WriteFile(bucketID, fileID string, src io.Reader) (int64, error) {
+	dataKey := make([]byte, encKeySize)
+
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return 0, fmt.Errorf("EncryptedContainer.WriteFile rand.Read: %w", err)
+	}
+
+	header, err := container.keys.wrap(dataKey)
+	if err != nil {
+		return 0, fmt.Errorf("EncryptedContainer.WriteFile: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return 0, fmt.Errorf("EncryptedContainer.WriteFile: %w", err)
+	}
+
+	sealer := newSealingReader(src, aead, 0, nil)
+
+	_, err = container.inner.WriteFile(bucketID, encryptedID(fileID), io.MultiReader(bytes.NewReader(header), sealer))
+	if err != nil {
+		return sealer.consumed, fmt.Errorf("EncryptedContainer.WriteFile: %w", err)
+	}
+
+	container.dropPlaintext(bucketID, fileID)
+
+	return sealer.consumed, nil
+}
+
+// AppendFile reseals the chunk the offset falls into and appends the rest after it.
+// The plaintext blobs are appended to as they are.
+func (container EncryptedContainer) AppendFile(bucketID, fileID string, offset int64, src io.Reader) (int64, error) {
+	file, encrypted, err := container.openBlob(bucketID, fileID)
+	if err != nil {
+		return 0, fmt.Errorf("EncryptedContainer.AppendFile: %w", err)
+	}
+
+	if !encrypted {
+		file.Close()
+
+		return container.inner.AppendFile(bucketID, fileID, offset, src) //nolint:wrapcheck // a proxy.
+	}
+
+	aead, err := container.readHeader(file)
+	if err != nil {
+		file.Close()
+
+		return 0, fmt.Errorf("EncryptedContainer.AppendFile %s/%s: %w", bucketID, fileID, err)
+	}
+
+	reader, err := newOpeningReader(file, aead)
+	if err != nil {
+		file.Close()
+
+		return 0, fmt.Errorf("EncryptedContainer.AppendFile: %w", err)
+	}
+
+	if offset > reader.size {
+		file.Close()
+
+		return 0, fmt.Errorf("EncryptedContainer.AppendFile %s/%s at %d: %w", bucketID, fileID, offset,
+			ErrOffsetBeyondEnd)
+	}
+
+	index := offset / encChunkSize
+
+	var prefix []byte
+
+	if within := offset % encChunkSize; within > 0 {
+		err = reader.loadChunk(index)
+		if err != nil {
+			file.Close()
+
+			return 0, fmt.Errorf("EncryptedContainer.AppendFile: %w", err)
+		}
+
+		if within > int64(len(reader.plain)) {
+			file.Close()
+
+			return 0, fmt.Errorf("EncryptedContainer.AppendFile: %w", ErrCorruptBlob)
+		}
+
+		prefix = reader.plain[:within]
+	}
+
+	file.Close()
+
+	sealer := newSealingReader(src, aead, index, prefix)
+
+	sealedWritten, err := container.inner.AppendFile(bucketID, encryptedID(fileID), chunkOffset(index), sealer)
+	if err != nil {
+		// only the chunks that made it in full are kept, the next append at the returned offset drops the rest.
+		kept := sealer.consumed
+		if sealedWritten < sealer.sealed {
+			kept = (sealedWritten/encSealedChunkSize)*encChunkSize - int64(len(prefix))
+		}
+
+		return max(kept, 0), fmt.Errorf("EncryptedContainer.AppendFile: %w", err)
+	}
+
+	return sealer.consumed, nil
+}
+
+func (container EncryptedContainer) OpenFile(bucketID, fileID string) (io.ReadSeekCloser, error) {
+	file, encrypted, err := container.openBlob(bucketID, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("EncryptedContainer.OpenFile: %w", err)
+	}
+
+	if !encrypted {
+		return file, nil
+	}
+
+	aead, err := container.readHeader(file)
+	if err != nil {
+		file.Close()
+
+		return nil, fmt.Errorf("EncryptedContainer.OpenFile %s/%s: %w", bucketID, fileID, err)
+	}
+
+	reader, err := newOpeningReader(file, aead)
+	if err != nil {
+		file.Close()
+
+		return nil, fmt.Errorf("EncryptedContainer.OpenFile: %w", err)
+	}
+
+	return reader, nil
+}
+
+// readHeader reads the header of the encrypted blob and returns the cipher of its data key.
+func (container EncryptedContainer) readHeader(src io.Reader) (cipher.AEAD, error) {
+	header, err := readHeaderBytes(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, _, err := container.unwrapHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGCM(dataKey)
+}
+
+// readHeaderBytes reads the header of the encrypted blob, failing with ErrCorruptBlob if the blob is shorter.
+func readHeaderBytes(src io.Reader) ([]byte, error) {
+	header := make([]byte, encHeaderSize)
+
+	_, err := io.ReadFull(src, header)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, ErrCorruptBlob
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("readHeader io.ReadFull: %w", err)
+	}
+
+	return header, nil
+}
+
+// unwrapHeader returns the data key of the blob header and the id of the master key wrapping it.
+func (container EncryptedContainer) unwrapHeader(header []byte) ([]byte, uint32, error) {
+	if !bytes.HasPrefix(header, []byte(encMagic)) {
+		return nil, 0, ErrCorruptBlob
+	}
+
+	dataKey, err := container.keys.unwrap(header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return dataKey, binary.BigEndian.Uint32(header[len(encMagic)+1 : encPrefixSize]), nil
+}
+
+func (container EncryptedContainer) CreateFolder(bucketID string) error {
+	return container.inner.CreateFolder(bucketID) //nolint:wrapcheck // a proxy.
+}
+
+// DeleteFile removes the blob, encrypted or not. It only fails if there was no blob
+// or if the removal failed for a reason other than the blob being absent.
+func (container EncryptedContainer) DeleteFile(bucketID, fileID string) error {
+	encErr := container.inner.DeleteFile(bucketID, encryptedID(fileID))
+	if encErr != nil && !errors.Is(encErr, fs.ErrNotExist) {
+		return fmt.Errorf("EncryptedContainer.DeleteFile: %w", encErr)
+	}
+
+	plainErr := container.inner.DeleteFile(bucketID, fileID)
+	if plainErr != nil && !errors.Is(plainErr, fs.ErrNotExist) {
+		return fmt.Errorf("EncryptedContainer.DeleteFile plaintext: %w", plainErr)
+	}
+
+	if encErr != nil && plainErr != nil {
+		return fmt.Errorf("EncryptedContainer.DeleteFile: %w", plainErr)
+	}
+
+	return nil
+}
+
+func (container EncryptedContainer) DeleteFolder(bucketID string) error {
+	return container.inner.DeleteFolder(bucketID) //nolint:wrapcheck // a proxy.
+}
+
+// MoveFile moves the blob, encrypted or not, over the destination.
+func (container EncryptedContainer) MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	return container.transfer(srcBucketID, srcFileID, dstBucketID, dstFileID, true)
+}
+
+// LinkFile links the blob on the inner backend, the blobs being sealed independently of their ids.
+func (container EncryptedContainer) LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	return container.transfer(srcBucketID, srcFileID, dstBucketID, dstFileID, false)
+}
+
+// transfer moves or links the encrypted blob, or the plaintext one if there is no encrypted blob,
+// and removes the blob of the other kind at the destination, the encrypted one being the one served.
+func (container EncryptedContainer) transfer(srcBucketID, srcFileID, dstBucketID, dstFileID string, move bool,
+) error {
+	transferBlob := func(srcID, dstID string) error {
+		if move {
+			return container.inner.MoveFile(srcBucketID, srcID, dstBucketID, dstID) //nolint:wrapcheck // a proxy.
+		}
+
+		return linkBackend(container.inner, srcBucketID, srcID, dstBucketID, dstID)
+	}
+
+	err := transferBlob(encryptedID(srcFileID), encryptedID(dstFileID))
+	if err == nil {
+		container.dropPlaintext(dstBucketID, dstFileID)
+
+		if move {
+			container.dropPlaintext(srcBucketID, srcFileID)
+		}
+
+		return nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("EncryptedContainer.transfer: %w", err)
+	}
+
+	err = transferBlob(srcFileID, dstFileID)
+	if err != nil {
+		return fmt.Errorf("EncryptedContainer.transfer plaintext: %w", err)
+	}
+
+	err = container.inner.DeleteFile(dstBucketID, encryptedID(dstFileID))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("EncryptedContainer.transfer: %w", err)
+	}
+
+	return nil
+}
+
+// ListFolder reports the blobs under their ids along with their plaintext sizes.
+func (container EncryptedContainer) ListFolder(bucketID string) ([]model.BlobInfo, error) {
+	blobs, err := container.inner.ListFolder(bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("EncryptedContainer.ListFolder: %w", err)
+	}
+
+	encrypted := make(map[string]struct{}, len(blobs))
+
+	for _, blob := range blobs {
+		if fileID, ok := strings.CutSuffix(blob.ID, encBlobSuffix); ok {
+			encrypted[fileID] = struct{}{}
+		}
+	}
+
+	listed := make([]model.BlobInfo, 0, len(blobs))
+
+	for _, blob := range blobs {
+		if fileID, ok := strings.CutSuffix(blob.ID, encBlobSuffix); ok {
+			blob.ID = fileID
+			blob.Size = plainSize(blob.Size)
+		} else if _, shadowed := encrypted[blob.ID]; shadowed {
+			continue
+		}
+
+		listed = append(listed, blob)
+	}
+
+	return listed, nil
+}
+
+// RelayoutFolder moves the blobs of the folder to the configured directory layout of the inner backend.
+func (container EncryptedContainer) RelayoutFolder(bucketID string) (int, error) {
+	moved, err := relayoutBackends(bucketID, container.inner)
+	if err != nil {
+		return moved, fmt.Errorf("EncryptedContainer.RelayoutFolder: %w", err)
+	}
+
+	return moved, nil
+}
+
+// Rewrap seals the data key of the blob with the current master key, encrypting the blob in full if it
+// is stored in plaintext. It reports whether the blob was rewritten. The blob is rewritten next to the
+// original and then moved over it, so it's meant for the blobs that are no longer appended to.
+func (container EncryptedContainer) Rewrap(bucketID, fileID string) (bool, error) {
+	file, encrypted, err := container.openBlob(bucketID, fileID)
+	if err != nil {
+		return false, fmt.Errorf("EncryptedContainer.Rewrap: %w", err)
+	}
+
+	defer file.Close()
+
+	tmpID := encryptedID(fileID + rewrapSuffix)
+
+	if encrypted {
+		var (
+			header, dataKey []byte
+			keyID           uint32
+		)
+
+		header, err = readHeaderBytes(file)
+		if err != nil {
+			return false, fmt.Errorf("EncryptedContainer.Rewrap %s/%s: %w", bucketID, fileID, err)
+		}
+
+		dataKey, keyID, err = container.unwrapHeader(header)
+		if err != nil {
+			return false, fmt.Errorf("EncryptedContainer.Rewrap %s/%s: %w", bucketID, fileID, err)
+		}
+
+		if keyID == container.keys.current {
+			return false, nil
+		}
+
+		header, err = container.keys.wrap(dataKey)
+		if err != nil {
+			return false, fmt.Errorf("EncryptedContainer.Rewrap: %w", err)
+		}
+
+		// the chunks are sealed by the data key, so they are copied as they are.
+		_, err = container.inner.WriteFile(bucketID, tmpID, io.MultiReader(bytes.NewReader(header), file))
+	} else {
+		_, err = container.WriteFile(bucketID, fileID+rewrapSuffix, file)
+	}
+
+	if err != nil {
+		_ = container.inner.DeleteFile(bucketID, tmpID)
+
+		return false, fmt.Errorf("EncryptedContainer.Rewrap: %w", err)
+	}
+
+	err = container.inner.MoveFile(bucketID, tmpID, bucketID, encryptedID(fileID))
+	if err != nil {
+		return false, fmt.Errorf("EncryptedContainer.Rewrap: %w", err)
+	}
+
+	container.dropPlaintext(bucketID, fileID)
+
+	return true, nil
+}
+
+// chunkOffset is the offset of the sealed chunk in the blob.
+func chunkOffset(index int64) int64 {
+	return encHeaderSize + index*encSealedChunkSize
+}
+
+// plainSize is the plaintext size of an encrypted blob of the size. A torn tail chunk doesn't count.
+func plainSize(sealedSize int64) int64 {
+	body := sealedSize - encHeaderSize
+	if body <= 0 {
+		return 0
+	}
+
+	size := (body / encSealedChunkSize) * encChunkSize
+
+	if tail := body % encSealedChunkSize; tail > encChunkOverhead {
+		size += tail - encChunkOverhead
+	}
+
+	return size
+}
+
+func chunkAD(index int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(index)) //nolint:gosec // never negative.
+}
+
+// sealingReader seals src chunk by chunk as it's read, starting at the chunk of the index.
+// The prefix is the plaintext the first chunk starts with.
+type sealingReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	err     error
+	plain   []byte
+	pending []byte
+	index   int64
+	filled  int
+	// consumed is the number of bytes read from src, sealed is the number of the sealed bytes produced.
+	consumed int64
+	sealed   int64
+}
+
+func newSealingReader(src io.Reader, aead cipher.AEAD, index int64, prefix []byte) *sealingReader {
+	plain := make([]byte, encChunkSize)
+
+	return &sealingReader{ //nolint:exhaustruct // the rest is the state.
+		src:    src,
+		aead:   aead,
+		plain:  plain,
+		index:  index,
+		filled: copy(plain, prefix),
+	}
+}
+
+func (reader *sealingReader) Read(dst []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.err != nil {
+			return 0, reader.err
+		}
+
+		reader.fill()
+	}
+
+	copied := copy(dst, reader.pending)
+	reader.pending = reader.pending[copied:]
+
+	return copied, nil
+}
+
+// fill seals the next chunk, a short one only at the end of src or when src fails.
+func (reader *sealingReader) fill() {
+	read, err := io.ReadFull(reader.src, reader.plain[reader.filled:])
+	reader.consumed += int64(read)
+	reader.filled += read
+
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+
+	if reader.filled > 0 {
+		var nonce [encNonceSize]byte
+
+		_, randErr := rand.Read(nonce[:])
+		if randErr != nil {
+			reader.err = fmt.Errorf("sealingReader rand.Read: %w", randErr)
+
+			return
+		}
+
+		sealed := make([]byte, 0, reader.filled+encChunkOverhead)
+		sealed = append(sealed, nonce[:]...)
+		sealed = reader.aead.Seal(sealed, nonce[:], reader.plain[:reader.filled], chunkAD(reader.index))
+
+		reader.pending = sealed
+		reader.sealed += int64(len(sealed))
+		reader.index++
+		reader.filled = 0
+	}
+
+	reader.err = err
+}
+
+// openingReader decrypts the blob chunk by chunk, keeping the last decrypted chunk.
+type openingReader struct {
+	src    io.ReadSeekCloser
+	aead   cipher.AEAD
+	plain  []byte
+	sealed []byte
+	size   int64
+	pos    int64
+	chunk  int64
+}
+
+func newOpeningReader(src io.ReadSeekCloser, aead cipher.AEAD) (*openingReader, error) {
+	sealedSize, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("newOpeningReader Seek: %w", err)
+	}
+
+	return &openingReader{
+		src:    src,
+		aead:   aead,
+		plain:  make([]byte, 0, encChunkSize),
+		sealed: make([]byte, encSealedChunkSize),
+		size:   plainSize(sealedSize),
+		pos:    0,
+		chunk:  -1,
+	}, nil
+}
+
+func (reader *openingReader) loadChunk(index int64) error {
+	if index == reader.chunk {
+		return nil
+	}
+
+	_, err := reader.src.Seek(chunkOffset(index), io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("openingReader.loadChunk Seek: %w", err)
+	}
+
+	read, err := io.ReadFull(reader.src, reader.sealed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("openingReader.loadChunk io.ReadFull: %w", err)
+	}
+
+	if read <= encChunkOverhead {
+		return ErrCorruptBlob
+	}
+
+	reader.chunk = -1
+
+	reader.plain, err = reader.aead.Open(reader.plain[:0], reader.sealed[:encNonceSize],
+		reader.sealed[encNonceSize:read], chunkAD(index))
+	if err != nil {
+		return fmt.Errorf("openingReader.loadChunk chunk %d: %w", index, ErrCorruptBlob)
+	}
+
+	reader.chunk = index
+
+	return nil
+}
+
+func (reader *openingReader) Read(dst []byte) (int, error) {
+	if reader.pos >= reader.size {
+		return 0, io.EOF
+	}
+
+	index := reader.pos / encChunkSize
+
+	err := reader.loadChunk(index)
+	if err != nil {
+		return 0, err
+	}
+
+	within := reader.pos - index*encChunkSize
+	if within >= int64(len(reader.plain)) {
+		return 0, ErrCorruptBlob
+	}
+
+	copied := copy(dst, reader.plain[within:])
+	reader.pos += int64(copied)
+
+	return copied, nil
+}
+
+func (reader *openingReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = reader.pos + offset
+	case io.SeekEnd:
+		pos = reader.size + offset
+	default:
+		return 0, fmt.Errorf("openingReader.Seek whence %d: %w", whence, fs.ErrInvalid)
+	}
+
+	if pos < 0 {
+		return 0, fmt.Errorf("openingReader.Seek to %d: %w", pos, fs.ErrInvalid)
+	}
+
+	reader.pos = pos
+
+	return pos, nil
+}
+
+func (reader *openingReader) Close() error {
+	return reader.src.Close() //nolint:wrapcheck // a proxy.
+}
@@ -0,0 +1,814 @@
+package files
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"slices"
+	"sync"
+
+	"github.com/eldarbr/go-s3/internal/model"
+)
+
+// The erasure coded blob is striped over the shards, a stripe of the content being split into dataShards chunks
+// and extended with parityShards parity chunks, the chunk i of every stripe going to the shard i. A shard is:
+//
+//	chunks: for every stripe the chunk followed by its CRC-32, the chunks of the last stripe being shorter
+//	footer: magic, version, data shards, parity shards, shard index, chunk size, size, write id, CRC-32
+//
+// The chunks failing their CRC-32 are restored from the other shards like the missing ones. The write id tells
+// apart the shards of the same blob written by the different writes.
+const (
+	ErasureChunkSize = 64 << 10
+
+	erasureMagic      = "GS3R"
+	erasureVersion    = 1
+	erasureCRCSize    = 4
+	erasureFooterSize = 4 + 1 + 1 + 1 + 1 + 4 + 8 + 8 + erasureCRCSize
+)
+
+var ErrTooFewShards = errors.New("too few intact shards of the blob")
+
+// erasureFooter describes the blob a shard belongs to.
+type erasureFooter struct {
+	writeID      [8]byte
+	size         int64
+	chunkSize    int64
+	dataShards   int
+	parityShards int
+	index        int
+}
+
+func (footer erasureFooter) marshal() []byte {
+	buf := make([]byte, 0, erasureFooterSize)
+	buf = append(buf, erasureMagic...)
+	buf = append(buf, erasureVersion, byte(footer.dataShards), byte(footer.parityShards), byte(footer.index))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(footer.chunkSize)) //nolint:gosec // a constant.
+	buf = binary.BigEndian.AppendUint64(buf, uint64(footer.size))      //nolint:gosec // never negative.
+	buf = append(buf, footer.writeID[:]...)
+
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+func parseErasureFooter(buf []byte) (erasureFooter, error) {
+	var footer erasureFooter
+
+	if len(buf) != erasureFooterSize || string(buf[:4]) != erasureMagic || buf[4] != erasureVersion ||
+		binary.BigEndian.Uint32(buf[erasureFooterSize-erasureCRCSize:]) !=
+			crc32.ChecksumIEEE(buf[:erasureFooterSize-erasureCRCSize]) {
+		return footer, ErrTooFewShards
+	}
+
+	footer.dataShards = int(buf[5])
+	footer.parityShards = int(buf[6])
+	footer.index = int(buf[7])
+	footer.chunkSize = int64(binary.BigEndian.Uint32(buf[8:12]))
+	footer.size = int64(binary.BigEndian.Uint64(buf[12:20])) //nolint:gosec // checked below.
+	copy(footer.writeID[:], buf[20:28])
+
+	if footer.dataShards == 0 || footer.chunkSize == 0 || footer.size < 0 {
+		return footer, ErrTooFewShards
+	}
+
+	return footer, nil
+}
+
+// sameBlob tells whether the footers are of the shards written together.
+func (footer erasureFooter) sameBlob(other erasureFooter) bool {
+	footer.index = other.index
+
+	return footer == other
+}
+
+func (footer erasureFooter) stripeSize() int64 {
+	return footer.chunkSize * int64(footer.dataShards)
+}
+
+func (footer erasureFooter) stripes() int64 {
+	return (footer.size + footer.stripeSize() - 1) / footer.stripeSize()
+}
+
+// chunkLen returns the length of the chunks of the stripe, the last stripe being split into shorter ones.
+func (footer erasureFooter) chunkLen(stripe int64) int64 {
+	if stripe < footer.stripes()-1 {
+		return footer.chunkSize
+	}
+
+	left := footer.size - stripe*footer.stripeSize()
+
+	return (left + int64(footer.dataShards) - 1) / int64(footer.dataShards)
+}
+
+func (footer erasureFooter) shardSize() int64 {
+	if footer.size == 0 {
+		return erasureFooterSize
+	}
+
+	lastStripe := footer.stripes() - 1
+
+	return lastStripe*(footer.chunkSize+erasureCRCSize) + footer.chunkLen(lastStripe) + erasureCRCSize +
+		erasureFooterSize
+}
+
+// ErasureContainer stripes every blob over its shard backends, e.g. the local backends on separate disks,
+// with a Reed-Solomon code, so the blob survives the loss of as many shards as there are parity ones.
+// A write succeeds once the write quorum of the shards is written, the shards that failed it are removed.
+// The other operations tolerate the failures of the parity count of the shards. The reads restore the missing
+// and the damaged chunks on the fly and can seek.
+type ErasureContainer struct {
+	code   *reedSolomon
+	shards []Backend
+	quorum int
+}
+
+// NewErasureContainer codes the blobs over the shards, the first dataShards of them keeping the content as is and
+// the rest the parity. The writeQuorum is clamped to dataShards..len(shards).
+func NewErasureContainer(dataShards, writeQuorum int, shards ...Backend) (*ErasureContainer, error) {
+	code, err := newReedSolomon(dataShards, len(shards)-dataShards)
+	if err != nil {
+		return nil, fmt.Errorf("NewErasureContainer: %w", err)
+	}
+
+	return &ErasureContainer{
+		code:   code,
+		shards: shards,
+		quorum: max(dataShards, min(writeQuorum, len(shards))),
+	}, nil
+}
+
+// each runs the operation on every shard, see eachBackend.
+func (container ErasureContainer) each(operation func(shard Backend) error, tolerated ...error) error {
+	return eachBackend(container.shards, container.code.dataShards, operation, tolerated...)
+}
+
+func (container ErasureContainer) WriteFile(bucketID, fileID string, src io.Reader) (int64, error) {
+	footer := erasureFooter{ //nolint:exhaustruct // set below.
+		chunkSize:    ErasureChunkSize,
+		dataShards:   container.code.dataShards,
+		parityShards: container.code.parityShards,
+	}
+
+	_, err := rand.Read(footer.writeID[:])
+	if err != nil {
+		return 0, fmt.Errorf("ErasureContainer.WriteFile rand.Read: %w", err)
+	}
+
+	writers, wait := container.startWrites(func(shard Backend, src io.Reader) (int64, error) {
+		return shard.WriteFile(bucketID, fileID, src)
+	})
+
+	// the shards of a write failing midway are discarded, the previous blob stays.
+	footer.size, err = container.encode(src, writers, footer)
+	if err == nil {
+		err = container.settleWrites(bucketID, fileID, wait(nil), footer.shardSize())
+	} else {
+		wait(err)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("ErasureContainer.WriteFile: %w", err)
+	}
+
+	return footer.size, nil
+}
+
+// startWrites runs the write on every shard concurrently, each fed by its pipe writer. The returned wait closes
+// the writers with the error given and returns the results of the writes.
+func (container ErasureContainer) startWrites(write func(shard Backend, src io.Reader) (int64, error),
+) ([]*io.PipeWriter, func(err error) []replicaResult) {
+	var wg sync.WaitGroup
+
+	results := make([]replicaResult, len(container.shards))
+	writers := make([]*io.PipeWriter, len(container.shards))
+
+	for i, shard := range container.shards {
+		reader, writer := io.Pipe()
+		writers[i] = writer
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i].written, results[i].err = write(shard, reader)
+
+			reader.CloseWithError(errReplicaDetached)
+		}()
+	}
+
+	return writers, func(err error) []replicaResult {
+		for _, writer := range writers {
+			writer.CloseWithError(err)
+		}
+
+		wg.Wait()
+
+		return results
+	}
+}
+
+// settleWrites checks that the write quorum of the shards got the bytes expected, and removes the shards
+// that failed the write.
+func (container ErasureContainer) settleWrites(bucketID, fileID string, results []replicaResult, expected int64,
+) error {
+	var errs []error
+
+	failed := make([]int, 0, len(results))
+
+	for i, result := range results {
+		switch {
+		case result.err != nil:
+			errs = append(errs, fmt.Errorf("shard %d: %w", i, result.err))
+			failed = append(failed, i)
+		case result.written != expected:
+			errs = append(errs, fmt.Errorf("shard %d: %w", i, io.ErrShortWrite))
+			failed = append(failed, i)
+		}
+	}
+
+	if len(results)-len(failed) < container.quorum {
+		return errors.Join(append(errs, ErrNoQuorum)...)
+	}
+
+	for _, i := range failed {
+		container.shards[i].DeleteFile(bucketID, fileID) //nolint:errcheck // best effort, may be gone already.
+	}
+
+	return nil
+}
+
+// encode codes src stripe by stripe to the shard writers followed by the footers, detaching the writers that fail.
+// The stripes are appended to the footer.size bytes of the content coded already, a multiple of the stripe size.
+// Returns the size of the content. A failure of src ends the content with the bytes read before it, the footers
+// being written all the same, the error of src being returned along with the size.
+//
+//nolint:cyclop // the stripes are coded and fanned out in a single pass.
+func (container ErasureContainer) encode(src io.Reader, writers []*io.PipeWriter, footer erasureFooter,
+) (int64, error) {
+	dataShards := int64(container.code.dataShards)
+	stripe := make([]byte, footer.stripeSize())
+	records := make([][]byte, len(writers))
+	chunks := make([][]byte, len(writers))
+	detached := make([]bool, len(writers))
+	attached := len(writers)
+
+	for i := range records {
+		records[i] = make([]byte, footer.chunkSize+erasureCRCSize)
+	}
+
+	write := func(i int, content []byte) {
+		if detached[i] {
+			return
+		}
+
+		_, err := writers[i].Write(content)
+		if err != nil {
+			detached[i] = true
+			attached--
+		}
+	}
+
+	var srcErr error
+
+	size := footer.size
+
+	for {
+		read, err := io.ReadFull(src, stripe)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			srcErr = err
+		}
+
+		if read == 0 {
+			break
+		}
+
+		size += int64(read)
+		chunkLen := (int64(read) + dataShards - 1) / dataShards
+		clear(stripe[read : chunkLen*dataShards])
+
+		for i := range records {
+			chunks[i] = records[i][:chunkLen]
+
+			if int64(i) < dataShards {
+				copy(chunks[i], stripe[int64(i)*chunkLen:])
+			}
+		}
+
+		container.code.encode(chunks)
+
+		for i := range records {
+			binary.BigEndian.PutUint32(records[i][chunkLen:], crc32.ChecksumIEEE(chunks[i]))
+			write(i, records[i][:chunkLen+erasureCRCSize])
+		}
+
+		if attached < container.quorum {
+			return size, ErrNoQuorum
+		}
+
+		if int64(read) < footer.stripeSize() {
+			break
+		}
+	}
+
+	footer.size = size
+
+	for i := range writers {
+		footer.index = i
+		write(i, footer.marshal())
+	}
+
+	if attached < container.quorum {
+		return size, ErrNoQuorum
+	}
+
+	return size, srcErr
+}
+
+// AppendFile writes src to the blob starting at the offset, dropping whatever was stored past it. The shards keep
+// the stripes before the one of the offset, and get the rest of that stripe, the stripes of src and new footers
+// appended in their place, so an append costs the size of src and a stripe at most. A blob missing some of its
+// shards is rewritten as a whole instead, which restores them. A src failing midway leaves the blob with the
+// content read before the failure, the written count telling how much of src that is. An append losing the write
+// quorum leaves the blob with src if enough shards got it to read it back, the written count telling so, and with
+// the content up to the offset written back otherwise.
+func (container ErasureContainer) AppendFile(bucketID, fileID string, offset int64, src io.Reader) (int64, error) {
+	current, err := container.openBlob(bucketID, fileID)
+	if err != nil {
+		return 0, fmt.Errorf("ErasureContainer.AppendFile: %w", err)
+	}
+
+	defer current.Close()
+
+	footer := current.footer
+
+	if footer.size < offset {
+		return 0, fmt.Errorf("ErasureContainer.AppendFile %s/%s at %d: %w", bucketID, fileID, offset,
+			ErrOffsetBeyondEnd)
+	}
+
+	if slices.Contains(current.shards, nil) {
+		return container.rewriteFile(current, bucketID, fileID, offset, src)
+	}
+
+	keptStripes := offset / footer.stripeSize()
+	kept := keptStripes * footer.stripeSize()
+
+	tail, err := readAt(current, kept, offset-kept)
+	if err != nil {
+		return 0, fmt.Errorf("ErasureContainer.AppendFile: %w", err)
+	}
+
+	footer.size = kept
+
+	appended, srcErr, err := container.appendStripes(bucketID, fileID, footer,
+		io.MultiReader(bytes.NewReader(tail), src))
+	if err != nil {
+		return container.recoverAppend(bucketID, fileID, offset, appended, tail, err)
+	}
+
+	written := appended.size - offset
+	if srcErr != nil {
+		return written, fmt.Errorf("ErasureContainer.AppendFile: %w", srcErr)
+	}
+
+	return written, nil
+}
+
+// appendStripes cuts the shards of the blob after the footer.size bytes of the content, a multiple of the stripe
+// size, and appends the stripes of src and the footers of a new write in their place. Returns the footer of the
+// write along with the error of src, if any, and the error of the write.
+func (container ErasureContainer) appendStripes(bucketID, fileID string, footer erasureFooter, src io.Reader,
+) (erasureFooter, error, error) {
+	_, err := rand.Read(footer.writeID[:])
+	if err != nil {
+		return footer, nil, fmt.Errorf("rand.Read: %w", err)
+	}
+
+	shardOffset := footer.size / footer.stripeSize() * (footer.chunkSize + erasureCRCSize)
+
+	writers, wait := container.startWrites(func(shard Backend, src io.Reader) (int64, error) {
+		return shard.AppendFile(bucketID, fileID, shardOffset, src)
+	})
+
+	var srcErr error
+
+	footer.size, err = container.encode(src, writers, footer)
+	if err != nil && !errors.Is(err, ErrNoQuorum) {
+		srcErr, err = err, nil
+	}
+
+	if err == nil {
+		err = container.settleWrites(bucketID, fileID, wait(nil), footer.shardSize()-shardOffset)
+	} else {
+		wait(err)
+	}
+
+	return footer, srcErr, err
+}
+
+// recoverAppend settles the blob after the append of the write failed, the shards being cut already. The blob
+// read back being the one of the write tells how much of src is written, another readable one being kept as is.
+// A blob left unreadable gets the content up to the offset, the kept stripes followed by the tail, written back
+// over the shards, nothing of src being written.
+func (container ErasureContainer) recoverAppend(bucketID, fileID string, offset int64, appended erasureFooter,
+	tail []byte, appendErr error,
+) (int64, error) {
+	current, err := container.openBlob(bucketID, fileID)
+	if err == nil {
+		current.Close()
+
+		if current.footer.sameBlob(appended) {
+			return appended.size - offset, fmt.Errorf("ErasureContainer.AppendFile: %w", appendErr)
+		}
+
+		return 0, fmt.Errorf("ErasureContainer.AppendFile: %w", appendErr)
+	}
+
+	kept := appended
+	kept.size = offset / kept.stripeSize() * kept.stripeSize()
+
+	_, _, err = container.appendStripes(bucketID, fileID, kept, bytes.NewReader(tail))
+	if err != nil {
+		err = fmt.Errorf("restoring the content up to %d: %w", offset, err)
+	}
+
+	return 0, fmt.Errorf("ErasureContainer.AppendFile: %w", errors.Join(appendErr, err))
+}
+
+// rewriteFile writes the blob anew with its content up to the offset followed by src. A failed rewrite
+// keeps the previous blob, nothing of src being written.
+func (container ErasureContainer) rewriteFile(current *erasureReader, bucketID, fileID string, offset int64,
+	src io.Reader,
+) (int64, error) {
+	_, err := current.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, fmt.Errorf("ErasureContainer.rewriteFile Seek: %w", err)
+	}
+
+	written, err := container.WriteFile(bucketID, fileID, io.MultiReader(io.LimitReader(current, offset), src))
+	if err != nil {
+		return 0, fmt.Errorf("ErasureContainer.rewriteFile: %w", err)
+	}
+
+	return written - offset, nil
+}
+
+// OpenFile opens the shards of the blob, the ones of the write having the most shards being used.
+// Fails with fs.ErrNotExist if no shard is found, and with ErrTooFewShards if the blob can't be restored.
+func (container ErasureContainer) OpenFile(bucketID, fileID string) (io.ReadSeekCloser, error) {
+	return container.openBlob(bucketID, fileID)
+}
+
+// openBlob opens the blob like OpenFile does, the shards not taking part in it being left nil.
+func (container ErasureContainer) openBlob(bucketID, fileID string) (*erasureReader, error) {
+	shards := make([]io.ReadSeekCloser, len(container.shards))
+	footers := make([]erasureFooter, len(container.shards))
+	errs := make([]error, 0, len(container.shards))
+
+	for i, backend := range container.shards {
+		shard, footer, err := openShard(backend, bucketID, fileID, i)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shard %d: %w", i, err))
+
+			continue
+		}
+
+		shards[i], footers[i] = shard, footer
+	}
+
+	// the footer of the write having the most shards.
+	best, bestCount := -1, 0
+
+	for i := range shards {
+		count := 0
+
+		for j := range shards {
+			if shards[i] != nil && shards[j] != nil && footers[i].sameBlob(footers[j]) {
+				count++
+			}
+		}
+
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+
+	if bestCount == 0 {
+		return nil, fmt.Errorf("ErasureContainer.OpenFile: %w", errors.Join(errs...))
+	}
+
+	for i := range shards {
+		if shards[i] != nil && !footers[i].sameBlob(footers[best]) {
+			shards[i].Close()
+			shards[i] = nil
+		}
+	}
+
+	footer := footers[best]
+
+	if bestCount < footer.dataShards || footer.dataShards != container.code.dataShards ||
+		footer.parityShards != container.code.parityShards {
+		closeShards(shards)
+
+		return nil, fmt.Errorf("ErasureContainer.OpenFile %d of %d shards: %w", bestCount, len(shards),
+			ErrTooFewShards)
+	}
+
+	buffers := make([][]byte, len(shards))
+	for i := range buffers {
+		buffers[i] = make([]byte, footer.chunkSize+erasureCRCSize)
+	}
+
+	return &erasureReader{
+		code:    container.code,
+		shards:  shards,
+		buffers: buffers,
+		plain:   make([]byte, 0, footer.stripeSize()),
+		footer:  footer,
+		pos:     0,
+		stripe:  -1,
+	}, nil
+}
+
+// openShard opens the shard and reads its footer, checking it against the shard size and index.
+func openShard(backend Backend, bucketID, fileID string, index int) (io.ReadSeekCloser, erasureFooter, error) {
+	shard, err := backend.OpenFile(bucketID, fileID)
+	if err != nil {
+		return nil, erasureFooter{}, err //nolint:exhaustruct,wrapcheck // wrapped by the caller.
+	}
+
+	shardSize, err := shard.Seek(0, io.SeekEnd)
+	if err != nil || shardSize < erasureFooterSize {
+		shard.Close()
+
+		return nil, erasureFooter{}, errors.Join(ErrTooFewShards, err) //nolint:exhaustruct // none.
+	}
+
+	buf, err := readAt(shard, shardSize-erasureFooterSize, erasureFooterSize)
+	if err != nil {
+		shard.Close()
+
+		return nil, erasureFooter{}, err //nolint:exhaustruct // none.
+	}
+
+	footer, err := parseErasureFooter(buf)
+	if err == nil && (footer.index != index || footer.shardSize() != shardSize) {
+		err = ErrTooFewShards
+	}
+
+	if err != nil {
+		shard.Close()
+
+		return nil, erasureFooter{}, err //nolint:exhaustruct // none.
+	}
+
+	return shard, footer, nil
+}
+
+func closeShards(shards []io.ReadSeekCloser) {
+	for _, shard := range shards {
+		if shard != nil {
+			shard.Close()
+		}
+	}
+}
+
+// erasureReader decodes the blob stripe by stripe, keeping the last decoded stripe.
+type erasureReader struct {
+	code    *reedSolomon
+	shards  []io.ReadSeekCloser
+	buffers [][]byte
+	plain   []byte
+	footer  erasureFooter
+	pos     int64
+	stripe  int64
+}
+
+// loadStripe reads the chunks of the stripe from the data shards, falling back to the parity ones
+// for the chunks missing or failing their CRC-32.
+func (reader *erasureReader) loadStripe(stripe int64) error {
+	if stripe == reader.stripe {
+		return nil
+	}
+
+	reader.stripe = -1
+
+	chunkLen := reader.footer.chunkLen(stripe)
+	offset := stripe * (reader.footer.chunkSize + erasureCRCSize)
+	present := make([]bool, len(reader.shards))
+	chunks := make([][]byte, len(reader.shards))
+	intact := 0
+
+	for i, shard := range reader.shards {
+		chunks[i] = reader.buffers[i][:chunkLen]
+
+		if shard == nil || intact == reader.code.dataShards {
+			continue
+		}
+
+		record := reader.buffers[i][:chunkLen+erasureCRCSize]
+
+		_, err := shard.Seek(offset, io.SeekStart)
+		if err == nil {
+			_, err = io.ReadFull(shard, record)
+		}
+
+		if err == nil && binary.BigEndian.Uint32(record[chunkLen:]) == crc32.ChecksumIEEE(chunks[i]) {
+			present[i] = true
+			intact++
+		}
+	}
+
+	err := reader.code.reconstructData(chunks, present)
+	if err != nil {
+		return fmt.Errorf("erasureReader.loadStripe stripe %d: %w", stripe, ErrTooFewShards)
+	}
+
+	plain := bytes.NewBuffer(reader.plain[:0])
+	for _, chunk := range chunks[:reader.code.dataShards] {
+		plain.Write(chunk)
+	}
+
+	stripeStart := stripe * reader.footer.stripeSize()
+	reader.plain = plain.Bytes()[:min(reader.footer.stripeSize(), reader.footer.size-stripeStart)]
+	reader.stripe = stripe
+
+	return nil
+}
+
+func (reader *erasureReader) Read(dst []byte) (int, error) {
+	if reader.pos >= reader.footer.size {
+		return 0, io.EOF
+	}
+
+	stripe := reader.pos / reader.footer.stripeSize()
+
+	err := reader.loadStripe(stripe)
+	if err != nil {
+		return 0, err
+	}
+
+	copied := copy(dst, reader.plain[reader.pos-stripe*reader.footer.stripeSize():])
+	reader.pos += int64(copied)
+
+	return copied, nil
+}
+
+func (reader *erasureReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = reader.pos + offset
+	case io.SeekEnd:
+		pos = reader.footer.size + offset
+	default:
+		return 0, fmt.Errorf("erasureReader.Seek whence %d: %w", whence, fs.ErrInvalid)
+	}
+
+	if pos < 0 {
+		return 0, fmt.Errorf("erasureReader.Seek to %d: %w", pos, fs.ErrInvalid)
+	}
+
+	reader.pos = pos
+
+	return pos, nil
+}
+
+func (reader *erasureReader) Close() error {
+	closeShards(reader.shards)
+
+	return nil
+}
+
+// CreateFolder creates the folder on every shard, failing with fs.ErrExist only if every shard has it.
+func (container ErasureContainer) CreateFolder(bucketID string) error {
+	err := container.each(func(shard Backend) error {
+		return shard.CreateFolder(bucketID) //nolint:wrapcheck // wrapped below.
+	}, fs.ErrExist)
+	if err != nil {
+		return fmt.Errorf("ErasureContainer.CreateFolder: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFile removes the shards of the blob, failing with fs.ErrNotExist only if there was none.
+func (container ErasureContainer) DeleteFile(bucketID, fileID string) error {
+	err := container.each(func(shard Backend) error {
+		return shard.DeleteFile(bucketID, fileID) //nolint:wrapcheck // wrapped below.
+	}, fs.ErrNotExist)
+	if err != nil {
+		return fmt.Errorf("ErasureContainer.DeleteFile: %w", err)
+	}
+
+	return nil
+}
+
+func (container ErasureContainer) DeleteFolder(bucketID string) error {
+	err := container.each(func(shard Backend) error {
+		return shard.DeleteFolder(bucketID) //nolint:wrapcheck // wrapped below.
+	})
+	if err != nil {
+		return fmt.Errorf("ErasureContainer.DeleteFolder: %w", err)
+	}
+
+	return nil
+}
+
+// MoveFile moves the shards of the blob, failing with fs.ErrNotExist only if there was none.
+func (container ErasureContainer) MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	err := container.each(func(shard Backend) error {
+		return shard.MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID) //nolint:wrapcheck // wrapped below.
+	}, fs.ErrNotExist)
+	if err != nil {
+		return fmt.Errorf("ErasureContainer.MoveFile: %w", err)
+	}
+
+	return nil
+}
+
+// LinkFile links the shards of the blob, failing with fs.ErrNotExist only if there was none.
+func (container ErasureContainer) LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	err := container.each(func(shard Backend) error {
+		return linkBackend(shard, srcBucketID, srcFileID, dstBucketID, dstFileID)
+	}, fs.ErrNotExist)
+	if err != nil {
+		return fmt.Errorf("ErasureContainer.LinkFile: %w", err)
+	}
+
+	return nil
+}
+
+// ListFolder merges the listings of the shards, reporting the sizes of the blobs as written
+// by the footer of their first shard found.
+func (container ErasureContainer) ListFolder(bucketID string) ([]model.BlobInfo, error) {
+	var (
+		blobs  []model.BlobInfo
+		found  []int
+		errs   []error
+		failed int
+		listed bool
+	)
+
+	seen := make(map[string]struct{})
+
+	for i, shard := range container.shards {
+		shardBlobs, err := shard.ListFolder(bucketID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shard %d: %w", i, err))
+
+			if !errors.Is(err, fs.ErrNotExist) {
+				failed++
+			}
+
+			continue
+		}
+
+		listed = true
+
+		for _, blob := range shardBlobs {
+			if _, ok := seen[blob.ID]; !ok {
+				seen[blob.ID] = struct{}{}
+				blobs = append(blobs, blob)
+				found = append(found, i)
+			}
+		}
+	}
+
+	if len(container.shards)-failed < container.code.dataShards {
+		return nil, fmt.Errorf("ErasureContainer.ListFolder: %w", errors.Join(append(errs, ErrNoQuorum)...))
+	}
+
+	if !listed {
+		return nil, fmt.Errorf("ErasureContainer.ListFolder: %w", errors.Join(errs...))
+	}
+
+	for i := range blobs {
+		shard, footer, err := openShard(container.shards[found[i]], bucketID, blobs[i].ID, found[i])
+		if err == nil {
+			shard.Close()
+
+			blobs[i].Size = footer.size
+		}
+	}
+
+	return blobs, nil
+}
+
+// RelayoutFolder moves the blobs of the folder to the configured directory layout of each shard.
+func (container ErasureContainer) RelayoutFolder(bucketID string) (int, error) {
+	moved, err := relayoutBackends(bucketID, container.shards...)
+	if err != nil {
+		return moved, fmt.Errorf("ErasureContainer.RelayoutFolder: %w", err)
+	}
+
+	return moved, nil
+}
@@ -1,36 +1,183 @@
 package files
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path"
+	"slices"
+
+	"github.com/eldarbr/go-s3/internal/model"
 )
 
+// MaxFanOut is the deepest directory layout supported by the Container.
+const MaxFanOut = 4
+
+// fanOutLevelLen is the number of the characters of the file id naming a directory level.
+const fanOutLevelLen = 2
+
 type Container struct {
 	basePath string
+	fanOut   int
 	fileMode fs.FileMode
 	dirMode  fs.FileMode
 }
 
 func NewContainer(basePath string, fileMode, dirMode fs.FileMode) *Container {
+	return NewFanOutContainer(basePath, 0, fileMode, dirMode)
+}
+
+// NewFanOutContainer keeps the blobs of a bucket under fanOut levels of directories named by the leading characters
+// of the file id, e.g. ab/cd/abcdef12-... for 2 levels, so a bucket with many files doesn't make a huge directory.
+// fanOut is clamped to 0..MaxFanOut, 0 being the flat layout. The blobs stored in another layout are still found,
+// RelayoutFolder moves them to the configured one.
+func NewFanOutContainer(basePath string, fanOut int, fileMode, dirMode fs.FileMode) *Container {
 	return &Container{
 		basePath: basePath,
+		fanOut:   min(max(fanOut, 0), MaxFanOut),
 		fileMode: fileMode,
 		dirMode:  dirMode,
 	}
 }
 
+// tempPrefix starts the names of the blobs being written, they get their file id once complete.
+const tempPrefix = ".tmp-"
+
+// isFanOutLevel reports whether the name may name a directory level, the file ids not fitting are stored flat.
+func isFanOutLevel(name string) bool {
+	if len(name) != fanOutLevelLen {
+		return false
+	}
+
+	for _, char := range name {
+		if (char < '0' || char > '9') && (char < 'a' || char > 'z') && (char < 'A' || char > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fanOutLevels returns the directories of the blob in the layout of the depth, none if the file id doesn't fit it.
+func fanOutLevels(fileID string, depth int) []string {
+	if len(fileID) <= depth*fanOutLevelLen {
+		return nil
+	}
+
+	levels := make([]string, 0, depth)
+
+	for level := range depth {
+		name := fileID[level*fanOutLevelLen : (level+1)*fanOutLevelLen]
+		if !isFanOutLevel(name) {
+			return nil
+		}
+
+		levels = append(levels, name)
+	}
+
+	return levels
+}
+
+func (container Container) blobPath(bucketID, fileID string, depth int) string {
+	return path.Join(append(append([]string{container.basePath, bucketID}, fanOutLevels(fileID, depth)...), fileID)...)
+}
+
+// blobPaths returns the distinct paths the blob may be found at, the one of the configured layout first.
+func (container Container) blobPaths(bucketID, fileID string) []string {
+	names := []string{container.blobPath(bucketID, fileID, container.fanOut)}
+
+	for depth := range MaxFanOut + 1 {
+		name := container.blobPath(bucketID, fileID, depth)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// tryLayouts runs the op on the path of the blob in the configured layout, then in the other layouts while
+// the blob is not found. The blob moved to the configured layout meanwhile by RelayoutFolder is found by a retry.
+func (container Container) tryLayouts(bucketID, fileID string, op func(name string) error) error {
+	names := container.blobPaths(bucketID, fileID)
+
+	var err error
+
+	for _, name := range names {
+		err = op(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if len(names) == 1 {
+		return err
+	}
+
+	return op(names[0])
+}
+
+// removeOtherLayouts removes the copies of the blob left in the layouts other than the configured one.
+func (container Container) removeOtherLayouts(bucketID, fileID string) error {
+	for _, name := range container.blobPaths(bucketID, fileID)[1:] {
+		err := os.Remove(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removeOtherLayouts os.Remove %w", err)
+		}
+	}
+
+	return nil
+}
+
+// makeBlobDir creates the missing directories of the blob in the configured layout and returns the one keeping it.
+// The parent of each directory created is synced, so a blob renamed into it is durable once its directory is synced.
+func (container Container) makeBlobDir(bucketID, fileID string) (string, error) {
+	dir := path.Join(container.basePath, bucketID)
+
+	for _, level := range fanOutLevels(fileID, container.fanOut) {
+		parent := dir
+		dir = path.Join(dir, level)
+
+		err := os.Mkdir(dir, container.dirMode)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("makeBlobDir os.Mkdir %w", err)
+		}
+
+		err = syncFolder(parent)
+		if err != nil {
+			return "", fmt.Errorf("makeBlobDir: %w", err)
+		}
+	}
+
+	return dir, nil
+}
+
+// WriteFile writes the blob to a temporary file in the bucket folder and renames it into place once it
+// is synced, so a failed or interrupted write never leaves a partial blob under the file id, and an existing
+// blob is replaced only by the complete new one. A crash may leave the temporary file behind, it's listed
+// by ListFolder for the reconciler to remove.
 func (container Container) WriteFile(bucketID, fileID string, src io.Reader) (int64, error) {
-	fullPath := path.Join(container.basePath, bucketID, fileID)
+	folder := path.Join(container.basePath, bucketID)
 
-	file, err := os.Create(fullPath)
+	file, err := os.CreateTemp(folder, tempPrefix+fileID+"-*")
 	if err != nil {
-		return 0, fmt.Errorf("WriteFile os.Create %w", err)
+		return 0, fmt.Errorf("WriteFile os.CreateTemp %w", err)
 	}
 
-	defer file.Close()
+	renamed := false
+
+	defer func() {
+		if !renamed {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
 
 	err = file.Chmod(container.fileMode)
 	if err != nil {
@@ -42,11 +189,110 @@ func (container Container) WriteFile(bucketID, fileID string, src io.Reader) (in
 		return written, fmt.Errorf("WriteFile io.Copy %w", err)
 	}
 
+	err = file.Sync()
+	if err != nil {
+		return written, fmt.Errorf("WriteFile file.Sync %w", err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return written, fmt.Errorf("WriteFile file.Close %w", err)
+	}
+
+	dir, err := container.makeBlobDir(bucketID, fileID)
+	if err != nil {
+		return written, fmt.Errorf("WriteFile: %w", err)
+	}
+
+	err = os.Rename(file.Name(), path.Join(dir, fileID))
+	if err != nil {
+		return written, fmt.Errorf("WriteFile os.Rename %w", err)
+	}
+
+	renamed = true
+
+	err = syncFolder(dir)
+	if err != nil {
+		return written, fmt.Errorf("WriteFile: %w", err)
+	}
+
+	err = container.removeOtherLayouts(bucketID, fileID)
+	if err != nil {
+		return written, fmt.Errorf("WriteFile: %w", err)
+	}
+
+	return written, nil
+}
+
+// syncFolder makes the entries of the folder durable.
+func syncFolder(folder string) error {
+	dir, err := os.Open(folder)
+	if err != nil {
+		return fmt.Errorf("syncFolder os.Open %w", err)
+	}
+
+	defer dir.Close()
+
+	err = dir.Sync()
+	if err != nil {
+		return fmt.Errorf("syncFolder dir.Sync %w", err)
+	}
+
+	return nil
+}
+
+// AppendFile writes src to an existing file starting at the offset, dropping whatever was stored past it.
+func (container Container) AppendFile(bucketID, fileID string, offset int64, src io.Reader) (int64, error) {
+	var file *os.File
+
+	err := container.tryLayouts(bucketID, fileID, func(name string) error {
+		var err error
+		file, err = os.OpenFile(name, os.O_WRONLY, container.fileMode)
+
+		return err //nolint:wrapcheck // wrapped below.
+	})
+	if err != nil {
+		return 0, fmt.Errorf("AppendFile os.OpenFile %w", err)
+	}
+
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("AppendFile file.Stat %w", err)
+	}
+
+	if stat.Size() < offset {
+		return 0, fmt.Errorf("AppendFile %s/%s at %d: %w", bucketID, fileID, offset, ErrOffsetBeyondEnd)
+	}
+
+	err = file.Truncate(offset)
+	if err != nil {
+		return 0, fmt.Errorf("AppendFile file.Truncate %w", err)
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, fmt.Errorf("AppendFile file.Seek %w", err)
+	}
+
+	written, err := io.Copy(file, src)
+	if err != nil {
+		return written, fmt.Errorf("AppendFile io.Copy %w", err)
+	}
+
 	return written, nil
 }
 
 func (container Container) OpenFile(bucketID, fileID string) (io.ReadSeekCloser, error) {
-	reader, err := os.Open(path.Join(container.basePath, bucketID, fileID))
+	var reader *os.File
+
+	err := container.tryLayouts(bucketID, fileID, func(name string) error {
+		var err error
+		reader, err = os.Open(name)
+
+		return err //nolint:wrapcheck // wrapped below.
+	})
 	if err != nil {
 		return nil, fmt.Errorf("OpenFile os.Open %w", err)
 	}
@@ -63,11 +309,306 @@ func (container Container) CreateFolder(bucketID string) error {
 	return nil
 }
 
+// DeleteFile removes the blob from every layout, the configured one last so a blob being moved to it
+// by RelayoutFolder is not left behind.
 func (container Container) DeleteFile(bucketID, fileID string) error {
-	err := os.Remove(path.Join(container.basePath, bucketID, fileID))
+	names := container.blobPaths(bucketID, fileID)
+	slices.Reverse(names)
+
+	var notFound error
+
+	removed := false
+
+	for _, name := range names {
+		err := os.Remove(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			notFound = err
+
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("DeleteFile os.Remove %w", err)
+		}
+
+		removed = true
+	}
+
+	if !removed {
+		return fmt.Errorf("DeleteFile os.Remove %w", notFound)
+	}
+
+	return nil
+}
+
+// MoveFile renames the blob, replacing the destination if it exists.
+func (container Container) MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	dir, err := container.makeBlobDir(dstBucketID, dstFileID)
+	if err != nil {
+		return fmt.Errorf("MoveFile: %w", err)
+	}
+
+	err = container.tryLayouts(srcBucketID, srcFileID, func(name string) error {
+		return os.Rename(name, path.Join(dir, dstFileID)) //nolint:wrapcheck // wrapped below.
+	})
+	if err != nil {
+		return fmt.Errorf("MoveFile os.Rename %w", err)
+	}
+
+	err = container.removeOtherLayouts(dstBucketID, dstFileID)
 	if err != nil {
-		return fmt.Errorf("DeleteFile os.Remove %w", err)
+		return fmt.Errorf("MoveFile: %w", err)
 	}
 
 	return nil
 }
+
+// LinkFile hard-links the blob under the destination, the copy sharing the content with the source. The blobs are
+// replaced rather than rewritten in place once complete, so the copies stay independent. The destination must not
+// exist. Fails with errors.ErrUnsupported if the file system can't link the blobs, e.g. across devices.
+func (container Container) LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	dir, err := container.makeBlobDir(dstBucketID, dstFileID)
+	if err != nil {
+		return fmt.Errorf("LinkFile: %w", err)
+	}
+
+	err = container.tryLayouts(srcBucketID, srcFileID, func(name string) error {
+		return os.Link(name, path.Join(dir, dstFileID)) //nolint:wrapcheck // wrapped below.
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("LinkFile os.Link %w: %w", errors.ErrUnsupported, err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("LinkFile os.Link %w", err)
+	}
+
+	err = syncFolder(dir)
+	if err != nil {
+		return fmt.Errorf("LinkFile: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFolder removes the bucket folder with everything left inside. A missing folder is not an error.
+func (container Container) DeleteFolder(bucketID string) error {
+	if bucketID == "" {
+		return fmt.Errorf("DeleteFolder: %w", fs.ErrInvalid)
+	}
+
+	err := os.RemoveAll(path.Join(container.basePath, bucketID))
+	if err != nil {
+		return fmt.Errorf("DeleteFolder os.RemoveAll %w", err)
+	}
+
+	return nil
+}
+
+// ListFolder lists the blobs of the bucket folder in every layout, skipping anything that is not a regular file.
+// A blob found in several layouts is listed once, as the one in the configured layout.
+func (container Container) ListFolder(bucketID string) ([]model.BlobInfo, error) {
+	blobs := []model.BlobInfo{}
+	found := map[string]int{}
+
+	err := container.walkFolder(path.Join(container.basePath, bucketID), 0,
+		func(_ string, depth int, entry fs.DirEntry) error {
+			info, err := entry.Info()
+			if errors.Is(err, fs.ErrNotExist) { // removed meanwhile.
+				return nil
+			}
+
+			if err != nil {
+				return fmt.Errorf("entry.Info %w", err)
+			}
+
+			blob := model.BlobInfo{ModTS: info.ModTime(), ID: entry.Name(), Size: info.Size()}
+
+			i, ok := found[blob.ID]
+			if !ok {
+				found[blob.ID] = len(blobs)
+				blobs = append(blobs, blob)
+			} else if depth == container.fanOut {
+				blobs[i] = blob
+			}
+
+			return nil
+		}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ListFolder %w", err)
+	}
+
+	return blobs, nil
+}
+
+// walkFolder visits the regular files of the folder and of its fan-out directories, the folder being at the depth.
+// afterDir, if set, is called with each fan-out directory once it has been walked.
+func (container Container) walkFolder(folder string, depth int,
+	visit func(dir string, depth int, entry fs.DirEntry) error, afterDir func(dir string, depth int),
+) error {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return fmt.Errorf("os.ReadDir %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && depth < MaxFanOut && isFanOutLevel(entry.Name()) {
+			dir := path.Join(folder, entry.Name())
+
+			err = container.walkFolder(dir, depth+1, visit, afterDir)
+			if errors.Is(err, fs.ErrNotExist) { // removed meanwhile.
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if afterDir != nil {
+				afterDir(dir, depth+1)
+			}
+
+			continue
+		}
+
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		err = visit(folder, depth, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RelayoutFolder moves the blobs of the bucket folder stored in another layout to the configured one and removes
+// the directories of the other layouts emptied. It's safe to run while the blobs are being read and written: a blob
+// is linked to its new path before being removed from the old one, and a newer blob already there is kept.
+// Returns the number of the blobs moved.
+func (container Container) RelayoutFolder(bucketID string) (int, error) {
+	type misplacedBlob struct {
+		name   string
+		fileID string
+	}
+
+	var misplaced []misplacedBlob
+
+	folder := path.Join(container.basePath, bucketID)
+
+	err := container.walkFolder(folder, 0, func(dir string, _ int, entry fs.DirEntry) error {
+		name := path.Join(dir, entry.Name())
+		if name != container.blobPath(bucketID, entry.Name(), container.fanOut) {
+			misplaced = append(misplaced, misplacedBlob{name: name, fileID: entry.Name()})
+		}
+
+		return nil
+	}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("RelayoutFolder %w", err)
+	}
+
+	moved := 0
+
+	for _, blob := range misplaced {
+		relinked, err := container.relayoutBlob(bucketID, blob.fileID, blob.name)
+		if err != nil {
+			return moved, fmt.Errorf("RelayoutFolder %s: %w", blob.name, err)
+		}
+
+		if relinked {
+			moved++
+		}
+	}
+
+	// the directories deeper than the configured layout are not used by the writers.
+	err = container.walkFolder(folder, 0, func(string, int, fs.DirEntry) error { return nil },
+		func(dir string, depth int) {
+			if depth > container.fanOut {
+				os.Remove(dir) // fails unless empty.
+			}
+		})
+	if err != nil {
+		return moved, fmt.Errorf("RelayoutFolder %w", err)
+	}
+
+	return moved, nil
+}
+
+// relayoutBlob moves the blob at the name to the configured layout and reports whether it was moved there.
+func (container Container) relayoutBlob(bucketID, fileID, name string) (bool, error) {
+	dir, err := container.makeBlobDir(bucketID, fileID)
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Link(name, path.Join(dir, fileID))
+	if errors.Is(err, fs.ErrNotExist) { // removed meanwhile.
+		return false, nil
+	}
+
+	relinked := err == nil
+
+	// a blob already in the configured layout was written after this one.
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return false, fmt.Errorf("os.Link %w", err)
+	}
+
+	err = syncFolder(dir)
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("os.Remove %w", err)
+	}
+
+	return relinked, nil
+}
+
+// fileLinker is implemented by the backends able to copy a blob without copying its content.
+type fileLinker interface {
+	LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error
+}
+
+// linkBackend links the blob on the backend, failing with errors.ErrUnsupported if the backend can't link.
+func linkBackend(backend Backend, srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	linker, ok := backend.(fileLinker)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+
+	return linker.LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID) //nolint:wrapcheck // a proxy.
+}
+
+// folderRelayouter is implemented by the backends keeping the blobs in a directory layout.
+type folderRelayouter interface {
+	RelayoutFolder(bucketID string) (int, error)
+}
+
+// relayoutBackends runs RelayoutFolder on the backends having a directory layout and the folder.
+func relayoutBackends(bucketID string, backends ...Backend) (int, error) {
+	var (
+		errs  []error
+		moved int
+	)
+
+	for i, backend := range backends {
+		relayouter, ok := backend.(folderRelayouter)
+		if !ok {
+			continue
+		}
+
+		count, err := relayouter.RelayoutFolder(bucketID)
+		moved += count
+
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("backend %d: %w", i, err))
+		}
+	}
+
+	return moved, errors.Join(errs...)
+}
@@ -0,0 +1,181 @@
+package files_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/eldarbr/go-s3/internal/provider/files"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	crashDirEnv   = "GO_S3_TEST_CRASH_DIR"
+	crashAtEnv    = "GO_S3_TEST_CRASH_AT"
+	crashExitCode = 3
+)
+
+var errInjected = errors.New("injected")
+
+// crashingReader yields the content up to the crash point, then either fails or kills the process.
+type crashingReader struct {
+	src   io.Reader
+	left  int
+	crash func()
+}
+
+func (reader *crashingReader) Read(dst []byte) (int, error) {
+	if reader.left == 0 {
+		reader.crash()
+
+		return 0, errInjected
+	}
+
+	read, err := reader.src.Read(dst[:min(len(dst), reader.left)])
+	reader.left -= read
+
+	return read, err //nolint:wrapcheck // a proxy.
+}
+
+func crashContent() []byte {
+	return bytes.Repeat([]byte("0123456789abcdef"), 1<<14)
+}
+
+// TestWriteFileCrash kills a process writing the blob over an existing one at several points, the reader
+// delivering the content up to the point, and checks the partial blob never shows up under the file id.
+func TestWriteFileCrash(t *testing.T) {
+	if dir := os.Getenv(crashDirEnv); dir != "" {
+		crashAt, _ := strconv.Atoi(os.Getenv(crashAtEnv))
+		container := files.NewContainer(dir, 0o600, 0o700)
+
+		_, _ = container.WriteFile("1", "a", &crashingReader{
+			src:   bytes.NewReader(crashContent()),
+			left:  crashAt,
+			crash: func() { os.Exit(crashExitCode) },
+		})
+
+		return
+	}
+
+	content := crashContent()
+
+	for _, crashAt := range []int{0, 1, 32 << 10, 64<<10 + 1, len(content)} {
+		t.Run(strconv.Itoa(crashAt), func(t *testing.T) {
+			dir := t.TempDir()
+			container := files.NewContainer(dir, 0o600, 0o700)
+
+			require.NoError(t, container.CreateFolder("1"))
+
+			_, err := container.WriteFile("1", "a", strings.NewReader("old"))
+			require.NoError(t, err)
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestWriteFileCrash$") //nolint:gosec // the test binary.
+			cmd.Env = append(os.Environ(), crashDirEnv+"="+dir, crashAtEnv+"="+strconv.Itoa(crashAt))
+
+			var exitErr *exec.ExitError
+
+			err = cmd.Run()
+			require.ErrorAs(t, err, &exitErr)
+			require.Equal(t, crashExitCode, exitErr.ExitCode())
+
+			assert.Equal(t, "old", readAll(t, container, "1", "a"))
+
+			blobs, err := container.ListFolder("1")
+			require.NoError(t, err)
+			require.Len(t, blobs, 2)
+
+			for _, blob := range blobs {
+				if blob.ID != "a" {
+					assert.True(t, strings.HasPrefix(blob.ID, ".tmp-a-"), blob.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFileFailure(t *testing.T) {
+	container := files.NewContainer(t.TempDir(), 0o600, 0o700)
+
+	require.NoError(t, container.CreateFolder("1"))
+
+	// a failed write of a new blob leaves nothing behind.
+	_, err := container.WriteFile("1", "a", &crashingReader{
+		src: bytes.NewReader(crashContent()), left: 100, crash: func() {},
+	})
+	require.ErrorIs(t, err, errInjected)
+
+	_, err = container.OpenFile("1", "a")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	blobs, err := container.ListFolder("1")
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+
+	// a failed overwrite keeps the previous blob.
+	_, err = container.WriteFile("1", "a", strings.NewReader("old"))
+	require.NoError(t, err)
+
+	_, err = container.WriteFile("1", "a", &crashingReader{
+		src: bytes.NewReader(crashContent()), left: 100, crash: func() {},
+	})
+	require.ErrorIs(t, err, errInjected)
+	assert.Equal(t, "old", readAll(t, container, "1", "a"))
+
+	blobs, err = container.ListFolder("1")
+	require.NoError(t, err)
+	assert.Len(t, blobs, 1)
+
+	// no bucket folder.
+	_, err = container.WriteFile("2", "a", strings.NewReader("data"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestContainerRelayout(t *testing.T) {
+	basePath := t.TempDir()
+	flat := files.NewContainer(basePath, 0o600, 0o700)
+	fanned := files.NewFanOutContainer(basePath, 2, 0o600, 0o700)
+
+	require.NoError(t, flat.CreateFolder("1"))
+
+	ids := []string{"0a1b2c3d-e", "0a1bffff-e", "ff000000-e", "x"}
+	for _, id := range ids {
+		_, err := flat.WriteFile("1", id, strings.NewReader("flat "+id))
+		require.NoError(t, err)
+	}
+
+	// the blobs of the previous layout are still read, the new ones go to the configured layout.
+	assert.Equal(t, "flat 0a1b2c3d-e", readAll(t, fanned, "1", "0a1b2c3d-e"))
+
+	_, err := fanned.WriteFile("1", "0a1bffff-e", strings.NewReader("fanned"))
+	require.NoError(t, err)
+	assert.FileExists(t, basePath+"/1/0a/1b/0a1bffff-e")
+	assert.NoFileExists(t, basePath+"/1/0a1bffff-e")
+	assert.Equal(t, "fanned", readAll(t, flat, "1", "0a1bffff-e"))
+
+	moved, err := fanned.RelayoutFolder("1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	assert.FileExists(t, basePath+"/1/ff/00/ff000000-e")
+	assert.FileExists(t, basePath+"/1/x")
+
+	blobs, err := fanned.ListFolder("1")
+	require.NoError(t, err)
+	assert.Len(t, blobs, len(ids))
+
+	// and back, the emptied directories being removed.
+	moved, err = flat.RelayoutFolder("1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, moved)
+	assert.NoDirExists(t, basePath+"/1/0a")
+	assert.Equal(t, "fanned", readAll(t, flat, "1", "0a1bffff-e"))
+
+	require.NoError(t, fanned.DeleteFile("1", "0a1b2c3d-e"))
+	require.ErrorIs(t, fanned.DeleteFile("1", "0a1b2c3d-e"), fs.ErrNotExist)
+}
@@ -0,0 +1,199 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/eldarbr/go-s3/internal/model"
+)
+
+// MemoryContainer keeps the blobs in memory. Meant for tests and throwaway setups.
+type MemoryContainer struct {
+	buckets map[string]map[string]memoryBlob
+	mu      sync.RWMutex
+}
+
+type memoryBlob struct {
+	modTS   time.Time
+	content []byte
+}
+
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
+
+func NewMemoryContainer() *MemoryContainer {
+	return &MemoryContainer{
+		buckets: map[string]map[string]memoryBlob{},
+	}
+}
+
+func (container *MemoryContainer) WriteFile(bucketID, fileID string, src io.Reader) (int64, error) {
+	var buf bytes.Buffer
+
+	written, err := io.Copy(&buf, src)
+	if err != nil {
+		return written, fmt.Errorf("WriteFile io.Copy %w", err)
+	}
+
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	bucket, ok := container.buckets[bucketID]
+	if !ok {
+		return 0, fmt.Errorf("WriteFile bucket %s: %w", bucketID, fs.ErrNotExist)
+	}
+
+	bucket[fileID] = memoryBlob{modTS: time.Now(), content: buf.Bytes()}
+
+	return written, nil
+}
+
+// AppendFile copies src into a buffer first, so the stored content only changes once the copy is over.
+func (container *MemoryContainer) AppendFile(bucketID, fileID string, offset int64, src io.Reader) (int64, error) {
+	var buf bytes.Buffer
+
+	written, copyErr := io.Copy(&buf, src)
+
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	blob, ok := container.buckets[bucketID][fileID]
+	if !ok {
+		return 0, fmt.Errorf("AppendFile %s/%s: %w", bucketID, fileID, fs.ErrNotExist)
+	}
+
+	content := blob.content
+
+	if int64(len(content)) < offset {
+		return 0, fmt.Errorf("AppendFile %s/%s at %d: %w", bucketID, fileID, offset, ErrOffsetBeyondEnd)
+	}
+
+	// the stored slice may be shared with the open readers.
+	appended := make([]byte, 0, offset+written)
+	appended = append(appended, content[:offset]...)
+	container.buckets[bucketID][fileID] = memoryBlob{modTS: time.Now(), content: append(appended, buf.Bytes()...)}
+
+	if copyErr != nil {
+		return written, fmt.Errorf("AppendFile io.Copy %w", copyErr)
+	}
+
+	return written, nil
+}
+
+func (container *MemoryContainer) OpenFile(bucketID, fileID string) (io.ReadSeekCloser, error) {
+	container.mu.RLock()
+	defer container.mu.RUnlock()
+
+	blob, ok := container.buckets[bucketID][fileID]
+	if !ok {
+		return nil, fmt.Errorf("OpenFile %s/%s: %w", bucketID, fileID, fs.ErrNotExist)
+	}
+
+	return memoryFile{bytes.NewReader(blob.content)}, nil
+}
+
+func (container *MemoryContainer) ListFolder(bucketID string) ([]model.BlobInfo, error) {
+	container.mu.RLock()
+	defer container.mu.RUnlock()
+
+	bucket, ok := container.buckets[bucketID]
+	if !ok {
+		return nil, fmt.Errorf("ListFolder %s: %w", bucketID, fs.ErrNotExist)
+	}
+
+	blobs := make([]model.BlobInfo, 0, len(bucket))
+
+	for fileID, blob := range bucket {
+		blobs = append(blobs, model.BlobInfo{ModTS: blob.modTS, ID: fileID, Size: int64(len(blob.content))})
+	}
+
+	return blobs, nil
+}
+
+func (container *MemoryContainer) CreateFolder(bucketID string) error {
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	if _, ok := container.buckets[bucketID]; ok {
+		return fmt.Errorf("CreateFolder %s: %w", bucketID, fs.ErrExist)
+	}
+
+	container.buckets[bucketID] = map[string]memoryBlob{}
+
+	return nil
+}
+
+func (container *MemoryContainer) DeleteFile(bucketID, fileID string) error {
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	if _, ok := container.buckets[bucketID][fileID]; !ok {
+		return fmt.Errorf("DeleteFile %s/%s: %w", bucketID, fileID, fs.ErrNotExist)
+	}
+
+	delete(container.buckets[bucketID], fileID)
+
+	return nil
+}
+
+func (container *MemoryContainer) MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	blob, ok := container.buckets[srcBucketID][srcFileID]
+	if !ok {
+		return fmt.Errorf("MoveFile %s/%s: %w", srcBucketID, srcFileID, fs.ErrNotExist)
+	}
+
+	dstBucket, ok := container.buckets[dstBucketID]
+	if !ok {
+		return fmt.Errorf("MoveFile bucket %s: %w", dstBucketID, fs.ErrNotExist)
+	}
+
+	delete(container.buckets[srcBucketID], srcFileID)
+	dstBucket[dstFileID] = blob
+
+	return nil
+}
+
+// LinkFile shares the content of the blob with the destination, the stored content is never changed in place.
+func (container *MemoryContainer) LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	blob, ok := container.buckets[srcBucketID][srcFileID]
+	if !ok {
+		return fmt.Errorf("LinkFile %s/%s: %w", srcBucketID, srcFileID, fs.ErrNotExist)
+	}
+
+	dstBucket, ok := container.buckets[dstBucketID]
+	if !ok {
+		return fmt.Errorf("LinkFile bucket %s: %w", dstBucketID, fs.ErrNotExist)
+	}
+
+	if _, exists := dstBucket[dstFileID]; exists {
+		return fmt.Errorf("LinkFile %s/%s: %w", dstBucketID, dstFileID, fs.ErrExist)
+	}
+
+	dstBucket[dstFileID] = memoryBlob{modTS: time.Now(), content: blob.content}
+
+	return nil
+}
+
+func (container *MemoryContainer) DeleteFolder(bucketID string) error {
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	delete(container.buckets, bucketID)
+
+	return nil
+}
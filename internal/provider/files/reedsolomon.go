@@ -0,0 +1,232 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var errSingularMatrix = errors.New("matrix is singular")
+
+// The GF(2^8) arithmetic over the 0x11d polynomial with the generator 2.
+//
+//nolint:gochecknoglobals // lookup tables, filled once.
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+	// gfMulTable[a][b] is a * b, a row being the multiplication by a single coefficient.
+	gfMulTable [256][256]byte
+)
+
+//nolint:gochecknoinits // the lookup tables are computed once.
+func init() {
+	x := 1
+
+	for i := range 255 {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			gfMulTable[a][b] = gfExp[int(gfLog[a])+int(gfLog[b])]
+		}
+	}
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+func gfPow(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+
+	if a == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])*n%255]
+}
+
+type gfMatrix [][]byte
+
+func newGFMatrix(rows, cols int) gfMatrix {
+	matrix := make(gfMatrix, rows)
+	for row := range matrix {
+		matrix[row] = make([]byte, cols)
+	}
+
+	return matrix
+}
+
+func (matrix gfMatrix) mul(other gfMatrix) gfMatrix {
+	product := newGFMatrix(len(matrix), len(other[0]))
+
+	for row := range matrix {
+		for col := range other[0] {
+			var sum byte
+			for i := range other {
+				sum ^= gfMulTable[matrix[row][i]][other[i][col]]
+			}
+
+			product[row][col] = sum
+		}
+	}
+
+	return product
+}
+
+// invert returns the inverse of the square matrix, found by the Gauss-Jordan elimination.
+func (matrix gfMatrix) invert() (gfMatrix, error) {
+	size := len(matrix)
+	work := newGFMatrix(size, 2*size)
+
+	for row := range size {
+		copy(work[row], matrix[row])
+		work[row][size+row] = 1
+	}
+
+	for col := range size {
+		pivot := col
+		for pivot < size && work[pivot][col] == 0 {
+			pivot++
+		}
+
+		if pivot == size {
+			return nil, errSingularMatrix
+		}
+
+		work[col], work[pivot] = work[pivot], work[col]
+
+		scale := &gfMulTable[gfInv(work[col][col])]
+		for i := range work[col] {
+			work[col][i] = scale[work[col][i]]
+		}
+
+		for row := range size {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+
+			factor := &gfMulTable[work[row][col]]
+			for i := range work[row] {
+				work[row][i] ^= factor[work[col][i]]
+			}
+		}
+	}
+
+	inverse := newGFMatrix(size, size)
+	for row := range size {
+		copy(inverse[row], work[row][size:])
+	}
+
+	return inverse, nil
+}
+
+// reedSolomon is a systematic Reed-Solomon code of dataShards data and parityShards parity shards,
+// any dataShards of the shards being enough to restore the data ones.
+type reedSolomon struct {
+	// matrix maps the data shards to all the shards, its top being the identity.
+	matrix       gfMatrix
+	dataShards   int
+	parityShards int
+}
+
+func newReedSolomon(dataShards, parityShards int) (*reedSolomon, error) {
+	if dataShards <= 0 || parityShards < 0 || dataShards+parityShards > 256 {
+		return nil, fmt.Errorf("reed-solomon %d+%d shards: %w", dataShards, parityShards, ErrBadBackendConfig)
+	}
+
+	// any rows of a vandermonde matrix are independent, which the product with the inverse of its top keeps.
+	vandermonde := newGFMatrix(dataShards+parityShards, dataShards)
+	for row := range vandermonde {
+		for col := range vandermonde[row] {
+			vandermonde[row][col] = gfPow(byte(row), col)
+		}
+	}
+
+	topInverse, err := gfMatrix(vandermonde[:dataShards]).invert()
+	if err != nil {
+		return nil, fmt.Errorf("reed-solomon: %w", err)
+	}
+
+	return &reedSolomon{
+		matrix:       vandermonde.mul(topInverse),
+		dataShards:   dataShards,
+		parityShards: parityShards,
+	}, nil
+}
+
+// mulAdd adds the input multiplied by the coefficient to the output.
+func mulAdd(coefficient byte, input, output []byte) {
+	factor := &gfMulTable[coefficient]
+	for i, value := range input {
+		output[i] ^= factor[value]
+	}
+}
+
+// encode computes the parity shards from the data ones, all the shards having the same length.
+func (code *reedSolomon) encode(shards [][]byte) {
+	for parity := code.dataShards; parity < len(shards); parity++ {
+		clear(shards[parity])
+
+		for data := range code.dataShards {
+			mulAdd(code.matrix[parity][data], shards[data], shards[parity])
+		}
+	}
+}
+
+// reconstructData restores the data shards not present from any dataShards of the present ones.
+// The restored shards must be allocated with the length of the present ones.
+func (code *reedSolomon) reconstructData(shards [][]byte, present []bool) error {
+	if !slices.Contains(present[:code.dataShards], false) {
+		return nil
+	}
+
+	rows := make([]int, 0, code.dataShards)
+
+	for i := range shards {
+		if present[i] && len(rows) < code.dataShards {
+			rows = append(rows, i)
+		}
+	}
+
+	if len(rows) < code.dataShards {
+		return ErrTooFewShards
+	}
+
+	sub := newGFMatrix(code.dataShards, code.dataShards)
+	for i, row := range rows {
+		copy(sub[i], code.matrix[row])
+	}
+
+	decode, err := sub.invert()
+	if err != nil {
+		return fmt.Errorf("reed-solomon: %w", err)
+	}
+
+	for data := range code.dataShards {
+		if present[data] {
+			continue
+		}
+
+		clear(shards[data])
+
+		for i, row := range rows {
+			mulAdd(decode[data][i], shards[row], shards[data])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,333 @@
+package files
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/eldarbr/go-s3/internal/model"
+)
+
+var (
+	ErrUnknownBackend   = errors.New("unknown storage backend")
+	ErrDuplicateBackend = errors.New("storage backend is already registered")
+	ErrBadBackendConfig = errors.New("bad storage backend config")
+	ErrOffsetBeyondEnd  = errors.New("offset is beyond the end of the file")
+)
+
+const (
+	BackendTypeLocal      = "local"
+	BackendTypeMemory     = "memory"
+	BackendTypeTiered     = "tiered"
+	BackendTypeEncrypted  = "encrypted"
+	BackendTypeReplicated = "replicated"
+	BackendTypeErasure    = "erasure"
+)
+
+// Backend is the blob storage contract the business module relies on.
+type Backend interface {
+	CreateFolder(bucketID string) error
+	OpenFile(bucketID, fileID string) (io.ReadSeekCloser, error)
+	WriteFile(bucketID, fileID string, src io.Reader) (int64, error)
+	AppendFile(bucketID, fileID string, offset int64, src io.Reader) (int64, error)
+	DeleteFile(bucketID, fileID string) error
+	DeleteFolder(bucketID string) error
+	ListFolder(bucketID string) ([]model.BlobInfo, error)
+	MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error
+}
+
+// BackendConfig describes a backend to be built by NewBackend.
+// Nested configs are used by the backends that wrap other backends.
+type BackendConfig struct {
+	Hot        *BackendConfig    `yaml:"hot"`
+	Cold       *BackendConfig    `yaml:"cold"`
+	Inner      *BackendConfig    `yaml:"inner"`
+	Type       string            `yaml:"type"`
+	Path       string            `yaml:"path"`
+	MasterKeys []MasterKeyConfig `yaml:"masterKeys"`
+	Replicas   []BackendConfig   `yaml:"replicas"`
+	Shards     []BackendConfig   `yaml:"shards"`
+	// FanOut is the number of the directory levels the local backend keeps the blobs of a bucket under.
+	FanOut int `yaml:"fanOut"`
+	// DataShards is the number of the shards keeping the content, the rest of the shards keeping the parity.
+	DataShards int `yaml:"dataShards"`
+	// WriteQuorum is the number of the replicas a write must succeed on, the majority by default,
+	// or the number of the shards, the data shards and one more by default.
+	WriteQuorum int         `yaml:"writeQuorum"`
+	FileMode    fs.FileMode `yaml:"-"`
+	DirMode     fs.FileMode `yaml:"-"`
+}
+
+// MasterKeyConfig is a base64 AES-256 key given either inline or as a path to a file holding it.
+// The first master key of the list is the current one, the rest are kept to read the blobs until rewrapped.
+type MasterKeyConfig struct {
+	Key     string `yaml:"key"`
+	KeyFile string `yaml:"keyFile"`
+	ID      uint32 `yaml:"id"`
+}
+
+type BackendFactory func(conf BackendConfig) (Backend, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]BackendFactory{}
+)
+
+//nolint:gochecknoinits // Register the built-in backends.
+func init() {
+	MustRegister(BackendTypeLocal, newLocalBackend)
+	MustRegister(BackendTypeMemory, newMemoryBackend)
+	MustRegister(BackendTypeTiered, newTieredBackend)
+	MustRegister(BackendTypeEncrypted, newEncryptedBackend)
+	MustRegister(BackendTypeReplicated, newReplicatedBackend)
+	MustRegister(BackendTypeErasure, newErasureBackend)
+}
+
+// Register makes a backend factory available under the name.
+func Register(name string, factory BackendFactory) error {
+	if name == "" || factory == nil {
+		return ErrBadBackendConfig
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		return fmt.Errorf("Register %s: %w", name, ErrDuplicateBackend)
+	}
+
+	registry[name] = factory
+
+	return nil
+}
+
+func MustRegister(name string, factory BackendFactory) {
+	err := Register(name, factory)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisteredBackends returns the sorted names of the known backends.
+func RegisteredBackends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// NewBackend builds the backend described by the config.
+func NewBackend(conf BackendConfig) (Backend, error) {
+	registryMu.RLock()
+	factory, ok := registry[conf.Type]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("NewBackend %q: %w", conf.Type, ErrUnknownBackend)
+	}
+
+	backend, err := factory(conf)
+	if err != nil {
+		return nil, fmt.Errorf("NewBackend %q: %w", conf.Type, err)
+	}
+
+	return backend, nil
+}
+
+// Inherit fills the unset fields of the config and of its nested configs from the defaults.
+func (conf *BackendConfig) Inherit(defaults BackendConfig) {
+	if conf.Type == "" {
+		conf.Type = defaults.Type
+	}
+
+	if conf.Path == "" {
+		conf.Path = defaults.Path
+	}
+
+	if conf.FileMode == 0 {
+		conf.FileMode = defaults.FileMode
+	}
+
+	if conf.DirMode == 0 {
+		conf.DirMode = defaults.DirMode
+	}
+
+	nestedConfs := []*BackendConfig{conf.Hot, conf.Cold, conf.Inner}
+	for i := range conf.Replicas {
+		nestedConfs = append(nestedConfs, &conf.Replicas[i])
+	}
+
+	for i := range conf.Shards {
+		nestedConfs = append(nestedConfs, &conf.Shards[i])
+	}
+
+	for _, nested := range nestedConfs {
+		if nested != nil {
+			nested.Inherit(BackendConfig{ //nolint:exhaustruct // only the leaf defaults are inherited.
+				Type:     BackendTypeLocal,
+				FileMode: defaults.FileMode,
+				DirMode:  defaults.DirMode,
+			})
+		}
+	}
+}
+
+func newLocalBackend(conf BackendConfig) (Backend, error) {
+	if conf.Path == "" {
+		return nil, fmt.Errorf("local backend requires a path: %w", ErrBadBackendConfig)
+	}
+
+	if conf.FanOut < 0 || conf.FanOut > MaxFanOut {
+		return nil, fmt.Errorf("local backend fan-out %d out of 0..%d: %w", conf.FanOut, MaxFanOut, ErrBadBackendConfig)
+	}
+
+	return NewFanOutContainer(conf.Path, conf.FanOut, conf.FileMode, conf.DirMode), nil
+}
+
+func newMemoryBackend(BackendConfig) (Backend, error) {
+	return NewMemoryContainer(), nil
+}
+
+func newTieredBackend(conf BackendConfig) (Backend, error) {
+	if conf.Hot == nil || conf.Cold == nil {
+		return nil, fmt.Errorf("tiered backend requires hot and cold tiers: %w", ErrBadBackendConfig)
+	}
+
+	hot, err := NewBackend(*conf.Hot)
+	if err != nil {
+		return nil, fmt.Errorf("tiered hot tier: %w", err)
+	}
+
+	cold, err := NewBackend(*conf.Cold)
+	if err != nil {
+		return nil, fmt.Errorf("tiered cold tier: %w", err)
+	}
+
+	return NewTieredContainer(hot, cold), nil
+}
+
+func newEncryptedBackend(conf BackendConfig) (Backend, error) {
+	if conf.Inner == nil || len(conf.MasterKeys) == 0 {
+		return nil, fmt.Errorf("encrypted backend requires an inner backend and a master key: %w", ErrBadBackendConfig)
+	}
+
+	keys := make([]MasterKey, 0, len(conf.MasterKeys))
+
+	for _, keyConf := range conf.MasterKeys {
+		key, err := keyConf.load()
+		if err != nil {
+			return nil, fmt.Errorf("encrypted backend master key %d: %w", keyConf.ID, err)
+		}
+
+		keys = append(keys, MasterKey{Key: key, ID: keyConf.ID})
+	}
+
+	ring, err := NewKeyRing(keys...)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted backend: %w", err)
+	}
+
+	inner, err := NewBackend(*conf.Inner)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted inner backend: %w", err)
+	}
+
+	return NewEncryptedContainer(inner, ring), nil
+}
+
+func newReplicatedBackend(conf BackendConfig) (Backend, error) {
+	if len(conf.Replicas) == 0 {
+		return nil, fmt.Errorf("replicated backend requires replicas: %w", ErrBadBackendConfig)
+	}
+
+	quorum := conf.WriteQuorum
+	if quorum == 0 {
+		quorum = len(conf.Replicas)/2 + 1
+	}
+
+	if quorum < 0 || quorum > len(conf.Replicas) {
+		return nil, fmt.Errorf("replicated backend write quorum %d of %d replicas: %w", quorum, len(conf.Replicas),
+			ErrBadBackendConfig)
+	}
+
+	replicas := make([]Backend, 0, len(conf.Replicas))
+
+	for i, replicaConf := range conf.Replicas {
+		replica, err := NewBackend(replicaConf)
+		if err != nil {
+			return nil, fmt.Errorf("replicated backend replica %d: %w", i, err)
+		}
+
+		replicas = append(replicas, replica)
+	}
+
+	return NewReplicatedContainer(quorum, replicas...), nil
+}
+
+func newErasureBackend(conf BackendConfig) (Backend, error) {
+	if conf.DataShards <= 0 || conf.DataShards > len(conf.Shards) {
+		return nil, fmt.Errorf("erasure backend requires %d data shards of %d: %w", conf.DataShards,
+			len(conf.Shards), ErrBadBackendConfig)
+	}
+
+	quorum := conf.WriteQuorum
+	if quorum == 0 {
+		quorum = min(conf.DataShards+1, len(conf.Shards))
+	}
+
+	if quorum < conf.DataShards || quorum > len(conf.Shards) {
+		return nil, fmt.Errorf("erasure backend write quorum %d of %d shards: %w", quorum, len(conf.Shards),
+			ErrBadBackendConfig)
+	}
+
+	shards := make([]Backend, 0, len(conf.Shards))
+
+	for i, shardConf := range conf.Shards {
+		shard, err := NewBackend(shardConf)
+		if err != nil {
+			return nil, fmt.Errorf("erasure backend shard %d: %w", i, err)
+		}
+
+		shards = append(shards, shard)
+	}
+
+	container, err := NewErasureContainer(conf.DataShards, quorum, shards...)
+	if err != nil {
+		return nil, fmt.Errorf("erasure backend: %w", err)
+	}
+
+	return container, nil
+}
+
+func (conf MasterKeyConfig) load() ([]byte, error) {
+	encoded := conf.Key
+
+	if conf.KeyFile != "" {
+		content, err := os.ReadFile(conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("MasterKeyConfig.load os.ReadFile: %w", err)
+		}
+
+		encoded = string(content)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("MasterKeyConfig.load: %w", ErrBadMasterKey)
+	}
+
+	return key, nil
+}
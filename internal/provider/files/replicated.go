@@ -0,0 +1,449 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"github.com/eldarbr/go-s3/internal/model"
+)
+
+var (
+	ErrNoQuorum        = errors.New("not enough replicas succeeded")
+	errReplicaDetached = errors.New("replica is detached from the write")
+)
+
+// replicaCopyBufferSize is the size of the chunks the written content is fanned out in.
+const replicaCopyBufferSize = 32 << 10
+
+// ReplicatedContainer mirrors every blob to all its replicas, e.g. the local backends on separate disks.
+// A write succeeds once the write quorum of the replicas has the complete content, the replicas that failed it
+// are cleared of the blob so they never serve a stale content. Reads are served by the first replica having
+// the blob. The other operations tolerate the failures of the replicas beyond the quorum. The missing copies
+// are restored by RepairFolder.
+type ReplicatedContainer struct {
+	replicas []Backend
+	quorum   int
+}
+
+// NewReplicatedContainer mirrors the blobs to the replicas, writeQuorum being clamped to 1..len(replicas).
+func NewReplicatedContainer(writeQuorum int, replicas ...Backend) *ReplicatedContainer {
+	return &ReplicatedContainer{
+		replicas: replicas,
+		quorum:   max(1, min(writeQuorum, len(replicas))),
+	}
+}
+
+type replicaResult struct {
+	err     error
+	written int64
+}
+
+// fanOut runs the write on every replica concurrently, feeding each the content of src. A replica that fails
+// is detached, while the rest go on as long as they can make the quorum. Once the quorum is made, the blob is
+// removed from the replicas that failed. Otherwise the complete copies are left for the caller to discard.
+func (container ReplicatedContainer) fanOut(bucketID, fileID string, src io.Reader,
+	write func(replica Backend, src io.Reader) (int64, error),
+) (int64, error) {
+	var wg sync.WaitGroup
+
+	results := make([]replicaResult, len(container.replicas))
+	writers := make([]*io.PipeWriter, len(container.replicas))
+
+	for i, replica := range container.replicas {
+		reader, writer := io.Pipe()
+		writers[i] = writer
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i].written, results[i].err = write(replica, reader)
+
+			// the writes to a replica that is done, whatever the reason, fail from now on.
+			reader.CloseWithError(errReplicaDetached)
+		}()
+	}
+
+	total, err := container.feed(src, writers)
+
+	for _, writer := range writers {
+		writer.CloseWithError(err) // a nil error is a clean EOF.
+	}
+
+	wg.Wait()
+
+	if err != nil {
+		return total, err
+	}
+
+	var errs []error
+
+	failed := make([]int, 0, len(results))
+
+	for i, result := range results {
+		switch {
+		case result.err != nil:
+			errs = append(errs, fmt.Errorf("replica %d: %w", i, result.err))
+			failed = append(failed, i)
+		case result.written != total:
+			errs = append(errs, fmt.Errorf("replica %d wrote %d of %d bytes: %w", i, result.written, total,
+				io.ErrShortWrite))
+			failed = append(failed, i)
+		}
+	}
+
+	if len(results)-len(failed) < container.quorum {
+		return total, errors.Join(append(errs, ErrNoQuorum)...)
+	}
+
+	for _, i := range failed {
+		container.replicas[i].DeleteFile(bucketID, fileID) //nolint:errcheck // best effort, may be gone already.
+	}
+
+	return total, nil
+}
+
+// feed copies src to the writers, detaching the ones that fail. Returns ErrNoQuorum once too few are left.
+func (container ReplicatedContainer) feed(src io.Reader, writers []*io.PipeWriter) (int64, error) {
+	buf := make([]byte, replicaCopyBufferSize)
+	attached := len(writers)
+	detached := make([]bool, len(writers))
+
+	var total int64
+
+	for {
+		read, readErr := src.Read(buf)
+
+		for i, writer := range writers {
+			if read == 0 || detached[i] {
+				continue
+			}
+
+			_, err := writer.Write(buf[:read])
+			if err != nil {
+				detached[i] = true
+				attached--
+			}
+		}
+
+		total += int64(read)
+
+		if attached < container.quorum {
+			return total, ErrNoQuorum
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return total, nil
+		}
+
+		if readErr != nil {
+			return total, readErr //nolint:wrapcheck // the caller's reader error as is.
+		}
+	}
+}
+
+func (container ReplicatedContainer) WriteFile(bucketID, fileID string, src io.Reader) (int64, error) {
+	written, err := container.fanOut(bucketID, fileID, src, func(replica Backend, src io.Reader) (int64, error) {
+		return replica.WriteFile(bucketID, fileID, src) //nolint:wrapcheck // wrapped by fanOut.
+	})
+	if err != nil {
+		return written, fmt.Errorf("ReplicatedContainer.WriteFile: %w", err)
+	}
+
+	return written, nil
+}
+
+// AppendFile appends to every replica of the blob. A replica failing an append loses the blob till it's repaired.
+func (container ReplicatedContainer) AppendFile(bucketID, fileID string, offset int64, src io.Reader,
+) (int64, error) {
+	written, err := container.fanOut(bucketID, fileID, src, func(replica Backend, src io.Reader) (int64, error) {
+		return replica.AppendFile(bucketID, fileID, offset, src) //nolint:wrapcheck // wrapped by fanOut.
+	})
+	if err != nil {
+		return written, fmt.Errorf("ReplicatedContainer.AppendFile: %w", err)
+	}
+
+	return written, nil
+}
+
+// OpenFile opens the blob on the first replica having it.
+func (container ReplicatedContainer) OpenFile(bucketID, fileID string) (io.ReadSeekCloser, error) {
+	errs := make([]error, 0, len(container.replicas))
+
+	for i, replica := range container.replicas {
+		file, err := replica.OpenFile(bucketID, fileID)
+		if err == nil {
+			return file, nil
+		}
+
+		errs = append(errs, fmt.Errorf("replica %d: %w", i, err))
+	}
+
+	return nil, fmt.Errorf("ReplicatedContainer.OpenFile: %w", errors.Join(errs...))
+}
+
+// each runs the operation on every replica, see eachBackend.
+func (container ReplicatedContainer) each(operation func(replica Backend) error, tolerated ...error) error {
+	return eachBackend(container.replicas, container.quorum, operation, tolerated...)
+}
+
+// eachBackend runs the operation on every backend. It fails if fewer than quorum backends didn't fail, the errors
+// matching any of the tolerated ones not counting as failures. If every backend returned a tolerated error,
+// the first one is returned.
+func eachBackend(backends []Backend, quorum int, operation func(backend Backend) error, tolerated ...error) error {
+	var (
+		errs         []error
+		failed       int
+		toleratedErr error
+		toleratedAll = true
+	)
+
+	for i, backend := range backends {
+		err := operation(backend)
+		if err == nil {
+			toleratedAll = false
+
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("backend %d: %w", i, err))
+
+		if !matchesAny(err, tolerated) {
+			failed++
+			toleratedAll = false
+
+			continue
+		}
+
+		if toleratedErr == nil {
+			toleratedErr = err
+		}
+	}
+
+	if len(backends)-failed < quorum {
+		return errors.Join(append(errs, ErrNoQuorum)...)
+	}
+
+	if toleratedAll && toleratedErr != nil {
+		return toleratedErr
+	}
+
+	return nil
+}
+
+func matchesAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateFolder creates the folder on every replica, failing with fs.ErrExist only if every replica has it.
+func (container ReplicatedContainer) CreateFolder(bucketID string) error {
+	err := container.each(func(replica Backend) error {
+		return replica.CreateFolder(bucketID) //nolint:wrapcheck // wrapped below.
+	}, fs.ErrExist)
+	if err != nil {
+		return fmt.Errorf("ReplicatedContainer.CreateFolder: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFile removes the blob from every replica, failing with fs.ErrNotExist only if no replica had it.
+func (container ReplicatedContainer) DeleteFile(bucketID, fileID string) error {
+	err := container.each(func(replica Backend) error {
+		return replica.DeleteFile(bucketID, fileID) //nolint:wrapcheck // wrapped below.
+	}, fs.ErrNotExist)
+	if err != nil {
+		return fmt.Errorf("ReplicatedContainer.DeleteFile: %w", err)
+	}
+
+	return nil
+}
+
+func (container ReplicatedContainer) DeleteFolder(bucketID string) error {
+	err := container.each(func(replica Backend) error {
+		return replica.DeleteFolder(bucketID) //nolint:wrapcheck // wrapped below.
+	})
+	if err != nil {
+		return fmt.Errorf("ReplicatedContainer.DeleteFolder: %w", err)
+	}
+
+	return nil
+}
+
+// MoveFile moves the blob on every replica having it, failing with fs.ErrNotExist only if no replica had it.
+func (container ReplicatedContainer) MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	err := container.each(func(replica Backend) error {
+		return replica.MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID) //nolint:wrapcheck // wrapped below.
+	}, fs.ErrNotExist)
+	if err != nil {
+		return fmt.Errorf("ReplicatedContainer.MoveFile: %w", err)
+	}
+
+	return nil
+}
+
+// LinkFile links the blob on every replica having it, failing with fs.ErrNotExist only if no replica had it.
+func (container ReplicatedContainer) LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	err := container.each(func(replica Backend) error {
+		return linkBackend(replica, srcBucketID, srcFileID, dstBucketID, dstFileID)
+	}, fs.ErrNotExist)
+	if err != nil {
+		return fmt.Errorf("ReplicatedContainer.LinkFile: %w", err)
+	}
+
+	return nil
+}
+
+// ListFolder merges the listings of the replicas. A blob is reported once, as stored on the first replica having it.
+func (container ReplicatedContainer) ListFolder(bucketID string) ([]model.BlobInfo, error) {
+	listings, err := container.listReplicas(bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("ReplicatedContainer.ListFolder: %w", err)
+	}
+
+	var blobs []model.BlobInfo
+
+	seen := make(map[string]struct{})
+
+	for _, listing := range listings {
+		for _, blob := range listing {
+			if _, ok := seen[blob.ID]; !ok {
+				seen[blob.ID] = struct{}{}
+				blobs = append(blobs, blob)
+			}
+		}
+	}
+
+	return blobs, nil
+}
+
+// listReplicas lists the folder on every replica, the listing of a replica that failed or misses the folder
+// being nil. Fails with fs.ErrNotExist if no replica has the folder.
+func (container ReplicatedContainer) listReplicas(bucketID string) ([][]model.BlobInfo, error) {
+	var (
+		errs   []error
+		failed int
+		listed bool
+	)
+
+	listings := make([][]model.BlobInfo, len(container.replicas))
+
+	for i, replica := range container.replicas {
+		blobs, err := replica.ListFolder(bucketID)
+		if err == nil {
+			listings[i] = append(make([]model.BlobInfo, 0, len(blobs)), blobs...)
+			listed = true
+
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("replica %d: %w", i, err))
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			failed++
+		}
+	}
+
+	if len(container.replicas)-failed < container.quorum {
+		return nil, errors.Join(append(errs, ErrNoQuorum)...)
+	}
+
+	if !listed {
+		return nil, errors.Join(errs...)
+	}
+
+	return listings, nil
+}
+
+// RelayoutFolder moves the blobs of the folder to the configured directory layout of each replica.
+func (container ReplicatedContainer) RelayoutFolder(bucketID string) (int, error) {
+	moved, err := relayoutBackends(bucketID, container.replicas...)
+	if err != nil {
+		return moved, fmt.Errorf("ReplicatedContainer.RelayoutFolder: %w", err)
+	}
+
+	return moved, nil
+}
+
+// RepairFolder copies the blobs of the folder to the replicas missing them, creating the folder where it's missing.
+// The blobs being written are skipped. A blob deleted during the repair may be restored on some replicas,
+// to be found as an orphan by the reconciler. Returns the number of the copies made.
+func (container ReplicatedContainer) RepairFolder(bucketID string) (int, error) {
+	listings, err := container.listReplicas(bucketID)
+	if err != nil {
+		return 0, fmt.Errorf("ReplicatedContainer.RepairFolder: %w", err)
+	}
+
+	present := make([]map[string]struct{}, len(listings))
+
+	for i, listing := range listings {
+		present[i] = make(map[string]struct{}, len(listing))
+
+		for _, blob := range listing {
+			present[i][blob.ID] = struct{}{}
+		}
+	}
+
+	var (
+		errs   []error
+		copies int
+	)
+
+	for i, replica := range container.replicas {
+		if listings[i] == nil {
+			err = replica.CreateFolder(bucketID)
+			if err != nil && !errors.Is(err, fs.ErrExist) {
+				errs = append(errs, fmt.Errorf("replica %d: %w", i, err))
+
+				continue
+			}
+		}
+
+		for source, listing := range listings {
+			for _, blob := range listing {
+				if _, ok := present[i][blob.ID]; ok || strings.HasPrefix(blob.ID, tempPrefix) {
+					continue
+				}
+
+				err = copyBlob(container.replicas[source], replica, bucketID, blob.ID)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("replica %d blob %s: %w", i, blob.ID, err))
+
+					continue
+				}
+
+				present[i][blob.ID] = struct{}{}
+				copies++
+			}
+		}
+	}
+
+	return copies, errors.Join(errs...)
+}
+
+func copyBlob(src, dst Backend, bucketID, fileID string) error {
+	file, err := src.OpenFile(bucketID, fileID)
+	if err != nil {
+		return fmt.Errorf("copyBlob OpenFile: %w", err)
+	}
+
+	defer file.Close()
+
+	_, err = dst.WriteFile(bucketID, fileID, file)
+	if err != nil {
+		return fmt.Errorf("copyBlob WriteFile: %w", err)
+	}
+
+	return nil
+}
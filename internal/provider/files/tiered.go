@@ -0,0 +1,219 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/eldarbr/go-s3/internal/model"
+)
+
+// TieredContainer writes to the hot tier and reads from the hot tier first,
+// falling back to the cold one. Blobs are moved to the cold tier by Demote, e.g. by age with `go-s3 demote`.
+type TieredContainer struct {
+	hot  Backend
+	cold Backend
+}
+
+func NewTieredContainer(hot, cold Backend) *TieredContainer {
+	return &TieredContainer{
+		hot:  hot,
+		cold: cold,
+	}
+}
+
+func (container TieredContainer) WriteFile(bucketID, fileID string, src io.Reader) (int64, error) {
+	written, err := container.hot.WriteFile(bucketID, fileID, src)
+	if err != nil {
+		return written, fmt.Errorf("TieredContainer.WriteFile hot: %w", err)
+	}
+
+	return written, nil
+}
+
+// AppendFile only appends to the hot tier, the partial blobs are not expected to be demoted.
+func (container TieredContainer) AppendFile(bucketID, fileID string, offset int64, src io.Reader) (int64, error) {
+	written, err := container.hot.AppendFile(bucketID, fileID, offset, src)
+	if err != nil {
+		return written, fmt.Errorf("TieredContainer.AppendFile hot: %w", err)
+	}
+
+	return written, nil
+}
+
+func (container TieredContainer) OpenFile(bucketID, fileID string) (io.ReadSeekCloser, error) {
+	file, err := container.hot.OpenFile(bucketID, fileID)
+	if err == nil {
+		return file, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("TieredContainer.OpenFile hot: %w", err)
+	}
+
+	file, err = container.cold.OpenFile(bucketID, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("TieredContainer.OpenFile cold: %w", err)
+	}
+
+	return file, nil
+}
+
+func (container TieredContainer) CreateFolder(bucketID string) error {
+	err := container.hot.CreateFolder(bucketID)
+	if err != nil {
+		return fmt.Errorf("TieredContainer.CreateFolder hot: %w", err)
+	}
+
+	err = container.cold.CreateFolder(bucketID)
+	if err != nil {
+		return fmt.Errorf("TieredContainer.CreateFolder cold: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFile removes the blob from both tiers. It only fails if neither tier had it
+// or if a tier failed for a reason other than the blob being absent.
+func (container TieredContainer) DeleteFile(bucketID, fileID string) error {
+	hotErr := container.hot.DeleteFile(bucketID, fileID)
+	if hotErr != nil && !errors.Is(hotErr, fs.ErrNotExist) {
+		return fmt.Errorf("TieredContainer.DeleteFile hot: %w", hotErr)
+	}
+
+	coldErr := container.cold.DeleteFile(bucketID, fileID)
+	if coldErr != nil && !errors.Is(coldErr, fs.ErrNotExist) {
+		return fmt.Errorf("TieredContainer.DeleteFile cold: %w", coldErr)
+	}
+
+	if hotErr != nil && coldErr != nil {
+		return fmt.Errorf("TieredContainer.DeleteFile: %w", hotErr)
+	}
+
+	return nil
+}
+
+func (container TieredContainer) DeleteFolder(bucketID string) error {
+	err := container.hot.DeleteFolder(bucketID)
+	if err != nil {
+		return fmt.Errorf("TieredContainer.DeleteFolder hot: %w", err)
+	}
+
+	err = container.cold.DeleteFolder(bucketID)
+	if err != nil {
+		return fmt.Errorf("TieredContainer.DeleteFolder cold: %w", err)
+	}
+
+	return nil
+}
+
+// MoveFile moves the blob within the tier it is stored in.
+func (container TieredContainer) MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	err := container.hot.MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("TieredContainer.MoveFile hot: %w", err)
+	}
+
+	err = container.cold.MoveFile(srcBucketID, srcFileID, dstBucketID, dstFileID)
+	if err != nil {
+		return fmt.Errorf("TieredContainer.MoveFile cold: %w", err)
+	}
+
+	return nil
+}
+
+// LinkFile links the blob within the tier it is stored in.
+func (container TieredContainer) LinkFile(srcBucketID, srcFileID, dstBucketID, dstFileID string) error {
+	err := linkBackend(container.hot, srcBucketID, srcFileID, dstBucketID, dstFileID)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("TieredContainer.LinkFile hot: %w", err)
+	}
+
+	err = linkBackend(container.cold, srcBucketID, srcFileID, dstBucketID, dstFileID)
+	if err != nil {
+		return fmt.Errorf("TieredContainer.LinkFile cold: %w", err)
+	}
+
+	return nil
+}
+
+// ListFolder merges the listings of both tiers. A blob present in both is reported once, as stored in the hot tier.
+func (container TieredContainer) ListFolder(bucketID string) ([]model.BlobInfo, error) {
+	hotBlobs, err := container.hot.ListFolder(bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("TieredContainer.ListFolder hot: %w", err)
+	}
+
+	coldBlobs, err := container.cold.ListFolder(bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("TieredContainer.ListFolder cold: %w", err)
+	}
+
+	seen := make(map[string]struct{}, len(hotBlobs))
+	for _, blob := range hotBlobs {
+		seen[blob.ID] = struct{}{}
+	}
+
+	for _, blob := range coldBlobs {
+		if _, ok := seen[blob.ID]; !ok {
+			hotBlobs = append(hotBlobs, blob)
+		}
+	}
+
+	return hotBlobs, nil
+}
+
+// RelayoutFolder moves the blobs of the folder to the configured directory layout of each tier.
+func (container TieredContainer) RelayoutFolder(bucketID string) (int, error) {
+	moved, err := relayoutBackends(bucketID, container.hot, container.cold)
+	if err != nil {
+		return moved, fmt.Errorf("TieredContainer.RelayoutFolder: %w", err)
+	}
+
+	return moved, nil
+}
+
+// Demote copies the blob to the cold tier and removes it from the hot one. A blob deleted from the hot tier
+// during the demotion is removed from the cold one too, the demotion failing with fs.ErrNotExist then.
+func (container TieredContainer) Demote(bucketID, fileID string) error {
+	src, err := container.hot.OpenFile(bucketID, fileID)
+	if err != nil {
+		return fmt.Errorf("TieredContainer.Demote hot.OpenFile: %w", err)
+	}
+
+	_, err = container.cold.WriteFile(bucketID, fileID, src)
+	src.Close()
+
+	if err != nil {
+		_ = container.cold.DeleteFile(bucketID, fileID)
+
+		return fmt.Errorf("TieredContainer.Demote cold.WriteFile: %w", err)
+	}
+
+	// the copy isn't left behind if the blob was deleted meanwhile, the hot tier being checked either way.
+	check, err := container.hot.OpenFile(bucketID, fileID)
+	if err == nil {
+		check.Close()
+
+		err = container.hot.DeleteFile(bucketID, fileID)
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		_ = container.cold.DeleteFile(bucketID, fileID)
+	}
+
+	if err != nil {
+		return fmt.Errorf("TieredContainer.Demote hot: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+BEGIN;
+
+DROP INDEX "idx_files_bucket_id_filename";
+
+DROP INDEX "idx_buckets_owner_id";
+
+DROP TABLE "access_keys";
+
+ALTER TABLE "buckets"
+  DROP COLUMN "created_ts";
+
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+
+ALTER TABLE "buckets"
+  ADD COLUMN "created_ts" TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- the secret is kept as is: SigV4 verification needs the plain secret.
+CREATE TABLE "access_keys" (
+  "id"         VARCHAR(32) PRIMARY KEY,
+  "secret"     TEXT NOT NULL,
+  "owner_id"   UUID NOT NULL,
+  "created_ts" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX "idx_access_keys_owner_id"
+  ON "access_keys"("owner_id");
+
+CREATE INDEX "idx_buckets_owner_id"
+  ON "buckets"("owner_id");
+
+CREATE INDEX "idx_files_bucket_id_filename"
+  ON "files"("bucket_id", "filename");
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE "buckets"
+  DROP COLUMN "is_deleting";
+
+COMMIT;
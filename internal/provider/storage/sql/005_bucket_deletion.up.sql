@@ -0,0 +1,7 @@
+BEGIN;
+
+-- a bucket being deleted is hidden and gets purged in the background.
+ALTER TABLE "buckets"
+  ADD COLUMN "is_deleting" BOOL NOT NULL DEFAULT FALSE;
+
+COMMIT;
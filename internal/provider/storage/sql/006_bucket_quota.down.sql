@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE "buckets"
+  DROP COLUMN "bytes_used";
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- the bytes taken by the bucket files, maintained along with the files rows.
+ALTER TABLE "buckets"
+  ADD COLUMN "bytes_used" BIGINT NOT NULL DEFAULT 0;
+
+UPDATE "buckets"
+SET "bytes_used" = "usage"."total"
+FROM (
+  SELECT "bucket_id", SUM("size_bytes") AS "total"
+  FROM "files"
+  GROUP BY "bucket_id"
+) AS "usage"
+WHERE "buckets"."id" = "usage"."bucket_id";
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+-- the resumable uploads in progress, the id becomes the file id once the upload is complete.
+CREATE TABLE "uploads" (
+  "id"         UUID PRIMARY KEY,
+  "bucket_id"  BIGINT NOT NULL REFERENCES "buckets"("id") ON DELETE CASCADE,
+  "filename"   TEXT NOT NULL,
+  "mime"       TEXT NOT NULL,
+  "access"     "file_access_enum" NOT NULL DEFAULT 'private',
+  "metadata"   TEXT NOT NULL DEFAULT '',
+  "length"     BIGINT NOT NULL,
+  "offset"     BIGINT NOT NULL DEFAULT 0,
+  "created_ts" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "expires_ts" TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX "idx_uploads_expires_ts"
+  ON "uploads"("expires_ts");
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE "multipart_parts";
+
+DROP TABLE "multipart_uploads";
+
+COMMIT;
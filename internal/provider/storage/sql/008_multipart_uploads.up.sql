@@ -0,0 +1,27 @@
+BEGIN;
+
+CREATE TABLE "multipart_uploads" (
+  "id"         UUID PRIMARY KEY,
+  "bucket_id"  BIGINT NOT NULL REFERENCES "buckets"("id") ON DELETE CASCADE,
+  "key"        TEXT NOT NULL,
+  "mime"       TEXT NOT NULL,
+  "access"     "file_access_enum" NOT NULL DEFAULT 'private',
+  "created_ts" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX "idx_multipart_uploads_created_ts"
+  ON "multipart_uploads"("created_ts");
+
+-- a part re-upload gets a new blob, so the concurrent uploads of a part don't share one.
+CREATE TABLE "multipart_parts" (
+  "upload_id"   UUID NOT NULL REFERENCES "multipart_uploads"("id") ON DELETE CASCADE,
+  "part_number" INTEGER NOT NULL,
+  "blob_id"     UUID NOT NULL,
+  "size_bytes"  BIGINT NOT NULL,
+  "md5"         TEXT NOT NULL,
+  "sha256"      TEXT NOT NULL,
+  "created_ts"  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY ("upload_id", "part_number")
+);
+
+COMMIT;
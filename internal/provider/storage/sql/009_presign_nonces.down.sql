@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE "presign_nonces";
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- the nonces of the used presigned upload urls, kept till the urls expire.
+CREATE TABLE "presign_nonces" (
+  "nonce"      UUID PRIMARY KEY,
+  "expires_ts" TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX "idx_presign_nonces_expires_ts"
+  ON "presign_nonces"("expires_ts");
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+DELETE FROM "files"
+WHERE "is_delete_marker" = TRUE;
+
+ALTER TABLE "files"
+  DROP COLUMN "is_delete_marker";
+
+ALTER TABLE "buckets"
+  DROP COLUMN "versioning";
+
+COMMIT;
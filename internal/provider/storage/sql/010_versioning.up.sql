@@ -0,0 +1,12 @@
+BEGIN;
+
+-- with the versioning on, the files of a bucket sharing a filename are the versions of an object,
+-- the one with the greatest suffix being the current version.
+ALTER TABLE "buckets"
+  ADD COLUMN "versioning" BOOL NOT NULL DEFAULT FALSE;
+
+-- a delete marker is a version without content that hides the object.
+ALTER TABLE "files"
+  ADD COLUMN "is_delete_marker" BOOL NOT NULL DEFAULT FALSE;
+
+COMMIT;
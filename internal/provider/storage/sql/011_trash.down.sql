@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX "idx_files_deleted_ts";
+
+ALTER TABLE "files"
+  DROP COLUMN "deleted_ts";
+
+ALTER TABLE "buckets"
+  DROP COLUMN "trash_retention_days";
+
+COMMIT;
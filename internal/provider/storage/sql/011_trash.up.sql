@@ -0,0 +1,15 @@
+BEGIN;
+
+-- the deleted files stay in the trash of the bucket for this many days, 0 meaning no trash.
+ALTER TABLE "buckets"
+  ADD COLUMN "trash_retention_days" INT NOT NULL DEFAULT 0;
+
+-- a deleted file with deleted_ts set is in the trash, without it the file is being removed.
+ALTER TABLE "files"
+  ADD COLUMN "deleted_ts" TIMESTAMPTZ;
+
+CREATE INDEX "idx_files_deleted_ts"
+  ON "files"("deleted_ts")
+  WHERE "deleted_ts" IS NOT NULL;
+
+COMMIT;
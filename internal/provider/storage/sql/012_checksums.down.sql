@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE "files"
+  DROP COLUMN "md5",
+  DROP COLUMN "sha256";
+
+COMMIT;
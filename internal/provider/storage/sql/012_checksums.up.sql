@@ -0,0 +1,8 @@
+BEGIN;
+
+-- the hex digests of the content, empty for the files stored before they were computed and for the delete markers.
+ALTER TABLE "files"
+  ADD COLUMN "md5" TEXT NOT NULL DEFAULT '',
+  ADD COLUMN "sha256" TEXT NOT NULL DEFAULT '';
+
+COMMIT;
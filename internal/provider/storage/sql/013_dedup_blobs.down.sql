@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX "idx_files_blob_sha256";
+
+ALTER TABLE "files"
+  DROP COLUMN "blob_sha256";
+
+DROP TABLE "blobs";
+
+COMMIT;
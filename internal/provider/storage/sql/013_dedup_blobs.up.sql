@@ -0,0 +1,19 @@
+BEGIN;
+
+-- the deduplicated contents, stored by their hex SHA-256 and shared by the files with the same content.
+CREATE TABLE "blobs" (
+  "sha256"     TEXT PRIMARY KEY,
+  "size_bytes" BIGINT NOT NULL,
+  "ref_count"  BIGINT NOT NULL,
+  "created_ts" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- empty for the files stored in their bucket folder under their own id.
+ALTER TABLE "files"
+  ADD COLUMN "blob_sha256" TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX "idx_files_blob_sha256"
+  ON "files"("blob_sha256")
+  WHERE "blob_sha256" <> '';
+
+COMMIT;
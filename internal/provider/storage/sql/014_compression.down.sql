@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE "files"
+  DROP COLUMN "stored_size_bytes",
+  DROP COLUMN "content_encoding";
+
+ALTER TABLE "buckets"
+  DROP COLUMN "compression";
+
+COMMIT;
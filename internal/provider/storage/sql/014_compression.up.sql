@@ -0,0 +1,16 @@
+BEGIN;
+
+-- the codec the compressible uploads of the bucket are stored with, empty meaning none.
+ALTER TABLE "buckets"
+  ADD COLUMN "compression" TEXT NOT NULL DEFAULT '';
+
+-- size_bytes stays the size of the content, stored_size_bytes is the size of what's in the file storage.
+ALTER TABLE "files"
+  ADD COLUMN "content_encoding" TEXT NOT NULL DEFAULT '',
+  ADD COLUMN "stored_size_bytes" BIGINT NOT NULL DEFAULT 0;
+
+UPDATE "files"
+SET
+  "stored_size_bytes" = "size_bytes";
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+-- the blobs whose content doesn't match its digest, found by the scrubber.
+-- The folder is the bucket id, or the folder of the deduplicated blobs.
+CREATE TABLE "blob_corruptions" (
+  "folder"          TEXT NOT NULL,
+  "blob_id"         TEXT NOT NULL,
+  "bucket_id"       BIGINT,
+  "expected_sha256" TEXT NOT NULL,
+  "actual_sha256"   TEXT NOT NULL DEFAULT '',
+  "detail"          TEXT NOT NULL DEFAULT '',
+  "detected_ts"     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "checked_ts"      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY ("folder", "blob_id")
+);
+
+COMMIT;
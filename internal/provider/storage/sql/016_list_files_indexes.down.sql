@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX "idx_files_filename_trgm";
+DROP INDEX "idx_files_bucket_id_created_ts";
+DROP INDEX "idx_files_bucket_id_size_bytes";
+DROP INDEX "idx_files_bucket_id_filename_c";
+
+-- the pg_trgm extension is kept, it may be used by others.
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+-- the keyset pagination of the files of a bucket, the keys being compared in the byte order.
+CREATE INDEX "idx_files_bucket_id_filename_c"
+  ON "files"("bucket_id", "filename" COLLATE "C", "filename_suffix")
+  WHERE "is_deleted" = FALSE;
+
+CREATE INDEX "idx_files_bucket_id_size_bytes"
+  ON "files"("bucket_id", "size_bytes", "filename" COLLATE "C", "filename_suffix")
+  WHERE "is_deleted" = FALSE;
+
+CREATE INDEX "idx_files_bucket_id_created_ts"
+  ON "files"("bucket_id", "created_ts", "filename" COLLATE "C", "filename_suffix")
+  WHERE "is_deleted" = FALSE;
+
+-- the filename substring filter.
+CREATE EXTENSION IF NOT EXISTS "pg_trgm";
+
+CREATE INDEX "idx_files_filename_trgm"
+  ON "files" USING GIN ("filename" gin_trgm_ops);
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX "idx_files_search_vector";
+
+ALTER TABLE "files"
+  DROP COLUMN "search_vector";
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- the full-text search of the files, the path separators and the extension dots splitting the words.
+ALTER TABLE "files"
+  ADD COLUMN "search_vector" TSVECTOR
+    GENERATED ALWAYS AS (TO_TSVECTOR('simple', TRANSLATE("filename", '/._', '   '))) STORED;
+
+CREATE INDEX "idx_files_search_vector"
+  ON "files" USING GIN ("search_vector")
+  WHERE "is_deleted" = FALSE;
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+DROP INDEX "idx_files_tags";
+DROP INDEX "idx_files_search_vector";
+
+ALTER TABLE "files"
+  DROP COLUMN "search_vector";
+
+ALTER TABLE "files"
+  ADD COLUMN "search_vector" TSVECTOR
+    GENERATED ALWAYS AS (TO_TSVECTOR('simple', TRANSLATE("filename", '/._', '   '))) STORED;
+
+CREATE INDEX "idx_files_search_vector"
+  ON "files" USING GIN ("search_vector")
+  WHERE "is_deleted" = FALSE;
+
+ALTER TABLE "files"
+  DROP COLUMN "tags",
+  DROP COLUMN "metadata";
+
+COMMIT;
@@ -0,0 +1,28 @@
+BEGIN;
+
+-- the user-defined metadata and tags of the files, the JSON objects of the string values.
+ALTER TABLE "files"
+  ADD COLUMN "metadata" JSONB NOT NULL DEFAULT '{}',
+  ADD COLUMN "tags"     JSONB NOT NULL DEFAULT '{}';
+
+-- the metadata values are searched along with the filename.
+DROP INDEX "idx_files_search_vector";
+
+ALTER TABLE "files"
+  DROP COLUMN "search_vector";
+
+ALTER TABLE "files"
+  ADD COLUMN "search_vector" TSVECTOR
+    GENERATED ALWAYS AS (TO_TSVECTOR('simple', TRANSLATE("filename", '/._', '   '))
+      || JSONB_TO_TSVECTOR('simple', "metadata", '["string"]')) STORED;
+
+CREATE INDEX "idx_files_search_vector"
+  ON "files" USING GIN ("search_vector")
+  WHERE "is_deleted" = FALSE;
+
+-- the search by the tags.
+CREATE INDEX "idx_files_tags"
+  ON "files" USING GIN ("tags" jsonb_path_ops)
+  WHERE "is_deleted" = FALSE;
+
+COMMIT;
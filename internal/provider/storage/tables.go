@@ -2,16 +2,31 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/eldarbr/go-auth/pkg/database"
 	"github.com/eldarbr/go-s3/internal/model"
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrRowLocked is returned by the NOWAIT lookups when the row is locked by another transaction.
+	ErrRowLocked = errors.New("row is locked")
+	ErrBadQuery  = errors.New("bad query")
+)
+
 //nolint:gochecknoinits // Set default implementations.
 func init() {
 	TableBuckets = implTableBuckets{}
 	TableFiles = implTableFiles{}
+	TableAccessKeys = implTableAccessKeys{}
+	TableUploads = implTableUploads{}
+	TableMultipartUploads = implTableMultipartUploads{}
+	TableMultipartParts = implTableMultipartParts{}
+	TablePresignNonces = implTablePresignNonces{}
+	TableBlobs = implTableBlobs{}
+	TableBlobCorruptions = implTableBlobCorruptions{}
 }
 
 var TableBuckets interface {
@@ -20,7 +35,18 @@ var TableBuckets interface {
 	// UpdateByName(ctx context.Context, querier database.Querier, bucket *model.Bucket, name string) error
 	GetByID(ctx context.Context, querier database.Querier, id int64) (*model.Bucket, error)
 	GetByName(ctx context.Context, querier database.Querier, name string) (*model.Bucket, error)
+	GetByOwner(ctx context.Context, querier database.Querier, ownerID uuid.UUID) ([]model.Bucket, error)
+	GetUsageByOwner(ctx context.Context, querier database.Querier, ownerID uuid.UUID) ([]model.BucketUsage, error)
 	DeleteByID(ctx context.Context, querier database.Querier, id int64) error
+	MarkDeleting(ctx context.Context, querier database.Querier, id int64) error
+	AddBytesUsed(ctx context.Context, querier database.Querier, id int64, delta int64) (int64, error)
+	SetQuota(ctx context.Context, querier database.Querier, id int64, sizeQuota float64) error
+	SetVersioning(ctx context.Context, querier database.Querier, id int64, enabled bool) error
+	SetCompression(ctx context.Context, querier database.Querier, bucketID int64, compression string) error
+	SetTrashRetention(ctx context.Context, querier database.Querier, id int64, days int32) error
+	GetDeleting(ctx context.Context, querier database.Querier) ([]model.Bucket, error)
+	GetActive(ctx context.Context, querier database.Querier) ([]model.Bucket, error)
+	RecountBytesUsed(ctx context.Context, querier database.Querier, id int64) (int64, error)
 	// DeleteByName(ctx context.Context, querier database.Querier, name string) error
 }
 
@@ -29,9 +55,86 @@ var TableFiles interface {
 	InsertID(ctx context.Context, querier database.Querier, file *model.File) error
 	UpdateByID(ctx context.Context, querier database.Querier, file *model.File) error
 	GetByID(ctx context.Context, querier database.Querier, fileID uuid.UUID) (*model.File, error)
+	LockByID(ctx context.Context, querier database.Querier, fileID uuid.UUID) (*model.File, error)
 	GetFilesOfABucket(ctx context.Context, querier database.Querier, bucketID int64) ([]model.File, error)
+	GetPage(ctx context.Context, querier database.Querier, query model.FilesQuery) ([]model.File, error)
+	GetVersionsPage(ctx context.Context, querier database.Querier, query model.VersionsQuery,
+	) ([]model.FileVersion, error)
+	MovePrefix(ctx context.Context, querier database.Querier, bucketID int64, from, to string) (int64, error)
+	Search(ctx context.Context, querier database.Querier, search model.FilesSearch) ([]model.FoundFile, error)
+	GetByFilename(ctx context.Context, querier database.Querier, bucketID int64, filename string) ([]model.File, error)
+	CountFilesOfABucket(ctx context.Context, querier database.Querier, bucketID int64) (int64, error)
+	GetIDsOfABucket(ctx context.Context, querier database.Querier, bucketID int64, limit int) ([]uuid.UUID, error)
 	DeleteByID(ctx context.Context, querier database.Querier, fileID uuid.UUID) error
+	DeleteByIDReturning(ctx context.Context, querier database.Querier, fileID uuid.UUID) (*model.File, error)
 	LockFilename(ctx context.Context, querier database.Querier, filename string) error
-	PrepareNewFilenameSuffix(ctx context.Context, querier database.Querier, filename string) (int32, error)
+	LockBucketKeys(ctx context.Context, querier database.Querier, bucketID int64, exclusive bool) error
+	PrepareNewFilenameSuffix(ctx context.Context, querier database.Querier, bucketID int64, filename string,
+	) (int32, error)
 	MarkDeleted(ctx context.Context, querier database.Querier, fileID uuid.UUID) error
+	MoveToTrash(ctx context.Context, querier database.Querier, fileID uuid.UUID) error
+	RestoreFromTrash(ctx context.Context, querier database.Querier, fileID uuid.UUID, filenameSuffix int32) error
+	GetTrashedByID(ctx context.Context, querier database.Querier, fileID uuid.UUID) (*model.File, error)
+	LockTrashedByID(ctx context.Context, querier database.Querier, fileID uuid.UUID) (*model.File, error)
+	GetTrashOfABucket(ctx context.Context, querier database.Querier, bucketID int64) ([]model.File, error)
+	GetExpiredTrash(ctx context.Context, querier database.Querier, moment time.Time, limit int) ([]model.File, error)
+	GetDeletedOfABucket(ctx context.Context, querier database.Querier, bucketID int64) ([]model.File, error)
+	SetSize(ctx context.Context, querier database.Querier, fileID uuid.UUID, sizeBytes int64) error
+}
+
+var TableAccessKeys interface {
+	Add(ctx context.Context, querier database.Querier, key *model.AccessKey) error
+	GetByID(ctx context.Context, querier database.Querier, keyID string) (*model.AccessKey, error)
+	GetByOwner(ctx context.Context, querier database.Querier, ownerID uuid.UUID) ([]model.AccessKey, error)
+	DeleteByID(ctx context.Context, querier database.Querier, keyID string) error
+}
+
+var TableUploads interface {
+	Add(ctx context.Context, querier database.Querier, upload *model.Upload) error
+	GetByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID) (*model.Upload, error)
+	LockByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID) (*model.Upload, error)
+	GetExpired(ctx context.Context, querier database.Querier, before time.Time, limit int) ([]model.Upload, error)
+	UpdateOffset(ctx context.Context, querier database.Querier, uploadID uuid.UUID, offset int64,
+		expiresTS time.Time) error
+	DeleteByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID) error
+	GetIDsOfABucket(ctx context.Context, querier database.Querier, bucketID int64) ([]uuid.UUID, error)
+}
+
+var TableMultipartUploads interface {
+	Add(ctx context.Context, querier database.Querier, upload *model.MultipartUpload) error
+	GetByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID) (*model.MultipartUpload, error)
+	LockByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID) (*model.MultipartUpload, error)
+	GetStale(ctx context.Context, querier database.Querier, before time.Time, limit int) ([]model.MultipartUpload, error)
+	DeleteByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID) error
+}
+
+var TableMultipartParts interface {
+	Add(ctx context.Context, querier database.Querier, part *model.MultipartPart) error
+	GetByUpload(ctx context.Context, querier database.Querier, uploadID uuid.UUID) ([]model.MultipartPart, error)
+	DeleteByNumber(ctx context.Context, querier database.Querier, uploadID uuid.UUID, partNumber int,
+	) (uuid.UUID, error)
+	GetBlobIDsOfABucket(ctx context.Context, querier database.Querier, bucketID int64) ([]uuid.UUID, error)
+}
+
+var TablePresignNonces interface {
+	Add(ctx context.Context, querier database.Querier, nonce uuid.UUID, expiresTS time.Time) error
+	Exists(ctx context.Context, querier database.Querier, nonce uuid.UUID) (bool, error)
+	DeleteExpired(ctx context.Context, querier database.Querier, before time.Time) error
+}
+
+var TableBlobs interface {
+	Acquire(ctx context.Context, querier database.Querier, sha256 string, sizeBytes int64) (int64, error)
+	Release(ctx context.Context, querier database.Querier, sha256 string) (int64, error)
+	GetAll(ctx context.Context, querier database.Querier) ([]model.Blob, error)
+	GetCreatedBefore(ctx context.Context, querier database.Querier, before time.Time, afterSHA256 string, limit int,
+	) ([]model.Blob, error)
+	GetMiscounted(ctx context.Context, querier database.Querier) ([]model.Blob, error)
+	Recount(ctx context.Context, querier database.Querier, sha256 string) (int64, error)
+}
+
+var TableBlobCorruptions interface {
+	Record(ctx context.Context, querier database.Querier, corruption *model.BlobCorruption) error
+	Clear(ctx context.Context, querier database.Querier, folder, blobID string) error
+	DeleteCheckedBefore(ctx context.Context, querier database.Querier, before time.Time) (int64, error)
+	GetAll(ctx context.Context, querier database.Querier) ([]model.BlobCorruption, error)
 }
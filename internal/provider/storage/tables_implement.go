@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/eldarbr/go-auth/pkg/database"
 	"github.com/eldarbr/go-s3/internal/model"
@@ -16,6 +19,20 @@ type implTableBuckets struct{}
 
 type implTableFiles struct{}
 
+type implTableAccessKeys struct{}
+
+type implTableUploads struct{}
+
+type implTableMultipartUploads struct{}
+
+type implTableMultipartParts struct{}
+
+type implTablePresignNonces struct{}
+
+type implTableBlobs struct{}
+
+type implTableBlobCorruptions struct{}
+
 func (implTableBuckets) Add(ctx context.Context, querier database.Querier, bucket *model.Bucket) error {
 	if querier == nil || bucket == nil {
 		return database.ErrNilArgument
@@ -26,14 +43,16 @@ INSERT INTO "buckets"
   ("name",
    "owner_id",
    "availability",
-   "size_quota")
+   "size_quota",
+   "trash_retention_days")
 VALUES
-  ($1, $2, $3, $4)
-RETURNING "id"
+  ($1, $2, $3, $4, $5)
+RETURNING "id", "created_ts"
 	`
 
-	queryResult := querier.QueryRow(ctx, query, bucket.Name, bucket.OwnerID, bucket.Availability, bucket.SizeQuota)
-	err := queryResult.Scan(&bucket.ID)
+	queryResult := querier.QueryRow(ctx, query, bucket.Name, bucket.OwnerID, bucket.Availability, bucket.SizeQuota,
+		bucket.TrashRetentionDays)
+	err := queryResult.Scan(&bucket.ID, &bucket.CreatedTS)
 
 	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
 		return database.ErrUniqueKeyViolation
@@ -92,7 +111,12 @@ SELECT
   "name",
   "owner_id",
   "availability",
-  "size_quota"
+  "size_quota",
+  "created_ts",
+  "bytes_used",
+  "versioning",
+  "trash_retention_days",
+  "compression"
 FROM "buckets"
 WHERE "id" = $1
 	`
@@ -100,7 +124,8 @@ WHERE "id" = $1
 	var dst model.Bucket
 
 	queryResult := querier.QueryRow(ctx, query, bucketID)
-	err := queryResult.Scan(&dst.ID, &dst.Name, &dst.OwnerID, &dst.Availability, &dst.SizeQuota)
+	err := queryResult.Scan(&dst.ID, &dst.Name, &dst.OwnerID, &dst.Availability, &dst.SizeQuota, &dst.CreatedTS,
+		&dst.BytesUsed, &dst.Versioning, &dst.TrashRetentionDays, &dst.Compression)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, database.ErrNoRows
@@ -124,15 +149,21 @@ SELECT
   "name",
   "owner_id",
   "availability",
-  "size_quota"
+  "size_quota",
+  "created_ts",
+  "bytes_used",
+  "versioning",
+  "trash_retention_days",
+  "compression"
 FROM "buckets"
-WHERE "name" = $1
+WHERE "name" = $1 AND "is_deleting" = FALSE
 	`
 
 	var dst model.Bucket
 
 	queryResult := querier.QueryRow(ctx, query, name)
-	err := queryResult.Scan(&dst.ID, &dst.Name, &dst.OwnerID, &dst.Availability, &dst.SizeQuota)
+	err := queryResult.Scan(&dst.ID, &dst.Name, &dst.OwnerID, &dst.Availability, &dst.SizeQuota, &dst.CreatedTS,
+		&dst.BytesUsed, &dst.Versioning, &dst.TrashRetentionDays, &dst.Compression)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, database.ErrNoRows
@@ -145,6 +176,310 @@ WHERE "name" = $1
 	return &dst, nil
 }
 
+func (implTableBuckets) GetByOwner(ctx context.Context, querier database.Querier, ownerID uuid.UUID,
+) ([]model.Bucket, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "name",
+  "owner_id",
+  "availability",
+  "size_quota",
+  "created_ts",
+  "bytes_used",
+  "versioning",
+  "trash_retention_days",
+  "compression"
+FROM "buckets"
+WHERE "owner_id" = $1 AND "is_deleting" = FALSE
+ORDER BY "name"
+	`
+
+	var (
+		dst     []model.Bucket
+		nextDst model.Bucket
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableBuckets.GetByOwner failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.Bucket, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.Name, &nextDst.OwnerID, &nextDst.Availability, &nextDst.SizeQuota,
+			&nextDst.CreatedTS, &nextDst.BytesUsed, &nextDst.Versioning, &nextDst.TrashRetentionDays,
+			&nextDst.Compression)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableBuckets.GetByOwner failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// GetUsageByOwner returns the buckets of the owner along with the count and the size of their files.
+func (implTableBuckets) GetUsageByOwner(ctx context.Context, querier database.Querier, ownerID uuid.UUID,
+) ([]model.BucketUsage, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "buckets"."name",
+  "buckets"."availability",
+  "buckets"."size_quota",
+  "buckets"."created_ts",
+  "buckets"."versioning",
+  "buckets"."trash_retention_days",
+  "buckets"."compression",
+  COUNT("files"."id"),
+  COALESCE(SUM("files"."size_bytes"), 0)
+FROM "buckets"
+LEFT JOIN "files"
+  ON "files"."bucket_id" = "buckets"."id" AND "files"."is_deleted" = FALSE AND "files"."is_delete_marker" = FALSE
+WHERE "buckets"."owner_id" = $1 AND "buckets"."is_deleting" = FALSE
+GROUP BY "buckets"."id"
+ORDER BY "buckets"."name"
+	`
+
+	var (
+		dst     []model.BucketUsage
+		nextDst model.BucketUsage
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableBuckets.GetUsageByOwner failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.BucketUsage, error) {
+		err = row.Scan(&nextDst.Name, &nextDst.Availability, &nextDst.SizeQuota, &nextDst.CreatedTS,
+			&nextDst.Versioning, &nextDst.TrashRetentionDays, &nextDst.Compression, &nextDst.FilesCount,
+			&nextDst.BytesUsed)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableBuckets.GetUsageByOwner failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// AddBytesUsed changes the bytes used by the bucket. A growth beyond the quota is refused with
+// ErrNoRows, a non-positive quota meaning no limit. A shrink always succeeds.
+func (implTableBuckets) AddBytesUsed(ctx context.Context, querier database.Querier, bucketID int64,
+	delta int64,
+) (int64, error) {
+	if querier == nil {
+		return 0, database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "buckets"
+SET
+  "bytes_used" = GREATEST("bytes_used" + $2, 0)
+WHERE "id" = $1 AND ($2 <= 0 OR "size_quota" <= 0 OR "bytes_used" + $2 <= "size_quota")
+RETURNING "bytes_used"
+	`
+
+	var dst int64
+
+	err := querier.QueryRow(ctx, query, bucketID, delta).Scan(&dst)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, database.ErrNoRows
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("implTableBuckets.AddBytesUsed failed on UPDATE: %w", err)
+	}
+
+	return dst, nil
+}
+
+func (implTableBuckets) SetQuota(ctx context.Context, querier database.Querier, bucketID int64,
+	sizeQuota float64,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "buckets"
+SET
+  "size_quota" = $2
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, bucketID, sizeQuota)
+	if err != nil {
+		return fmt.Errorf("implTableBuckets.SetQuota failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableBuckets) SetVersioning(ctx context.Context, querier database.Querier, bucketID int64,
+	enabled bool,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "buckets"
+SET
+  "versioning" = $2
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, bucketID, enabled)
+	if err != nil {
+		return fmt.Errorf("implTableBuckets.SetVersioning failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableBuckets) SetCompression(ctx context.Context, querier database.Querier, bucketID int64,
+	compression string,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "buckets"
+SET
+  "compression" = $2
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, bucketID, compression)
+	if err != nil {
+		return fmt.Errorf("implTableBuckets.SetCompression failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableBuckets) SetTrashRetention(ctx context.Context, querier database.Querier, bucketID int64,
+	days int32,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "buckets"
+SET
+  "trash_retention_days" = $2
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, bucketID, days)
+	if err != nil {
+		return fmt.Errorf("implTableBuckets.SetTrashRetention failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableBuckets) MarkDeleting(ctx context.Context, querier database.Querier, bucketID int64) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "buckets"
+SET
+  "is_deleting" = TRUE
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, bucketID)
+	if err != nil {
+		return fmt.Errorf("implTableBuckets.MarkDeleting failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableBuckets) GetDeleting(ctx context.Context, querier database.Querier) ([]model.Bucket, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "name",
+  "owner_id",
+  "availability",
+  "size_quota",
+  "created_ts",
+  "bytes_used",
+  "versioning",
+  "trash_retention_days",
+  "compression"
+FROM "buckets"
+WHERE "is_deleting" = TRUE
+	`
+
+	var (
+		dst     []model.Bucket
+		nextDst model.Bucket
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("implTableBuckets.GetDeleting failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.Bucket, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.Name, &nextDst.OwnerID, &nextDst.Availability, &nextDst.SizeQuota,
+			&nextDst.CreatedTS, &nextDst.BytesUsed, &nextDst.Versioning, &nextDst.TrashRetentionDays,
+			&nextDst.Compression)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableBuckets.GetDeleting failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
 func (implTableBuckets) DeleteByID(ctx context.Context, querier database.Querier, bucketID int64) error {
 	if querier == nil {
 		return database.ErrNilArgument
@@ -167,6 +502,15 @@ WHERE "id" = $1
 	return nil
 }
 
+// jsonObject keeps the nil attributes of a file from being stored as the JSON null.
+func jsonObject(attributes map[string]string) map[string]string {
+	if attributes == nil {
+		return map[string]string{}
+	}
+
+	return attributes
+}
+
 func (implTableFiles) Add(ctx context.Context, querier database.Querier, file *model.File) error {
 	if querier == nil || file == nil {
 		return database.ErrNilArgument
@@ -179,14 +523,23 @@ INSERT INTO "files"
    "bucket_id",
    "access",
    "size_bytes",
-   "filename_suffix")
+   "filename_suffix",
+   "is_delete_marker",
+   "md5",
+   "sha256",
+   "blob_sha256",
+   "content_encoding",
+   "stored_size_bytes",
+   "metadata",
+   "tags")
 VALUES
-  ($1, $2, $3, $4, $5, $6)
+  ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 RETURNING "id", "created_ts"
 	`
 
 	queryResult := querier.QueryRow(ctx, query, file.Filename, file.MIME, file.BucketID, file.Access,
-		file.SizeBytes, file.FilenameSuffix)
+		file.SizeBytes, file.FilenameSuffix, file.DeleteMarker, file.MD5, file.SHA256,
+		file.BlobSHA256, file.ContentEncoding, file.StoredSizeBytes, jsonObject(file.Metadata), jsonObject(file.Tags))
 	err := queryResult.Scan(&file.ID, &file.CreatedTS)
 
 	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
@@ -212,28 +565,40 @@ func (implTableFiles) InsertID(ctx context.Context, querier database.Querier, fi
 	query := `
 INSERT INTO "files"
   ("id",
-	 "filename",
+   "filename",
    "mime",
    "bucket_id",
    "access",
    "size_bytes",
-   "filename_suffix")
+   "filename_suffix",
+   "is_delete_marker",
+   "md5",
+   "sha256",
+   "blob_sha256",
+   "content_encoding",
+   "stored_size_bytes",
+   "metadata",
+   "tags")
 VALUES
-  ($1, $2, $3, $4, $5, $6, $7)
+  ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+RETURNING "created_ts"
 	`
 
-	result, err := querier.Exec(ctx, query, file.ID, file.Filename, file.MIME, file.BucketID, file.Access,
-		file.SizeBytes, file.FilenameSuffix)
+	queryResult := querier.QueryRow(ctx, query, file.ID, file.Filename, file.MIME, file.BucketID, file.Access,
+		file.SizeBytes, file.FilenameSuffix, file.DeleteMarker, file.MD5, file.SHA256,
+		file.BlobSHA256, file.ContentEncoding, file.StoredSizeBytes, jsonObject(file.Metadata), jsonObject(file.Tags))
+	err := queryResult.Scan(&file.CreatedTS)
+
 	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
 		return database.ErrUniqueKeyViolation
 	}
 
-	if err != nil {
-		return fmt.Errorf("implTableFiles.UpdateByID failed on UPDATE: %w", err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.ErrNoRows
 	}
 
-	if result.RowsAffected() == 0 {
-		return database.ErrNoRows
+	if err != nil {
+		return fmt.Errorf("implTableFiles.InsertID failed on INSERT: %w", err)
 	}
 
 	return nil
@@ -252,12 +617,14 @@ SET
   "bucket_id" = $3,
   "access" = $4,
   "size_bytes" = $5,
-  "filename_suffix" = $6
-WHERE "id" = $7 AND "is_deleted" = FALSE
+  "filename_suffix" = $6,
+  "metadata" = $7,
+  "tags" = $8
+WHERE "id" = $9 AND "is_deleted" = FALSE
 	`
 
 	result, err := querier.Exec(ctx, query, file.Filename, file.MIME, file.BucketID, file.Access, file.SizeBytes,
-		file.FilenameSuffix, file.ID)
+		file.FilenameSuffix, jsonObject(file.Metadata), jsonObject(file.Tags), file.ID)
 	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
 		return database.ErrUniqueKeyViolation
 	}
@@ -287,7 +654,15 @@ SELECT
   "bucket_id",
   "access",
   "size_bytes",
-  "filename_suffix"
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "metadata",
+  "tags"
 FROM "files"
 WHERE "id" = $1 AND "is_deleted" = FALSE
 	`
@@ -296,7 +671,8 @@ WHERE "id" = $1 AND "is_deleted" = FALSE
 
 	queryResult := querier.QueryRow(ctx, query, fileID)
 	err := queryResult.Scan(&dst.ID, &dst.Filename, &dst.MIME, &dst.CreatedTS, &dst.BucketID, &dst.Access,
-		&dst.SizeBytes, &dst.FilenameSuffix)
+		&dst.SizeBytes, &dst.FilenameSuffix, &dst.DeleteMarker, &dst.MD5, &dst.SHA256,
+		&dst.BlobSHA256, &dst.ContentEncoding, &dst.StoredSizeBytes, &dst.Metadata, &dst.Tags)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, database.ErrNoRows
@@ -309,8 +685,8 @@ WHERE "id" = $1 AND "is_deleted" = FALSE
 	return &dst, nil
 }
 
-func (implTableFiles) GetFilesOfABucket(ctx context.Context, querier database.Querier,
-	bucketID int64) ([]model.File, error) {
+// LockByID is GetByID locking the row till the end of the transaction.
+func (implTableFiles) LockByID(ctx context.Context, querier database.Querier, fileID uuid.UUID) (*model.File, error) {
 	if querier == nil {
 		return nil, database.ErrNilArgument
 	}
@@ -324,49 +700,1903 @@ SELECT
   "bucket_id",
   "access",
   "size_bytes",
-  "filename_suffix"
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "metadata",
+  "tags"
 FROM "files"
-WHERE "bucket_id" = $1 AND "is_deleted" = FALSE
-ORDER BY "filename", "filename_suffix"
+WHERE "id" = $1 AND "is_deleted" = FALSE
+FOR UPDATE
 	`
 
-	var (
-		dst     []model.File
-		nextDst model.File
-		err     error
-	)
+	var dst model.File
 
-	queryResult, err := querier.Query(ctx, query, bucketID)
-	if err != nil {
-		return nil, fmt.Errorf("implTableFiles.GetFilesOfABucket failed on SELECT: %w", err)
-	}
+	queryResult := querier.QueryRow(ctx, query, fileID)
+	err := queryResult.Scan(&dst.ID, &dst.Filename, &dst.MIME, &dst.CreatedTS, &dst.BucketID, &dst.Access,
+		&dst.SizeBytes, &dst.FilenameSuffix, &dst.DeleteMarker, &dst.MD5, &dst.SHA256,
+		&dst.BlobSHA256, &dst.ContentEncoding, &dst.StoredSizeBytes, &dst.Metadata, &dst.Tags)
 
-	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.File, error) {
-		err = row.Scan(&nextDst.ID, &nextDst.Filename, &nextDst.MIME, &nextDst.CreatedTS,
-			&nextDst.BucketID, &nextDst.Access, &nextDst.SizeBytes, &nextDst.FilenameSuffix)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
 
-		return nextDst, err //nolint:wrapcheck // not an actual return
-	})
 	if err != nil {
-		return nil, fmt.Errorf("implTableFiles.GetFilesOfABucket failed on Scan: %w", err)
+		return nil, fmt.Errorf("implTableFiles.LockByID failed on SELECT: %w", err)
 	}
 
-	return dst, nil
+	return &dst, nil
+}
+
+func (implTableFiles) GetFilesOfABucket(ctx context.Context, querier database.Querier,
+	bucketID int64) ([]model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "filename",
+  "mime",
+  "created_ts",
+  "bucket_id",
+  "access",
+  "size_bytes",
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes"
+FROM "files"
+WHERE "bucket_id" = $1 AND "is_deleted" = FALSE
+ORDER BY "filename", "filename_suffix"
+	`
+
+	var (
+		dst     []model.File
+		nextDst model.File
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetFilesOfABucket failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.File, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.Filename, &nextDst.MIME, &nextDst.CreatedTS,
+			&nextDst.BucketID, &nextDst.Access, &nextDst.SizeBytes, &nextDst.FilenameSuffix, &nextDst.DeleteMarker,
+			&nextDst.MD5, &nextDst.SHA256, &nextDst.BlobSHA256, &nextDst.ContentEncoding, &nextDst.StoredSizeBytes)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetFilesOfABucket failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// filesSortColumns are the columns leading the listing order of the files, the filename and its suffix following.
+//
+//nolint:gochecknoglobals // constant lookup.
+var filesSortColumns = map[string]string{
+	model.FilesSortName:    "",
+	model.FilesSortSize:    `"size_bytes"`,
+	model.FilesSortCreated: `"created_ts"`,
+}
+
+// prefixEnd returns the least string greater than all the strings with the prefix in the byte order,
+// empty if there is none.
+func prefixEnd(prefix string) string {
+	runes := []rune(prefix)
+
+	for len(runes) > 0 {
+		last := runes[len(runes)-1] + 1
+		if last == 0xd800 { // the surrogates are not valid in utf-8.
+			last = 0xe000
+		}
+
+		if last <= utf8.MaxRune {
+			runes[len(runes)-1] = last
+
+			return string(runes)
+		}
+
+		runes = runes[:len(runes)-1]
+	}
+
+	return ""
+}
+
+// escapeLike escapes the pattern characters of the LIKE operator.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// GetPage returns a page of the files of a bucket selected by the query, resuming past its cursor.
+func (implTableFiles) GetPage(ctx context.Context, querier database.Querier, query model.FilesQuery,
+) ([]model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	sortColumn, ok := filesSortColumns[query.Sort]
+	if !ok || query.Limit <= 0 {
+		return nil, fmt.Errorf("implTableFiles.GetPage sort %q limit %d: %w", query.Sort, query.Limit, ErrBadQuery)
+	}
+
+	args := []any{query.BucketID}
+	arg := func(value any) string {
+		args = append(args, value)
+
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := []string{`"bucket_id" = $1`, `"is_deleted" = FALSE`, `"is_delete_marker" = FALSE`}
+
+	if query.LatestOnly {
+		conditions = append(conditions, `NOT EXISTS (
+    SELECT 1
+    FROM "files" AS "newer"
+    WHERE "newer"."bucket_id" = "files"."bucket_id" AND "newer"."filename" = "files"."filename"
+      AND "newer"."filename_suffix" > "files"."filename_suffix" AND "newer"."is_deleted" = FALSE
+  )`)
+	}
+
+	if query.Prefix != "" {
+		conditions = append(conditions, `"filename" COLLATE "C" >= `+arg(query.Prefix))
+
+		if end := prefixEnd(query.Prefix); end != "" {
+			conditions = append(conditions, `"filename" COLLATE "C" < `+arg(end))
+		}
+	}
+
+	if query.NameContains != "" {
+		conditions = append(conditions, `"filename" ILIKE '%' || `+arg(escapeLike(query.NameContains))+` || '%'`)
+	}
+
+	if family, ok := strings.CutSuffix(query.MIME, "/*"); ok {
+		conditions = append(conditions, `STARTS_WITH("mime", `+arg(family+"/")+`)`)
+	} else if query.MIME != "" {
+		conditions = append(conditions, `"mime" = `+arg(query.MIME))
+	}
+
+	if query.Access != "" {
+		conditions = append(conditions, `"access" = `+arg(query.Access))
+	}
+
+	if query.MinSize != nil {
+		conditions = append(conditions, `"size_bytes" >= `+arg(*query.MinSize))
+	}
+
+	if query.MaxSize != nil {
+		conditions = append(conditions, `"size_bytes" <= `+arg(*query.MaxSize))
+	}
+
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, `"created_ts" >= `+arg(*query.CreatedAfter))
+	}
+
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, `"created_ts" < `+arg(*query.CreatedBefore))
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	orderColumns := []string{`"filename" COLLATE "C"`, `"filename_suffix"`}
+	if sortColumn != "" {
+		orderColumns = append([]string{sortColumn}, orderColumns...)
+	}
+
+	if cursor := query.After; cursor != nil {
+		switch {
+		case cursor.SkipPrefix != "" && sortColumn != "":
+			return nil, fmt.Errorf("implTableFiles.GetPage prefix skipped in the %s order: %w", query.Sort, ErrBadQuery)
+		case cursor.SkipPrefix != "" && query.Descending:
+			conditions = append(conditions, `"filename" COLLATE "C" < `+arg(cursor.SkipPrefix))
+		case cursor.SkipPrefix != "":
+			end := prefixEnd(cursor.SkipPrefix)
+			if end == "" {
+				return nil, nil
+			}
+
+			conditions = append(conditions, `"filename" COLLATE "C" >= `+arg(end))
+		default:
+			position := []string{arg(cursor.Filename) + `::TEXT COLLATE "C"`, arg(cursor.Suffix)}
+
+			switch query.Sort {
+			case model.FilesSortSize:
+				position = append([]string{arg(cursor.SizeBytes)}, position...)
+			case model.FilesSortCreated:
+				position = append([]string{arg(cursor.CreatedTS)}, position...)
+			}
+
+			conditions = append(conditions, "("+strings.Join(orderColumns, ", ")+") "+comparison+
+				" ("+strings.Join(position, ", ")+")")
+		}
+	}
+
+	for i := range orderColumns {
+		orderColumns[i] += " " + direction
+	}
+
+	sqlQuery := `
+SELECT
+  "id",
+  "filename",
+  "mime",
+  "created_ts",
+  "bucket_id",
+  "access",
+  "size_bytes",
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "metadata",
+  "tags"
+FROM "files"
+WHERE ` + strings.Join(conditions, "\n  AND ") + `
+ORDER BY ` + strings.Join(orderColumns, ", ") + `
+LIMIT ` + arg(query.Limit)
+
+	var (
+		dst     []model.File
+		nextDst model.File
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetPage failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.File, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.Filename, &nextDst.MIME, &nextDst.CreatedTS,
+			&nextDst.BucketID, &nextDst.Access, &nextDst.SizeBytes, &nextDst.FilenameSuffix, &nextDst.DeleteMarker,
+			&nextDst.MD5, &nextDst.SHA256, &nextDst.BlobSHA256, &nextDst.ContentEncoding, &nextDst.StoredSizeBytes,
+			&nextDst.Metadata, &nextDst.Tags)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetPage failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// GetVersionsPage returns a page of the versions of the objects of the bucket, the delete markers included,
+// ordered by the filename byte-wise and the latest version first.
+func (implTableFiles) GetVersionsPage(ctx context.Context, querier database.Querier, query model.VersionsQuery,
+) ([]model.FileVersion, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	if query.Limit <= 0 {
+		return nil, fmt.Errorf("implTableFiles.GetVersionsPage limit %d: %w", query.Limit, ErrBadQuery)
+	}
+
+	args := []any{query.BucketID, query.Limit}
+	arg := func(value any) string {
+		args = append(args, value)
+
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := []string{`"bucket_id" = $1`, `"is_deleted" = FALSE`}
+
+	if query.Filename != "" {
+		conditions = append(conditions, `"filename" = `+arg(query.Filename))
+	}
+
+	if cursor := query.After; cursor != nil {
+		filename := arg(cursor.Filename)
+		conditions = append(conditions, `("filename" COLLATE "C" > `+filename+`::TEXT COLLATE "C"
+    OR ("filename" = `+filename+` AND "filename_suffix" < `+arg(cursor.Suffix)+`))`)
+	}
+
+	sqlQuery := `
+SELECT
+  "id",
+  "filename",
+  "mime",
+  "created_ts",
+  "bucket_id",
+  "access",
+  "size_bytes",
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "metadata",
+  "tags",
+  NOT EXISTS (
+    SELECT 1
+    FROM "files" AS "newer"
+    WHERE "newer"."bucket_id" = "files"."bucket_id" AND "newer"."filename" = "files"."filename"
+      AND "newer"."filename_suffix" > "files"."filename_suffix" AND "newer"."is_deleted" = FALSE
+  )
+FROM "files"
+WHERE ` + strings.Join(conditions, "\n  AND ") + `
+ORDER BY "filename" COLLATE "C", "filename_suffix" DESC
+LIMIT $2`
+
+	var (
+		dst     []model.FileVersion
+		nextDst model.FileVersion
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetVersionsPage failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.FileVersion, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.Filename, &nextDst.MIME, &nextDst.CreatedTS,
+			&nextDst.BucketID, &nextDst.Access, &nextDst.SizeBytes, &nextDst.FilenameSuffix, &nextDst.DeleteMarker,
+			&nextDst.MD5, &nextDst.SHA256, &nextDst.BlobSHA256, &nextDst.ContentEncoding, &nextDst.StoredSizeBytes,
+			&nextDst.Metadata, &nextDst.Tags, &nextDst.IsLatest)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetVersionsPage failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// Search ranks the latest files of the active buckets of the owner matching the query, the most relevant first.
+// The query words are split the same way the filenames are, the metadata values being searched as well.
+func (implTableFiles) Search(ctx context.Context, querier database.Querier, search model.FilesSearch,
+) ([]model.FoundFile, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	if search.Limit <= 0 {
+		return nil, fmt.Errorf("implTableFiles.Search limit %d: %w", search.Limit, ErrBadQuery)
+	}
+
+	// without the words, the files having the tags are listed, the newest first.
+	match, order := `"files"."search_vector" @@ "query"`, `"rank" DESC`
+	if strings.TrimSpace(search.Query) == "" {
+		match, order = `TRUE`, `"files"."created_ts" DESC`
+	}
+
+	query := `
+SELECT
+  "files"."id",
+  "files"."filename",
+  "files"."mime",
+  "files"."created_ts",
+  "files"."bucket_id",
+  "files"."access",
+  "files"."size_bytes",
+  "files"."filename_suffix",
+  "files"."is_delete_marker",
+  "files"."md5",
+  "files"."sha256",
+  "files"."blob_sha256",
+  "files"."content_encoding",
+  "files"."stored_size_bytes",
+  "files"."metadata",
+  "files"."tags",
+  "buckets"."name",
+  "buckets"."versioning",
+  TS_RANK_CD("files"."search_vector", "query") AS "rank"
+FROM "files"
+JOIN "buckets"
+  ON "buckets"."id" = "files"."bucket_id",
+  WEBSEARCH_TO_TSQUERY('simple', TRANSLATE($2, '/._', '   ')) AS "query"
+WHERE "buckets"."owner_id" = $1
+  AND "buckets"."is_deleting" = FALSE
+  AND "files"."is_deleted" = FALSE
+  AND "files"."is_delete_marker" = FALSE
+  AND ` + match + `
+  AND "files"."tags" @> $4
+  AND NOT ("buckets"."versioning" AND EXISTS (
+    SELECT 1
+    FROM "files" AS "newer"
+    WHERE "newer"."bucket_id" = "files"."bucket_id" AND "newer"."filename" = "files"."filename"
+      AND "newer"."filename_suffix" > "files"."filename_suffix" AND "newer"."is_deleted" = FALSE
+  ))
+ORDER BY ` + order + `, "buckets"."name", "files"."filename" COLLATE "C", "files"."filename_suffix"
+LIMIT $3
+	`
+
+	var (
+		dst     []model.FoundFile
+		nextDst model.FoundFile
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, search.OwnerID, search.Query, search.Limit, jsonObject(search.Tags))
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.Search failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.FoundFile, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.Filename, &nextDst.MIME, &nextDst.CreatedTS,
+			&nextDst.BucketID, &nextDst.Access, &nextDst.SizeBytes, &nextDst.FilenameSuffix, &nextDst.DeleteMarker,
+			&nextDst.MD5, &nextDst.SHA256, &nextDst.BlobSHA256, &nextDst.ContentEncoding, &nextDst.StoredSizeBytes,
+			&nextDst.Metadata, &nextDst.Tags, &nextDst.BucketName, &nextDst.BucketVersioning, &nextDst.Rank)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.Search failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// MovePrefix replaces the from prefix of the filenames of the bucket with the to prefix, the versions and
+// the delete markers included, the trash left as is. The moved files get the filename suffixes following
+// the ones taken under their new filenames, keeping the order of the versions.
+// Returns database.ErrUniqueKeyViolation if a file left in place already has one of the new filenames.
+// Only makes sense if the querier is a tx.
+func (filesTable implTableFiles) MovePrefix(ctx context.Context, querier database.Querier, bucketID int64,
+	from, to string,
+) (int64, error) {
+	if querier == nil {
+		return 0, database.ErrNilArgument
+	}
+
+	// the keys checked stay free till the end of the transaction.
+	err := filesTable.LockBucketKeys(ctx, querier, bucketID, true)
+	if err != nil {
+		return 0, fmt.Errorf("implTableFiles.MovePrefix: %w", err)
+	}
+
+	// the suffixes taken under the new filenames in the other buckets stay as they are too, the filenames
+	// being locked the way LockFilename does, in the order of their hashes.
+	lockQuery := `
+SELECT PG_ADVISORY_XACT_LOCK($4, "hash")
+FROM (
+  SELECT DISTINCT HASHTEXT($3::TEXT || SUBSTRING("filename" FROM CHAR_LENGTH($2::TEXT) + 1)) AS "hash"
+  FROM "files"
+  WHERE "bucket_id" = $1 AND "is_deleted" = FALSE AND STARTS_WITH("filename", $2)
+  ORDER BY "hash"
+) AS "names"
+	`
+
+	_, err = querier.Exec(ctx, lockQuery, bucketID, from, to, filenameLockClass)
+	if err != nil {
+		return 0, fmt.Errorf("implTableFiles.MovePrefix failed on advisory lock: %w", err)
+	}
+
+	conflictQuery := `
+SELECT EXISTS (
+  SELECT 1
+  FROM "files" AS "taken"
+  JOIN "files" AS "moved"
+    ON $3::TEXT || SUBSTRING("moved"."filename" FROM CHAR_LENGTH($2::TEXT) + 1) = "taken"."filename"
+  WHERE "taken"."bucket_id" = $1 AND "taken"."is_deleted" = FALSE AND NOT STARTS_WITH("taken"."filename", $2)
+    AND "moved"."bucket_id" = $1 AND "moved"."is_deleted" = FALSE AND STARTS_WITH("moved"."filename", $2)
+)
+	`
+
+	var conflict bool
+
+	err = querier.QueryRow(ctx, conflictQuery, bucketID, from, to).Scan(&conflict)
+	if err != nil {
+		return 0, fmt.Errorf("implTableFiles.MovePrefix failed on SELECT: %w", err)
+	}
+
+	if conflict {
+		return 0, database.ErrUniqueKeyViolation
+	}
+
+	// the suffixes follow every one taken under the new filename, in any bucket, the filenames being unique
+	// with their suffixes across the buckets.
+	query := `
+WITH "moved" AS (
+  SELECT
+    "id",
+    $3::TEXT || SUBSTRING("filename" FROM CHAR_LENGTH($2::TEXT) + 1) AS "new_filename",
+    ROW_NUMBER() OVER(PARTITION BY "filename" ORDER BY "filename_suffix") AS "rank"
+  FROM "files"
+  WHERE "bucket_id" = $1 AND "is_deleted" = FALSE AND STARTS_WITH("filename", $2)
+), "taken" AS (
+  SELECT
+    "names"."new_filename",
+    COALESCE(MAX("files"."filename_suffix"), -1) AS "max_suffix"
+  FROM (SELECT DISTINCT "new_filename" FROM "moved") AS "names"
+  LEFT JOIN "files" ON "files"."filename" = "names"."new_filename"
+  GROUP BY "names"."new_filename"
+)
+UPDATE "files"
+SET
+  "filename" = "moved"."new_filename",
+  "filename_suffix" = "taken"."max_suffix" + "moved"."rank"
+FROM "moved"
+JOIN "taken" ON "taken"."new_filename" = "moved"."new_filename"
+WHERE "files"."id" = "moved"."id"
+	`
+
+	result, err := querier.Exec(ctx, query, bucketID, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("implTableFiles.MovePrefix failed on UPDATE: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetByFilename returns the files of the bucket stored under the filename, the latest first.
+// The delete markers are included.
+func (implTableFiles) GetByFilename(ctx context.Context, querier database.Querier, bucketID int64,
+	filename string,
+) ([]model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "filename",
+  "mime",
+  "created_ts",
+  "bucket_id",
+  "access",
+  "size_bytes",
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "metadata",
+  "tags"
+FROM "files"
+WHERE "bucket_id" = $1 AND "filename" = $2 AND "is_deleted" = FALSE
+ORDER BY "filename_suffix" DESC
+	`
+
+	var (
+		dst     []model.File
+		nextDst model.File
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, bucketID, filename)
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetByFilename failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.File, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.Filename, &nextDst.MIME, &nextDst.CreatedTS,
+			&nextDst.BucketID, &nextDst.Access, &nextDst.SizeBytes, &nextDst.FilenameSuffix, &nextDst.DeleteMarker,
+			&nextDst.MD5, &nextDst.SHA256, &nextDst.BlobSHA256, &nextDst.ContentEncoding, &nextDst.StoredSizeBytes,
+			&nextDst.Metadata, &nextDst.Tags)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetByFilename failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// CountFilesOfABucket counts the files that are not deleted.
+func (implTableFiles) CountFilesOfABucket(ctx context.Context, querier database.Querier, bucketID int64,
+) (int64, error) {
+	if querier == nil {
+		return 0, database.ErrNilArgument
+	}
+
+	query := `
+SELECT COUNT(*)
+FROM "files"
+WHERE "bucket_id" = $1 AND "is_deleted" = FALSE
+	`
+
+	var dst int64
+
+	err := querier.QueryRow(ctx, query, bucketID).Scan(&dst)
+	if err != nil {
+		return 0, fmt.Errorf("implTableFiles.CountFilesOfABucket failed on SELECT: %w", err)
+	}
+
+	return dst, nil
+}
+
+// GetIDsOfABucket returns up to limit ids of the bucket files, including the ones marked deleted.
+func (implTableFiles) GetIDsOfABucket(ctx context.Context, querier database.Querier, bucketID int64,
+	limit int,
+) ([]uuid.UUID, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT "id"
+FROM "files"
+WHERE "bucket_id" = $1
+LIMIT $2
+	`
+
+	queryResult, err := querier.Query(ctx, query, bucketID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetIDsOfABucket failed on SELECT: %w", err)
+	}
+
+	dst, err := pgx.CollectRows(queryResult, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetIDsOfABucket failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+func (implTableFiles) DeleteByID(ctx context.Context, querier database.Querier, fileID uuid.UUID) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "files"
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, fileID)
+	if err != nil {
+		return fmt.Errorf("implTableFiles.DeleteByID failed on DELETE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteByIDReturning deletes the file entry and returns its size and its deduplicated blob, if any.
+func (implTableFiles) DeleteByIDReturning(ctx context.Context, querier database.Querier, fileID uuid.UUID,
+) (*model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "files"
+WHERE "id" = $1
+RETURNING "id", "bucket_id", "size_bytes", "blob_sha256", "content_encoding", "stored_size_bytes"
+	`
+
+	var dst model.File
+
+	err := querier.QueryRow(ctx, query, fileID).Scan(&dst.ID, &dst.BucketID, &dst.SizeBytes, &dst.BlobSHA256,
+		&dst.ContentEncoding, &dst.StoredSizeBytes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.DeleteByIDReturning failed on DELETE: %w", err)
+	}
+
+	return &dst, nil
+}
+
+// filenameLockClass keys the advisory locks of the filenames, the two keys form of the advisory locks
+// never conflicting with the one key form of LockBucketKeys.
+const filenameLockClass = 1
+
+// LockFilename locks the filename till the end of the transaction, across the buckets, along with the rows
+// stored under it. The lock is the advisory one keyed by the hash of the filename, so that it holds even
+// if no row is stored under the filename yet.
+func (implTableFiles) LockFilename(ctx context.Context, querier database.Querier, filename string) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	_, err := querier.Exec(ctx, `SELECT PG_ADVISORY_XACT_LOCK($1, HASHTEXT($2))`, filenameLockClass, filename)
+	if err != nil {
+		return fmt.Errorf("implTableFiles.LockFilename failed on advisory lock: %w", err)
+	}
+
+	query := `
+SELECT 1
+FROM "files"
+WHERE "filename" = $1 AND "is_deleted" = FALSE
+FOR UPDATE
+	`
+
+	_, err = querier.Exec(ctx, query, filename)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.ErrNoRows
+	}
+
+	if err != nil {
+		return fmt.Errorf("implTableFiles.LockFilename failed on SELECT: %w", err)
+	}
+
+	return nil
+}
+
+// LockBucketKeys takes the lock of the keys of the bucket till the end of the transaction, shared by the writes
+// of a key and exclusive for the moves of many keys. A move waits for the writes in progress, and the writes
+// started meanwhile wait for the move. The lock is the advisory one keyed by the bucket id.
+func (implTableFiles) LockBucketKeys(ctx context.Context, querier database.Querier, bucketID int64,
+	exclusive bool,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `SELECT PG_ADVISORY_XACT_LOCK_SHARED($1)`
+	if exclusive {
+		query = `SELECT PG_ADVISORY_XACT_LOCK($1)`
+	}
+
+	_, err := querier.Exec(ctx, query, bucketID)
+	if err != nil {
+		return fmt.Errorf("implTableFiles.LockBucketKeys failed on SELECT: %w", err)
+	}
+
+	return nil
+}
+
+func (filesTable implTableFiles) PrepareNewFilenameSuffix(ctx context.Context, querier database.Querier,
+	bucketID int64, filename string,
+) (int32, error) {
+	if querier == nil {
+		return 0, database.ErrNilArgument
+	}
+
+	// only makes sense if the querire is a tx.
+	err := filesTable.LockBucketKeys(ctx, querier, bucketID, false)
+	if err != nil {
+		return 0, fmt.Errorf("implTableFiles.PrepareNewFilenameSuffix: %w", err)
+	}
+
+	err = filesTable.LockFilename(ctx, querier, filename)
+	if err != nil {
+		return 0, fmt.Errorf("implTableFiles.PrepareNewFilenameSuffix couldn't lock the filename: %w", err)
+	}
+
+	query := `
+SELECT COALESCE(MAX("filename_suffix"), -1) + 1
+FROM "files"
+WHERE "filename" = $1
+	`
+
+	var dst int32
+
+	queryResult := querier.QueryRow(ctx, query, filename)
+	err = queryResult.Scan(&dst)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, database.ErrNoRows
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("implTableFiles.PrepareNewFilenameSuffix failed on SELECT: %w", err)
+	}
+
+	return dst, nil
+}
+
+// MarkDeleted marks the file for the removal, taking it out of the trash if it's there.
+func (implTableFiles) MarkDeleted(ctx context.Context, querier database.Querier, fileID uuid.UUID) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "files"
+SET
+  "is_deleted" = TRUE,
+  "deleted_ts" = NULL
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, fileID)
+	if err != nil {
+		return fmt.Errorf("implTableFiles.MarkDeleted failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableAccessKeys) Add(ctx context.Context, querier database.Querier, key *model.AccessKey) error {
+	if querier == nil || key == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+INSERT INTO "access_keys"
+  ("id",
+   "secret",
+   "owner_id")
+VALUES
+  ($1, $2, $3)
+RETURNING "created_ts"
+	`
+
+	queryResult := querier.QueryRow(ctx, query, key.ID, key.Secret, key.OwnerID)
+	err := queryResult.Scan(&key.CreatedTS)
+
+	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		return database.ErrUniqueKeyViolation
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.ErrNoRows
+	}
+
+	if err != nil {
+		return fmt.Errorf("implTableAccessKeys.Add failed on INSERT: %w", err)
+	}
+
+	return nil
+}
+
+func (implTableAccessKeys) GetByID(ctx context.Context, querier database.Querier, keyID string,
+) (*model.AccessKey, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "secret",
+  "owner_id",
+  "created_ts"
+FROM "access_keys"
+WHERE "id" = $1
+	`
+
+	var dst model.AccessKey
+
+	queryResult := querier.QueryRow(ctx, query, keyID)
+	err := queryResult.Scan(&dst.ID, &dst.Secret, &dst.OwnerID, &dst.CreatedTS)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("implTableAccessKeys.GetByID failed on SELECT: %w", err)
+	}
+
+	return &dst, nil
+}
+
+// GetByOwner doesn't fetch the secrets.
+func (implTableAccessKeys) GetByOwner(ctx context.Context, querier database.Querier, ownerID uuid.UUID,
+) ([]model.AccessKey, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "owner_id",
+  "created_ts"
+FROM "access_keys"
+WHERE "owner_id" = $1
+ORDER BY "created_ts"
+	`
+
+	var (
+		dst     []model.AccessKey
+		nextDst model.AccessKey
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableAccessKeys.GetByOwner failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.AccessKey, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.OwnerID, &nextDst.CreatedTS)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableAccessKeys.GetByOwner failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+func (implTableAccessKeys) DeleteByID(ctx context.Context, querier database.Querier, keyID string) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "access_keys"
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, keyID)
+	if err != nil {
+		return fmt.Errorf("implTableAccessKeys.DeleteByID failed on DELETE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableUploads) Add(ctx context.Context, querier database.Querier, upload *model.Upload) error {
+	if querier == nil || upload == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+INSERT INTO "uploads"
+  ("id",
+   "bucket_id",
+   "filename",
+   "mime",
+   "access",
+   "metadata",
+   "length",
+   "offset",
+   "expires_ts")
+VALUES
+  ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING "created_ts"
+	`
+
+	queryResult := querier.QueryRow(ctx, query, upload.ID, upload.BucketID, upload.Filename, upload.MIME,
+		upload.Access, upload.Metadata, upload.Length, upload.Offset, upload.ExpiresTS)
+	err := queryResult.Scan(&upload.CreatedTS)
+
+	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		return database.ErrUniqueKeyViolation
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.ErrNoRows
+	}
+
+	if err != nil {
+		return fmt.Errorf("implTableUploads.Add failed on INSERT: %w", err)
+	}
+
+	return nil
+}
+
+const selectUploadQuery = `
+SELECT
+  "uploads"."id",
+  "uploads"."bucket_id",
+  "uploads"."filename",
+  "uploads"."mime",
+  "uploads"."access",
+  "uploads"."metadata",
+  "uploads"."length",
+  "uploads"."offset",
+  "uploads"."created_ts",
+  "uploads"."expires_ts"
+FROM "uploads"
+JOIN "buckets" ON "buckets"."id" = "uploads"."bucket_id"
+`
+
+func scanUpload(row pgx.Row, dst *model.Upload) error {
+	return row.Scan(&dst.ID, &dst.BucketID, &dst.Filename, &dst.MIME, &dst.Access, //nolint:wrapcheck // helper.
+		&dst.Metadata, &dst.Length, &dst.Offset, &dst.CreatedTS, &dst.ExpiresTS)
+}
+
+// GetByID doesn't return the uploads of the buckets being deleted.
+func (implTableUploads) GetByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID,
+) (*model.Upload, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := selectUploadQuery + `
+WHERE "uploads"."id" = $1 AND "buckets"."is_deleting" = FALSE
+	`
+
+	var dst model.Upload
+
+	err := scanUpload(querier.QueryRow(ctx, query, uploadID), &dst)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("implTableUploads.GetByID failed on SELECT: %w", err)
+	}
+
+	return &dst, nil
+}
+
+// LockByID is GetByID locking the row till the end of the transaction.
+// It doesn't wait for a concurrent lock to be released and returns ErrRowLocked instead.
+func (implTableUploads) LockByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID,
+) (*model.Upload, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := selectUploadQuery + `
+WHERE "uploads"."id" = $1 AND "buckets"."is_deleting" = FALSE
+FOR UPDATE OF "uploads" NOWAIT
+	`
+
+	var dst model.Upload
+
+	err := scanUpload(querier.QueryRow(ctx, query, uploadID), &dst)
+	if err != nil && strings.Contains(err.Error(), "could not obtain lock") {
+		return nil, ErrRowLocked
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("implTableUploads.LockByID failed on SELECT: %w", err)
+	}
+
+	return &dst, nil
+}
+
+func (implTableUploads) GetExpired(ctx context.Context, querier database.Querier, before time.Time, limit int,
+) ([]model.Upload, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := selectUploadQuery + `
+WHERE "uploads"."expires_ts" < $1
+ORDER BY "uploads"."expires_ts"
+LIMIT $2
+	`
+
+	var (
+		dst     []model.Upload
+		nextDst model.Upload
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("implTableUploads.GetExpired failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.Upload, error) {
+		err = scanUpload(row, &nextDst)
+
+		return nextDst, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableUploads.GetExpired failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+func (implTableUploads) UpdateOffset(ctx context.Context, querier database.Querier, uploadID uuid.UUID,
+	offset int64, expiresTS time.Time,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "uploads"
+SET
+  "offset" = $1,
+  "expires_ts" = $2
+WHERE "id" = $3
+	`
+
+	result, err := querier.Exec(ctx, query, offset, expiresTS, uploadID)
+	if err != nil {
+		return fmt.Errorf("implTableUploads.UpdateOffset failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableUploads) DeleteByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "uploads"
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, uploadID)
+	if err != nil {
+		return fmt.Errorf("implTableUploads.DeleteByID failed on DELETE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableMultipartUploads) Add(ctx context.Context, querier database.Querier,
+	upload *model.MultipartUpload,
+) error {
+	if querier == nil || upload == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+INSERT INTO "multipart_uploads"
+  ("id",
+   "bucket_id",
+   "key",
+   "mime",
+   "access")
+VALUES
+  ($1, $2, $3, $4, $5)
+RETURNING "created_ts"
+	`
+
+	queryResult := querier.QueryRow(ctx, query, upload.ID, upload.BucketID, upload.Key, upload.MIME, upload.Access)
+	err := queryResult.Scan(&upload.CreatedTS)
+
+	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		return database.ErrUniqueKeyViolation
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.ErrNoRows
+	}
+
+	if err != nil {
+		return fmt.Errorf("implTableMultipartUploads.Add failed on INSERT: %w", err)
+	}
+
+	return nil
+}
+
+const selectMultipartUploadQuery = `
+SELECT
+  "multipart_uploads"."id",
+  "multipart_uploads"."bucket_id",
+  "multipart_uploads"."key",
+  "multipart_uploads"."mime",
+  "multipart_uploads"."access",
+  "multipart_uploads"."created_ts"
+FROM "multipart_uploads"
+JOIN "buckets" ON "buckets"."id" = "multipart_uploads"."bucket_id"
+`
+
+func scanMultipartUpload(row pgx.Row, dst *model.MultipartUpload) error {
+	return row.Scan(&dst.ID, &dst.BucketID, &dst.Key, &dst.MIME, &dst.Access, //nolint:wrapcheck // helper.
+		&dst.CreatedTS)
+}
+
+// GetByID doesn't return the uploads of the buckets being deleted.
+func (implTableMultipartUploads) GetByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID,
+) (*model.MultipartUpload, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := selectMultipartUploadQuery + `
+WHERE "multipart_uploads"."id" = $1 AND "buckets"."is_deleting" = FALSE
+	`
+
+	var dst model.MultipartUpload
+
+	err := scanMultipartUpload(querier.QueryRow(ctx, query, uploadID), &dst)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("implTableMultipartUploads.GetByID failed on SELECT: %w", err)
+	}
+
+	return &dst, nil
+}
+
+// LockByID is GetByID locking the row till the end of the transaction, the new parts of the upload
+// wait for the lock. It doesn't wait for a concurrent lock to be released and returns ErrRowLocked instead.
+func (implTableMultipartUploads) LockByID(ctx context.Context, querier database.Querier, uploadID uuid.UUID,
+) (*model.MultipartUpload, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := selectMultipartUploadQuery + `
+WHERE "multipart_uploads"."id" = $1 AND "buckets"."is_deleting" = FALSE
+FOR UPDATE OF "multipart_uploads" NOWAIT
+	`
+
+	var dst model.MultipartUpload
+
+	err := scanMultipartUpload(querier.QueryRow(ctx, query, uploadID), &dst)
+	if err != nil && strings.Contains(err.Error(), "could not obtain lock") {
+		return nil, ErrRowLocked
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("implTableMultipartUploads.LockByID failed on SELECT: %w", err)
+	}
+
+	return &dst, nil
+}
+
+func (implTableMultipartUploads) GetStale(ctx context.Context, querier database.Querier, before time.Time,
+	limit int,
+) ([]model.MultipartUpload, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := selectMultipartUploadQuery + `
+WHERE "multipart_uploads"."created_ts" < $1
+ORDER BY "multipart_uploads"."created_ts"
+LIMIT $2
+	`
+
+	var (
+		dst     []model.MultipartUpload
+		nextDst model.MultipartUpload
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("implTableMultipartUploads.GetStale failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.MultipartUpload, error) {
+		err = scanMultipartUpload(row, &nextDst)
+
+		return nextDst, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableMultipartUploads.GetStale failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// DeleteByID deletes the parts entries of the upload as well.
+func (implTableMultipartUploads) DeleteByID(ctx context.Context, querier database.Querier,
+	uploadID uuid.UUID,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "multipart_uploads"
+WHERE "id" = $1
+	`
+
+	result, err := querier.Exec(ctx, query, uploadID)
+	if err != nil {
+		return fmt.Errorf("implTableMultipartUploads.DeleteByID failed on DELETE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func (implTableMultipartParts) Add(ctx context.Context, querier database.Querier, part *model.MultipartPart) error {
+	if querier == nil || part == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+INSERT INTO "multipart_parts"
+  ("upload_id",
+   "part_number",
+   "blob_id",
+   "size_bytes",
+   "md5",
+   "sha256")
+VALUES
+  ($1, $2, $3, $4, $5, $6)
+RETURNING "created_ts"
+	`
+
+	queryResult := querier.QueryRow(ctx, query, part.UploadID, part.PartNumber, part.BlobID, part.SizeBytes,
+		part.MD5, part.SHA256)
+	err := queryResult.Scan(&part.CreatedTS)
+
+	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		return database.ErrUniqueKeyViolation
+	}
+
+	// the upload is gone meanwhile.
+	if err != nil && strings.Contains(err.Error(), "violates foreign key constraint") {
+		return database.ErrNoRows
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.ErrNoRows
+	}
+
+	if err != nil {
+		return fmt.Errorf("implTableMultipartParts.Add failed on INSERT: %w", err)
+	}
+
+	return nil
+}
+
+func (implTableMultipartParts) GetByUpload(ctx context.Context, querier database.Querier, uploadID uuid.UUID,
+) ([]model.MultipartPart, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "upload_id",
+  "part_number",
+  "blob_id",
+  "size_bytes",
+  "md5",
+  "sha256",
+  "created_ts"
+FROM "multipart_parts"
+WHERE "upload_id" = $1
+ORDER BY "part_number"
+	`
+
+	var (
+		dst     []model.MultipartPart
+		nextDst model.MultipartPart
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableMultipartParts.GetByUpload failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.MultipartPart, error) {
+		err = row.Scan(&nextDst.UploadID, &nextDst.PartNumber, &nextDst.BlobID, &nextDst.SizeBytes, &nextDst.MD5,
+			&nextDst.SHA256, &nextDst.CreatedTS)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableMultipartParts.GetByUpload failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// DeleteByNumber returns the blob id of the deleted part.
+func (implTableMultipartParts) DeleteByNumber(ctx context.Context, querier database.Querier, uploadID uuid.UUID,
+	partNumber int,
+) (uuid.UUID, error) {
+	if querier == nil {
+		return uuid.Nil, database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "multipart_parts"
+WHERE "upload_id" = $1 AND "part_number" = $2
+RETURNING "blob_id"
+	`
+
+	var blobID uuid.UUID
+
+	err := querier.QueryRow(ctx, query, uploadID, partNumber).Scan(&blobID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("implTableMultipartParts.DeleteByNumber failed on DELETE: %w", err)
+	}
+
+	return blobID, nil
+}
+
+func (implTablePresignNonces) Add(ctx context.Context, querier database.Querier, nonce uuid.UUID,
+	expiresTS time.Time,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+INSERT INTO "presign_nonces"
+  ("nonce",
+   "expires_ts")
+VALUES
+  ($1, $2)
+	`
+
+	_, err := querier.Exec(ctx, query, nonce, expiresTS)
+	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		return database.ErrUniqueKeyViolation
+	}
+
+	if err != nil {
+		return fmt.Errorf("implTablePresignNonces.Add failed on INSERT: %w", err)
+	}
+
+	return nil
+}
+
+func (implTablePresignNonces) Exists(ctx context.Context, querier database.Querier, nonce uuid.UUID) (bool, error) {
+	if querier == nil {
+		return false, database.ErrNilArgument
+	}
+
+	query := `
+SELECT EXISTS (
+  SELECT 1
+  FROM "presign_nonces"
+  WHERE "nonce" = $1
+)
+	`
+
+	var exists bool
+
+	err := querier.QueryRow(ctx, query, nonce).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("implTablePresignNonces.Exists failed on SELECT: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (implTablePresignNonces) DeleteExpired(ctx context.Context, querier database.Querier, before time.Time) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "presign_nonces"
+WHERE "expires_ts" < $1
+	`
+
+	_, err := querier.Exec(ctx, query, before)
+	if err != nil {
+		return fmt.Errorf("implTablePresignNonces.DeleteExpired failed on DELETE: %w", err)
+	}
+
+	return nil
+}
+
+// MoveToTrash marks the file deleted, keeping it restorable.
+func (implTableFiles) MoveToTrash(ctx context.Context, querier database.Querier, fileID uuid.UUID) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "files"
+SET
+  "is_deleted" = TRUE,
+  "deleted_ts" = NOW()
+WHERE "id" = $1 AND "is_deleted" = FALSE
+	`
+
+	result, err := querier.Exec(ctx, query, fileID)
+	if err != nil {
+		return fmt.Errorf("implTableFiles.MoveToTrash failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+// RestoreFromTrash brings the file back under the filename suffix. A file marked for the removal is out of
+// the trash already.
+func (implTableFiles) RestoreFromTrash(ctx context.Context, querier database.Querier, fileID uuid.UUID,
+	filenameSuffix int32,
+) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "files"
+SET
+  "is_deleted" = FALSE,
+  "deleted_ts" = NULL,
+  "filename_suffix" = $2
+WHERE "id" = $1 AND "is_deleted" = TRUE AND "deleted_ts" IS NOT NULL
+	`
+
+	result, err := querier.Exec(ctx, query, fileID, filenameSuffix)
+	if err != nil {
+		return fmt.Errorf("implTableFiles.RestoreFromTrash failed on UPDATE: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return database.ErrNoRows
+	}
+
+	return nil
+}
+
+func scanTrashedFile(row pgx.Row, dst *model.File) error {
+	return row.Scan(&dst.ID, &dst.Filename, &dst.MIME, &dst.CreatedTS, &dst.BucketID, //nolint:wrapcheck // helper.
+		&dst.Access, &dst.SizeBytes, &dst.FilenameSuffix, &dst.DeleteMarker, &dst.MD5, &dst.SHA256,
+		&dst.BlobSHA256, &dst.ContentEncoding, &dst.StoredSizeBytes, &dst.DeletedTS)
+}
+
+func (implTableFiles) GetTrashedByID(ctx context.Context, querier database.Querier, fileID uuid.UUID,
+) (*model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "filename",
+  "mime",
+  "created_ts",
+  "bucket_id",
+  "access",
+  "size_bytes",
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "deleted_ts"
+FROM "files"
+WHERE "id" = $1 AND "deleted_ts" IS NOT NULL
+	`
+
+	var dst model.File
+
+	err := scanTrashedFile(querier.QueryRow(ctx, query, fileID), &dst)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetTrashedByID failed on SELECT: %w", err)
+	}
+
+	return &dst, nil
+}
+
+// LockTrashedByID is GetTrashedByID locking the row till the end of the transaction.
+func (implTableFiles) LockTrashedByID(ctx context.Context, querier database.Querier, fileID uuid.UUID,
+) (*model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "filename",
+  "mime",
+  "created_ts",
+  "bucket_id",
+  "access",
+  "size_bytes",
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "deleted_ts"
+FROM "files"
+WHERE "id" = $1 AND "deleted_ts" IS NOT NULL
+FOR UPDATE
+	`
+
+	var dst model.File
+
+	err := scanTrashedFile(querier.QueryRow(ctx, query, fileID), &dst)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, database.ErrNoRows
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.LockTrashedByID failed on SELECT: %w", err)
+	}
+
+	return &dst, nil
+}
+
+// GetTrashOfABucket returns the files in the trash of the bucket, the latest deleted first.
+func (implTableFiles) GetTrashOfABucket(ctx context.Context, querier database.Querier, bucketID int64,
+) ([]model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "filename",
+  "mime",
+  "created_ts",
+  "bucket_id",
+  "access",
+  "size_bytes",
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "deleted_ts"
+FROM "files"
+WHERE "bucket_id" = $1 AND "deleted_ts" IS NOT NULL
+ORDER BY "deleted_ts" DESC
+	`
+
+	queryResult, err := querier.Query(ctx, query, bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetTrashOfABucket failed on SELECT: %w", err)
+	}
+
+	dst, err := pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.File, error) {
+		var nextDst model.File
+
+		return nextDst, scanTrashedFile(row, &nextDst)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetTrashOfABucket failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// GetExpiredTrash returns up to limit files kept in the trash beyond the retention of their bucket at the moment.
+func (implTableFiles) GetExpiredTrash(ctx context.Context, querier database.Querier, moment time.Time, limit int,
+) ([]model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "files"."id",
+  "files"."filename",
+  "files"."mime",
+  "files"."created_ts",
+  "files"."bucket_id",
+  "files"."access",
+  "files"."size_bytes",
+  "files"."filename_suffix",
+  "files"."is_delete_marker",
+  "files"."md5",
+  "files"."sha256",
+  "files"."blob_sha256",
+  "files"."content_encoding",
+  "files"."stored_size_bytes",
+  "files"."deleted_ts"
+FROM "files"
+JOIN "buckets"
+  ON "buckets"."id" = "files"."bucket_id"
+WHERE "files"."deleted_ts" IS NOT NULL
+  AND "files"."deleted_ts" + MAKE_INTERVAL(days => "buckets"."trash_retention_days") <= $1
+ORDER BY "files"."deleted_ts"
+LIMIT $2
+	`
+
+	queryResult, err := querier.Query(ctx, query, moment, limit)
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetExpiredTrash failed on SELECT: %w", err)
+	}
+
+	dst, err := pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.File, error) {
+		var nextDst model.File
+
+		return nextDst, scanTrashedFile(row, &nextDst)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetExpiredTrash failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// GetActive returns the buckets that are not being deleted.
+func (implTableBuckets) GetActive(ctx context.Context, querier database.Querier) ([]model.Bucket, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "name",
+  "owner_id",
+  "availability",
+  "size_quota",
+  "created_ts",
+  "bytes_used",
+  "versioning",
+  "trash_retention_days",
+  "compression"
+FROM "buckets"
+WHERE "is_deleting" = FALSE
+ORDER BY "id"
+	`
+
+	var (
+		dst     []model.Bucket
+		nextDst model.Bucket
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("implTableBuckets.GetActive failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.Bucket, error) {
+		err = row.Scan(&nextDst.ID, &nextDst.Name, &nextDst.OwnerID, &nextDst.Availability, &nextDst.SizeQuota,
+			&nextDst.CreatedTS, &nextDst.BytesUsed, &nextDst.Versioning, &nextDst.TrashRetentionDays,
+			&nextDst.Compression)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableBuckets.GetActive failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// RecountBytesUsed sets the bytes used by the bucket to the total size of its file entries and returns it.
+func (implTableBuckets) RecountBytesUsed(ctx context.Context, querier database.Querier, bucketID int64,
+) (int64, error) {
+	if querier == nil {
+		return 0, database.ErrNilArgument
+	}
+
+	query := `
+UPDATE "buckets"
+SET
+  "bytes_used" = (
+    SELECT COALESCE(SUM("size_bytes"), 0)
+    FROM "files"
+    WHERE "bucket_id" = $1
+  )
+WHERE "id" = $1
+RETURNING "bytes_used"
+	`
+
+	var dst int64
+
+	err := querier.QueryRow(ctx, query, bucketID).Scan(&dst)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, database.ErrNoRows
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("implTableBuckets.RecountBytesUsed failed on UPDATE: %w", err)
+	}
+
+	return dst, nil
+}
+
+// GetDeletedOfABucket returns the files marked deleted outside of the trash, i.e. the deletions in progress
+// or interrupted.
+func (implTableFiles) GetDeletedOfABucket(ctx context.Context, querier database.Querier, bucketID int64,
+) ([]model.File, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "id",
+  "filename",
+  "mime",
+  "created_ts",
+  "bucket_id",
+  "access",
+  "size_bytes",
+  "filename_suffix",
+  "is_delete_marker",
+  "md5",
+  "sha256",
+  "blob_sha256",
+  "content_encoding",
+  "stored_size_bytes",
+  "deleted_ts"
+FROM "files"
+WHERE "bucket_id" = $1 AND "is_deleted" = TRUE AND "deleted_ts" IS NULL
+	`
+
+	queryResult, err := querier.Query(ctx, query, bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetDeletedOfABucket failed on SELECT: %w", err)
+	}
+
+	dst, err := pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.File, error) {
+		var nextDst model.File
+
+		return nextDst, scanTrashedFile(row, &nextDst)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableFiles.GetDeletedOfABucket failed on Scan: %w", err)
+	}
+
+	return dst, nil
 }
 
-func (implTableFiles) DeleteByID(ctx context.Context, querier database.Querier, fileID uuid.UUID) error {
+// SetSize overwrites the recorded size of the file stored as is, the bucket usage is left to the caller.
+func (implTableFiles) SetSize(ctx context.Context, querier database.Querier, fileID uuid.UUID,
+	sizeBytes int64,
+) error {
 	if querier == nil {
 		return database.ErrNilArgument
 	}
 
 	query := `
-DELETE FROM "files"
-WHERE "id" = $1
+UPDATE "files"
+SET
+  "size_bytes" = $2,
+  "stored_size_bytes" = $2
+WHERE "id" = $1 AND "content_encoding" = ''
 	`
 
-	result, err := querier.Exec(ctx, query, fileID)
+	result, err := querier.Exec(ctx, query, fileID, sizeBytes)
 	if err != nil {
-		return fmt.Errorf("implTableFiles.DeleteByID failed on DELETE: %w", err)
+		return fmt.Errorf("implTableFiles.SetSize failed on UPDATE: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
@@ -376,86 +2606,433 @@ WHERE "id" = $1
 	return nil
 }
 
-func (implTableFiles) LockFilename(ctx context.Context, querier database.Querier, filename string) error {
+func (implTableUploads) GetIDsOfABucket(ctx context.Context, querier database.Querier, bucketID int64,
+) ([]uuid.UUID, error) {
 	if querier == nil {
-		return database.ErrNilArgument
+		return nil, database.ErrNilArgument
 	}
 
 	query := `
-SELECT 1
-FROM "files"
-WHERE "filename" = $1 AND "is_deleted" = FALSE
-FOR UPDATE
+SELECT "id"
+FROM "uploads"
+WHERE "bucket_id" = $1
 	`
 
-	_, err := querier.Exec(ctx, query, filename)
+	queryResult, err := querier.Query(ctx, query, bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableUploads.GetIDsOfABucket failed on SELECT: %w", err)
+	}
 
-	if errors.Is(err, pgx.ErrNoRows) {
-		return database.ErrNoRows
+	dst, err := pgx.CollectRows(queryResult, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("implTableUploads.GetIDsOfABucket failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// GetBlobIDsOfABucket returns the blob ids of the parts of every multipart upload to the bucket.
+func (implTableMultipartParts) GetBlobIDsOfABucket(ctx context.Context, querier database.Querier, bucketID int64,
+) ([]uuid.UUID, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT "multipart_parts"."blob_id"
+FROM "multipart_parts"
+JOIN "multipart_uploads"
+  ON "multipart_uploads"."id" = "multipart_parts"."upload_id"
+WHERE "multipart_uploads"."bucket_id" = $1
+	`
+
+	queryResult, err := querier.Query(ctx, query, bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("implTableMultipartParts.GetBlobIDsOfABucket failed on SELECT: %w", err)
 	}
 
+	dst, err := pgx.CollectRows(queryResult, pgx.RowTo[uuid.UUID])
 	if err != nil {
-		return fmt.Errorf("implTableFiles.GetByID failed on SELECT: %w", err)
+		return nil, fmt.Errorf("implTableMultipartParts.GetBlobIDsOfABucket failed on Scan: %w", err)
 	}
 
-	return nil
+	return dst, nil
 }
 
-func (filesTable implTableFiles) PrepareNewFilenameSuffix(ctx context.Context, querier database.Querier,
-	filename string,
-) (int32, error) {
+// Acquire takes a reference to the blob, creating it with a single reference if it's new.
+// The row stays locked till the end of the transaction. Returns the reference count.
+func (implTableBlobs) Acquire(ctx context.Context, querier database.Querier, sha256 string, sizeBytes int64,
+) (int64, error) {
 	if querier == nil {
 		return 0, database.ErrNilArgument
 	}
 
-	// only makes sense if the querire is a tx.
-	err := filesTable.LockFilename(ctx, querier, filename)
+	query := `
+INSERT INTO "blobs"
+  ("sha256",
+   "size_bytes",
+   "ref_count")
+VALUES
+  ($1, $2, 1)
+ON CONFLICT ("sha256") DO UPDATE
+SET
+  "ref_count" = "blobs"."ref_count" + 1
+RETURNING "ref_count"
+	`
+
+	var dst int64
+
+	err := querier.QueryRow(ctx, query, sha256, sizeBytes).Scan(&dst)
 	if err != nil {
-		return 0, fmt.Errorf("implTableFiles.PrepareNewFilenameSuffix couldn't lock the filename: %w", err)
+		return 0, fmt.Errorf("implTableBlobs.Acquire failed on INSERT: %w", err)
+	}
+
+	return dst, nil
+}
+
+// Release drops a reference to the blob and returns the references left.
+// The row is deleted along with the last reference.
+func (implTableBlobs) Release(ctx context.Context, querier database.Querier, sha256 string) (int64, error) {
+	if querier == nil {
+		return 0, database.ErrNilArgument
 	}
 
 	query := `
-SELECT COALESCE(MAX("filename_suffix"), -1) + 1
-FROM "files"
-WHERE "filename" = $1
+UPDATE "blobs"
+SET
+  "ref_count" = "ref_count" - 1
+WHERE "sha256" = $1
+RETURNING "ref_count"
 	`
 
-	var dst int32
-
-	queryResult := querier.QueryRow(ctx, query, filename)
-	err = queryResult.Scan(&dst)
+	var dst int64
 
+	err := querier.QueryRow(ctx, query, sha256).Scan(&dst)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return 0, database.ErrNoRows
 	}
 
 	if err != nil {
-		return 0, fmt.Errorf("implTableFiles.PrepareNewFilenameSuffix failed on SELECT: %w", err)
+		return 0, fmt.Errorf("implTableBlobs.Release failed on UPDATE: %w", err)
+	}
+
+	if dst > 0 {
+		return dst, nil
+	}
+
+	query = `
+DELETE FROM "blobs"
+WHERE "sha256" = $1
+	`
+
+	_, err = querier.Exec(ctx, query, sha256)
+	if err != nil {
+		return 0, fmt.Errorf("implTableBlobs.Release failed on DELETE: %w", err)
+	}
+
+	return 0, nil
+}
+
+func (implTableBlobs) GetAll(ctx context.Context, querier database.Querier) ([]model.Blob, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "sha256",
+  "size_bytes",
+  "ref_count",
+  "created_ts"
+FROM "blobs"
+	`
+
+	var (
+		dst     []model.Blob
+		nextDst model.Blob
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("implTableBlobs.GetAll failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.Blob, error) {
+		err = row.Scan(&nextDst.SHA256, &nextDst.SizeBytes, &nextDst.RefCount, &nextDst.CreatedTS)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableBlobs.GetAll failed on Scan: %w", err)
 	}
 
 	return dst, nil
 }
 
-func (implTableFiles) MarkDeleted(ctx context.Context, querier database.Querier, fileID uuid.UUID) error {
+// GetCreatedBefore returns a page of the blobs created before the moment, in the order of their digests
+// past the afterSHA256 one.
+func (implTableBlobs) GetCreatedBefore(ctx context.Context, querier database.Querier, before time.Time,
+	afterSHA256 string, limit int,
+) ([]model.Blob, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "sha256",
+  "size_bytes",
+  "ref_count",
+  "created_ts"
+FROM "blobs"
+WHERE "created_ts" < $1 AND "sha256" > $2
+ORDER BY "sha256"
+LIMIT $3
+	`
+
+	var (
+		dst     []model.Blob
+		nextDst model.Blob
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query, before, afterSHA256, limit)
+	if err != nil {
+		return nil, fmt.Errorf("implTableBlobs.GetCreatedBefore failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.Blob, error) {
+		err = row.Scan(&nextDst.SHA256, &nextDst.SizeBytes, &nextDst.RefCount, &nextDst.CreatedTS)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableBlobs.GetCreatedBefore failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// GetMiscounted returns the blobs whose reference count differs from the number of the file entries
+// referring to them, with RefCount set to the latter.
+func (implTableBlobs) GetMiscounted(ctx context.Context, querier database.Querier) ([]model.Blob, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "blobs"."sha256",
+  "blobs"."size_bytes",
+  COUNT("files"."id"),
+  "blobs"."created_ts"
+FROM "blobs"
+LEFT JOIN "files"
+  ON "files"."blob_sha256" = "blobs"."sha256"
+GROUP BY "blobs"."sha256"
+HAVING COUNT("files"."id") <> "blobs"."ref_count"
+	`
+
+	var (
+		dst     []model.Blob
+		nextDst model.Blob
+		err     error
+	)
+
+	queryResult, err := querier.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("implTableBlobs.GetMiscounted failed on SELECT: %w", err)
+	}
+
+	dst, err = pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.Blob, error) {
+		err = row.Scan(&nextDst.SHA256, &nextDst.SizeBytes, &nextDst.RefCount, &nextDst.CreatedTS)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableBlobs.GetMiscounted failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
+
+// Recount locks the blob and sets its reference count to the number of the file entries referring to it.
+// A blob nothing refers to is deleted. Returns the new count.
+func (implTableBlobs) Recount(ctx context.Context, querier database.Querier, sha256 string) (int64, error) {
 	if querier == nil {
+		return 0, database.ErrNilArgument
+	}
+
+	// the lock comes first, so the count sees every entry committed along with a reference.
+	query := `
+SELECT "ref_count"
+FROM "blobs"
+WHERE "sha256" = $1
+FOR UPDATE
+	`
+
+	var dst int64
+
+	err := querier.QueryRow(ctx, query, sha256).Scan(&dst)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, database.ErrNoRows
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("implTableBlobs.Recount failed on SELECT: %w", err)
+	}
+
+	query = `
+UPDATE "blobs"
+SET
+  "ref_count" = (
+    SELECT COUNT(*)
+    FROM "files"
+    WHERE "blob_sha256" = $1
+  )
+WHERE "sha256" = $1
+RETURNING "ref_count"
+	`
+
+	err = querier.QueryRow(ctx, query, sha256).Scan(&dst)
+	if err != nil {
+		return 0, fmt.Errorf("implTableBlobs.Recount failed on UPDATE: %w", err)
+	}
+
+	if dst > 0 {
+		return dst, nil
+	}
+
+	query = `
+DELETE FROM "blobs"
+WHERE "sha256" = $1
+	`
+
+	_, err = querier.Exec(ctx, query, sha256)
+	if err != nil {
+		return 0, fmt.Errorf("implTableBlobs.Recount failed on DELETE: %w", err)
+	}
+
+	return 0, nil
+}
+
+// Record saves the corruption of the blob, or marks an already known one as checked again.
+func (implTableBlobCorruptions) Record(ctx context.Context, querier database.Querier,
+	corruption *model.BlobCorruption,
+) error {
+	if querier == nil || corruption == nil {
 		return database.ErrNilArgument
 	}
 
 	query := `
-UPDATE "files"
+INSERT INTO "blob_corruptions"
+  ("folder",
+   "blob_id",
+   "bucket_id",
+   "expected_sha256",
+   "actual_sha256",
+   "detail")
+VALUES
+  ($1, $2, $3, $4, $5, $6)
+ON CONFLICT ("folder", "blob_id") DO UPDATE
 SET
-  "is_deleted" = TRUE
-WHERE "id" = $1
+  "bucket_id" = EXCLUDED."bucket_id",
+  "expected_sha256" = EXCLUDED."expected_sha256",
+  "actual_sha256" = EXCLUDED."actual_sha256",
+  "detail" = EXCLUDED."detail",
+  "checked_ts" = NOW()
+RETURNING "detected_ts", "checked_ts"
 	`
 
-	result, err := querier.Exec(ctx, query, fileID)
+	err := querier.QueryRow(ctx, query, corruption.Folder, corruption.BlobID, corruption.BucketID,
+		corruption.ExpectedSHA256, corruption.ActualSHA256, corruption.Detail).
+		Scan(&corruption.DetectedTS, &corruption.CheckedTS)
 	if err != nil {
-		return fmt.Errorf("implTableFiles.MarkDeleted failed on UPDATE: %w", err)
+		return fmt.Errorf("implTableBlobCorruptions.Record failed on INSERT: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
-		return database.ErrNoRows
+	return nil
+}
+
+// Clear forgets the corruption of the blob, e.g. once it's found intact. A blob not recorded is not an error.
+func (implTableBlobCorruptions) Clear(ctx context.Context, querier database.Querier, folder, blobID string) error {
+	if querier == nil {
+		return database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "blob_corruptions"
+WHERE "folder" = $1 AND "blob_id" = $2
+	`
+
+	_, err := querier.Exec(ctx, query, folder, blobID)
+	if err != nil {
+		return fmt.Errorf("implTableBlobCorruptions.Clear failed on DELETE: %w", err)
 	}
 
 	return nil
 }
+
+// DeleteCheckedBefore drops the corruptions not seen since the time, i.e. of the blobs deleted meanwhile.
+// Returns the number of the corruptions dropped.
+func (implTableBlobCorruptions) DeleteCheckedBefore(ctx context.Context, querier database.Querier,
+	before time.Time,
+) (int64, error) {
+	if querier == nil {
+		return 0, database.ErrNilArgument
+	}
+
+	query := `
+DELETE FROM "blob_corruptions"
+WHERE "checked_ts" < $1
+	`
+
+	result, err := querier.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("implTableBlobCorruptions.DeleteCheckedBefore failed on DELETE: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (implTableBlobCorruptions) GetAll(ctx context.Context, querier database.Querier,
+) ([]model.BlobCorruption, error) {
+	if querier == nil {
+		return nil, database.ErrNilArgument
+	}
+
+	query := `
+SELECT
+  "folder",
+  "blob_id",
+  "bucket_id",
+  "expected_sha256",
+  "actual_sha256",
+  "detail",
+  "detected_ts",
+  "checked_ts"
+FROM "blob_corruptions"
+ORDER BY "detected_ts"
+	`
+
+	queryResult, err := querier.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("implTableBlobCorruptions.GetAll failed on SELECT: %w", err)
+	}
+
+	// a fresh row every time, BucketID is a pointer.
+	dst, err := pgx.CollectRows(queryResult, func(row pgx.CollectableRow) (model.BlobCorruption, error) {
+		var nextDst model.BlobCorruption
+
+		err := row.Scan(&nextDst.Folder, &nextDst.BlobID, &nextDst.BucketID, &nextDst.ExpectedSHA256,
+			&nextDst.ActualSHA256, &nextDst.Detail, &nextDst.DetectedTS, &nextDst.CheckedTS)
+
+		return nextDst, err //nolint:wrapcheck // not an actual return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("implTableBlobCorruptions.GetAll failed on Scan: %w", err)
+	}
+
+	return dst, nil
+}
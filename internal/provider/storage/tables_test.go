@@ -3,12 +3,16 @@ package storage_test
 import (
 	"context"
 	"flag"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/eldarbr/go-auth/pkg/database"
 	"github.com/eldarbr/go-s3/internal/model"
 	"github.com/eldarbr/go-s3/internal/provider/storage"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -21,6 +25,15 @@ func clearTables(t *testing.T) {
 
 	_, err = testDB.GetPool().Exec(context.Background(), "TRUNCATE TABLE buckets RESTART IDENTITY CASCADE")
 	require.NoError(t, err)
+
+	_, err = testDB.GetPool().Exec(context.Background(), "TRUNCATE TABLE access_keys")
+	require.NoError(t, err)
+
+	_, err = testDB.GetPool().Exec(context.Background(), "TRUNCATE TABLE blobs")
+	require.NoError(t, err)
+
+	_, err = testDB.GetPool().Exec(context.Background(), "TRUNCATE TABLE blob_corruptions")
+	require.NoError(t, err)
 }
 
 var testDBUri = flag.String("t-db-uri", "", "perform sql tests on the `t-db-uri` database")
@@ -89,6 +102,12 @@ func TestTableBucketsIntegration(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, bucket.ID, retrievedBucketByName.ID)
 
+	// GetUsageByOwner
+	usage, err := storage.TableBuckets.GetUsageByOwner(ctx, querier, bucket.OwnerID)
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, int64(0), usage[0].FilesCount)
+
 	// GetByName - not found
 	_, err = storage.TableBuckets.GetByName(ctx, querier, "NonExistentBucket")
 	require.ErrorIs(t, err, database.ErrNoRows)
@@ -102,11 +121,56 @@ func TestTableBucketsIntegration(t *testing.T) {
 	require.NoError(t, err)
 	assert.InEpsilon(t, float64(2048), updatedBucket.SizeQuota, 0.1)
 
+	// AddBytesUsed - within the quota
+	used, err := storage.TableBuckets.AddBytesUsed(ctx, querier, bucket.ID, 2000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000), used)
+
+	// AddBytesUsed - beyond the quota
+	_, err = storage.TableBuckets.AddBytesUsed(ctx, querier, bucket.ID, 100)
+	require.ErrorIs(t, err, database.ErrNoRows)
+
+	// SetQuota - lower than used, a shrink still succeeds
+	err = storage.TableBuckets.SetQuota(ctx, querier, bucket.ID, 1000)
+	require.NoError(t, err)
+
+	used, err = storage.TableBuckets.AddBytesUsed(ctx, querier, bucket.ID, -500)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1500), used)
+
+	// SetVersioning
+	err = storage.TableBuckets.SetVersioning(ctx, querier, bucket.ID, true)
+	require.NoError(t, err)
+
+	versionedBucket, err := storage.TableBuckets.GetByID(ctx, querier, bucket.ID)
+	require.NoError(t, err)
+	assert.True(t, versionedBucket.Versioning)
+
+	// SetCompression
+	err = storage.TableBuckets.SetCompression(ctx, querier, bucket.ID, "gzip")
+	require.NoError(t, err)
+
+	compressedBucket, err := storage.TableBuckets.GetByID(ctx, querier, bucket.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", compressedBucket.Compression)
+
 	// UpdateByID - not found
 	nonExistentBucket := &model.Bucket{ID: -1, Name: "NonExistentBucket", Availability: model.BucketAvailabilityClosed}
 	err = storage.TableBuckets.UpdateByID(ctx, querier, nonExistentBucket)
 	require.ErrorIs(t, err, database.ErrNoRows)
 
+	// MarkDeleting - hidden from GetByName, listed by GetDeleting
+	err = storage.TableBuckets.MarkDeleting(ctx, querier, bucket.ID)
+	require.NoError(t, err)
+
+	_, err = storage.TableBuckets.GetByName(ctx, querier, bucket.Name)
+	require.ErrorIs(t, err, database.ErrNoRows)
+
+	deletingBuckets, err := storage.TableBuckets.GetDeleting(ctx, querier)
+	require.NoError(t, err)
+	require.Len(t, deletingBuckets, 1)
+	assert.Equal(t, bucket.ID, deletingBuckets[0].ID)
+
 	// DeleteByID
 	err = storage.TableBuckets.DeleteByID(ctx, querier, bucket.ID)
 	require.NoError(t, err)
@@ -158,6 +222,8 @@ func TestTableFilesIntegration(t *testing.T) {
 		Access:         model.FileAccessPublic,
 		SizeBytes:      123,
 		FilenameSuffix: 0,
+		MD5:            "d41d8cd98f00b204e9800998ecf8427e",
+		SHA256:         "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 	}
 	err = storage.TableFiles.InsertID(ctx, querier, file2)
 	require.NoError(t, err)
@@ -165,6 +231,8 @@ func TestTableFilesIntegration(t *testing.T) {
 	retrievedFile2, err := storage.TableFiles.GetByID(ctx, querier, fileID)
 	require.NoError(t, err)
 	assert.Equal(t, file2.Filename, retrievedFile2.Filename)
+	assert.Equal(t, file2.MD5, retrievedFile2.MD5)
+	assert.Equal(t, file2.SHA256, retrievedFile2.SHA256)
 
 	// GetByID
 	retrievedFile, err := storage.TableFiles.GetByID(ctx, querier, file.ID)
@@ -175,11 +243,69 @@ func TestTableFilesIntegration(t *testing.T) {
 	_, err = storage.TableFiles.GetByID(ctx, querier, uuid.New())
 	require.ErrorIs(t, err, database.ErrNoRows)
 
+	// LockByID
+	lockedFile, err := storage.TableFiles.LockByID(ctx, querier, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, file.Filename, lockedFile.Filename)
+
+	_, err = storage.TableFiles.LockByID(ctx, querier, uuid.New())
+	require.ErrorIs(t, err, database.ErrNoRows)
+
 	// GetFilesOfABucket
 	files, err := storage.TableFiles.GetFilesOfABucket(ctx, querier, bucket.ID)
 	require.NoError(t, err)
 	require.Len(t, files, 2)
 
+	// InsertID - a delete marker, listed by GetByFilename but not counted
+	marker := &model.File{
+		ID:             uuid.New(),
+		Filename:       "TestFile2",
+		BucketID:       bucket.ID,
+		Access:         model.FileAccessPrivate,
+		FilenameSuffix: 1,
+		DeleteMarker:   true,
+	}
+	err = storage.TableFiles.InsertID(ctx, querier, marker)
+	require.NoError(t, err)
+
+	versions, err := storage.TableFiles.GetByFilename(ctx, querier, bucket.ID, "TestFile2")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.True(t, versions[0].DeleteMarker)
+	assert.Equal(t, fileID, versions[1].ID)
+
+	// GetVersionsPage - the latest first, continued past the delete marker
+	versionsPage, err := storage.TableFiles.GetVersionsPage(ctx, querier, model.VersionsQuery{
+		BucketID: bucket.ID,
+		Filename: "TestFile2",
+		Limit:    1,
+	})
+	require.NoError(t, err)
+	require.Len(t, versionsPage, 1)
+	assert.True(t, versionsPage[0].DeleteMarker)
+	assert.True(t, versionsPage[0].IsLatest)
+
+	versionsPage, err = storage.TableFiles.GetVersionsPage(ctx, querier, model.VersionsQuery{
+		After:    &model.FilesCursor{Filename: "TestFile2", Suffix: 1},
+		BucketID: bucket.ID,
+		Filename: "TestFile2",
+		Limit:    10,
+	})
+	require.NoError(t, err)
+	require.Len(t, versionsPage, 1)
+	assert.Equal(t, fileID, versionsPage[0].ID)
+	assert.False(t, versionsPage[0].IsLatest)
+
+	err = storage.TableFiles.DeleteByID(ctx, querier, marker.ID)
+	require.NoError(t, err)
+
+	// GetUsageByOwner
+	usage, err := storage.TableBuckets.GetUsageByOwner(ctx, querier, bucket.OwnerID)
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, int64(2), usage[0].FilesCount)
+	assert.Equal(t, int64(246), usage[0].BytesUsed)
+
 	// UpdateByID
 	file.SizeBytes = 456
 	err = storage.TableFiles.UpdateByID(ctx, querier, file)
@@ -194,6 +320,65 @@ func TestTableFilesIntegration(t *testing.T) {
 	err = storage.TableFiles.UpdateByID(ctx, querier, nonExistentFile)
 	require.ErrorIs(t, err, database.ErrNoRows)
 
+	// MoveToTrash - hidden from GetByID, listed in the trash
+	err = storage.TableFiles.MoveToTrash(ctx, querier, fileID)
+	require.NoError(t, err)
+
+	_, err = storage.TableFiles.GetByID(ctx, querier, fileID)
+	require.ErrorIs(t, err, database.ErrNoRows)
+
+	trash, err := storage.TableFiles.GetTrashOfABucket(ctx, querier, bucket.ID)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.NotNil(t, trash[0].DeletedTS)
+
+	// GetExpiredTrash - the bucket keeps no trash, so it's expired right away
+	expired, err := storage.TableFiles.GetExpiredTrash(ctx, querier, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, fileID, expired[0].ID)
+
+	// LockTrashedByID
+	lockedFile, err = storage.TableFiles.LockTrashedByID(ctx, querier, fileID)
+	require.NoError(t, err)
+	assert.Equal(t, fileID, lockedFile.ID)
+
+	// RestoreFromTrash
+	err = storage.TableFiles.RestoreFromTrash(ctx, querier, fileID, 1)
+	require.NoError(t, err)
+
+	restoredFile, err := storage.TableFiles.GetTrashedByID(ctx, querier, fileID)
+	require.ErrorIs(t, err, database.ErrNoRows)
+	assert.Nil(t, restoredFile)
+
+	restoredFile, err = storage.TableFiles.GetByID(ctx, querier, fileID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), restoredFile.FilenameSuffix)
+
+	// SetSize and RecountBytesUsed
+	require.NoError(t, storage.TableFiles.SetSize(ctx, querier, fileID, 42))
+
+	bytesUsed, err := storage.TableBuckets.RecountBytesUsed(ctx, querier, bucket.ID)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, bytesUsed, int64(42))
+
+	// MarkDeleted - a trashed file marked for the removal is out of the trash, no longer restorable
+	require.NoError(t, storage.TableFiles.MoveToTrash(ctx, querier, fileID))
+	require.NoError(t, storage.TableFiles.MarkDeleted(ctx, querier, fileID))
+
+	_, err = storage.TableFiles.LockTrashedByID(ctx, querier, fileID)
+	require.ErrorIs(t, err, database.ErrNoRows)
+
+	err = storage.TableFiles.RestoreFromTrash(ctx, querier, fileID, 1)
+	require.ErrorIs(t, err, database.ErrNoRows)
+
+	// GetDeletedOfABucket - a deletion in progress, not the trash
+
+	deleted, err := storage.TableFiles.GetDeletedOfABucket(ctx, querier, bucket.ID)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, fileID, deleted[0].ID)
+
 	// DeleteByID
 	err = storage.TableFiles.DeleteByID(ctx, querier, file.ID)
 	require.NoError(t, err)
@@ -211,7 +396,7 @@ func TestTableFilesIntegration(t *testing.T) {
 	defer tx1.Rollback(ctx)
 
 	// PrepareNewFilenameSuffix
-	suffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, tx1, "TestFile3")
+	suffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, tx1, bucket.ID, "TestFile3")
 	require.NoError(t, err)
 	assert.Equal(t, int32(1), suffix)
 
@@ -219,8 +404,663 @@ func TestTableFilesIntegration(t *testing.T) {
 	require.NoError(t, err)
 	defer tx2.Rollback(ctx)
 
-	// Subsequent call should increment suffix
-	suffix, err = storage.TableFiles.PrepareNewFilenameSuffix(ctx, tx2, "TestFile3")
+	// Subsequent call waits for the first transaction and follows its suffix
+	prepared := prepareAsync(ctx, t, tx2, bucket.ID, "TestFile3")
+	assertWaiting(t, prepared)
+
+	require.NoError(t, storage.TableFiles.InsertID(ctx, tx1, &model.File{
+		ID:             uuid.New(),
+		Filename:       "TestFile3",
+		BucketID:       bucket.ID,
+		Access:         model.FileAccessPrivate,
+		FilenameSuffix: suffix,
+	}))
+	require.NoError(t, tx1.Commit(ctx))
+	assert.Equal(t, int32(2), <-prepared)
+}
+
+// prepareAsync runs PrepareNewFilenameSuffix in the background, sending the suffix prepared.
+func prepareAsync(ctx context.Context, t *testing.T, querier database.Querier, bucketID int64, filename string,
+) <-chan int32 {
+	t.Helper()
+
+	prepared := make(chan int32, 1)
+
+	go func() {
+		suffix, err := storage.TableFiles.PrepareNewFilenameSuffix(ctx, querier, bucketID, filename)
+		assert.NoError(t, err)
+
+		prepared <- suffix
+	}()
+
+	return prepared
+}
+
+// assertWaiting asserts that nothing is sent on the channel for a while, the sender waiting on a lock.
+func assertWaiting[T any](t *testing.T, sent <-chan T) {
+	t.Helper()
+
+	select {
+	case <-sent:
+		assert.Fail(t, "not waiting for the lock")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestTableFilesPrefixIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+
+	bucket := &model.Bucket{
+		Name:         "TestBucketPrefixes",
+		Availability: model.BucketAvailabilityAccessible,
+		OwnerID:      uuid.New(),
+	}
+	require.NoError(t, storage.TableBuckets.Add(ctx, querier, bucket))
+
+	for _, file := range []struct {
+		name   string
+		suffix int32
+	}{{"docs/a.txt", 0}, {"docs/a.txt", 1}, {"docs/sub/b.txt", 0}, {"docsx/c.txt", 0}, {"archive/d.txt", 0}} {
+		require.NoError(t, storage.TableFiles.InsertID(ctx, querier, &model.File{
+			ID:             uuid.New(),
+			Filename:       file.name,
+			BucketID:       bucket.ID,
+			Access:         model.FileAccessPrivate,
+			FilenameSuffix: file.suffix,
+		}))
+	}
+
+	docs := model.FilesQuery{BucketID: bucket.ID, Prefix: "docs/", Sort: model.FilesSortName, Limit: 10}
+
+	// GetPage - the keys under the prefix
+	files, err := storage.TableFiles.GetPage(ctx, querier, docs)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	// MovePrefix - the versions keep their order
+	moved, err := storage.TableFiles.MovePrefix(ctx, querier, bucket.ID, "docs/", "archive/docs/")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), moved)
+
+	files, err = storage.TableFiles.GetByFilename(ctx, querier, bucket.ID, "archive/docs/a.txt")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Greater(t, files[0].FilenameSuffix, files[1].FilenameSuffix)
+
+	files, err = storage.TableFiles.GetPage(ctx, querier, docs)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	// MovePrefix - a key taken by a file left in place
+	_, err = storage.TableFiles.MovePrefix(ctx, querier, bucket.ID, "archive/docs/", "archive/")
 	require.NoError(t, err)
+
+	require.NoError(t, storage.TableFiles.InsertID(ctx, querier, &model.File{
+		ID:       uuid.New(),
+		Filename: "docsx/d.txt",
+		BucketID: bucket.ID,
+		Access:   model.FileAccessPrivate,
+	}))
+
+	_, err = storage.TableFiles.MovePrefix(ctx, querier, bucket.ID, "docsx/", "archive/")
+	require.ErrorIs(t, err, database.ErrUniqueKeyViolation)
+}
+
+func TestTableFilesMovePrefixConcurrentIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+
+	buckets := []*model.Bucket{
+		{Name: "TestBucketMoveA", Availability: model.BucketAvailabilityAccessible, OwnerID: uuid.New()},
+		{Name: "TestBucketMoveB", Availability: model.BucketAvailabilityAccessible, OwnerID: uuid.New()},
+	}
+	for _, bucket := range buckets {
+		require.NoError(t, storage.TableBuckets.Add(ctx, querier, bucket))
+	}
+
+	for _, name := range []string{"src/k", "other/k"} {
+		require.NoError(t, storage.TableFiles.InsertID(ctx, querier, &model.File{
+			ID:       uuid.New(),
+			Filename: name,
+			BucketID: buckets[0].ID,
+			Access:   model.FileAccessPrivate,
+		}))
+	}
+
+	insert := func(tx pgx.Tx, filename string, suffix int32) {
+		require.NoError(t, storage.TableFiles.InsertID(ctx, tx, &model.File{
+			ID:             uuid.New(),
+			Filename:       filename,
+			BucketID:       buckets[1].ID,
+			Access:         model.FileAccessPrivate,
+			FilenameSuffix: suffix,
+		}))
+	}
+
+	// a write of the same key in another bucket waits for the move.
+	moveTx, err := querier.Begin(ctx)
+	require.NoError(t, err)
+	defer moveTx.Rollback(ctx)
+
+	_, err = storage.TableFiles.MovePrefix(ctx, moveTx, buckets[0].ID, "src/", "dst/")
+	require.NoError(t, err)
+
+	writeTx, err := querier.Begin(ctx)
+	require.NoError(t, err)
+	defer writeTx.Rollback(ctx)
+
+	prepared := prepareAsync(ctx, t, writeTx, buckets[1].ID, "dst/k")
+	assertWaiting(t, prepared)
+
+	require.NoError(t, moveTx.Commit(ctx))
+
+	suffix := <-prepared
 	assert.Equal(t, int32(1), suffix)
+	insert(writeTx, "dst/k", suffix)
+	require.NoError(t, writeTx.Commit(ctx))
+
+	// and a move waits for a write of the same key in another bucket.
+	writeTx, err = querier.Begin(ctx)
+	require.NoError(t, err)
+	defer writeTx.Rollback(ctx)
+
+	suffix, err = storage.TableFiles.PrepareNewFilenameSuffix(ctx, writeTx, buckets[1].ID, "new/k")
+	require.NoError(t, err)
+	insert(writeTx, "new/k", suffix)
+
+	moved := make(chan error, 1)
+
+	go func() {
+		tx, err := querier.Begin(ctx)
+		if err == nil {
+			defer tx.Rollback(ctx)
+
+			_, err = storage.TableFiles.MovePrefix(ctx, tx, buckets[0].ID, "other/", "new/")
+			if err == nil {
+				err = tx.Commit(ctx)
+			}
+		}
+
+		moved <- err
+	}()
+
+	assertWaiting(t, moved)
+	require.NoError(t, writeTx.Commit(ctx))
+	require.NoError(t, <-moved)
+
+	files, err := storage.TableFiles.GetByFilename(ctx, querier, buckets[0].ID, "new/k")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, int32(1), files[0].FilenameSuffix)
+}
+
+func TestTableFilesPageIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+
+	bucket := &model.Bucket{
+		Name:         "TestBucketPages",
+		Availability: model.BucketAvailabilityAccessible,
+		OwnerID:      uuid.New(),
+	}
+	require.NoError(t, storage.TableBuckets.Add(ctx, querier, bucket))
+
+	for i, name := range []string{"b/x.png", "a.txt", "B.txt", "b/y.txt", "c_1.png"} {
+		require.NoError(t, storage.TableFiles.InsertID(ctx, querier, &model.File{
+			ID:        uuid.New(),
+			Filename:  name,
+			MIME:      map[bool]string{true: "image/png", false: "text/plain"}[strings.HasSuffix(name, ".png")],
+			BucketID:  bucket.ID,
+			Access:    model.FileAccessPrivate,
+			SizeBytes: int64(10 * (5 - i)),
+		}))
+	}
+
+	names := func(files []model.File) []string {
+		result := make([]string, 0, len(files))
+		for _, file := range files {
+			result = append(result, file.Filename)
+		}
+
+		return result
+	}
+
+	// the keys in the byte order, page by page
+	query := model.FilesQuery{BucketID: bucket.ID, Sort: model.FilesSortName, Limit: 2}
+
+	page, err := storage.TableFiles.GetPage(ctx, querier, query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B.txt", "a.txt"}, names(page))
+
+	query.After = &model.FilesCursor{Filename: page[1].Filename, Suffix: page[1].FilenameSuffix}
+
+	page, err = storage.TableFiles.GetPage(ctx, querier, query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b/x.png", "b/y.txt"}, names(page))
+
+	// past a prefix
+	query.After = &model.FilesCursor{SkipPrefix: "b/"}
+
+	page, err = storage.TableFiles.GetPage(ctx, querier, query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c_1.png"}, names(page))
+
+	// by size, descending, filtered
+	minSize := int64(20)
+	query = model.FilesQuery{
+		BucketID: bucket.ID, Sort: model.FilesSortSize, Descending: true, Limit: 10, MIME: "image/*", MinSize: &minSize,
+	}
+
+	page, err = storage.TableFiles.GetPage(ctx, querier, query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b/x.png"}, names(page))
+
+	// the filename substring, the pattern characters matched as is
+	query = model.FilesQuery{BucketID: bucket.ID, Sort: model.FilesSortCreated, Limit: 10, NameContains: "_1"}
+
+	page, err = storage.TableFiles.GetPage(ctx, querier, query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c_1.png"}, names(page))
+}
+
+func TestTableFilesSearchIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+	ownerID := uuid.New()
+
+	buckets := []*model.Bucket{
+		{Name: "TestBucketSearchA", Availability: model.BucketAvailabilityAccessible, OwnerID: ownerID},
+		{Name: "TestBucketSearchB", Availability: model.BucketAvailabilityAccessible, OwnerID: ownerID},
+		{Name: "TestBucketSearchC", Availability: model.BucketAvailabilityAccessible, OwnerID: uuid.New()},
+	}
+	for _, bucket := range buckets {
+		require.NoError(t, storage.TableBuckets.Add(ctx, querier, bucket))
+	}
+
+	require.NoError(t, storage.TableBuckets.SetVersioning(ctx, querier, buckets[1].ID, true))
+
+	for _, file := range []struct {
+		tags   map[string]string
+		name   string
+		bucket int
+		suffix int32
+	}{
+		{nil, "reports/quarterly_report.pdf", 0, 0},
+		{map[string]string{"team": "ml", "stage": "raw"}, "photos/cat.png", 0, 0},
+		{map[string]string{"team": "ml"}, "report.txt", 1, 0},
+		{map[string]string{"team": "web"}, "report.txt", 1, 1},
+		{nil, "old_report.csv", 2, 0},
+	} {
+		require.NoError(t, storage.TableFiles.InsertID(ctx, querier, &model.File{
+			ID:             uuid.New(),
+			Filename:       file.name,
+			MIME:           "application/octet-stream",
+			BucketID:       buckets[file.bucket].ID,
+			Access:         model.FileAccessPrivate,
+			FilenameSuffix: file.suffix,
+			Tags:           file.tags,
+			Metadata:       map[string]string{"source": "pipeline " + file.name},
+		}))
+	}
+
+	search := func(query string, tags ...string) []string {
+		filter := model.FilesSearch{Query: query, Limit: 10, OwnerID: ownerID, Tags: map[string]string{}}
+		for i := 0; i+1 < len(tags); i += 2 {
+			filter.Tags[tags[i]] = tags[i+1]
+		}
+
+		found, err := storage.TableFiles.Search(ctx, querier, filter)
+		require.NoError(t, err)
+
+		result := make([]string, 0, len(found))
+		for _, file := range found {
+			result = append(result, fmt.Sprintf("%s:%s:%d", file.BucketName, file.Filename, file.FilenameSuffix))
+		}
+
+		return result
+	}
+
+	// the words of the keys, the latest versions and the buckets of the owner only
+	assert.ElementsMatch(t, []string{
+		"TestBucketSearchA:reports/quarterly_report.pdf:0", "TestBucketSearchB:report.txt:1",
+	}, search("report"))
+
+	// the operators
+	assert.Equal(t, []string{"TestBucketSearchA:photos/cat.png:0"}, search("cat png"))
+	assert.Empty(t, search("cat -png"))
+	assert.Empty(t, search("./"))
+
+	// the metadata values and the tags
+	assert.ElementsMatch(t, []string{
+		"TestBucketSearchA:photos/cat.png:0", "TestBucketSearchA:reports/quarterly_report.pdf:0",
+		"TestBucketSearchB:report.txt:1",
+	}, search("pipeline"))
+	assert.Equal(t, []string{"TestBucketSearchA:photos/cat.png:0"}, search("pipeline", "team", "ml"))
+	assert.Empty(t, search("pipeline", "team", "ml", "stage", "done"))
+
+	// no words, the newest first
+	assert.Equal(t, []string{
+		"TestBucketSearchB:report.txt:1", "TestBucketSearchA:photos/cat.png:0",
+		"TestBucketSearchA:reports/quarterly_report.pdf:0",
+	}, search(""))
+	assert.Equal(t, []string{"TestBucketSearchA:photos/cat.png:0"}, search(" ", "team", "ml"))
+
+	found, err := storage.TableFiles.Search(ctx, querier, model.FilesSearch{Query: "cat", Limit: 1, OwnerID: ownerID})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, map[string]string{"team": "ml", "stage": "raw"}, found[0].Tags)
+
+	// the attributes are updated along with the file
+	file, err := storage.TableFiles.GetByID(ctx, querier, found[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"source": "pipeline photos/cat.png"}, file.Metadata)
+
+	file.Metadata = nil
+	file.Tags = map[string]string{"team": "web"}
+	require.NoError(t, storage.TableFiles.UpdateByID(ctx, querier, file))
+
+	file, err = storage.TableFiles.GetByID(ctx, querier, file.ID)
+	require.NoError(t, err)
+	assert.Empty(t, file.Metadata)
+	assert.Equal(t, map[string]string{"team": "web"}, file.Tags)
+}
+
+func TestTableAccessKeysIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+	ownerID := uuid.New()
+
+	// Add
+	key := &model.AccessKey{ID: "GS3TESTKEY", Secret: "secret", OwnerID: ownerID}
+	err := storage.TableAccessKeys.Add(ctx, querier, key)
+	require.NoError(t, err)
+	assert.False(t, key.CreatedTS.IsZero())
+
+	// Add - duplicate id
+	err = storage.TableAccessKeys.Add(ctx, querier, &model.AccessKey{ID: "GS3TESTKEY", Secret: "x", OwnerID: ownerID})
+	require.ErrorIs(t, err, database.ErrUniqueKeyViolation)
+
+	// GetByID
+	retrievedKey, err := storage.TableAccessKeys.GetByID(ctx, querier, key.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", retrievedKey.Secret)
+
+	// GetByOwner - no secrets
+	keys, err := storage.TableAccessKeys.GetByOwner(ctx, querier, ownerID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Empty(t, keys[0].Secret)
+
+	// DeleteByID
+	err = storage.TableAccessKeys.DeleteByID(ctx, querier, key.ID)
+	require.NoError(t, err)
+
+	_, err = storage.TableAccessKeys.GetByID(ctx, querier, key.ID)
+	require.ErrorIs(t, err, database.ErrNoRows)
+}
+
+func TestTableUploadsIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+
+	bucket := &model.Bucket{Name: "uploads-bucket", OwnerID: uuid.New(), Availability: model.BucketAvailabilityClosed}
+	require.NoError(t, storage.TableBuckets.Add(ctx, querier, bucket))
+
+	// Add
+	upload := &model.Upload{
+		ID:        uuid.New(),
+		BucketID:  bucket.ID,
+		Filename:  "big.bin",
+		Access:    model.FileAccessPrivate,
+		Length:    100,
+		ExpiresTS: time.Now().Add(time.Hour),
+	}
+	require.NoError(t, storage.TableUploads.Add(ctx, querier, upload))
+	assert.False(t, upload.CreatedTS.IsZero())
+
+	// UpdateOffset
+	require.NoError(t, storage.TableUploads.UpdateOffset(ctx, querier, upload.ID, 40, upload.ExpiresTS))
+
+	retrievedUpload, err := storage.TableUploads.GetByID(ctx, querier, upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), retrievedUpload.Offset)
+
+	// LockByID - locked by another transaction
+	transaction, err := querier.Begin(ctx)
+	require.NoError(t, err)
+
+	_, err = storage.TableUploads.LockByID(ctx, transaction, upload.ID)
+	require.NoError(t, err)
+
+	_, err = storage.TableUploads.LockByID(ctx, querier, upload.ID)
+	require.ErrorIs(t, err, storage.ErrRowLocked)
+	require.NoError(t, transaction.Rollback(ctx))
+
+	// GetExpired
+	expired, err := storage.TableUploads.GetExpired(ctx, querier, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	expired, err = storage.TableUploads.GetExpired(ctx, querier, time.Now().Add(2*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+
+	// GetIDsOfABucket
+	uploadIDs, err := storage.TableUploads.GetIDsOfABucket(ctx, querier, bucket.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{upload.ID}, uploadIDs)
+
+	// GetByID - the bucket is being deleted
+	require.NoError(t, storage.TableBuckets.MarkDeleting(ctx, querier, bucket.ID))
+
+	_, err = storage.TableUploads.GetByID(ctx, querier, upload.ID)
+	require.ErrorIs(t, err, database.ErrNoRows)
+
+	// DeleteByID
+	require.NoError(t, storage.TableUploads.DeleteByID(ctx, querier, upload.ID))
+	require.ErrorIs(t, storage.TableUploads.DeleteByID(ctx, querier, upload.ID), database.ErrNoRows)
+}
+
+func TestTableMultipartUploadsIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+
+	bucket := &model.Bucket{Name: "multipart-bucket", OwnerID: uuid.New(), Availability: model.BucketAvailabilityClosed}
+	require.NoError(t, storage.TableBuckets.Add(ctx, querier, bucket))
+
+	// Add
+	upload := &model.MultipartUpload{ID: uuid.New(), BucketID: bucket.ID, Key: "a/b.bin", Access: model.FileAccessPrivate}
+	require.NoError(t, storage.TableMultipartUploads.Add(ctx, querier, upload))
+
+	// Add parts, out of order
+	for _, partNumber := range []int{2, 1} {
+		part := &model.MultipartPart{UploadID: upload.ID, PartNumber: partNumber, BlobID: uuid.New(), SizeBytes: 10}
+		require.NoError(t, storage.TableMultipartParts.Add(ctx, querier, part))
+	}
+
+	err := storage.TableMultipartParts.Add(ctx, querier, &model.MultipartPart{UploadID: upload.ID, PartNumber: 1})
+	require.ErrorIs(t, err, database.ErrUniqueKeyViolation)
+
+	// GetByUpload - ordered by the part number
+	parts, err := storage.TableMultipartParts.GetByUpload(ctx, querier, upload.ID)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, 1, parts[0].PartNumber)
+
+	// DeleteByNumber
+	blobID, err := storage.TableMultipartParts.DeleteByNumber(ctx, querier, upload.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, parts[0].BlobID, blobID)
+
+	_, err = storage.TableMultipartParts.DeleteByNumber(ctx, querier, upload.ID, 1)
+	require.ErrorIs(t, err, database.ErrNoRows)
+
+	// GetBlobIDsOfABucket
+	blobIDs, err := storage.TableMultipartParts.GetBlobIDsOfABucket(ctx, querier, bucket.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{parts[1].BlobID}, blobIDs)
+
+	// GetStale
+	stale, err := storage.TableMultipartUploads.GetStale(ctx, querier, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+
+	// DeleteByID - the parts go along
+	require.NoError(t, storage.TableMultipartUploads.DeleteByID(ctx, querier, upload.ID))
+
+	parts, err = storage.TableMultipartParts.GetByUpload(ctx, querier, upload.ID)
+	require.NoError(t, err)
+	assert.Empty(t, parts)
+
+	// Add a part - the upload is gone
+	err = storage.TableMultipartParts.Add(ctx, querier, &model.MultipartPart{UploadID: upload.ID, PartNumber: 1})
+	require.ErrorIs(t, err, database.ErrNoRows)
+}
+
+func TestTableBlobsIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+
+	bucket := &model.Bucket{Name: "blobs-bucket", OwnerID: uuid.New(), Availability: model.BucketAvailabilityClosed}
+	require.NoError(t, storage.TableBuckets.Add(ctx, querier, bucket))
+
+	const sha = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// Acquire
+	refCount, err := storage.TableBlobs.Acquire(ctx, querier, sha, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), refCount)
+
+	file := &model.File{
+		ID:         uuid.New(),
+		Filename:   "deduplicated",
+		BucketID:   bucket.ID,
+		Access:     model.FileAccessPrivate,
+		SizeBytes:  10,
+		SHA256:     sha,
+		BlobSHA256: sha,
+	}
+	require.NoError(t, storage.TableFiles.InsertID(ctx, querier, file))
+
+	refCount, err = storage.TableBlobs.Acquire(ctx, querier, sha, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), refCount)
+
+	// GetAll
+	blobs, err := storage.TableBlobs.GetAll(ctx, querier)
+	require.NoError(t, err)
+	require.Len(t, blobs, 1)
+	assert.Equal(t, int64(10), blobs[0].SizeBytes)
+
+	// GetCreatedBefore
+	blobs, err = storage.TableBlobs.GetCreatedBefore(ctx, querier, time.Now().Add(time.Hour), "", 10)
+	require.NoError(t, err)
+	require.Len(t, blobs, 1)
+
+	blobs, err = storage.TableBlobs.GetCreatedBefore(ctx, querier, time.Now().Add(time.Hour), sha, 10)
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+
+	blobs, err = storage.TableBlobs.GetCreatedBefore(ctx, querier, time.Now().Add(-time.Hour), "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+
+	// GetMiscounted - two references recorded, one file
+	miscounted, err := storage.TableBlobs.GetMiscounted(ctx, querier)
+	require.NoError(t, err)
+	require.Len(t, miscounted, 1)
+	assert.Equal(t, int64(1), miscounted[0].RefCount)
+
+	// Recount
+	refCount, err = storage.TableBlobs.Recount(ctx, querier, sha)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), refCount)
+
+	// DeleteByIDReturning
+	deleted, err := storage.TableFiles.DeleteByIDReturning(ctx, querier, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, sha, deleted.BlobSHA256)
+	assert.Equal(t, int64(10), deleted.SizeBytes)
+
+	// Release - the last reference
+	refCount, err = storage.TableBlobs.Release(ctx, querier, sha)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), refCount)
+
+	_, err = storage.TableBlobs.Release(ctx, querier, sha)
+	require.ErrorIs(t, err, database.ErrNoRows)
+}
+
+func TestTableBlobCorruptionsIntegration(t *testing.T) {
+	checkDB(t)
+	clearTables(t)
+
+	ctx := context.Background()
+	querier := testDB.GetPool()
+	bucketID := int64(1)
+
+	// Record
+	corruption := &model.BlobCorruption{
+		BucketID:       &bucketID,
+		Folder:         "1",
+		BlobID:         uuid.NewString(),
+		ExpectedSHA256: "expected",
+		ActualSHA256:   "actual",
+	}
+	require.NoError(t, storage.TableBlobCorruptions.Record(ctx, querier, corruption))
+	assert.False(t, corruption.DetectedTS.IsZero())
+
+	deduplicated := &model.BlobCorruption{Folder: "dedup", BlobID: "expected", ExpectedSHA256: "expected"}
+	require.NoError(t, storage.TableBlobCorruptions.Record(ctx, querier, deduplicated))
+
+	// Record - seen again keeps the detection time
+	corruption.Detail = "again"
+	require.NoError(t, storage.TableBlobCorruptions.Record(ctx, querier, corruption))
+
+	// GetAll
+	corruptions, err := storage.TableBlobCorruptions.GetAll(ctx, querier)
+	require.NoError(t, err)
+	require.Len(t, corruptions, 2)
+	assert.Equal(t, "again", corruptions[0].Detail)
+	require.NotNil(t, corruptions[0].BucketID)
+	assert.Equal(t, bucketID, *corruptions[0].BucketID)
+	assert.Nil(t, corruptions[1].BucketID)
+
+	// Clear
+	require.NoError(t, storage.TableBlobCorruptions.Clear(ctx, querier, "dedup", "expected"))
+	require.NoError(t, storage.TableBlobCorruptions.Clear(ctx, querier, "dedup", "expected"))
+
+	// DeleteCheckedBefore
+	deleted, err := storage.TableBlobCorruptions.DeleteCheckedBefore(ctx, querier, corruption.CheckedTS)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	deleted, err = storage.TableBlobCorruptions.DeleteCheckedBefore(ctx, querier, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"expvar"
 	"net/http"
 	"net/http/pprof"
 )
@@ -13,6 +14,7 @@ func NewPprofServemux() *http.ServeMux {
 	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
 	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
 
 	return mux
 }
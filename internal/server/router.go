@@ -19,11 +19,40 @@ type APIHandlingModule interface {
 	MiddlewareIPRateLimit(next httprouter.Handle) httprouter.Handle
 
 	CreateBucket(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	DeleteBucket(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	ListBuckets(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	SetBucketQuota(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 	ListFiles(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	MovePrefix(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	SearchFiles(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	CopyFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	MoveFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 	EditFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 	DeleteFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 	UploadFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	SetBucketVersioning(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	ListVersions(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	RestoreVersion(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	SetBucketCompression(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	SetTrashRetention(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	ListBlobCorruptions(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	ListTrash(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	RestoreFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	PurgeFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+
+	MiddlewareTusResumable(next httprouter.Handle) httprouter.Handle
+	TusOptions(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	TusCreateUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	TusHeadUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	TusPatchUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	TusTerminateUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 	GetFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	PresignURL(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	PresignedUploadFile(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+
+	CreateAccessKey(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	ListAccessKeys(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	DeleteAccessKey(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 }
 
 func constructAdminOrRootMiddleware(apiHandler APIHandlingModule, final httprouter.Handle,
@@ -38,6 +67,33 @@ func constructAdminOrRootMiddleware(apiHandler APIHandlingModule, final httprout
 	))
 }
 
+func constructRootMiddleware(apiHandler APIHandlingModule, final httprouter.Handle,
+	authMiddle func(requestedRoles []string, theServiceName string, next httprouter.Handle) httprouter.Handle,
+) httprouter.Handle {
+	return apiHandler.MiddlewareIPRateLimit(authMiddle(
+		[]string{
+			model.UserRoleTypeRoot,
+		},
+		myOwnServiceName,
+		apiHandler.MiddlewareRateLimit(final),
+	))
+}
+
+// routeSegment only passes the requests with the param equal to the value.
+// httprouter can't have a static segment next to a wildcard one, so the routes
+// sharing a method with /buckets/:bucketName/:fileID match "uploads" by hand.
+func routeSegment(apiHandler APIHandlingModule, param, value string, next httprouter.Handle) httprouter.Handle {
+	return func(respWriter http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		if params.ByName(param) != value {
+			apiHandler.NotFound(respWriter, request)
+
+			return
+		}
+
+		next(respWriter, request, params)
+	}
+}
+
 func NewRouter(apiHandler APIHandlingModule) http.Handler {
 	handler := httprouter.New()
 
@@ -54,12 +110,58 @@ func NewRouter(apiHandler APIHandlingModule) http.Handler {
 	handler.POST("/fgw/manage/buckets", constructAdminOrRootMiddleware(
 		apiHandler, apiHandler.CreateBucket, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
 
+	// list the buckets of the user.
+	handler.GET("/api/manage/buckets", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.ListBuckets, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.GET("/fgw/manage/buckets", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.ListBuckets, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// delete a bucket.
+	handler.DELETE("/api/manage/buckets/:bucketName", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.DeleteBucket, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.DELETE("/fgw/manage/buckets/:bucketName", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.DeleteBucket, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// set the size quota of a bucket.
+	handler.PUT("/api/manage/admin/buckets/:bucketName/quota", constructRootMiddleware(
+		apiHandler, apiHandler.SetBucketQuota, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.PUT("/fgw/manage/admin/buckets/:bucketName/quota", constructRootMiddleware(
+		apiHandler, apiHandler.SetBucketQuota, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// list the corrupt blobs found by the scrubber.
+	handler.GET("/api/manage/admin/corruptions", constructRootMiddleware(
+		apiHandler, apiHandler.ListBlobCorruptions, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.GET("/fgw/manage/admin/corruptions", constructRootMiddleware(
+		apiHandler, apiHandler.ListBlobCorruptions, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
 	// list files in a bucket.
 	handler.GET("/api/manage/buckets/:bucketName/files", constructAdminOrRootMiddleware(
 		apiHandler, apiHandler.ListFiles, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
 	handler.GET("/fgw/manage/buckets/:bucketName/files", constructAdminOrRootMiddleware(
 		apiHandler, apiHandler.ListFiles, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
 
+	// move or rename a virtual folder.
+	handler.POST("/api/manage/buckets/:bucketName/prefixes/move", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.MovePrefix, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.POST("/fgw/manage/buckets/:bucketName/prefixes/move", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.MovePrefix, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// copy or move a file to a bucket of the user.
+	handler.POST("/api/manage/buckets/:bucketName/files/:fileID/copy", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.CopyFile, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.POST("/fgw/manage/buckets/:bucketName/files/:fileID/copy", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.CopyFile, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+	handler.POST("/api/manage/buckets/:bucketName/files/:fileID/move", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.MoveFile, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.POST("/fgw/manage/buckets/:bucketName/files/:fileID/move", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.MoveFile, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// search the files of all the buckets of the user.
+	handler.GET("/api/manage/search", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.SearchFiles, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.GET("/fgw/manage/search", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.SearchFiles, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
 	// edit a file.
 	handler.PATCH("/api/manage/buckets/:bucketName/:fileID", constructAdminOrRootMiddleware(
 		apiHandler, apiHandler.EditFile, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
@@ -78,8 +180,100 @@ func NewRouter(apiHandler APIHandlingModule) http.Handler {
 	handler.POST("/fgw/manage/buckets/:bucketName", constructAdminOrRootMiddleware(
 		apiHandler, apiHandler.UploadFile, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
 
+	// switch the versioning of a bucket.
+	handler.PUT("/api/manage/buckets/:bucketName/versioning", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.SetBucketVersioning, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.PUT("/fgw/manage/buckets/:bucketName/versioning", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.SetBucketVersioning, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// set the codec the compressible files of a bucket are stored with.
+	handler.PUT("/api/manage/buckets/:bucketName/compression", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.SetBucketCompression, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.PUT("/fgw/manage/buckets/:bucketName/compression", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.SetBucketCompression, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// list the versions of the files in a bucket.
+	handler.GET("/api/manage/buckets/:bucketName/versions", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.ListVersions, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.GET("/fgw/manage/buckets/:bucketName/versions", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.ListVersions, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// make a version the latest one.
+	handler.POST("/api/manage/buckets/:bucketName/versions/:versionID/restore", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.RestoreVersion, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.POST("/fgw/manage/buckets/:bucketName/versions/:versionID/restore", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.RestoreVersion, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// the trash of a bucket: the retention, the deleted files, their restore and purge.
+	handler.PUT("/api/manage/buckets/:bucketName/trash", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.SetTrashRetention, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.PUT("/fgw/manage/buckets/:bucketName/trash", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.SetTrashRetention, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+	handler.GET("/api/manage/buckets/:bucketName/trash", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.ListTrash, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.GET("/fgw/manage/buckets/:bucketName/trash", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.ListTrash, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+	handler.POST("/api/manage/buckets/:bucketName/trash/:fileID/restore", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.RestoreFile, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.POST("/fgw/manage/buckets/:bucketName/trash/:fileID/restore", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.RestoreFile, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+	// a POST as the DELETE routes have a wildcard in place of "trash".
+	handler.POST("/api/manage/buckets/:bucketName/trash/:fileID/purge", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.PurgeFile, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.POST("/fgw/manage/buckets/:bucketName/trash/:fileID/purge", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.PurgeFile, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// resumable uploads, tus 1.0.
+	handler.OPTIONS("/api/manage/buckets/:bucketName/uploads", apiHandler.MiddlewareTusResumable(
+		apiHandler.MiddlewareIPRateLimit(apiHandler.TusOptions)))
+	handler.OPTIONS("/fgw/manage/buckets/:bucketName/uploads", apiHandler.MiddlewareTusResumable(
+		apiHandler.MiddlewareIPRateLimit(apiHandler.TusOptions)))
+	handler.POST("/api/manage/buckets/:bucketName/uploads", apiHandler.MiddlewareTusResumable(
+		constructAdminOrRootMiddleware(apiHandler, apiHandler.TusCreateUpload, apiHandler.MiddlewareAPIAuthorizeAnyClaim)))
+	handler.POST("/fgw/manage/buckets/:bucketName/uploads", apiHandler.MiddlewareTusResumable(
+		constructAdminOrRootMiddleware(apiHandler, apiHandler.TusCreateUpload, apiHandler.MiddlewareFGWAuthorizeAnyClaim)))
+	handler.HEAD("/api/manage/buckets/:bucketName/uploads/:uploadID", apiHandler.MiddlewareTusResumable(
+		constructAdminOrRootMiddleware(apiHandler, apiHandler.TusHeadUpload, apiHandler.MiddlewareAPIAuthorizeAnyClaim)))
+	handler.HEAD("/fgw/manage/buckets/:bucketName/uploads/:uploadID", apiHandler.MiddlewareTusResumable(
+		constructAdminOrRootMiddleware(apiHandler, apiHandler.TusHeadUpload, apiHandler.MiddlewareFGWAuthorizeAnyClaim)))
+	handler.PATCH("/api/manage/buckets/:bucketName/:fileID/:uploadID", routeSegment(apiHandler, "fileID", "uploads",
+		apiHandler.MiddlewareTusResumable(constructAdminOrRootMiddleware(
+			apiHandler, apiHandler.TusPatchUpload, apiHandler.MiddlewareAPIAuthorizeAnyClaim))))
+	handler.PATCH("/fgw/manage/buckets/:bucketName/:fileID/:uploadID", routeSegment(apiHandler, "fileID", "uploads",
+		apiHandler.MiddlewareTusResumable(constructAdminOrRootMiddleware(
+			apiHandler, apiHandler.TusPatchUpload, apiHandler.MiddlewareFGWAuthorizeAnyClaim))))
+	handler.DELETE("/api/manage/buckets/:bucketName/:fileID/:uploadID", routeSegment(apiHandler, "fileID", "uploads",
+		apiHandler.MiddlewareTusResumable(constructAdminOrRootMiddleware(
+			apiHandler, apiHandler.TusTerminateUpload, apiHandler.MiddlewareAPIAuthorizeAnyClaim))))
+	handler.DELETE("/fgw/manage/buckets/:bucketName/:fileID/:uploadID", routeSegment(apiHandler, "fileID", "uploads",
+		apiHandler.MiddlewareTusResumable(constructAdminOrRootMiddleware(
+			apiHandler, apiHandler.TusTerminateUpload, apiHandler.MiddlewareFGWAuthorizeAnyClaim))))
+
+	// manage the S3 API access keys.
+	handler.POST("/api/manage/access-keys", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.CreateAccessKey, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.POST("/fgw/manage/access-keys", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.CreateAccessKey, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+	handler.GET("/api/manage/access-keys", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.ListAccessKeys, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.GET("/fgw/manage/access-keys", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.ListAccessKeys, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+	handler.DELETE("/api/manage/access-keys/:accessKeyID", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.DeleteAccessKey, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.DELETE("/fgw/manage/access-keys/:accessKeyID", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.DeleteAccessKey, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
+	// mint a presigned url.
+	handler.POST("/api/manage/buckets/:bucketName/presign", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.PresignURL, apiHandler.MiddlewareAPIAuthorizeAnyClaim))
+	handler.POST("/fgw/manage/buckets/:bucketName/presign", constructAdminOrRootMiddleware(
+		apiHandler, apiHandler.PresignURL, apiHandler.MiddlewareFGWAuthorizeAnyClaim))
+
 	// download a file.
 	handler.GET("/buckets/:bucketName/:fileID", apiHandler.MiddlewareIPRateLimit(apiHandler.GetFile))
 
+	// upload a file by a presigned url.
+	handler.PUT("/buckets/:bucketName", apiHandler.MiddlewareIPRateLimit(apiHandler.PresignedUploadFile))
+
 	return handler
 }
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type S3HandlingModule interface {
+	S3NotFound(w http.ResponseWriter, r *http.Request)
+	S3MethodNotAllowed(w http.ResponseWriter, r *http.Request)
+	MiddlewareS3Authenticate(next httprouter.Handle) httprouter.Handle
+
+	S3ListBuckets(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	S3CreateBucket(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	S3HeadBucket(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	S3DeleteBucket(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	S3ListObjects(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	S3PutObject(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	S3GetObject(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	S3DeleteObject(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	S3PostObject(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+}
+
+// NewS3Router serves the path-style S3 compatible API.
+func NewS3Router(s3Handler S3HandlingModule) http.Handler {
+	handler := httprouter.New()
+
+	handler.HandleOPTIONS = false
+	handler.RedirectTrailingSlash = false
+	handler.HandleMethodNotAllowed = true
+	handler.RedirectFixedPath = false
+
+	handler.NotFound = http.HandlerFunc(s3Handler.S3NotFound)
+	handler.MethodNotAllowed = http.HandlerFunc(s3Handler.S3MethodNotAllowed)
+
+	auth := s3Handler.MiddlewareS3Authenticate
+
+	// service.
+	handler.GET("/", auth(s3Handler.S3ListBuckets))
+
+	// buckets.
+	handler.PUT("/:bucket", auth(s3Handler.S3CreateBucket))
+	handler.HEAD("/:bucket", auth(s3Handler.S3HeadBucket))
+	handler.GET("/:bucket", auth(s3Handler.S3ListObjects))
+	handler.DELETE("/:bucket", auth(s3Handler.S3DeleteBucket))
+
+	// objects.
+	handler.PUT("/:bucket/*key", auth(s3Handler.S3PutObject))
+	handler.GET("/:bucket/*key", auth(s3Handler.S3GetObject))
+	handler.HEAD("/:bucket/*key", auth(s3Handler.S3GetObject))
+	handler.DELETE("/:bucket/*key", auth(s3Handler.S3DeleteObject))
+
+	// multipart uploads, the rest of the calls are told apart by the query in the object handlers.
+	handler.POST("/:bucket/*key", auth(s3Handler.S3PostObject))
+
+	return handler
+}